@@ -0,0 +1,102 @@
+package main
+
+import (
+	sensorAPI "SensorContinuum/internal/api-backend/sensor"
+	"SensorContinuum/pkg/logger"
+	"SensorContinuum/pkg/types"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// commandRequest è il corpo della richiesta di creazione di un comando
+type commandRequest struct {
+	Type             types.CommandType `json:"type"`
+	SamplingInterval int64             `json:"sampling_interval,omitempty"`
+}
+
+func handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	region := request.PathParameters["region"]
+	macrozone := request.PathParameters["macrozone"]
+	zone := request.PathParameters["zone"]
+	sensor := request.PathParameters["sensor"]
+
+	body := []byte(request.Body)
+	if request.IsBase64Encoded {
+		var err error
+		body, err = base64.StdEncoding.DecodeString(request.Body)
+		if err != nil {
+			return badRequest("Corpo della richiesta non valido", err)
+		}
+	}
+
+	var req commandRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return badRequest("Corpo della richiesta non valido", err)
+	}
+
+	command := types.SensorCommand{
+		EdgeMacrozone:    macrozone,
+		EdgeZone:         zone,
+		SensorID:         sensor,
+		Type:             req.Type,
+		SamplingInterval: req.SamplingInterval,
+	}
+	if err := command.Validate(); err != nil {
+		return badRequest("Comando non valido", err)
+	}
+
+	ctx := context.Background()
+	created, err := sensorAPI.CreateSensorCommand(ctx, region, command)
+	if err != nil {
+		errBody, _ := json.Marshal(types.ErrorResponse{
+			Error:  "Errore nella creazione del comando",
+			Detail: err.Error(),
+		})
+		return events.APIGatewayProxyResponse{
+			StatusCode: http.StatusInternalServerError,
+			Body:       string(errBody),
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		}, nil
+	}
+	if created == nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode: http.StatusNotFound,
+			Body:       `{"error":"Sensore non trovato"}`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		}, nil
+	}
+
+	respBody, err := json.Marshal(created)
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+	}
+
+	return events.APIGatewayProxyResponse{
+		Body:       string(respBody),
+		StatusCode: http.StatusCreated,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+	}, nil
+}
+
+// badRequest restituisce una risposta 400 con il messaggio e il dettaglio dell'errore
+func badRequest(message string, err error) (events.APIGatewayProxyResponse, error) {
+	errBody, _ := json.Marshal(types.ErrorResponse{
+		Error:  message,
+		Detail: err.Error(),
+	})
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusBadRequest,
+		Body:       string(errBody),
+		Headers:    map[string]string{"Content-Type": "application/json"},
+	}, nil
+}
+
+func main() {
+	logger.CreateLogger(logger.GetCloudContext())
+	lambda.Start(handler)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	sensorAPI "SensorContinuum/internal/api-backend/sensor"
+	"SensorContinuum/pkg/logger"
+	"SensorContinuum/pkg/types"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	region := request.PathParameters["region"]
+	macrozone := request.PathParameters["macrozone"]
+	zone := request.PathParameters["zone"]
+	sensor := request.PathParameters["sensor"]
+
+	var limit int
+	limitStr := request.QueryStringParameters["limit"]
+	if limitStr == "" {
+		limit = 50
+	} else {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 0 {
+			return events.APIGatewayProxyResponse{
+				StatusCode: http.StatusBadRequest,
+				Body:       `{"error":"Parametro 'limit' non valido"}`,
+				Headers:    map[string]string{"Content-Type": "application/json"},
+			}, nil
+		}
+	}
+
+	ctx := context.Background()
+	commands, err := sensorAPI.GetSensorCommands(ctx, region, macrozone, zone, sensor, limit)
+	if err != nil {
+		errBody, _ := json.Marshal(types.ErrorResponse{
+			Error:  "Errore nel recupero dei comandi del sensore",
+			Detail: err.Error(),
+		})
+		return events.APIGatewayProxyResponse{
+			StatusCode: http.StatusInternalServerError,
+			Body:       string(errBody),
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		}, nil
+	}
+
+	body, err := json.Marshal(commands)
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+	}
+
+	return events.APIGatewayProxyResponse{
+		Body:       string(body),
+		StatusCode: 200,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+	}, nil
+}
+
+func main() {
+	logger.CreateLogger(logger.GetCloudContext())
+	lambda.Start(handler)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	sensorAPI "SensorContinuum/internal/api-backend/sensor"
+	"SensorContinuum/pkg/logger"
+	"SensorContinuum/pkg/types"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	region := request.PathParameters["region"]
+	id := request.PathParameters["id"]
+
+	ctx := context.Background()
+	command, err := sensorAPI.GetSensorCommand(ctx, region, id)
+	if err != nil {
+		errBody, _ := json.Marshal(types.ErrorResponse{
+			Error:  "Errore nel recupero del comando",
+			Detail: err.Error(),
+		})
+		return events.APIGatewayProxyResponse{
+			StatusCode: http.StatusInternalServerError,
+			Body:       string(errBody),
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		}, nil
+	}
+	if command == nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode: http.StatusNotFound,
+			Body:       `{"error":"Comando non trovato"}`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		}, nil
+	}
+
+	body, err := json.Marshal(command)
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+	}
+
+	return events.APIGatewayProxyResponse{
+		Body:       string(body),
+		StatusCode: 200,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+	}, nil
+}
+
+func main() {
+	logger.CreateLogger(logger.GetCloudContext())
+	lambda.Start(handler)
+}
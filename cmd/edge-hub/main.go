@@ -3,11 +3,16 @@ package main
 import (
 	edge_hub "SensorContinuum/internal/edge-hub"
 	"SensorContinuum/internal/edge-hub/comunication"
+	"SensorContinuum/internal/edge-hub/dispatcher"
 	"SensorContinuum/internal/edge-hub/environment"
 	"SensorContinuum/internal/edge-hub/health"
+	"SensorContinuum/internal/edge-hub/notification"
+	"SensorContinuum/internal/edge-hub/processing/filtering"
+	"SensorContinuum/internal/edge-hub/storage"
 	"SensorContinuum/pkg/logger"
 	"SensorContinuum/pkg/types"
 	"SensorContinuum/pkg/utils"
+	"context"
 	"math/rand"
 	"os"
 	"time"
@@ -25,11 +30,11 @@ RESPONSABILITÀ CHIAVE:
 
 3.  Aggregazione: Calcola la media dei valori validati presenti nella cache nell'ultimo minuto. Applica un offset di 2 minuti per mitigare la latenza e i ritardi di pacchetto.
 
-4.  Comunicazione Outgoing: Inoltra i dati aggregati al Proximity Hub di riferimento tramite MQTT.
+4.  Comunicazione Outgoing: Inoltra i dati aggregati al Proximity Hub di riferimento tramite MQTT. I riepiloghi vengono salvati in un outbox Redis e rimossi solo dopo la conferma del broker, quindi non vengono persi se l'invio fallisce o l'hub si riavvia.
 
 5.  Gestione della Concorrenza: Utilizza un lock distribuito in Redis per la leader election e per garantire l'esecuzione atomica delle operazioni di aggregazione.
 
-6.  Manutenzione e Notifica: Il Servizio di Pulizia monitora la cache, identificando ed etichettando come unhealthy i sensori in caso di interruzione prolungata del flusso dati (timeout di 5 minuti).
+6.  Manutenzione e Notifica: Il Servizio di Pulizia monitora la cache, identificando ed etichettando come unhealthy i sensori in caso di interruzione prolungata del flusso dati e degli heartbeat (timeout di 5 minuti).
 */
 func main() {
 
@@ -47,10 +52,24 @@ func main() {
 
 	// Creazione del canale per i messaggi di configurazione
 	sensorConfigurationMessageChannel := make(chan types.ConfigurationMsg, 200)
-	// creazione del canale per i dati ricevuti dai sensori
-	sensorDataChannel := make(chan types.SensorData, 200)
+	// creazione della coda per i dati ricevuti dai sensori, con la policy configurata per quando il filtro non tiene il passo
+	sensorDataQueue, err := utils.NewBoundedQueue[types.SensorData]("sensor-data", environment.SensorDataQueue)
+	if err != nil {
+		logger.Log.Error("Failed to create sensor data queue: ", err)
+		os.Exit(1)
+	}
+	// creazione dei canali per i comandi destinati ai sensori e per le relative conferme
+	sensorCommandChannel := make(chan types.SensorCommand, 200)
+	commandAckChannel := make(chan types.CommandAck, 200)
+	// creazione del canale per gli heartbeat dei sensori
+	sensorHeartbeatChannel := make(chan types.HeartbeatMsg, 200)
+	// le firme delle letture vengono verificate alla ricezione con le chiavi pubbliche dei sensori salvate in cache,
+	// quindi la connessione a Redis deve essere attiva prima della sottoscrizione ai dati
+	if environment.SensorSignatureMode != environment.DisabledSignatureMode && (environment.ServiceMode == types.EdgeHubFilterService || environment.ServiceMode == types.EdgeHubService) {
+		storage.InitRedisConnection()
+	}
 	// inizializza connessione MQTT in maniera sincrona
-	comunication.SetupMQTTConnection(sensorDataChannel, sensorConfigurationMessageChannel)
+	comunication.SetupMQTTConnection(sensorDataQueue, sensorConfigurationMessageChannel, sensorCommandChannel, commandAckChannel, sensorHeartbeatChannel)
 
 	// Si registra al proximity Hub in base al proprio Service Mode
 	// Questo invio è sincrono, se fallisce l'applicazione termina
@@ -61,6 +80,9 @@ func main() {
 	// Avvia il thread per l'invio dei messaggi di heartbeat
 	go comunication.SendHeartbeatMessage()
 
+	// Inizializza i canali di notifica per i manutentori
+	notification.SetupNotifiers()
+
 	/* ----- CONFIGURATION SERVICE ------ */
 
 	if environment.ServiceMode == types.EdgeHubConfigurationService || environment.ServiceMode == types.EdgeHubService {
@@ -70,14 +92,39 @@ func main() {
 		go edge_hub.ProcessSensorConfigurationMessages(sensorConfigurationMessageChannel, hubConfigurationMessageChannel)
 		go comunication.PublishConfigurationMessage(hubConfigurationMessageChannel)
 
+		// Avvia la consegna dei comandi ai sensori e l'inoltro delle relative conferme.
+		go edge_hub.ProcessSensorCommands(sensorCommandChannel)
+		go edge_hub.ProcessCommandAcks(commandAckChannel)
+
+		// Avvia la registrazione degli heartbeat dei sensori, utilizzati dal servizio di pulizia.
+		go edge_hub.ProcessSensorHeartbeats(sensorHeartbeatChannel)
+
 	}
 
 	/* ----- FILTER SERVICE ------ */
 
 	if environment.ServiceMode == types.EdgeHubFilterService || environment.ServiceMode == types.EdgeHubService {
 
+		// Carica i profili di filtraggio per tipo di sensore
+		if err := filtering.LoadProfiles(environment.FilteringProfilesFile); err != nil {
+			logger.Log.Error("Failed to load filtering profiles: ", err)
+			os.Exit(1)
+		}
+
+		// Creazione del canale per i dati scartati dal filtro
+		rejectedDataChannel := make(chan types.RejectedSensorData, 200)
+		// Aspettiamo che arrivino i dati sul canale rejectedDataChannel e li invia via MQTT
+		go comunication.PublishRejectedData(rejectedDataChannel)
+		// Inoltra le letture scartate rimaste in Redis quando il canale era pieno
+		go edge_hub.ReplayRejectedSensorData(rejectedDataChannel)
+
+		// Le letture critiche vengono salvate in Redis dal filtro e inviate via MQTT nella fast lane, senza attendere l'aggregazione:
+		// il canale segnala al dispatcher le nuove letture critiche, senza che il filtro attenda il broker
+		criticalEventSignal := make(chan struct{}, 1)
+		go edge_hub.DispatchCriticalEvents(criticalEventSignal)
+
 		// Avvia il filtro in un'altra goroutine.
-		go edge_hub.FilterSensorData(sensorDataChannel)
+		go edge_hub.FilterSensorData(sensorDataQueue.C(), rejectedDataChannel, criticalEventSignal)
 
 	}
 
@@ -85,10 +132,12 @@ func main() {
 
 	if (environment.ServiceMode == types.EdgeHubAggregatorService && environment.OperationMode == types.OperationModeLoop) || environment.ServiceMode == types.EdgeHubService {
 
-		// Creazione del canale per i dati filtrati
-		filteredDataChannel := make(chan types.SensorData, 200)
-		// Aspettiamo che arrivino i dati sul canale filteredDataChannel e li invia via MQTT
-		go comunication.PublishFilteredData(filteredDataChannel)
+		// Avvia il dispatcher, che invia al Proximity Hub i riepiloghi salvati nell'outbox
+		// e ritenta periodicamente quelli non confermati dal broker, anche dopo un riavvio
+		storage.InitRedisConnection()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go dispatcher.Run(ctx)
 
 		// Crea un ticker che scatta ogni AggregationInterval (1 minuto di default).
 		// Ogni volta che scatta, chiama AggregateAllSensorsData per aggregare i dati.
@@ -129,9 +178,11 @@ func main() {
 				// mettiti in attesa
 				select {
 				//il codice si blocca aspettando che il ticker invii il segnale (ogni minuto)
-				// quando arriva il segnale, viene chiamata AggregateAllSensorsData per l'aggregazione dei dati filtrati.
+				// quando arriva il segnale, viene chiamata AggregateAllSensorsData per l'aggregazione dei dati filtrati,
+				// poi i riepiloghi salvati nell'outbox vengono inviati senza attendere il dispatcher.
 				case <-aggregateTicker.C:
-					edge_hub.AggregateAllSensorsData(filteredDataChannel)
+					edge_hub.AggregateAllSensorsData()
+					dispatcher.ProcessPendingSummaries(ctx)
 				}
 			}
 		}()
@@ -140,13 +191,10 @@ func main() {
 
 	if environment.ServiceMode == types.EdgeHubAggregatorService && environment.OperationMode == types.OperationModeOnce {
 
-		// Creazione del canale per i dati filtrati
-		filteredDataChannel := make(chan types.SensorData, 200)
-		// Aspettiamo che arrivino i dati sul canale filteredDataChannel e li invia via MQTT
-		go comunication.PublishFilteredData(filteredDataChannel)
-
-		// Esegue una singola aggregazione e termina
-		edge_hub.AggregateAllSensorsData(filteredDataChannel)
+		// Esegue una singola aggregazione, invia i riepiloghi salvati nell'outbox e termina.
+		// I riepiloghi non confermati dal broker restano nell'outbox per l'esecuzione successiva.
+		edge_hub.AggregateAllSensorsData()
+		dispatcher.ProcessPendingSummaries(context.Background())
 		logger.Log.Info("Aggregation completed. The service will now terminate.")
 		os.Exit(0)
 	}
@@ -165,9 +213,10 @@ func main() {
 			for {
 				select {
 				case <-cleanHealthTicker.C:
-					unhealthySensors, removedSensors := edge_hub.CleanUnhealthySensors()
+					unhealthySensors, removedSensors, activeSensors := edge_hub.CleanUnhealthySensors()
 					edge_hub.NotifyUnhealthySensors(unhealthySensors)
 					edge_hub.NotifyRemovedSensors(removedSensors)
+					edge_hub.NotifyRecoveredSensors(activeSensors)
 				}
 			}
 		}()
@@ -175,9 +224,10 @@ func main() {
 	}
 
 	if environment.ServiceMode == types.EdgeHubCleanerService && environment.OperationMode == types.OperationModeOnce {
-		unhealthySensors, removedSensors := edge_hub.CleanUnhealthySensors()
+		unhealthySensors, removedSensors, activeSensors := edge_hub.CleanUnhealthySensors()
 		edge_hub.NotifyUnhealthySensors(unhealthySensors)
 		edge_hub.NotifyRemovedSensors(removedSensors)
+		edge_hub.NotifyRecoveredSensors(activeSensors)
 		logger.Log.Info("Cleaning completed. The service will now terminate.")
 		os.Exit(0)
 	}
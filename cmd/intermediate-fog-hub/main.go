@@ -71,20 +71,53 @@ func main() {
 	if environment.ServiceMode == types.IntermediateHubRealtimeService || environment.ServiceMode == types.IntermediateHubService {
 
 		// Avvia il processo di gestione dei dati intermedi
-		realTimeDataChannel := make(chan types.SensorData, environment.SensorDataBatchSize*3)
+		realTimeDataQueue, err := utils.NewBoundedQueue[types.SensorData]("real-time-data", environment.RealTimeDataQueue)
+		if err != nil {
+			logger.Log.Error("Failed to create real-time data queue: ", err)
+			os.Exit(1)
+		}
 		realTimePauseSignal := utils.NewPauseSignal()
-		go intermediate_fog_hub.ProcessRealTimeData(realTimeDataChannel, realTimePauseSignal)
+		go intermediate_fog_hub.ProcessRealTimeData(realTimeDataQueue.C(), realTimePauseSignal)
 
 		go func() {
 			// Se la funzione ritorna (a causa di un errore), lo logghiamo.
 			// Questo farà terminare l'applicazione.
-			err := comunication.PullRealTimeData(realTimeDataChannel, realTimePauseSignal)
+			err := comunication.PullRealTimeData(realTimeDataQueue, realTimePauseSignal)
 			if err != nil {
 				logger.Log.Error("Kafka consumer for the real time data has stopped: ", err.Error())
 				os.Exit(1)
 			}
 		}()
 
+		// Avvia il processo di gestione dei dati scartati dal filtro degli Edge Hub
+		rejectedDataChannel := make(chan types.RejectedSensorData, environment.SensorDataBatchSize*3)
+		rejectedPauseSignal := utils.NewPauseSignal()
+		go intermediate_fog_hub.ProcessRejectedData(rejectedDataChannel, rejectedPauseSignal)
+
+		go func() {
+			// Se la funzione ritorna (a causa di un errore), lo logghiamo.
+			// Questo farà terminare l'applicazione.
+			err := comunication.PullRejectedData(rejectedDataChannel, rejectedPauseSignal)
+			if err != nil {
+				logger.Log.Error("Kafka consumer for the rejected data has stopped: ", err.Error())
+				os.Exit(1)
+			}
+		}()
+
+		// Avvia il processo di gestione delle letture critiche rilevate dagli Edge Hub (fast lane)
+		criticalEventChannel := make(chan types.CriticalEvent, 100)
+		go intermediate_fog_hub.ProcessCriticalEvents(criticalEventChannel)
+
+		go func() {
+			// Se la funzione ritorna (a causa di un errore), lo logghiamo.
+			// Questo farà terminare l'applicazione.
+			err := comunication.PullCriticalEvents(criticalEventChannel)
+			if err != nil {
+				logger.Log.Error("Kafka consumer for the critical events has stopped: ", err.Error())
+				os.Exit(1)
+			}
+		}()
+
 	}
 
 	/* -------- STATISTICS SERVICE -------- */
@@ -128,6 +161,39 @@ func main() {
 			}
 		}()
 
+		// Avvia il processo di gestione delle transizioni di stato dei sensori
+		sensorStateChannel := make(chan types.SensorStateEvent, environment.ConfigurationMessageBatchSize*3)
+		sensorStatePauseSignal := utils.NewPauseSignal()
+		go intermediate_fog_hub.ProcessSensorStateEvents(sensorStateChannel, sensorStatePauseSignal)
+
+		go func() {
+			// Se la funzione ritorna (a causa di un errore), lo logghiamo.
+			// Questo farà terminare l'applicazione.
+			err := comunication.PullSensorStateEvents(sensorStateChannel, sensorStatePauseSignal)
+			if err != nil {
+				logger.Log.Error("Kafka consumer for sensor state events has stopped: ", err.Error())
+				os.Exit(1)
+			}
+		}()
+
+		// Avvia il processo di inoltro dei comandi destinati ai sensori
+		go intermediate_fog_hub.DispatchSensorCommands()
+
+		// Avvia il processo di gestione delle conferme dei comandi
+		commandAckChannel := make(chan types.CommandAck, environment.ConfigurationMessageBatchSize*3)
+		commandAckPauseSignal := utils.NewPauseSignal()
+		go intermediate_fog_hub.ProcessCommandAcks(commandAckChannel, commandAckPauseSignal)
+
+		go func() {
+			// Se la funzione ritorna (a causa di un errore), lo logghiamo.
+			// Questo farà terminare l'applicazione.
+			err := comunication.PullCommandAcks(commandAckChannel, commandAckPauseSignal)
+			if err != nil {
+				logger.Log.Error("Kafka consumer for command acks has stopped: ", err.Error())
+				os.Exit(1)
+			}
+		}()
+
 	}
 
 	/* -------- HEARTBEAT SERVICE -------- */
@@ -51,12 +51,16 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Creazione dei canali per i messaggi di configurazione, heartbeat e dati filtrati
-	filteredDataChannel := make(chan types.SensorData, 100)
+	// Creazione dei canali per i messaggi di configurazione, stato dei sensori, conferme dei comandi, heartbeat, dati filtrati, dati scartati e letture critiche
+	filteredDataChannel := make(chan types.SensorMinuteSummary, 100)
+	rejectedDataChannel := make(chan types.RejectedSensorData, 100)
+	criticalEventChannel := make(chan types.CriticalEvent, 100)
 	configurationMessageChannel := make(chan types.ConfigurationMsg, 100)
+	sensorStateChannel := make(chan types.SensorStateEvent, 100)
+	commandAckChannel := make(chan types.CommandAck, 100)
 	heartbeatMessageChannel := make(chan types.HeartbeatMsg, 100)
 	// Inizializza connessione MQTT in maniera sincrona
-	comunication.SetupMQTTConnection(filteredDataChannel, configurationMessageChannel, heartbeatMessageChannel)
+	comunication.SetupMQTTConnection(filteredDataChannel, rejectedDataChannel, criticalEventChannel, configurationMessageChannel, sensorStateChannel, commandAckChannel, heartbeatMessageChannel)
 
 	// Si registra al proximity Hub in base al proprio Service Mode
 	// Questo invio è sincrono, se fallisce l'applicazione termina
@@ -73,6 +77,10 @@ func main() {
 		// Avvia l'elaborazione dei dati filtrati in un'altra goroutine.
 		// Riceve i dati dal canale filteredDataChannel e li salva nella cache locale.
 		go proximity_fog_hub.ProcessEdgeHubData(filteredDataChannel)
+		// Inoltra all'Intermediate Fog Hub i dati scartati dal filtro degli Edge Hub.
+		go proximity_fog_hub.ProcessEdgeHubRejectedData(rejectedDataChannel)
+		// Inoltra subito all'Intermediate Fog Hub le letture critiche rilevate dagli Edge Hub (fast lane).
+		go proximity_fog_hub.ProcessEdgeHubCriticalEvents(criticalEventChannel)
 	}
 
 	/* ----- CONFIGURATION SERVICE ------ */
@@ -81,6 +89,19 @@ func main() {
 		// Avvia l'elaborazione dei messaggi di configurazione in un'altra goroutine.
 		// Riceve i messaggi dal canale configurationMessageChannel e li elabora.
 		go proximity_fog_hub.ProcessEdgeHubConfiguration(configurationMessageChannel)
+		// Inoltra all'Intermediate Fog Hub le transizioni di stato dei sensori rilevate dagli Edge Hub.
+		go proximity_fog_hub.ProcessEdgeHubSensorState(sensorStateChannel)
+		// Inoltra agli Edge Hub i comandi destinati ai sensori della macrozona
+		// e all'Intermediate Fog Hub le relative conferme.
+		commandChannel := make(chan types.SensorCommand, 100)
+		go proximity_fog_hub.ProcessIntermediateFogHubCommands(commandChannel)
+		go func() {
+			if err := comunication.PullSensorCommands(commandChannel); err != nil {
+				logger.Log.Error("Kafka consumer for sensor commands has stopped: ", err.Error())
+				os.Exit(1)
+			}
+		}()
+		go proximity_fog_hub.ProcessEdgeHubCommandAcks(commandAckChannel)
 	}
 
 	/* ----- HEARTBEAT SERVICE ------ */
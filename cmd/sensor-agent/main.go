@@ -1,10 +1,10 @@
 package main
 
 import (
+	sensor_agent "SensorContinuum/internal/sensor-agent"
 	"SensorContinuum/internal/sensor-agent/comunication"
 	"SensorContinuum/internal/sensor-agent/environment"
 	"SensorContinuum/internal/sensor-agent/health"
-	"SensorContinuum/internal/sensor-agent/simulation"
 	"SensorContinuum/pkg/logger"
 	"SensorContinuum/pkg/types"
 	"SensorContinuum/pkg/utils"
@@ -17,9 +17,9 @@ Il Sensor Agent opera come il nodo computazionale di base nel Compute Continuum,
 
 RESPONSABILITÀ CHIAVE:
 
-1.  Generazione dei Dati: Produce periodicamente misurazioni multivariate (es. temperatura, umidità) basate su distribuzioni realistiche per replicare l'ambiente fisico.
+1.  Generazione dei Dati: Produce periodicamente misurazioni multivariate (es. temperatura, umidità) basate su distribuzioni realistiche per replicare l'ambiente fisico, oppure le legge da un sensore fisico (linea seriale, file sysfs/hwmon o output di un comando).
 
-2.  Simulazione delle Anomalie: Introduce intenzionalmente outlier e dati mancanti per testare la robustezza e le capacità di filtraggio dei nodi Edge.
+2.  Simulazione delle Anomalie: Introduce intenzionalmente outlier, dati mancanti e guasti (valori bloccati, deriva, raffiche di outlier, timestamp errati, duplicati) per testare la robustezza e le capacità di filtraggio dei nodi Edge.
 
 3.  Comunicazione Outgoing: Invia i dati grezzi all'Edge Hub designato utilizzando il protocollo MQTT.
 
@@ -27,7 +27,11 @@ RESPONSABILITÀ CHIAVE:
 
 5.  Comunicazione di Controllo: Invia messaggi di registrazione contenenti i metadati del sensore con QoS exactly-once.
 
-6.  Stato di Salute: Non trasmette heartbeat espliciti; la sua operatività è dedotta dalla continuità del flusso di misurazioni da parte dei nodi superiori.
+6.  Comandi: Riceve dall'Edge Hub i comandi inviati dal cloud (intervallo di campionamento, pausa, ripresa, riavvio) e ne conferma l'esecuzione. Riceve inoltre la configurazione desiderata della simulazione e riporta quella applicata, come un device twin.
+
+7.  Stato di Salute: Trasmette periodicamente un heartbeat con uptime, letture in attesa nel buffer offline, esito dell'ultimo invio e versione; l'Edge Hub ne deduce l'operatività insieme alla continuità del flusso di misurazioni.
+
+8.  Integrità: Se abilitato, firma ogni misurazione con una chiave Ed25519, la cui chiave pubblica viene inviata nel messaggio di registrazione.
 */
 func main() {
 
@@ -43,29 +47,77 @@ func main() {
 	logger.Log.Info("Starting Sensor Agent...")
 	logger.Log.Info("Sensor Location: ", environment.SensorLocation)
 	logger.Log.Info("Sensor Type: ", environment.SensorType)
+	for _, channel := range environment.SensorChannels {
+		logger.Log.Info("Sensor Channel: ", channel.Type, " (column: ", channel.ValueColumn, ", id: ", channel.SensorID, ")")
+	}
 	logger.Log.Info("Sensor Reference: ", environment.SimulationSensorReference)
 
+	// Carica la chiave di firma delle letture, la cui chiave pubblica viene inviata nella registrazione
+	if environment.Signing {
+		if err := comunication.SetupSigning(); err != nil {
+			logger.Log.Error("Failed to setup signing key: ", err)
+			os.Exit(1)
+		}
+	}
+
 	// Registra il sensore all'edge hub
 	comunication.SendRegistrationMessage()
 	logger.Log.Info("Sensor registration message sent.")
 
-	// Inizializza la comunicazione con il simulatore del sensore
+	// Abilita la ricezione dei comandi inviati dal cloud
+	commandChannel := make(chan types.SensorCommand, 10)
+	go sensor_agent.ProcessSensorCommands(commandChannel)
+	comunication.SubscribeCommands(commandChannel)
+
+	// Abilita la ricezione della configurazione desiderata (intervallo di campionamento, probabilità di dati mancanti e outlier)
+	desiredConfigurationChannel := make(chan types.SensorDesiredConfiguration, 10)
+	go sensor_agent.ProcessDesiredConfigurations(desiredConfigurationChannel)
+	comunication.SubscribeDesiredConfiguration(desiredConfigurationChannel)
+
+	// Invia periodicamente gli heartbeat all'Edge Hub
+	if environment.Heartbeat {
+		go sensor_agent.SendHeartbeats()
+	}
+
+	// Inizializza la comunicazione con il sensore (simulatore o driver fisico)
 	sensorChannelSource := make(chan types.SensorData, 100)
-	go simulation.SimulateForever(sensorChannelSource)
 
-	sensorChannelTarget := make(chan types.SensorData, 100)
+	// Se abilitate, pubblica le etichette delle letture alterate dai guasti iniettati dal simulatore
+	var faultLabelChannel chan types.FaultLabel
+	if environment.SimulationFaultLabels && environment.SensorDriver == environment.SimulationDriver {
+		faultLabelChannel = make(chan types.FaultLabel, 100)
+		go comunication.PublishFaultLabels(faultLabelChannel)
+	}
+
+	sensor, err := sensor_agent.NewSensor(faultLabelChannel)
+	if err != nil {
+		logger.Log.Error("Failed to create sensor: ", err)
+		os.Exit(1)
+	}
+	logger.Log.Info("Using sensor: ", sensor.Name())
+	go func() {
+		if err := sensor.Run(sensorChannelSource); err != nil {
+			logger.Log.Error("Sensor stopped: ", err)
+			os.Exit(1)
+		}
+	}()
+
+	sensorQueueTarget, err := utils.NewBoundedQueue[types.SensorData]("publish", environment.PublishQueue)
+	if err != nil {
+		logger.Log.Error("Failed to create publish queue: ", err)
+		os.Exit(1)
+	}
 	// Invia i dati al broker MQTT
-	go comunication.PublishData(sensorChannelTarget)
+	go comunication.PublishData(sensorQueueTarget.C())
 
 	go func() {
 		for data := range sensorChannelSource {
 			health.UpdateLastValueTimestamp()
-			// Invia i dati al canale di comunicazione
-			select {
-			case sensorChannelTarget <- data:
+			// Invia i dati alla coda di pubblicazione, secondo la policy configurata se è piena
+			if sensorQueueTarget.Push(data) {
 				health.UpdateLastValueTimestamp()
-			default:
-				logger.Log.Warn("MQTT channel is full, discarding data: ", data)
+			} else {
+				logger.Log.Warn("MQTT queue is full, discarding data: ", data)
 			}
 		}
 	}()
@@ -18,6 +18,31 @@ kafka-topics.sh --create --if-not-exists --topic statistics-data-proximity-fog-h
   --bootstrap-server kafka-01:9092 \
   --partitions 5 --replication-factor 1
 
+# rejected-data-proximity-fog-hub
+kafka-topics.sh --create --if-not-exists --topic rejected-data-proximity-fog-hub \
+  --bootstrap-server kafka-01:9092 \
+  --partitions 3 --replication-factor 1
+
+# critical-events-proximity-fog-hub
+kafka-topics.sh --create --if-not-exists --topic critical-events-proximity-fog-hub \
+  --bootstrap-server kafka-01:9092 \
+  --partitions 3 --replication-factor 1
+
+# sensor-state-proximity-fog-hub
+kafka-topics.sh --create --if-not-exists --topic sensor-state-proximity-fog-hub \
+  --bootstrap-server kafka-01:9092 \
+  --partitions 3 --replication-factor 1
+
+# commands-intermediate-fog-hub
+kafka-topics.sh --create --if-not-exists --topic commands-intermediate-fog-hub \
+  --bootstrap-server kafka-01:9092 \
+  --partitions 3 --replication-factor 1
+
+# command-ack-proximity-fog-hub
+kafka-topics.sh --create --if-not-exists --topic command-ack-proximity-fog-hub \
+  --bootstrap-server kafka-01:9092 \
+  --partitions 3 --replication-factor 1
+
 # heartbeats-proximity-fog-hub (compacted)
 kafka-topics.sh --create --if-not-exists --topic heartbeats-proximity-fog-hub \
   --bootstrap-server kafka-01:9092 \
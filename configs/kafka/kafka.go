@@ -30,3 +30,23 @@ const PROXIMITY_FOG_HUB_AGGREGATED_STATS_TOPIC = "statistics-data-proximity-fog-
 
 // PROXIMITY_FOG_HUB_HEARTBEAT_TOPIC permette la comunicazione tra il proximity fog hub e l'intermediate fog hub per lo scambio dei messaggi di heartbeat.
 const PROXIMITY_FOG_HUB_HEARTBEAT_TOPIC = "heartbeats-proximity-fog-hub"
+
+// PROXIMITY_FOG_HUB_REJECTED_DATA_TOPIC permette la comunicazione tra il proximity fog hub e l'intermediate fog hub
+// per lo scambio delle misurazioni scartate dal filtro degli edge hub.
+const PROXIMITY_FOG_HUB_REJECTED_DATA_TOPIC = "rejected-data-proximity-fog-hub"
+
+// PROXIMITY_FOG_HUB_CRITICAL_EVENTS_TOPIC permette la comunicazione tra il proximity fog hub e l'intermediate fog hub
+// per lo scambio delle letture critiche rilevate dagli edge hub, inoltrate senza attendere l'aggregazione (fast lane).
+const PROXIMITY_FOG_HUB_CRITICAL_EVENTS_TOPIC = "critical-events-proximity-fog-hub"
+
+// PROXIMITY_FOG_HUB_SENSOR_STATE_TOPIC permette la comunicazione tra il proximity fog hub e l'intermediate fog hub
+// per lo scambio delle transizioni di stato dei sensori rilevate dagli edge hub.
+const PROXIMITY_FOG_HUB_SENSOR_STATE_TOPIC = "sensor-state-proximity-fog-hub"
+
+// INTERMEDIATE_FOG_HUB_COMMAND_TOPIC permette la comunicazione tra l'intermediate fog hub e i proximity fog hub
+// per l'inoltro dei comandi destinati ai sensori.
+const INTERMEDIATE_FOG_HUB_COMMAND_TOPIC = "commands-intermediate-fog-hub"
+
+// PROXIMITY_FOG_HUB_COMMAND_ACK_TOPIC permette la comunicazione tra il proximity fog hub e l'intermediate fog hub
+// per lo scambio delle conferme dei comandi inviati ai sensori.
+const PROXIMITY_FOG_HUB_COMMAND_ACK_TOPIC = "command-ack-proximity-fog-hub"
@@ -12,10 +12,45 @@ CREATE TABLE IF NOT EXISTS sensor_measurements_cache (
     sensor_id       VARCHAR(255)      NOT NULL,
     type            VARCHAR(50)       NOT NULL,
     value           DOUBLE PRECISION  NOT NULL,
+    -- Statistiche del riepilogo al minuto inviato dall'edge hub ('value' è la media)
+    min_value       DOUBLE PRECISION  NOT NULL,
+    max_value       DOUBLE PRECISION  NOT NULL,
+    sample_count    INTEGER           NOT NULL DEFAULT 1,
+    std_dev         DOUBLE PRECISION  NOT NULL DEFAULT 0,
+    first_value     DOUBLE PRECISION  NOT NULL,
+    last_value      DOUBLE PRECISION  NOT NULL,
+    rejected_count  INTEGER           NOT NULL DEFAULT 0,
+    -- Revisione del riepilogo: le revisioni più recenti (letture arrivate in ritardo) sostituiscono le precedenti
+    revision        INTEGER           NOT NULL DEFAULT 0,
     status          TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent')),
     PRIMARY KEY (time, macrozone_name, zone_name, sensor_id, type)
 );
 
+-- 1.1. Aggiorniamo le tabelle create prima dei riepiloghi al minuto: le righe esistenti
+-- contengono una sola lettura, quindi minimo, massimo, prima e ultima lettura coincidono con 'value'
+ALTER TABLE sensor_measurements_cache
+    ADD COLUMN IF NOT EXISTS min_value       DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS max_value       DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS sample_count    INTEGER           NOT NULL DEFAULT 1,
+    ADD COLUMN IF NOT EXISTS std_dev         DOUBLE PRECISION  NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS first_value     DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS last_value      DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS rejected_count  INTEGER           NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS revision        INTEGER           NOT NULL DEFAULT 0;
+
+UPDATE sensor_measurements_cache
+SET min_value   = COALESCE(min_value, value),
+    max_value   = COALESCE(max_value, value),
+    first_value = COALESCE(first_value, value),
+    last_value  = COALESCE(last_value, value)
+WHERE min_value IS NULL OR max_value IS NULL OR first_value IS NULL OR last_value IS NULL;
+
+ALTER TABLE sensor_measurements_cache
+    ALTER COLUMN min_value   SET NOT NULL,
+    ALTER COLUMN max_value   SET NOT NULL,
+    ALTER COLUMN first_value SET NOT NULL,
+    ALTER COLUMN last_value  SET NOT NULL;
+
 -- 2. La trasformiamo in un'hypertable, partizionata per tempo sulla colonna 'time'
 SELECT create_hypertable('sensor_measurements_cache', 'time', if_not_exists => TRUE, chunk_time_interval => interval '1 hour');
 
@@ -36,5 +36,34 @@ CREATE TABLE IF NOT EXISTS sensors (
     reference           TEXT,
     registration_time   TIMESTAMP,
     last_seen           TIMESTAMP,
+    status              TEXT,                       -- stato del ciclo di vita (registered, active, silent, unhealthy, decommissioned)
+    status_since        TIMESTAMP,                  -- istante dell'ultima transizione di stato
     PRIMARY KEY (id, macrozone_name, zone_name)
-);
\ No newline at end of file
+);
+
+-- Storia delle transizioni di stato dei sensori, rilevate dagli edge hub
+CREATE TABLE IF NOT EXISTS sensor_status_history (
+    sensor_id           TEXT NOT NULL,
+    macrozone_name      TEXT NOT NULL,
+    zone_name           TEXT NOT NULL,
+    hub_id              TEXT,                       -- edge hub che ha rilevato la transizione
+    from_status         TEXT,
+    to_status           TEXT NOT NULL,
+    time                TIMESTAMP NOT NULL,
+    last_seen           TIMESTAMP,                  -- ultima lettura ricevuta dal sensore al momento della transizione
+    PRIMARY KEY (sensor_id, macrozone_name, zone_name, time, to_status)
+);
+
+-- Comandi inviati ai sensori tramite API e stato della loro consegna
+CREATE TABLE IF NOT EXISTS sensor_commands (
+    id                  TEXT PRIMARY KEY,
+    macrozone_name      TEXT NOT NULL,
+    zone_name           TEXT NOT NULL,
+    sensor_id           TEXT NOT NULL,
+    type                TEXT NOT NULL,
+    sampling_interval   BIGINT,                     -- in millisecondi, solo per set_sampling_interval
+    status              TEXT NOT NULL DEFAULT 'pending', -- pending, dispatched, delivered, executed, failed, expired
+    detail              TEXT,
+    created_at          TIMESTAMP NOT NULL,
+    updated_at          TIMESTAMP NOT NULL
+);
@@ -27,6 +27,65 @@ CREATE INDEX IF NOT EXISTS idx_sensor_type_time ON sensor_measurements (type, ti
 -- 5. (Opzionale) Partizionamento secondario per scaling orizzontale futuro
 -- SELECT create_hypertable('sensor_measurements', 'time', chunk_time_interval => interval '1 day');
 
+-- =================================================================
+-- ======== TABELLA PER LE MISURAZIONI SCARTATE DAGLI EDGE HUB ========
+-- =================================================================
+
+-- 1. Crea la tabella con le misurazioni scartate dal filtro e i parametri che ne hanno causato lo scarto
+CREATE TABLE IF NOT EXISTS rejected_measurements (
+    time            TIMESTAMPTZ       NOT NULL,
+    macrozone_name  TEXT              NOT NULL,
+    zone_name       TEXT              NOT NULL,
+    sensor_id       TEXT              NOT NULL,
+    type            TEXT              NOT NULL,
+    value           DOUBLE PRECISION  NOT NULL,
+    reason          TEXT              NOT NULL,
+    detector        TEXT,
+    lower_bound     DOUBLE PRECISION,
+    upper_bound     DOUBLE PRECISION,
+    center          DOUBLE PRECISION,
+    spread          DOUBLE PRECISION,
+    samples         INTEGER           NOT NULL DEFAULT 0,
+    rejected_at     TIMESTAMPTZ       NOT NULL,
+    PRIMARY KEY (time, macrozone_name, zone_name, sensor_id, type)
+);
+
+-- 2. Crea la hypertable (solo se non esiste già)
+SELECT create_hypertable('rejected_measurements', 'time', if_not_exists => TRUE, chunk_time_interval => interval '1 day');
+
+-- 3. Crea indice per analizzare gli scarti per sensore e motivo
+CREATE INDEX IF NOT EXISTS idx_rejected_sensor ON rejected_measurements (macrozone_name, zone_name, sensor_id, time DESC);
+CREATE INDEX IF NOT EXISTS idx_rejected_reason_time ON rejected_measurements (reason, time DESC);
+
+-- ===================================================================
+-- ======== TABELLA PER LE LETTURE CRITICHE (FAST LANE) ========
+-- ===================================================================
+
+-- 1. Letture che hanno superato una soglia critica del profilo del sensore
+CREATE TABLE IF NOT EXISTS critical_events (
+    time            TIMESTAMPTZ       NOT NULL,
+    macrozone_name  TEXT              NOT NULL,
+    zone_name       TEXT              NOT NULL,
+    sensor_id       TEXT              NOT NULL,
+    type            TEXT              NOT NULL,
+    value           DOUBLE PRECISION  NOT NULL,
+    severity        TEXT              NOT NULL,
+    condition       TEXT              NOT NULL,
+    threshold       DOUBLE PRECISION  NOT NULL,
+    detected_at     TIMESTAMPTZ       NOT NULL,
+    outlier         BOOLEAN,
+    detector        TEXT,
+    stored_at       TIMESTAMPTZ       NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (time, macrozone_name, zone_name, sensor_id, type)
+);
+
+-- 2. Crea la hypertable (solo se non esiste già)
+SELECT create_hypertable('critical_events', 'time', if_not_exists => TRUE, chunk_time_interval => interval '1 day');
+
+-- 3. Crea indici per consultare le letture critiche per sensore e per gravità
+CREATE INDEX IF NOT EXISTS idx_critical_sensor ON critical_events (macrozone_name, zone_name, sensor_id, time DESC);
+CREATE INDEX IF NOT EXISTS idx_critical_severity_time ON critical_events (severity, time DESC);
+
 -- ========================================================================
 -- ======== TABELLA PER STATISTICHE AGGREGATE A LIVELLO DI REGIONE ========
 -- ========================================================================
@@ -9,3 +9,15 @@ const MISSING_PROBABILITY = 0.15 // Probabilità di non generare un valore (simu
 const OUTLIER_PROBABILITY = 0.10 // Probabilità di generare un outlier
 const OUTLIER_MULTIPLIER = 20.0  // Moltiplicatore (sulla deviazione standard) per generare un outlier
 const OUTLIER_ADDITION = 0.0     // Valore aggiunto (nella media) per generare un outlier
+
+// Parametri di default dei guasti, modificabili per ogni Sensor Agent tramite SIMULATION_FAULTS
+const STUCK_LENGTH = 12      // Numero di letture bloccate sull'ultimo valore valido
+const DRIFT_LENGTH = 60      // Numero di letture con scostamento crescente
+const DRIFT_STEP = 0.05      // Incremento dello scostamento ad ogni lettura (sulla deviazione standard)
+const BURST_LENGTH = 5       // Numero di outlier consecutivi
+const CLOCK_SKEW_LENGTH = 12 // Numero di letture con il timestamp spostato
+const CLOCK_SKEW = 300       // Spostamento in avanti del timestamp, in secondi
+const OUT_OF_ORDER_DELAY = 3 // Ritardo del timestamp di una lettura fuori ordine, in intervalli di campionamento
+const FLAT_LINE_LENGTH = 12  // Numero di letture a zero
+
+const VERSION = "1.0.0" // Versione del simulatore, riportata negli heartbeat del Sensor Agent
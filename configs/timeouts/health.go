@@ -10,3 +10,7 @@ const IsAliveHubTimeout = IsAliveSensorTimeout
 
 // HeartbeatInterval è l'intervallo di invio del messaggio di heartbeat
 const HeartbeatInterval = 3 * time.Minute
+
+// SensorHeartbeatInterval è l'intervallo di invio del messaggio di heartbeat dei Sensor Agent,
+// inferiore a IsAliveSensorTimeout così un sensore attivo non viene mai considerato unhealthy
+const SensorHeartbeatInterval = time.Minute
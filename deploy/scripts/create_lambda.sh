@@ -46,3 +46,14 @@ set -e
 
 # Dati aggregati zona
 ./deploy_lambda.sh zone-data-aggregated-stack zone zoneDataAggregated "/zone/data/aggregated/{region}/{macrozone}/{zone}"
+
+
+
+# Invio di un comando a un sensore
+METHOD=POST ./deploy_lambda.sh sensor-command-create-stack sensor sensorCommandCreate "/sensor/command/{region}/{macrozone}/{zone}/{sensor}"
+
+# Stato di un comando
+./deploy_lambda.sh sensor-command-status-stack sensor sensorCommandStatus "/sensor/command/status/{region}/{id}"
+
+# Lista dei comandi di un sensore
+./deploy_lambda.sh sensor-command-list-stack sensor sensorCommandList "/sensor/command/list/{region}/{macrozone}/{zone}/{sensor}"
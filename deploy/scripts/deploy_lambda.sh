@@ -5,6 +5,7 @@ FOLDER=$2
 FUNCTION=$3
 PATH_ROUTE=$4       # percorso della route, es: /zone/sensor/data/raw/{region}/{macrozone}/{zone}/{sensor}
 RESET=$5            # opzionale: --reset
+METHOD=${METHOD:-GET} # metodo HTTP della route, es: METHOD=POST ./deploy_lambda.sh ...
 
 if [ -z "$FOLDER" ] || [ -z "$FUNCTION" ] || [ -z "$PATH_ROUTE" ] || [ -z "$STACK_NAME" ]; then
   echo "Usage: $0 <stack_name> <folder> <function> <path_route> [--reset]"
@@ -81,12 +82,12 @@ else
     --statement-id "apigw-invoke-$(date +%s)" \
     --action lambda:InvokeFunction \
     --principal apigateway.amazonaws.com \
-    --source-arn "arn:aws:execute-api:us-east-1:975050105348:$API_ID/*/GET$PATH_ROUTE"
+    --source-arn "arn:aws:execute-api:us-east-1:975050105348:$API_ID/*/$METHOD$PATH_ROUTE"
 fi
 
 # --- Crea integrazione Lambda HTTP API ---
-echo "[INFO] Controllo se la route GET $PATH_ROUTE esiste già"
-EXISTING_ROUTE=$(aws apigatewayv2 get-routes --api-id "$API_ID" --query "Items[?RouteKey=='GET $PATH_ROUTE'].RouteId" --output text || true)
+echo "[INFO] Controllo se la route $METHOD $PATH_ROUTE esiste già"
+EXISTING_ROUTE=$(aws apigatewayv2 get-routes --api-id "$API_ID" --query "Items[?RouteKey=='$METHOD $PATH_ROUTE'].RouteId" --output text || true)
 
 echo "[INFO] Controllo se l'integrazione esiste già"
 EXISTING_INTEGRATION=$(aws apigatewayv2 get-integrations --api-id "$API_ID" --query "Items[?IntegrationUri=='arn:aws:lambda:us-east-1:975050105348:function:$FUNCTION'].IntegrationId" --output text || true)
@@ -116,9 +117,9 @@ else
   echo "[INFO] Integrazione creata con ID: $INTEGRATION_ID"
 fi
 
-# --- Crea route GET sulla API con integrazione ---
+# --- Crea route sulla API con integrazione ---
 if [ -n "$EXISTING_ROUTE" ] && [ "$RESET" != "--reset" ]; then
-  echo "[WARNING] La route GET $PATH_ROUTE esiste già con ID: $EXISTING_ROUTE. Usa --reset per rigenerarla."
+  echo "[WARNING] La route $METHOD $PATH_ROUTE esiste già con ID: $EXISTING_ROUTE. Usa --reset per rigenerarla."
 else
   if [ "$RESET" == "--reset" ]; then
     echo "[INFO] Rimuovo route esistente"
@@ -126,11 +127,11 @@ else
       aws apigatewayv2 delete-route --api-id "$API_ID" --route-id "$EXISTING_ROUTE" || true
     fi
   fi
-  echo "[INFO] Creo route GET $PATH_ROUTE"
+  echo "[INFO] Creo route $METHOD $PATH_ROUTE"
   aws apigatewayv2 create-route \
     --api-id "$API_ID" \
-    --route-key "GET $PATH_ROUTE" \
+    --route-key "$METHOD $PATH_ROUTE" \
     --target "integrations/$INTEGRATION_ID"
 fi
 
-echo "[INFO] Lambda $FUNCTION agganciata a HTTP API $API_ID su route GET $PATH_ROUTE con PATH mapping \$request.path"
+echo "[INFO] Lambda $FUNCTION agganciata a HTTP API $API_ID su route $METHOD $PATH_ROUTE con PATH mapping \$request.path"
@@ -0,0 +1,115 @@
+package sensor
+
+import (
+	"SensorContinuum/internal/api-backend/storage"
+	"SensorContinuum/pkg/types"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CreateSensorCommand Salva un nuovo comando per un sensore nel database dei metadati della regione.
+// Il comando viene inoltrato al sensore dall'Intermediate Fog Hub. Restituisce nil se il sensore non esiste.
+func CreateSensorCommand(ctx context.Context, regionName string, command types.SensorCommand) (*types.SensorCommandInfo, error) {
+	regionDb, err := storage.GetRegionPostgresDB(ctx, regionName)
+	if err != nil {
+		return nil, err
+	}
+
+	var exists bool
+	err = regionDb.Conn().QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM sensors
+			WHERE macrozone_name = $1 AND zone_name = $2 AND id = $3
+		)
+	`, command.EdgeMacrozone, command.EdgeZone, command.SensorID).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	now := time.Now().UTC()
+	c := types.SensorCommandInfo{
+		ID:               uuid.New().String(),
+		MacrozoneName:    command.EdgeMacrozone,
+		ZoneName:         command.EdgeZone,
+		SensorID:         command.SensorID,
+		Type:             command.Type,
+		SamplingInterval: command.SamplingInterval,
+		Status:           types.CommandPending,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+
+	var samplingInterval *int64
+	if c.SamplingInterval > 0 {
+		samplingInterval = &c.SamplingInterval
+	}
+
+	_, err = regionDb.Conn().Exec(ctx, `
+		INSERT INTO sensor_commands (id, macrozone_name, zone_name, sensor_id, type, sampling_interval, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, c.ID, c.MacrozoneName, c.ZoneName, c.SensorID, string(c.Type), samplingInterval, string(c.Status), c.CreatedAt, c.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// GetSensorCommand Restituisce un comando e il suo stato corrente
+func GetSensorCommand(ctx context.Context, regionName, id string) (*types.SensorCommandInfo, error) {
+	regionDb, err := storage.GetRegionPostgresDB(ctx, regionName)
+	if err != nil {
+		return nil, err
+	}
+
+	var c types.SensorCommandInfo
+	err = regionDb.Conn().QueryRow(ctx, `
+		SELECT id, macrozone_name, zone_name, sensor_id, type, COALESCE(sampling_interval, 0), status, COALESCE(detail, ''), created_at, updated_at
+		FROM sensor_commands
+		WHERE id = $1
+	`, id).Scan(&c.ID, &c.MacrozoneName, &c.ZoneName, &c.SensorID, &c.Type, &c.SamplingInterval, &c.Status, &c.Detail, &c.CreatedAt, &c.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetSensorCommands Restituisce gli ultimi comandi inviati a un sensore, dal più recente
+func GetSensorCommands(ctx context.Context, regionName, macrozoneName, zoneName, sensorId string, limit int) ([]types.SensorCommandInfo, error) {
+	regionDb, err := storage.GetRegionPostgresDB(ctx, regionName)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := regionDb.Conn().Query(ctx, `
+		SELECT id, macrozone_name, zone_name, sensor_id, type, COALESCE(sampling_interval, 0), status, COALESCE(detail, ''), created_at, updated_at
+		FROM sensor_commands
+		WHERE macrozone_name = $1 AND zone_name = $2 AND sensor_id = $3
+		ORDER BY created_at DESC
+		LIMIT $4
+	`, macrozoneName, zoneName, sensorId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	commands := make([]types.SensorCommandInfo, 0)
+	for rows.Next() {
+		var c types.SensorCommandInfo
+		if err := rows.Scan(&c.ID, &c.MacrozoneName, &c.ZoneName, &c.SensorID, &c.Type, &c.SamplingInterval, &c.Status, &c.Detail, &c.CreatedAt, &c.UpdatedAt); err != nil {
+			return nil, err
+		}
+		commands = append(commands, c)
+	}
+	return commands, rows.Err()
+}
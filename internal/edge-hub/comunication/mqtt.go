@@ -4,11 +4,14 @@ import (
 	"SensorContinuum/internal/edge-hub/environment"
 	"SensorContinuum/pkg/logger"
 	"SensorContinuum/pkg/types"
+	"SensorContinuum/pkg/utils"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	MQTT "github.com/eclipse/paho.mqtt.golang"
@@ -26,7 +29,7 @@ var hubClient MQTT.Client
 var connectAttempts = 0
 
 // sensorDataHandler è la funzione di callback che processa i messaggi con le rilevazioni in arrivo.
-func makeSensorDataHandler(sensorDataChannel chan types.SensorData) MQTT.MessageHandler {
+func makeSensorDataHandler(sensorDataQueue *utils.BoundedQueue[types.SensorData]) MQTT.MessageHandler {
 	return func(client MQTT.Client, msg MQTT.Message) {
 		logger.Log.Debug("Received message on topic: ", msg.Topic())
 
@@ -37,16 +40,24 @@ func makeSensorDataHandler(sensorDataChannel chan types.SensorData) MQTT.Message
 			return
 		}
 
-		// select non bloccante, il ricevitore MQTT non viene mai bloccato dal processore
-		// Se il canale è pieno, scarta il messaggio per non rallentare la ricezione.
-		select {
+		// Il sensore può pubblicare solo sul topic con il proprio identificativo (ACL del broker)
+		// e non può inviare letture a nome di un altro sensore
+		if err := utils.CheckTopicIdentity(msg.Topic(), sensorData.SensorID); err != nil {
+			logger.Log.Error("Discarding sensor data: ", err.Error())
+			return
+		}
 
-		case sensorDataChannel <- sensorData:
-			// Messaggio inviato correttamente
-			logger.Log.Debug("Sent message on sensorDataChannel")
-		default:
-			// Se il canale è pieno scartiamo il messaggio per non bloccare la ricezione dei nuovi
-			logger.Log.Warn("Data channel is full. Discarding message from sensor: ", sensorData.SensorID)
+		// La firma garantisce che la lettura sia stata prodotta dal sensore e non sia stata alterata o ripetuta
+		if err := verifySensorData(sensorData); err != nil {
+			logger.Log.Error("Discarding sensor data: ", err.Error())
+			return
+		}
+
+		// Se la coda è piena, la policy configurata decide se attendere, scartare o salvare su disco la lettura
+		if sensorDataQueue.Push(sensorData) {
+			logger.Log.Debug("Sent message on sensorDataQueue")
+		} else {
+			logger.Log.Warn("Data queue is full. Discarding message from sensor: ", sensorData.SensorID)
 		}
 	}
 }
@@ -56,6 +67,12 @@ func makeConfigurationMessageHandler(configurationMessageChannel chan types.Conf
 	return func(client MQTT.Client, msg MQTT.Message) {
 		logger.Log.Debug("Received message on topic: ", msg.Topic())
 
+		// I topic desired e reported contengono la configurazione di simulazione dei sensori (device twin)
+		// e non sono messaggi di registrazione
+		if strings.HasSuffix(msg.Topic(), "/desired") || strings.HasSuffix(msg.Topic(), "/reported") {
+			return
+		}
+
 		configMsg, err := types.CreateConfigurationMsgFromMqtt(msg)
 		if err != nil {
 			logger.Log.Error("Error parsing sensor data from MQTT message: ", err.Error())
@@ -67,6 +84,11 @@ func makeConfigurationMessageHandler(configurationMessageChannel chan types.Conf
 			return
 		}
 
+		if err := utils.CheckTopicIdentity(msg.Topic(), configMsg.SensorID); err != nil {
+			logger.Log.Error("Discarding configuration message: ", err.Error())
+			return
+		}
+
 		// select non bloccante, il ricevitore MQTT non viene mai bloccato dal processore
 		// Se il canale è pieno, scarta il messaggio per non rallentare la ricezione.
 		select {
@@ -79,21 +101,102 @@ func makeConfigurationMessageHandler(configurationMessageChannel chan types.Conf
 	}
 }
 
+// makeSensorCommandHandler è la funzione di callback che processa i comandi in arrivo dal Proximity Fog Hub.
+func makeSensorCommandHandler(commandChannel chan types.SensorCommand) MQTT.MessageHandler {
+	return func(client MQTT.Client, msg MQTT.Message) {
+		logger.Log.Debug("Received message on topic: ", msg.Topic())
+
+		command, err := types.CreateSensorCommandFromMQTT(msg)
+		if err != nil {
+			logger.Log.Error("Error parsing sensor command from MQTT message: ", err.Error())
+			return
+		}
+
+		// I messaggi vuoti servono solo a rimuovere i comandi conservati dal broker
+		if command.ID == "" {
+			logger.Log.Debug("Received empty sensor command. Skipping processing.")
+			return
+		}
+
+		// select non bloccante, il ricevitore MQTT non viene mai bloccato dal processore
+		// Se il canale è pieno, scarta il messaggio: il comando resta conservato dal broker
+		// e verrà ricevuto di nuovo alla prossima riconnessione.
+		select {
+		case commandChannel <- command:
+			// Messaggio inviato correttamente
+			logger.Log.Debug("Sent sensor command to channel")
+		default:
+			logger.Log.Warn("Command channel is full. Discarding command for sensor: ", command.SensorID)
+		}
+	}
+}
+
+// makeCommandAckHandler è la funzione di callback che processa le conferme dei comandi in arrivo dai sensori.
+func makeCommandAckHandler(commandAckChannel chan types.CommandAck) MQTT.MessageHandler {
+	return func(client MQTT.Client, msg MQTT.Message) {
+		logger.Log.Debug("Received message on topic: ", msg.Topic())
+
+		ack, err := types.CreateCommandAckFromMQTT(msg)
+		if err != nil {
+			logger.Log.Error("Error parsing command ack from MQTT message: ", err.Error())
+			return
+		}
+
+		// select non bloccante, il ricevitore MQTT non viene mai bloccato dal processore
+		// Se il canale è pieno, scarta il messaggio per non rallentare la ricezione.
+		select {
+		case commandAckChannel <- ack:
+			// Messaggio inviato correttamente
+			logger.Log.Debug("Sent command ack to channel")
+		default:
+			logger.Log.Warn("Command ack channel is full. Discarding ack for command: ", ack.CommandID)
+		}
+	}
+}
+
+// makeSensorHeartbeatHandler è la funzione di callback che processa i messaggi di heartbeat in arrivo dai sensori.
+func makeSensorHeartbeatHandler(sensorHeartbeatChannel chan types.HeartbeatMsg) MQTT.MessageHandler {
+	return func(client MQTT.Client, msg MQTT.Message) {
+		logger.Log.Debug("Received message on topic: ", msg.Topic())
+
+		heartbeat, err := types.CreateHeartbeatMsgFromMqtt(msg)
+		if err != nil {
+			logger.Log.Error("Error parsing sensor heartbeat from MQTT message: ", err.Error())
+			return
+		}
+
+		if err := utils.CheckTopicIdentity(msg.Topic(), heartbeat.SensorID); err != nil {
+			logger.Log.Error("Discarding sensor heartbeat: ", err.Error())
+			return
+		}
+
+		// select non bloccante, il ricevitore MQTT non viene mai bloccato dal processore
+		// Se il canale è pieno, scarta il messaggio: il sensore invierà il prossimo heartbeat.
+		select {
+		case sensorHeartbeatChannel <- heartbeat:
+			// Messaggio inviato correttamente
+			logger.Log.Debug("Sent sensor heartbeat to channel")
+		default:
+			logger.Log.Warn("Sensor heartbeat channel is full. Discarding heartbeat from sensor: ", heartbeat.SensorID)
+		}
+	}
+}
+
 // makeConnectionHandler viene chiamata quando la connessione MQTT è già riuscita e quello che fa ora è
 // fare la subscribe al topic dei dati del sensore.
-func makeConnectionHandler(sensorDataChannel chan types.SensorData, configurationMessageChannel chan types.ConfigurationMsg) MQTT.OnConnectHandler {
+func makeConnectionHandler(sensorDataQueue *utils.BoundedQueue[types.SensorData], configurationMessageChannel chan types.ConfigurationMsg, commandChannel chan types.SensorCommand, commandAckChannel chan types.CommandAck, sensorHeartbeatChannel chan types.HeartbeatMsg) MQTT.OnConnectHandler {
 	return func(client MQTT.Client) {
 
 		var topic string
 		var token MQTT.Token
 
-		if sensorDataChannel != nil && (environment.ServiceMode == types.EdgeHubService || environment.ServiceMode == types.EdgeHubFilterService) {
+		if sensorDataQueue != nil && (environment.ServiceMode == types.EdgeHubService || environment.ServiceMode == types.EdgeHubFilterService) {
 			topic = environment.SensorDataTopic + "/#"
 			logger.Log.Debug("Subscribing to topic: ", topic)
 
 			// Sottoscrivi al topic per ricevere i dati dai sensori
 			// QoS 0, cioè "at most once", il messaggio può andare perso
-			token = client.Subscribe(topic, 0, makeSensorDataHandler(sensorDataChannel)) // Il message handler è globale
+			token = client.Subscribe(topic, 0, makeSensorDataHandler(sensorDataQueue)) // Il message handler è globale
 			logger.Log.Info("Subscribed to topic: ", topic)
 			if token.WaitTimeout(time.Duration(environment.MaxSubscriptionTimeout)*time.Second) && token.Error() != nil {
 				logger.Log.Error("Failed to subscribe to topic:", topic, "error:", token.Error())
@@ -115,6 +218,50 @@ func makeConnectionHandler(sensorDataChannel chan types.SensorData, configuratio
 			}
 		}
 
+		if commandChannel != nil && (environment.ServiceMode == types.EdgeHubService || environment.ServiceMode == types.EdgeHubConfigurationService) {
+			topic = environment.HubCommandTopic + "/#"
+			logger.Log.Debug("Subscribing to topic: ", topic)
+
+			// Sottoscrivi al topic per ricevere i comandi destinati ai sensori della zona
+			// La sottoscrizione non è condivisa, perché il broker non invia i messaggi conservati
+			// alle sottoscrizioni condivise: la consegna unica è garantita da ClaimSensorCommand
+			// QoS 2, cioè "exactly once", il messaggio viene consegnato una sola volta, senza duplicati
+			token = client.Subscribe(topic, 2, makeSensorCommandHandler(commandChannel))
+			logger.Log.Info("Subscribed to topic: ", topic)
+			if token.WaitTimeout(time.Duration(environment.MaxSubscriptionTimeout)*time.Second) && token.Error() != nil {
+				logger.Log.Error("Failed to subscribe to topic:", topic, "error:", token.Error())
+				os.Exit(1) // Esci se non riesci a sottoscrivere
+			}
+		}
+
+		if commandAckChannel != nil && (environment.ServiceMode == types.EdgeHubService || environment.ServiceMode == types.EdgeHubConfigurationService) {
+			topic = environment.SensorCommandAckTopic + "/#"
+			logger.Log.Debug("Subscribing to topic: ", topic)
+
+			// Sottoscrivi al topic per ricevere le conferme dei comandi dai sensori
+			// QoS 1, cioè "at least once", il messaggio viene consegnato almeno una volta, possono esserci duplicati
+			token = client.Subscribe(topic, 1, makeCommandAckHandler(commandAckChannel))
+			logger.Log.Info("Subscribed to topic: ", topic)
+			if token.WaitTimeout(time.Duration(environment.MaxSubscriptionTimeout)*time.Second) && token.Error() != nil {
+				logger.Log.Error("Failed to subscribe to topic:", topic, "error:", token.Error())
+				os.Exit(1) // Esci se non riesci a sottoscrivere
+			}
+		}
+
+		if sensorHeartbeatChannel != nil && (environment.ServiceMode == types.EdgeHubService || environment.ServiceMode == types.EdgeHubConfigurationService) {
+			topic = environment.SensorHeartbeatTopic + "/#"
+			logger.Log.Debug("Subscribing to topic: ", topic)
+
+			// Sottoscrivi al topic per ricevere gli heartbeat dei sensori
+			// QoS 1, cioè "at least once", il messaggio viene consegnato almeno una volta, possono esserci duplicati
+			token = client.Subscribe(topic, 1, makeSensorHeartbeatHandler(sensorHeartbeatChannel))
+			logger.Log.Info("Subscribed to topic: ", topic)
+			if token.WaitTimeout(time.Duration(environment.MaxSubscriptionTimeout)*time.Second) && token.Error() != nil {
+				logger.Log.Error("Failed to subscribe to topic:", topic, "error:", token.Error())
+				os.Exit(1) // Esci se non riesci a sottoscrivere
+			}
+		}
+
 		// Se siamo qui, la connessione è riuscita e abbiamo sottoscritto ai topic
 		// Quindi resettiamo il contatore dei tentativi di connessione
 		connectAttempts = 0
@@ -134,7 +281,9 @@ func makeConnectionHandler(sensorDataChannel chan types.SensorData, configuratio
 // - Intervallo massimo di riconnessione
 // - Gestione della connessione riuscita con la sottoscrizione ai topic dei dati
 // - Gestione della connessione riuscita con la sottoscrizione ai topic di configurazione
-func getCommonOptions(sensorDataChannel chan types.SensorData, configurationMessageChannel chan types.ConfigurationMsg) *MQTT.ClientOptions {
+// - Gestione della connessione riuscita con la sottoscrizione ai topic dei comandi e delle relative conferme
+// - Gestione della connessione riuscita con la sottoscrizione al topic degli heartbeat dei sensori
+func getCommonOptions(sensorDataQueue *utils.BoundedQueue[types.SensorData], configurationMessageChannel chan types.ConfigurationMsg, commandChannel chan types.SensorCommand, commandAckChannel chan types.CommandAck, sensorHeartbeatChannel chan types.HeartbeatMsg) *MQTT.ClientOptions {
 
 	// --- Impostazioni di Connessione ---
 
@@ -145,6 +294,14 @@ func getCommonOptions(sensorDataChannel chan types.SensorData, configurationMess
 	opts.SetClientID(mqttId)
 	opts.SetProtocolVersion(5)
 
+	// --- Impostazioni di Sicurezza ---
+
+	// TLS con autenticazione reciproca e credenziali dell'hub, se configurati
+	if err := environment.MqttSecurity.Apply(opts, environment.HubID); err != nil {
+		logger.Log.Error("Error configuring MQTT security: ", err.Error())
+		os.Exit(1)
+	}
+
 	// --- Impostazioni di Resilienza ---
 
 	// la libreria paho gestisce automaticamente la riconnessione in background,
@@ -158,7 +315,7 @@ func getCommonOptions(sensorDataChannel chan types.SensorData, configurationMess
 	// Questo handler viene chiamato quando la connessione è stabilita con successo
 	// e permette di sottoscrivere ai topic desiderati.
 	// In questo caso, sottoscrive al topic dei dati e di configurazione del sensore.
-	opts.SetOnConnectHandler(makeConnectionHandler(sensorDataChannel, configurationMessageChannel))
+	opts.SetOnConnectHandler(makeConnectionHandler(sensorDataQueue, configurationMessageChannel, commandChannel, commandAckChannel, sensorHeartbeatChannel))
 	opts.SetConnectionLostHandler(func(c MQTT.Client, err error) {
 		logger.Log.Warn("Hub lost connection to MQTT broker: ", err.Error())
 	})
@@ -186,7 +343,7 @@ func getCommonOptions(sensorDataChannel chan types.SensorData, configurationMess
 // connectAndManage gestisce la connessione una sola volta.
 // Se il client è già definito e connesso, non fa nulla.
 // Se il client non è definito o non è connesso, procede con la connessione al broker MQTT.
-func connectAndManage(sensorDataChannel chan types.SensorData, configurationMessageChannel chan types.ConfigurationMsg) {
+func connectAndManage(sensorDataQueue *utils.BoundedQueue[types.SensorData], configurationMessageChannel chan types.ConfigurationMsg, commandChannel chan types.SensorCommand, commandAckChannel chan types.CommandAck, sensorHeartbeatChannel chan types.HeartbeatMsg) {
 
 	sensorBrokerURL := fmt.Sprintf("%s://%s:%s", environment.MqttSensorBrokerProtocol, environment.MqttSensorBrokerAddress, environment.MqttSensorBrokerPort)
 	hubBrokerURL := fmt.Sprintf("%s://%s:%s", environment.MqttHubBrokerProtocol, environment.MqttHubBrokerAddress, environment.MqttHubBrokerPort)
@@ -201,7 +358,7 @@ func connectAndManage(sensorDataChannel chan types.SensorData, configurationMess
 			return
 		}
 
-		opts := getCommonOptions(sensorDataChannel, configurationMessageChannel)
+		opts := getCommonOptions(sensorDataQueue, configurationMessageChannel, commandChannel, commandAckChannel, sensorHeartbeatChannel)
 
 		// --- Connessione al broker ---
 
@@ -229,7 +386,7 @@ func connectAndManage(sensorDataChannel chan types.SensorData, configurationMess
 			return
 		}
 
-		opts := getCommonOptions(sensorDataChannel, configurationMessageChannel)
+		opts := getCommonOptions(sensorDataQueue, configurationMessageChannel, commandChannel, commandAckChannel, sensorHeartbeatChannel)
 
 		// --- Connessione al broker ---
 
@@ -248,7 +405,7 @@ func connectAndManage(sensorDataChannel chan types.SensorData, configurationMess
 	}
 }
 
-func SetupMQTTConnection(sensorDataChannel chan types.SensorData, configurationMessageChannel chan types.ConfigurationMsg) {
+func SetupMQTTConnection(sensorDataQueue *utils.BoundedQueue[types.SensorData], configurationMessageChannel chan types.ConfigurationMsg, commandChannel chan types.SensorCommand, commandAckChannel chan types.CommandAck, sensorHeartbeatChannel chan types.HeartbeatMsg) {
 
 	// Assicura che la connessione non sia già stata inizializzata.
 	if sensorClient != nil && sensorClient.IsConnected() && hubClient != nil && hubClient.IsConnected() {
@@ -257,7 +414,7 @@ func SetupMQTTConnection(sensorDataChannel chan types.SensorData, configurationM
 	}
 
 	// Inizializza la connessione MQTT
-	connectAndManage(sensorDataChannel, configurationMessageChannel)
+	connectAndManage(sensorDataQueue, configurationMessageChannel, commandChannel, commandAckChannel, sensorHeartbeatChannel)
 
 	// Non procedere se la connessione non è attiva.
 	if !sensorClient.IsConnected() {
@@ -273,45 +430,275 @@ func SetupMQTTConnection(sensorDataChannel chan types.SensorData, configurationM
 
 }
 
-// PublishFilteredData pubblica i dati filtrati al broker MQTT
-func PublishFilteredData(filteredDataChannel chan types.SensorData) {
+// PublishFilteredData pubblica al broker MQTT il riepilogo al minuto dei dati filtrati di un sensore.
+// Restituisce nil solo dopo la conferma (PUBACK) del broker, in modo che il dispatcher
+// possa rimuovere il riepilogo dall'outbox; altrimenti restituisce l'ultimo errore.
+func PublishFilteredData(filteredData types.SensorMinuteSummary) error {
 
 	// Non procedere se la connessione non è attiva.
+	// L'opzione AutoReconnect della libreria sta già lavorando per riconnettersi.
 	if !hubClient.IsConnected() {
-		logger.Log.Warn("MQTT client not connected. Skipping data publishing.")
-		// L'opzione AutoReconnect della libreria sta già lavorando per riconnettersi.
-		return
+		return errors.New("MQTT hub client not connected")
 	}
 
-	for filteredData := range filteredDataChannel {
-		payload, err := json.Marshal(filteredData)
+	payload, err := json.Marshal(filteredData)
+	if err != nil {
+		return err
+	}
+
+	topic := environment.FilteredDataTopic + "/" + filteredData.SensorID
+
+	// Invia i dati al broker MQTT
+	// QoS 1, cioè "at least once", il messaggio viene consegnato almeno una volta, può essere duplicato
+	// Retained false, il messaggio non viene conservato dal broker
+	//
+	// Usiamo WaitTimeout per non bloccare l'hub all'infinito,
+	// cioè se la rete è lenta l'hub comunque non si blocca:
+	// se si raggiunge il max dei retry il riepilogo resta nell'outbox
+	for i := 0; i < environment.MessagePublishAttempts; i++ {
+		token := hubClient.Publish(topic, 1, false, payload)
+		if !token.WaitTimeout(time.Duration(environment.MessagePublishTimeout) * time.Second) {
+			err = errors.New("timeout publishing message on topic " + topic)
+			logger.Log.Warn("Timeout publishing message. Retry ", i+1)
+		} else if err = token.Error(); err != nil {
+			logger.Log.Error("Error publishing message: ", err.Error(), ". Retry ", i+1)
+		} else {
+			logger.Log.Debug("Message published successfully on topic: ", topic)
+			return nil
+		}
+	}
+	return err
+}
+
+// PublishRejectedData pubblica al broker MQTT le letture scartate dal filtro,
+// in modo che il Proximity Hub possa inoltrarle per l'analisi delle decisioni del filtro.
+// La pubblicazione non viene saltata se il client non è connesso: l'opzione AutoReconnect della libreria
+// ristabilisce la connessione e, dopo MessagePublishAttempts tentativi falliti, la pubblicazione riprende
+// con un'attesa crescente. Nel frattempo le letture scartate che non entrano nel canale restano in Redis
+// e vengono inoltrate in seguito.
+func PublishRejectedData(rejectedDataChannel chan types.RejectedSensorData) {
+
+	for rejectedData := range rejectedDataChannel {
+		payload, err := json.Marshal(rejectedData)
 		if err != nil {
 			logger.Log.Error("Error during JSON serialization: ", err.Error())
-			return
+			continue
 		}
 
-		topic := environment.FilteredDataTopic + "/" + filteredData.SensorID
+		topic := environment.RejectedDataTopic + "/" + rejectedData.SensorID
 
-		// Invia i dati al broker MQTT
 		// QoS 1, cioè "at least once", il messaggio viene consegnato almeno una volta, può essere duplicato
 		// Retained false, il messaggio non viene conservato dal broker
-		//
-		// Usiamo WaitTimeout per non bloccare l'hub all'infinito,
-		// cioè se la rete è lenta l'hub comunque non si blocca
-		// anche se il timeout scade e si raggiunge il max dei
-		// retry il programma comunque prosegue
-		for i := 0; i < environment.MessagePublishAttempts; i++ {
-			token := hubClient.Publish(topic, 1, false, payload)
-			if !token.WaitTimeout(time.Duration(environment.MessagePublishTimeout) * time.Second) {
-				logger.Log.Warn("Timeout publishing message. Retry ", i+1)
-			} else if err := token.Error(); err != nil {
-				logger.Log.Error("Error publishing message: ", err.Error(), ". Retry ", i+1)
-			} else {
-				logger.Log.Debug("Message published successfully on topic: ", topic)
-				break
+		published := false
+		delay := environment.PublishRetryMinDelay
+		for !published {
+			for i := 0; i < environment.MessagePublishAttempts && !published; i++ {
+				token := hubClient.Publish(topic, 1, false, payload)
+				if !token.WaitTimeout(time.Duration(environment.MessagePublishTimeout) * time.Second) {
+					logger.Log.Warn("Timeout publishing rejected data. Retry ", i+1)
+				} else if err := token.Error(); err != nil {
+					logger.Log.Error("Error publishing rejected data: ", err.Error(), ". Retry ", i+1)
+				} else {
+					logger.Log.Debug("Rejected data published successfully on topic: ", topic)
+					published = true
+				}
 			}
+			if !published {
+				logger.Log.Error("Failed to publish rejected data from sensor ", rejectedData.SensorID, ". Retrying in ", delay.String())
+				time.Sleep(delay)
+				delay = min(2*delay, environment.PublishRetryMaxDelay)
+			}
+		}
+	}
+}
+
+// PublishCriticalEvent pubblica al broker MQTT una lettura critica appena rilevata dal filtro,
+// in modo che il Proximity Hub la inoltri senza attendere l'aggregazione.
+// A differenza dei dati scartati, la pubblicazione non viene saltata se il client non è connesso:
+// durante la riconnessione automatica la libreria mantiene i messaggi e li invia appena la connessione viene ristabilita.
+// Restituisce un errore se la lettura non è stata consegnata dopo MessagePublishAttempts tentativi.
+func PublishCriticalEvent(event types.CriticalEvent) error {
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	topic := environment.CriticalDataTopic + "/" + event.SensorID
+
+	// QoS 1, cioè "at least once", il messaggio viene consegnato almeno una volta, può essere duplicato
+	// Retained false, il messaggio non viene conservato dal broker
+	for i := 0; i < environment.MessagePublishAttempts; i++ {
+		token := hubClient.Publish(topic, 1, false, payload)
+		if !token.WaitTimeout(time.Duration(environment.MessagePublishTimeout) * time.Second) {
+			logger.Log.Warn("Timeout publishing critical event. Retry ", i+1)
+		} else if err = token.Error(); err != nil {
+			logger.Log.Error("Error publishing critical event: ", err.Error(), ". Retry ", i+1)
+		} else {
+			logger.Log.Debug("Critical event published successfully on topic: ", topic)
+			return nil
+		}
+	}
+	return errors.New("failed to publish critical event on topic " + topic)
+}
+
+// PublishSensorNotification pubblica al broker MQTT una notifica sullo stato di un sensore.
+// Restituisce un errore se la notifica non è stata consegnata dopo MessagePublishAttempts tentativi.
+func PublishSensorNotification(notification types.SensorNotification) error {
+
+	// Non procedere se la connessione non è attiva.
+	if !hubClient.IsConnected() {
+		return errors.New("MQTT client not connected")
+	}
+
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	topic := environment.AlertTopic + "/" + notification.SensorID
+
+	// QoS 1, cioè "at least once", il messaggio viene consegnato almeno una volta, può essere duplicato
+	// Retained false, il messaggio non viene conservato dal broker
+	for i := 0; i < environment.MessagePublishAttempts; i++ {
+		token := hubClient.Publish(topic, 1, false, payload)
+		if !token.WaitTimeout(time.Duration(environment.MessagePublishTimeout) * time.Second) {
+			logger.Log.Warn("Timeout publishing sensor notification. Retry ", i+1)
+		} else if err = token.Error(); err != nil {
+			logger.Log.Error("Error publishing sensor notification: ", err.Error(), ". Retry ", i+1)
+		} else {
+			logger.Log.Debug("Sensor notification published successfully on topic: ", topic)
+			return nil
 		}
 	}
+	return errors.New("failed to publish sensor notification on topic " + topic)
+}
+
+// PublishSensorStateEvent pubblica al broker MQTT una transizione di stato di un sensore,
+// in modo che il Proximity Hub possa inoltrarla al database dei metadati della regione.
+// Restituisce un errore se l'evento non è stato consegnato dopo MessagePublishAttempts tentativi.
+func PublishSensorStateEvent(event types.SensorStateEvent) error {
+
+	// Non procedere se la connessione non è attiva.
+	if !hubClient.IsConnected() {
+		return errors.New("MQTT client not connected")
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	topic := environment.SensorStateTopic + "/" + event.SensorID
+
+	// QoS 1, cioè "at least once", il messaggio viene consegnato almeno una volta, può essere duplicato
+	// Retained false, il messaggio non viene conservato dal broker
+	for i := 0; i < environment.MessagePublishAttempts; i++ {
+		token := hubClient.Publish(topic, 1, false, payload)
+		if !token.WaitTimeout(time.Duration(environment.MessagePublishTimeout) * time.Second) {
+			logger.Log.Warn("Timeout publishing sensor state event. Retry ", i+1)
+		} else if err = token.Error(); err != nil {
+			logger.Log.Error("Error publishing sensor state event: ", err.Error(), ". Retry ", i+1)
+		} else {
+			logger.Log.Debug("Sensor state event published successfully on topic: ", topic)
+			return nil
+		}
+	}
+	return errors.New("failed to publish sensor state event on topic " + topic)
+}
+
+// PublishSensorCommand consegna un comando al sensore sul topic SensorCommandTopic/<id sensore>/<id comando>.
+// Il messaggio viene conservato dal broker, così il sensore lo riceve anche se è temporaneamente disconnesso.
+func PublishSensorCommand(command types.SensorCommand) error {
+
+	// Non procedere se la connessione non è attiva.
+	if !sensorClient.IsConnected() {
+		return errors.New("MQTT client not connected")
+	}
+
+	payload, err := json.Marshal(command)
+	if err != nil {
+		return err
+	}
+
+	topic := environment.SensorCommandTopic + "/" + command.SensorID + "/" + command.ID
+
+	// QoS 2, cioè "exactly once", il messaggio viene consegnato una sola volta, senza duplicati
+	// Retained true, il messaggio viene conservato dal broker
+	for i := 0; i < environment.MessagePublishAttempts; i++ {
+		token := sensorClient.Publish(topic, 2, true, payload)
+		if !token.WaitTimeout(time.Duration(environment.MessagePublishTimeout) * time.Second) {
+			logger.Log.Warn("Timeout publishing sensor command. Retry ", i+1)
+		} else if err = token.Error(); err != nil {
+			logger.Log.Error("Error publishing sensor command: ", err.Error(), ". Retry ", i+1)
+		} else {
+			logger.Log.Debug("Sensor command published successfully on topic: ", topic)
+			return nil
+		}
+	}
+	return errors.New("failed to publish sensor command on topic " + topic)
+}
+
+// PublishCommandAck inoltra al Proximity Fog Hub la conferma di un comando sul topic HubCommandAckTopic/<id sensore>.
+func PublishCommandAck(ack types.CommandAck) error {
+
+	// Non procedere se la connessione non è attiva.
+	if !hubClient.IsConnected() {
+		return errors.New("MQTT client not connected")
+	}
+
+	payload, err := json.Marshal(ack)
+	if err != nil {
+		return err
+	}
+
+	topic := environment.HubCommandAckTopic + "/" + ack.SensorID
+
+	// QoS 1, cioè "at least once", il messaggio viene consegnato almeno una volta, può essere duplicato
+	// Retained false, il messaggio non viene conservato dal broker
+	for i := 0; i < environment.MessagePublishAttempts; i++ {
+		token := hubClient.Publish(topic, 1, false, payload)
+		if !token.WaitTimeout(time.Duration(environment.MessagePublishTimeout) * time.Second) {
+			logger.Log.Warn("Timeout publishing command ack. Retry ", i+1)
+		} else if err = token.Error(); err != nil {
+			logger.Log.Error("Error publishing command ack: ", err.Error(), ". Retry ", i+1)
+		} else {
+			logger.Log.Debug("Command ack published successfully on topic: ", topic)
+			return nil
+		}
+	}
+	return errors.New("failed to publish command ack on topic " + topic)
+}
+
+// CleanRetentionSensorCommand rimuove dal broker del Proximity Fog Hub un comando già preso in carico,
+// così non viene ricevuto di nuovo alla prossima riconnessione.
+func CleanRetentionSensorCommand(command types.SensorCommand) {
+
+	logger.Log.Debug("Cleaning retention for sensor command: ", command.ID)
+
+	// Non procedere se la connessione non è attiva.
+	if !hubClient.IsConnected() {
+		logger.Log.Warn("MQTT client not connected. Skipping data cleaning.")
+		// L'opzione AutoReconnect della libreria sta già lavorando per riconnettersi.
+		return
+	}
+
+	// Per pulire un comando, pubblichiamo un messaggio vuoto
+	// sullo stesso topic con retained=true. Questo indica al broker di rimuovere
+	// il messaggio precedente.
+	topic := environment.HubCommandTopic + "/" + command.SensorID + "/" + command.ID
+	token := hubClient.Publish(topic, 2, true, "")
+
+	if !token.WaitTimeout(time.Duration(environment.MessageCleaningTimeout) * time.Second) {
+		logger.Log.Error("Timeout cleaning message: ", topic)
+		return
+	}
+	err := token.Error()
+	if err != nil {
+		logger.Log.Error("Error cleaning message: ", err.Error())
+		return
+	}
+	logger.Log.Debug("Message cleaned successfully: ", topic)
 }
 
 // PublishConfigurationMessage pubblica i messaggi di configurazione al broker MQTT
@@ -407,6 +794,7 @@ func SendRegistrationMessage() {
 
 		// Crea il messaggio di configurazione
 		payload, err := json.Marshal(types.ConfigurationMsg{
+			SchemaVersion: types.ConfigurationMsgSchemaVersion,
 			EdgeMacrozone: environment.EdgeMacrozone,
 			MsgType:       types.NewEdgeMsgType,
 			Timestamp:     time.Now().UTC().Unix(),
@@ -450,6 +838,7 @@ func SendRegistrationMessage() {
 func SendHeartbeatMessage() {
 
 	msg := types.HeartbeatMsg{
+		SchemaVersion: types.HeartbeatMsgSchemaVersion,
 		EdgeMacrozone: environment.EdgeMacrozone,
 		EdgeZone:      environment.EdgeZone,
 		HubID:         environment.HubID,
@@ -0,0 +1,159 @@
+package comunication
+
+import (
+	"SensorContinuum/internal/edge-hub/environment"
+	"SensorContinuum/internal/edge-hub/storage"
+	"SensorContinuum/pkg/types"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"sync"
+	"time"
+)
+
+// SignatureFailure identifica il motivo per cui una lettura firmata non è stata accettata.
+type SignatureFailure string
+
+const (
+	// MissingSignatureFailure indica una lettura non firmata di un sensore che deve firmare le letture.
+	MissingSignatureFailure SignatureFailure = "missing"
+	// UnknownKeySignatureFailure indica una lettura di un sensore senza chiave pubblica registrata, con SensorSignatureMode required.
+	UnknownKeySignatureFailure SignatureFailure = "unknown_key"
+	// InvalidSignatureFailure indica una firma non valida per la chiave pubblica registrata.
+	InvalidSignatureFailure SignatureFailure = "invalid"
+	// ExpiredSignatureFailure indica una lettura firmata fuori dall'intervallo SignatureMaxAge.
+	ExpiredSignatureFailure SignatureFailure = "expired"
+	// ReplaySignatureFailure indica una lettura con un nonce già ricevuto, cioè una lettura ripetuta.
+	ReplaySignatureFailure SignatureFailure = "replay"
+)
+
+// signatureKey è la chiave pubblica di un sensore letta dalla cache Redis, nil se il sensore non ha una chiave.
+type signatureKey struct {
+	key      ed25519.PublicKey
+	loadedAt time.Time
+}
+
+// signatures contiene lo stato della verifica delle firme, condiviso dai message handler:
+// le chiavi pubbliche dei sensori e i contatori delle verifiche fallite per sensore e motivo.
+// I nonce ricevuti sono invece salvati in Redis, condivisi da tutte le istanze del servizio di filtraggio.
+var signatures = struct {
+	sync.Mutex
+	keys     map[string]signatureKey
+	failures map[string]map[SignatureFailure]uint64
+}{
+	keys:     make(map[string]signatureKey),
+	failures: make(map[string]map[SignatureFailure]uint64),
+}
+
+// verifySensorData verifica la firma di una lettura secondo SensorSignatureMode.
+// Le letture dei sensori con una chiave pubblica registrata devono essere firmate con quella chiave,
+// entro SignatureMaxAge dall'istante di ricezione e con un nonce non ancora ricevuto.
+// Le verifiche fallite vengono conteggiate per sensore e motivo.
+func verifySensorData(data types.SensorData) error {
+	if environment.SensorSignatureMode == environment.DisabledSignatureMode {
+		return nil
+	}
+
+	key, err := sensorPublicKey(data.SensorID)
+	if err != nil {
+		return errors.New("cannot load public key of sensor " + data.SensorID + ": " + err.Error())
+	}
+
+	if key == nil {
+		if environment.SensorSignatureMode == environment.RequiredSignatureMode {
+			return signatureFailure(data.SensorID, UnknownKeySignatureFailure, errors.New("sensor "+data.SensorID+" has no registered public key"))
+		}
+		return nil
+	}
+
+	if !data.Signed() {
+		return signatureFailure(data.SensorID, MissingSignatureFailure, errors.New("missing signature from sensor "+data.SensorID))
+	}
+	if err := data.VerifySignature(key); err != nil {
+		return signatureFailure(data.SensorID, InvalidSignatureFailure, errors.New(err.Error()+" from sensor "+data.SensorID))
+	}
+
+	now := time.Now().UTC()
+	signedAt := time.Unix(data.SignedAt, 0)
+	if signedAt.Before(now.Add(-environment.SignatureMaxAge)) || signedAt.After(now.Add(environment.SignatureMaxAge)) {
+		return signatureFailure(data.SensorID, ExpiredSignatureFailure, errors.New("signature from sensor "+data.SensorID+" is outside the accepted time window"))
+	}
+	fresh, err := recordNonce(data.SensorID, data.Nonce, signedAt, now)
+	if err != nil {
+		return errors.New("cannot record nonce of sensor " + data.SensorID + ": " + err.Error())
+	}
+	if !fresh {
+		return signatureFailure(data.SensorID, ReplaySignatureFailure, errors.New("replayed reading from sensor "+data.SensorID))
+	}
+	return nil
+}
+
+// sensorPublicKey restituisce la chiave pubblica di un sensore, nil se il sensore non è registrato o non ha una chiave.
+// La chiave viene letta dalla cache Redis e mantenuta in memoria per SignatureKeyCacheTTL.
+func sensorPublicKey(sensorID string) (ed25519.PublicKey, error) {
+	signatures.Lock()
+	cached, ok := signatures.keys[sensorID]
+	signatures.Unlock()
+	if ok && time.Since(cached.loadedAt) < environment.SignatureKeyCacheTTL {
+		return cached.key, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(environment.MessagePublishTimeout)*time.Second)
+	defer cancel()
+	sensor, _, err := storage.GetSensor(ctx, sensorID)
+	if err != nil {
+		return nil, err
+	}
+
+	var key ed25519.PublicKey
+	if sensor.PublicKey != "" {
+		if key, err = types.ParsePublicKey(sensor.PublicKey); err != nil {
+			return nil, err
+		}
+	}
+
+	signatures.Lock()
+	signatures.keys[sensorID] = signatureKey{key: key, loadedAt: time.Now()}
+	signatures.Unlock()
+	return key, nil
+}
+
+// recordNonce registra in Redis il nonce di una lettura firmata, finché la firma resta entro SignatureMaxAge:
+// una firma nel futuro resta valida fino a SignatureMaxAge dopo l'istante della firma, quindi oltre SignatureMaxAge dalla ricezione.
+// Restituisce false se il nonce era già stato ricevuto da una qualunque istanza.
+func recordNonce(sensorID string, nonce uint64, signedAt time.Time, now time.Time) (bool, error) {
+	ttl := signedAt.Add(environment.SignatureMaxAge).Sub(now) + time.Second
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(environment.MessagePublishTimeout)*time.Second)
+	defer cancel()
+	return storage.RecordSensorNonce(ctx, sensorID, nonce, ttl)
+}
+
+// signatureFailure conteggia una verifica fallita e restituisce l'errore corrispondente.
+func signatureFailure(sensorID string, failure SignatureFailure, err error) error {
+	signatures.Lock()
+	defer signatures.Unlock()
+
+	counters, ok := signatures.failures[sensorID]
+	if !ok {
+		counters = make(map[SignatureFailure]uint64)
+		signatures.failures[sensorID] = counters
+	}
+	counters[failure]++
+	return err
+}
+
+// GetSignatureFailures restituisce una copia dei contatori delle verifiche delle firme fallite, per sensore e motivo.
+func GetSignatureFailures() map[string]map[SignatureFailure]uint64 {
+	signatures.Lock()
+	defer signatures.Unlock()
+
+	failures := make(map[string]map[SignatureFailure]uint64, len(signatures.failures))
+	for sensorID, counters := range signatures.failures {
+		failures[sensorID] = make(map[SignatureFailure]uint64, len(counters))
+		for failure, count := range counters {
+			failures[sensorID][failure] = count
+		}
+	}
+	return failures
+}
@@ -0,0 +1,100 @@
+package dispatcher
+
+import (
+	"SensorContinuum/internal/edge-hub/comunication"
+	"SensorContinuum/internal/edge-hub/environment"
+	"SensorContinuum/internal/edge-hub/storage"
+	"SensorContinuum/pkg/logger"
+	"context"
+	"sync"
+	"time"
+)
+
+// dispatching impedisce che il ticker del dispatcher e l'invio dopo un'aggregazione processino l'outbox contemporaneamente.
+var dispatching sync.Mutex
+
+// Run avvia il processo del dispatcher dell'outbox.
+// Questa funzione viene eseguita in una goroutine separata e si occupa di:
+// 1. Controllare periodicamente l'outbox Redis per riepiloghi al minuto in attesa di invio.
+// 2. Inviare questi riepiloghi al Proximity Hub tramite MQTT.
+// 3. Rimuovere i riepiloghi dall'outbox solo dopo la conferma del broker.
+func Run(ctx context.Context) {
+
+	// Avvio del ticker per il polling periodico
+	outboxTicker := time.NewTicker(environment.OutboxPollInterval)
+	logger.Log.Info("Outbox ticker started, sending pending summaries every ", environment.OutboxPollInterval.String())
+	defer outboxTicker.Stop()
+
+	for {
+		select {
+		// Permette uno spegnimento pulito quando il contesto viene annullato
+		case <-ctx.Done():
+			logger.Log.Info("Stopping Outbox Dispatcher...")
+			return
+		case <-outboxTicker.C:
+			ProcessPendingSummaries(ctx)
+		}
+	}
+}
+
+// ProcessPendingSummaries invia al Proximity Hub i riepiloghi in attesa nell'outbox, a partire dal minuto più vecchio.
+// Solo il leader dell'aggregazione invia i riepiloghi, in modo che più istanze non inviino gli stessi riepiloghi.
+// Al primo invio fallito si ferma: i riepiloghi restano nell'outbox e vengono ritentati al ciclo successivo,
+// anche dopo un riavvio dell'hub.
+func ProcessPendingSummaries(ctx context.Context) {
+
+	if !dispatching.TryLock() {
+		logger.Log.Debug("Outbox dispatch already in progress, skipping this run.")
+		return
+	}
+	defer dispatching.Unlock()
+
+	// Prova a diventare il leader per il dispatching
+	isLeader, err := storage.TryOrRenewLeader(ctx)
+	if err != nil {
+		logger.Log.Error("Error acquiring leader lock: ", err)
+		return
+	} else if !isLeader {
+		logger.Log.Debug("Not the leader, skipping outbox dispatch")
+		return
+	}
+
+	nSummaries := environment.OutboxBatchSize
+	for nSummaries == environment.OutboxBatchSize {
+
+		// 1. Recupera i riepiloghi in attesa dall'outbox
+		summaries, err := storage.GetPendingSummaries(ctx, environment.OutboxBatchSize)
+		if err != nil {
+			logger.Log.Error("Error getting pending summaries from outbox: ", err)
+			return
+		}
+
+		if len(summaries) == 0 {
+			logger.Log.Debug("No pending summaries found in outbox.")
+			return
+		}
+
+		logger.Log.Info("Found ", len(summaries), " pending summaries to dispatch.")
+
+		for _, summary := range summaries {
+
+			// 2. Invia il riepilogo al Proximity Hub
+			if err := comunication.PublishFilteredData(summary.Summary); err != nil {
+				// Il riepilogo rimane nell'outbox e verrà ritentato al prossimo ciclo
+				logger.Log.Error("Failed to send pending summary ", summary.ID, ", will retry in next cycle: ", err)
+				return
+			}
+
+			// 3. Se l'invio ha successo, rimuove il riepilogo dall'outbox.
+			// Se la rimozione fallisce il riepilogo verrà inviato di nuovo: il Proximity Hub
+			// ignora i riepiloghi con una revisione già ricevuta.
+			if err := storage.MarkSummarySent(ctx, summary); err != nil {
+				logger.Log.Error("Failed to remove sent summary ", summary.ID, " from outbox: ", err)
+				return
+			}
+		}
+
+		logger.Log.Info("Successfully dispatched ", len(summaries), " pending summaries.")
+		nSummaries = len(summaries)
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"SensorContinuum/configs/timeouts"
 	"SensorContinuum/pkg/logger"
 	"SensorContinuum/pkg/types"
+	"SensorContinuum/pkg/utils"
 	"errors"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -36,6 +38,10 @@ var MqttSensorBrokerAddress string
 // MqttSensorBrokerPort specifica la porta del broker MQTT per la comunicazione tra SensorAgent ed EdgeHub.
 var MqttSensorBrokerPort string
 
+// MqttSecurity contiene le impostazioni TLS e le credenziali della connessione al broker MQTT.
+// Con un certificato client, il suo CN è l'identità dell'hub e deve coincidere con HubID.
+var MqttSecurity utils.MQTTSecurity
+
 // Queste impostazioni sono utilizzate per la connessione tra EdgeHub e Proximity Hub.
 
 // MqttHubBrokerProtocol specifica il protocollo (es. "tcp", "ws") tra EdgeHub e Proximity Hub.
@@ -53,6 +59,12 @@ var SensorDataTopic string
 // FilteredDataTopic specifica il topic MQTT per i dati filtrati.
 var FilteredDataTopic string
 
+// RejectedDataTopic specifica il topic MQTT per i dati scartati dal filtro.
+var RejectedDataTopic string
+
+// CriticalDataTopic specifica il topic MQTT della fast lane, per le letture che superano una soglia critica.
+var CriticalDataTopic string
+
 // HubConfigurationTopic specifica il topic MQTT per i messaggi di configurazione del hub.
 var HubConfigurationTopic string
 
@@ -62,6 +74,27 @@ var SensorConfigurationTopic string
 // HeartbeatTopic specifica il topic MQTT per i messaggi di heartbeat del hub.
 var HeartbeatTopic string
 
+// AlertTopic specifica il topic MQTT per le notifiche sullo stato dei sensori.
+var AlertTopic string
+
+// SensorStateTopic specifica il topic MQTT per gli eventi di transizione di stato dei sensori.
+var SensorStateTopic string
+
+// HubCommandTopic specifica il topic MQTT su cui il Proximity Fog Hub pubblica i comandi per i sensori della zona.
+var HubCommandTopic string
+
+// SensorCommandTopic specifica il topic MQTT su cui l'hub consegna i comandi ai sensori.
+var SensorCommandTopic string
+
+// SensorCommandAckTopic specifica il topic MQTT su cui l'hub riceve le conferme dei comandi dai sensori.
+var SensorCommandAckTopic string
+
+// SensorHeartbeatTopic specifica il topic MQTT su cui l'hub riceve i messaggi di heartbeat dei sensori.
+var SensorHeartbeatTopic string
+
+// HubCommandAckTopic specifica il topic MQTT su cui l'hub inoltra le conferme dei comandi al Proximity Fog Hub.
+var HubCommandAckTopic string
+
 // Queste impostazioni controllano il comportamento della riconnessione al broker MQTT.
 
 // MaxReconnectionInterval specifica l'intervallo massimo tra i tentativi di riconnessione in secondi.
@@ -97,18 +130,172 @@ const AggregationInterval = time.Minute
 // per recuperare i dati aggregati.
 const AggregationFetchOffset = -2 * time.Minute
 
+// AggregationAllowedLateness specifica per quanto tempo, dopo l'aggregazione di un minuto,
+// le letture in ritardo di quel minuto causano il ricalcolo e il reinvio del riepilogo come revisione.
+// Con valore 0 le letture in ritardo vengono ignorate dall'aggregazione.
+var AggregationAllowedLateness = 5 * time.Minute
+
+// OutboxPollInterval specifica ogni quanto il dispatcher controlla l'outbox dei riepiloghi in attesa di invio.
+// I riepiloghi vengono inviati anche subito dopo ogni aggregazione: il polling serve a ritentare gli invii falliti.
+const OutboxPollInterval = 10 * time.Second
+
+// OutboxBatchSize specifica quanti riepiloghi il dispatcher recupera dall'outbox ad ogni iterazione.
+const OutboxBatchSize = 50
+
+// CriticalEventPollInterval specifica ogni quanto il dispatcher delle letture critiche controlla la lista Redis
+// delle letture in attesa. Le letture vengono inviate anche subito dopo il rilevamento: il polling serve a ritentare gli invii falliti.
+const CriticalEventPollInterval = 10 * time.Second
+
+// CriticalEventBatchSize specifica quante letture critiche il dispatcher recupera da Redis ad ogni iterazione.
+const CriticalEventBatchSize = 50
+
+// SensorDataQueue è la configurazione della coda tra la ricezione MQTT delle letture e il filtro.
+// Con la policy di default, se il filtro non tiene il passo le nuove letture vengono scartate
+// per non rallentare la ricezione; con block la ricezione rallenta e le letture non vengono perse.
+var SensorDataQueue = utils.QueueConfig{Policy: utils.DropNewestQueuePolicy, Size: 200, SpillDir: "queue-spill"}
+
 const LeaderKey = "edge-hub-leader"
 const LeaderTTL = 70 * time.Second
 
 const HistoryWindowSize int = 100
+
+// HistoryMaxAge specifica l'età massima delle letture mantenute nella storia di un sensore,
+// rispetto alla lettura più recente. Le letture più vecchie vengono rimosse ad ogni inserimento.
+const HistoryMaxAge = time.Hour
+
+// RejectedWindowSize specifica il numero massimo di letture scartate mantenute in cache per ogni sensore.
+const RejectedWindowSize int = 100
+
+// RejectedCountTTL specifica per quanto tempo viene mantenuto il contatore delle letture scartate in un minuto.
+// Deve essere maggiore dell'offset di aggregazione, in modo che il contatore sia disponibile all'aggregatore.
+const RejectedCountTTL = 10 * time.Minute
+
+// RejectedReplayInterval specifica ogni quanto vengono inoltrate le letture scartate rimaste in Redis
+// perché il canale dei dati scartati era pieno.
+const RejectedReplayInterval = 10 * time.Second
+
+// PublishRetryMinDelay e PublishRetryMaxDelay delimitano l'attesa tra i cicli di pubblicazione di un messaggio
+// che non può essere scartato: l'attesa raddoppia ad ogni ciclo fallito, fino al massimo, finché la pubblicazione non riesce.
+const PublishRetryMinDelay = time.Second
+const PublishRetryMaxDelay = 30 * time.Second
 const FilteringMinSamples int = 5
 const FilteringStdDevFactor float64 = 3
 
+// DetectorType identifica l'algoritmo di rilevamento degli outlier.
+type DetectorType string
+
+const (
+	// ZScoreDetector scarta i valori oltre media ± FilteringStdDevFactor·σ.
+	ZScoreDetector DetectorType = "zscore"
+	// MADDetector (filtro di Hampel) scarta i valori oltre mediana ± FilteringMADFactor·MAD.
+	MADDetector DetectorType = "mad"
+	// IQRDetector scarta i valori oltre [Q1 - FilteringIQRFactor·IQR, Q3 + FilteringIQRFactor·IQR].
+	IQRDetector DetectorType = "iqr"
+	// EWMADetector scarta i valori oltre la media mobile esponenziale ± FilteringEWMAFactor·σ.
+	EWMADetector DetectorType = "ewma"
+)
+
+// FilteringDetector specifica l'algoritmo utilizzato dal filtro per il rilevamento degli outlier.
+var FilteringDetector DetectorType
+
+// FilteringProfilesFile specifica il percorso del file JSON con i profili di filtraggio
+// per tipo (ed eventualmente riferimento) di sensore. Se vuoto si usano i parametri di default.
+var FilteringProfilesFile string
+
+// FilteringMADScale è la costante che rende la MAD uno stimatore consistente
+// della deviazione standard per dati distribuiti normalmente.
+const FilteringMADScale float64 = 1.4826
+const FilteringMADFactor float64 = 3
+const FilteringIQRFactor float64 = 1.5
+
+// FilteringEWMAAlpha è il peso dato al campione più recente nella media mobile esponenziale.
+const FilteringEWMAAlpha float64 = 0.3
+const FilteringEWMAFactor float64 = 3
+
+// SignatureMode specifica come vengono verificate le firme delle letture dei sensori.
+type SignatureMode string
+
+const (
+	// DisabledSignatureMode non verifica le firme.
+	DisabledSignatureMode SignatureMode = "disabled"
+	// OptionalSignatureMode verifica le letture dei sensori registrati con una chiave pubblica, che devono essere firmate,
+	// e accetta senza verifica quelle degli altri sensori.
+	OptionalSignatureMode SignatureMode = "optional"
+	// RequiredSignatureMode scarta le letture che non possono essere verificate, cioè non firmate
+	// o di sensori registrati senza chiave pubblica.
+	RequiredSignatureMode SignatureMode = "required"
+)
+
+// SensorSignatureMode specifica come vengono verificate le firme delle letture dei sensori.
+var SensorSignatureMode = OptionalSignatureMode
+
+// SignatureMaxAge specifica lo scostamento massimo, nel passato o nel futuro, tra l'istante della firma di una lettura e quello di ricezione.
+// Le letture firmate fuori da questo intervallo vengono scartate; al suo interno, i nonce già ricevuti identificano le letture ripetute.
+var SignatureMaxAge = 2 * time.Minute
+
+// SignatureKeyCacheTTL specifica per quanto tempo la chiave pubblica di un sensore, o la sua assenza, resta in memoria
+// prima di essere letta di nuovo dalla cache Redis.
+const SignatureKeyCacheTTL = time.Minute
+
+// SensorReferenceCacheTTL specifica per quanto tempo il riferimento di un sensore, usato per selezionare il profilo di filtraggio,
+// resta in memoria prima di essere letto di nuovo dalla cache Redis.
+// Il servizio di filtraggio vede così, entro questo intervallo, le registrazioni gestite da un'altra istanza.
+const SensorReferenceCacheTTL = time.Minute
+
+// SilentSensorTimeout specifica dopo quanto tempo senza letture un sensore attivo passa nello stato silent.
+const SilentSensorTimeout = time.Minute
 const UnhealthySensorTimeout = timeouts.IsAliveSensorTimeout
 const RegistrationSensorTimeout = 6 * time.Hour
 
+// SilentSamplingIntervals specifica dopo quanti intervalli di campionamento senza letture, riportati negli heartbeat,
+// un sensore attivo passa nello stato silent, se il risultato è maggiore di SilentSensorTimeout.
+const SilentSamplingIntervals = 2
+
+// DecommissionedSensorStateTTL specifica per quanto tempo viene mantenuto in cache lo stato di un sensore dismesso,
+// in modo da rilevarne un'eventuale nuova registrazione o ripresa dell'invio di dati.
+const DecommissionedSensorStateTTL = 24 * time.Hour
+
 const HeartbeatInterval = timeouts.HeartbeatInterval
 
+// NotificationChannel identifica un canale di notifica per i manutentori.
+type NotificationChannel string
+
+const (
+	// SMTPNotificationChannel invia le notifiche via e-mail.
+	SMTPNotificationChannel NotificationChannel = "smtp"
+	// WebhookNotificationChannel invia le notifiche tramite una richiesta HTTP POST con payload JSON.
+	WebhookNotificationChannel NotificationChannel = "webhook"
+	// MQTTNotificationChannel pubblica le notifiche sul topic AlertTopic del broker MQTT degli hub.
+	MQTTNotificationChannel NotificationChannel = "mqtt"
+)
+
+// NotificationChannels specifica i canali su cui vengono inviate le notifiche sullo stato dei sensori.
+// Se vuoto, le notifiche vengono solo registrate nei log.
+var NotificationChannels []NotificationChannel
+
+// NotificationRateLimit specifica l'intervallo minimo tra due notifiche relative allo stesso sensore.
+var NotificationRateLimit = 10 * time.Minute
+
+// NotificationTimeout specifica il tempo massimo per l'invio di una notifica su un canale.
+const NotificationTimeout = 10 * time.Second
+
+// SMTPHost e SMTPPort specificano il server SMTP utilizzato per le notifiche via e-mail.
+var SMTPHost string
+var SMTPPort string
+
+// SMTPUsername e SMTPPassword specificano le credenziali del server SMTP. Se vuote, non viene usata l'autenticazione.
+var SMTPUsername string
+var SMTPPassword string
+
+// SMTPFrom specifica il mittente delle notifiche via e-mail.
+var SMTPFrom string
+
+// SMTPTo specifica i destinatari delle notifiche via e-mail.
+var SMTPTo []string
+
+// NotificationWebhookURL specifica l'URL a cui inviare le notifiche tramite webhook.
+var NotificationWebhookURL string
+
 var HealthzServer bool = false
 var HealthzServerPort string = ":"
 
@@ -155,6 +342,17 @@ func SetupEnvironment() error {
 		}
 	}
 
+	/* ----- MQTT SECURITY SETTINGS ----- */
+
+	MqttSecurity = utils.MQTTSecurity{
+		CAFile:   os.Getenv("MQTT_CA_FILE"),
+		CertFile: os.Getenv("MQTT_CERT_FILE"),
+		KeyFile:  os.Getenv("MQTT_KEY_FILE"),
+		Username: os.Getenv("MQTT_USERNAME"),
+		Password: os.Getenv("MQTT_PASSWORD"),
+		Token:    os.Getenv("MQTT_TOKEN"),
+	}
+
 	/* ----- ENVIRONMENT SETTINGS ----- */
 
 	EdgeMacrozone, exists = os.LookupEnv("EDGE_MACROZONE")
@@ -168,10 +366,19 @@ func SetupEnvironment() error {
 	}
 
 	HubID, exists = os.LookupEnv("HUB_ID")
+	hubIDConfigured := exists
 	if !exists {
 		HubID = uuid.New().String()
 	}
 
+	// Con un certificato client l'identità dell'hub è il CN del certificato:
+	// viene utilizzata come HubID se HUB_ID non è impostata, altrimenti deve coincidere con HubID
+	var err error
+	HubID, err = MqttSecurity.ResolveIdentity(HubID, hubIDConfigured)
+	if err != nil {
+		return errors.New("invalid value for HUB_ID: " + err.Error())
+	}
+
 	/* ----- MQTT BROKER SETTINGS ----- */
 
 	// La configurazione del broker MQTT è divisa in due parti:
@@ -222,11 +429,27 @@ func SetupEnvironment() error {
 		MqttHubBrokerPort = commonPort
 	}
 
+	// Le stesse impostazioni di sicurezza vengono utilizzate con entrambi i broker
+	for _, protocol := range []string{MqttSensorBrokerProtocol, MqttHubBrokerProtocol} {
+		if err := MqttSecurity.Validate(protocol); err != nil {
+			return errors.New("invalid MQTT security settings: " + err.Error())
+		}
+	}
+
 	SensorDataTopic = "$share/edge-hub_" + EdgeMacrozone + "_" + EdgeZone + "/sensor-data/" + EdgeMacrozone + "/" + EdgeZone
 	FilteredDataTopic = "filtered-data/" + EdgeMacrozone + "/" + EdgeZone
+	RejectedDataTopic = "rejected-data/" + EdgeMacrozone + "/" + EdgeZone
+	CriticalDataTopic = "critical-data/" + EdgeMacrozone + "/" + EdgeZone
 	HubConfigurationTopic = "configuration/hub/" + EdgeMacrozone + "/" + EdgeZone
 	SensorConfigurationTopic = "configuration/sensor/" + EdgeMacrozone + "/" + EdgeZone
 	HeartbeatTopic = "heartbeat/" + EdgeMacrozone + "/" + EdgeZone
+	AlertTopic = "alert/" + EdgeMacrozone + "/" + EdgeZone
+	SensorStateTopic = "sensor-state/" + EdgeMacrozone + "/" + EdgeZone
+	HubCommandTopic = "command/hub/" + EdgeMacrozone + "/" + EdgeZone
+	SensorCommandTopic = "command/sensor/" + EdgeMacrozone + "/" + EdgeZone
+	SensorCommandAckTopic = "$share/edge-hub_" + EdgeMacrozone + "_" + EdgeZone + "/command-ack/sensor/" + EdgeMacrozone + "/" + EdgeZone
+	HubCommandAckTopic = "command-ack/hub/" + EdgeMacrozone + "/" + EdgeZone
+	SensorHeartbeatTopic = "$share/edge-hub_" + EdgeMacrozone + "_" + EdgeZone + "/heartbeat/sensor/" + EdgeMacrozone + "/" + EdgeZone
 
 	var MaxReconnectionIntervalStr string
 	MaxReconnectionIntervalStr, exists = os.LookupEnv("MAX_RECONNECTION_INTERVAL")
@@ -298,6 +521,148 @@ func SetupEnvironment() error {
 		}
 	}
 
+	/* ----- FILTERING SETTINGS ----- */
+
+	FilteringDetectorStr, exists := os.LookupEnv("FILTERING_DETECTOR")
+	if !exists {
+		FilteringDetector = ZScoreDetector
+	} else {
+		switch FilteringDetectorStr {
+		case string(ZScoreDetector):
+			FilteringDetector = ZScoreDetector
+		case string(MADDetector):
+			FilteringDetector = MADDetector
+		case string(IQRDetector):
+			FilteringDetector = IQRDetector
+		case string(EWMADetector):
+			FilteringDetector = EWMADetector
+		default:
+			return errors.New("invalid value for FILTERING_DETECTOR: " + FilteringDetectorStr + ". Valid values are 'zscore', 'mad', 'iqr' or 'ewma'.")
+		}
+	}
+
+	FilteringProfilesFile, exists = os.LookupEnv("FILTERING_PROFILES_FILE")
+	if !exists {
+		FilteringProfilesFile = ""
+	}
+
+	/* ----- SIGNATURE SETTINGS ----- */
+
+	SensorSignatureModeStr, exists := os.LookupEnv("SENSOR_SIGNATURE_MODE")
+	if exists {
+		switch SensorSignatureModeStr {
+		case string(DisabledSignatureMode):
+			SensorSignatureMode = DisabledSignatureMode
+		case string(OptionalSignatureMode):
+			SensorSignatureMode = OptionalSignatureMode
+		case string(RequiredSignatureMode):
+			SensorSignatureMode = RequiredSignatureMode
+		default:
+			return errors.New("invalid value for SENSOR_SIGNATURE_MODE: " + SensorSignatureModeStr + ". Valid values are 'disabled', 'optional' or 'required'.")
+		}
+	}
+
+	SignatureMaxAgeStr, exists := os.LookupEnv("SIGNATURE_MAX_AGE")
+	if exists {
+		seconds, err := strconv.Atoi(SignatureMaxAgeStr)
+		if err != nil || seconds <= 0 {
+			return errors.New("invalid value for SIGNATURE_MAX_AGE: " + SignatureMaxAgeStr + ". Must be a positive integer (seconds)")
+		}
+		SignatureMaxAge = time.Duration(seconds) * time.Second
+	}
+
+	/* ----- QUEUE SETTINGS ----- */
+
+	if err := utils.LoadQueueConfigFromEnv("SENSOR_DATA", &SensorDataQueue); err != nil {
+		return err
+	}
+
+	/* ----- AGGREGATION SETTINGS ----- */
+
+	AggregationAllowedLatenessStr, exists := os.LookupEnv("AGGREGATION_ALLOWED_LATENESS")
+	if exists {
+		minutes, err := strconv.Atoi(AggregationAllowedLatenessStr)
+		if err != nil || minutes < 0 {
+			return errors.New("invalid value for AGGREGATION_ALLOWED_LATENESS: " + AggregationAllowedLatenessStr + ". Must be a non-negative integer (minutes)")
+		}
+		AggregationAllowedLateness = time.Duration(minutes) * time.Minute
+	}
+
+	/* ----- NOTIFICATION SETTINGS ----- */
+
+	NotificationChannels = nil
+	NotificationChannelsStr, exists := os.LookupEnv("NOTIFICATION_CHANNELS")
+	if exists && NotificationChannelsStr != "" {
+		for _, channel := range strings.Split(NotificationChannelsStr, ",") {
+			switch NotificationChannel(strings.TrimSpace(channel)) {
+			case SMTPNotificationChannel:
+				NotificationChannels = append(NotificationChannels, SMTPNotificationChannel)
+			case WebhookNotificationChannel:
+				NotificationChannels = append(NotificationChannels, WebhookNotificationChannel)
+			case MQTTNotificationChannel:
+				NotificationChannels = append(NotificationChannels, MQTTNotificationChannel)
+			default:
+				return errors.New("invalid value for NOTIFICATION_CHANNELS: " + channel + ". Valid values are 'smtp', 'webhook' or 'mqtt'.")
+			}
+		}
+	}
+
+	NotificationRateLimitStr, exists := os.LookupEnv("NOTIFICATION_RATE_LIMIT")
+	if exists {
+		minutes, err := strconv.Atoi(NotificationRateLimitStr)
+		if err != nil || minutes < 0 {
+			return errors.New("invalid value for NOTIFICATION_RATE_LIMIT: " + NotificationRateLimitStr + ". Must be a non-negative integer (minutes)")
+		}
+		NotificationRateLimit = time.Duration(minutes) * time.Minute
+	}
+
+	SMTPHost, exists = os.LookupEnv("SMTP_HOST")
+	if !exists {
+		SMTPHost = "localhost"
+	}
+
+	SMTPPort, exists = os.LookupEnv("SMTP_PORT")
+	if !exists {
+		SMTPPort = "25"
+	}
+
+	SMTPUsername, exists = os.LookupEnv("SMTP_USERNAME")
+	if !exists {
+		SMTPUsername = ""
+	}
+
+	SMTPPassword, exists = os.LookupEnv("SMTP_PASSWORD")
+	if !exists {
+		SMTPPassword = ""
+	}
+
+	SMTPFrom, exists = os.LookupEnv("SMTP_FROM")
+	if !exists {
+		SMTPFrom = "edge-hub@sensor-continuum.local"
+	}
+
+	SMTPTo = nil
+	SMTPToStr, exists := os.LookupEnv("SMTP_TO")
+	if exists && SMTPToStr != "" {
+		for _, to := range strings.Split(SMTPToStr, ",") {
+			SMTPTo = append(SMTPTo, strings.TrimSpace(to))
+		}
+	}
+
+	NotificationWebhookURL, exists = os.LookupEnv("NOTIFICATION_WEBHOOK_URL")
+	if !exists {
+		NotificationWebhookURL = ""
+	}
+
+	for _, channel := range NotificationChannels {
+		if channel == SMTPNotificationChannel && len(SMTPTo) == 0 {
+			return errors.New("environment variable SMTP_TO not set, required by the 'smtp' notification channel")
+		}
+		if channel == WebhookNotificationChannel && NotificationWebhookURL == "" {
+			return errors.New("environment variable NOTIFICATION_WEBHOOK_URL not set, required by the 'webhook' notification channel")
+		}
+	}
+
 	/* ----- REDIS CACHE SETTINGS ----- */
 
 	RedisAddress, exists = os.LookupEnv("REDIS_ADDRESS")
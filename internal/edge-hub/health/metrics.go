@@ -0,0 +1,64 @@
+package health
+
+import (
+	"SensorContinuum/internal/edge-hub/comunication"
+	"SensorContinuum/internal/edge-hub/storage"
+	"SensorContinuum/pkg/logger"
+	"SensorContinuum/pkg/utils"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// MetricsHandler espone, nel formato testuale di Prometheus, i contatori delle verifiche delle firme fallite,
+// per sensore e motivo, il numero di riepiloghi in attesa nell'outbox e di letture critiche in attesa di pubblicazione
+// e le metriche delle code interne.
+func MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	failures := comunication.GetSignatureFailures()
+
+	var b strings.Builder
+
+	// L'outbox è disponibile solo nei servizi connessi a Redis
+	if storage.RedisClient != nil {
+		pending, err := storage.CountPendingSummaries(r.Context())
+		if err != nil {
+			logger.Log.Error("Failed to count pending summaries: ", err)
+		} else {
+			fmt.Fprintf(&b, "# TYPE edge_hub_outbox_pending_summaries gauge\nedge_hub_outbox_pending_summaries %d\n", pending)
+		}
+		critical, err := storage.CountPendingCriticalEvents(r.Context())
+		if err != nil {
+			logger.Log.Error("Failed to count pending critical events: ", err)
+		} else {
+			fmt.Fprintf(&b, "# TYPE edge_hub_critical_pending_events gauge\nedge_hub_critical_pending_events %d\n", critical)
+		}
+	}
+
+	b.WriteString("# TYPE edge_hub_signature_failures_total counter\n")
+	sensorIDs := make([]string, 0, len(failures))
+	for sensorID := range failures {
+		sensorIDs = append(sensorIDs, sensorID)
+	}
+	sort.Strings(sensorIDs)
+	for _, sensorID := range sensorIDs {
+		reasons := make([]string, 0, len(failures[sensorID]))
+		for reason := range failures[sensorID] {
+			reasons = append(reasons, string(reason))
+		}
+		sort.Strings(reasons)
+		for _, reason := range reasons {
+			fmt.Fprintf(&b, "edge_hub_signature_failures_total{sensor_id=%q,reason=%q} %d\n",
+				sensorID, reason, failures[sensorID][comunication.SignatureFailure(reason)])
+		}
+	}
+
+	if err := utils.WriteQueueMetrics(&b, "edge_hub"); err != nil {
+		logger.Log.Error("Failed to write queue metrics: ", err)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if _, err := w.Write([]byte(b.String())); err != nil {
+		logger.Log.Error("Failed to write response:", err.Error())
+	}
+}
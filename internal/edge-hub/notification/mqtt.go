@@ -0,0 +1,24 @@
+package notification
+
+import (
+	"SensorContinuum/internal/edge-hub/comunication"
+	"SensorContinuum/internal/edge-hub/environment"
+	"SensorContinuum/pkg/types"
+	"context"
+)
+
+// MQTTNotifier pubblica le notifiche sul topic AlertTopic/<id sensore> del broker MQTT degli hub.
+type MQTTNotifier struct{}
+
+// NewMQTTNotifier crea un MQTTNotifier, che usa la connessione MQTT già stabilita dall'hub.
+func NewMQTTNotifier() *MQTTNotifier {
+	return &MQTTNotifier{}
+}
+
+func (n *MQTTNotifier) Name() string {
+	return string(environment.MQTTNotificationChannel)
+}
+
+func (n *MQTTNotifier) Notify(_ context.Context, notification types.SensorNotification) error {
+	return comunication.PublishSensorNotification(notification)
+}
@@ -0,0 +1,145 @@
+package notification
+
+import (
+	"SensorContinuum/internal/edge-hub/environment"
+	"SensorContinuum/internal/edge-hub/storage"
+	"SensorContinuum/pkg/logger"
+	"SensorContinuum/pkg/types"
+	"context"
+	"fmt"
+	"time"
+)
+
+// Notifier rappresenta un canale su cui inviare le notifiche sullo stato dei sensori ai manutentori.
+type Notifier interface {
+	// Name restituisce il nome del canale, usato nei log.
+	Name() string
+	// Notify invia la notifica sul canale.
+	Notify(ctx context.Context, notification types.SensorNotification) error
+}
+
+// notifiers contiene i canali di notifica configurati tramite NOTIFICATION_CHANNELS.
+var notifiers []Notifier
+
+// SetupNotifiers inizializza i canali di notifica configurati.
+func SetupNotifiers() {
+	notifiers = nil
+	for _, channel := range environment.NotificationChannels {
+		switch channel {
+		case environment.SMTPNotificationChannel:
+			notifiers = append(notifiers, NewSMTPNotifier())
+		case environment.WebhookNotificationChannel:
+			notifiers = append(notifiers, NewWebhookNotifier())
+		case environment.MQTTNotificationChannel:
+			notifiers = append(notifiers, NewMQTTNotifier())
+		}
+	}
+	logger.Log.Info("Notification channels configured: ", len(notifiers))
+}
+
+// NotifySensor invia la notifica per un sensore su tutti i canali configurati.
+// La notifica non viene inviata se è uguale all'ultima inviata per lo stesso sensore
+// o se non è trascorso NotificationRateLimit dalla notifica precedente: in questo caso
+// verrà inviata al successivo controllo del cleaner. La notifica di rimozione non ha un controllo successivo,
+// perché il sensore non è più in cache, quindi non è soggetta al limite di frequenza.
+func NotifySensor(ctx context.Context, sensorID string, notificationType types.NotificationType) {
+	last, err := storage.GetLastNotification(ctx, sensorID)
+	if err != nil {
+		logger.Log.Error("Error getting last notification from Redis for sensor ", sensorID, ": ", err)
+		return
+	}
+	if last == notificationType {
+		logger.Log.Debug("Sensor ", sensorID, " already notified as ", notificationType, ", skipping notification")
+		return
+	}
+
+	if !isTerminal(notificationType) {
+		allowed, err := storage.TryAcquireNotificationSlot(ctx, sensorID)
+		if err != nil {
+			logger.Log.Error("Error checking notification rate limit for sensor ", sensorID, ": ", err)
+			return
+		}
+		if !allowed {
+			logger.Log.Info("Notification rate limit reached for sensor ", sensorID, ", ", notificationType, " notification postponed")
+			return
+		}
+	}
+
+	notification := types.SensorNotification{
+		Type:          notificationType,
+		EdgeMacrozone: environment.EdgeMacrozone,
+		EdgeZone:      environment.EdgeZone,
+		HubID:         environment.HubID,
+		SensorID:      sensorID,
+		Timestamp:     time.Now().UTC().Unix(),
+	}
+	logger.Log.Warn("Notifying ", notificationType, " sensor: ", sensorID)
+
+	// La notifica è considerata inviata se almeno un canale l'ha consegnata
+	delivered := len(notifiers) == 0
+	for _, notifier := range notifiers {
+		notifyCtx, cancel := context.WithTimeout(ctx, environment.NotificationTimeout)
+		err := notifier.Notify(notifyCtx, notification)
+		cancel()
+		if err != nil {
+			logger.Log.Error("Error sending ", notificationType, " notification for sensor ", sensorID, " via ", notifier.Name(), ": ", err)
+			continue
+		}
+		logger.Log.Debug("Notification for sensor ", sensorID, " sent via ", notifier.Name())
+		delivered = true
+	}
+	if !delivered {
+		return
+	}
+
+	if notificationType == types.RecoveredSensorNotification {
+		err = storage.ClearLastNotification(ctx, sensorID)
+	} else {
+		err = storage.SetLastNotification(ctx, sensorID, notificationType)
+	}
+	if err != nil {
+		logger.Log.Error("Error saving last notification to Redis for sensor ", sensorID, ": ", err)
+	}
+}
+
+// isTerminal indica se una notifica viene generata una sola volta, senza che l'evento si ripresenti.
+func isTerminal(notificationType types.NotificationType) bool {
+	return notificationType == types.RemovedSensorNotification
+}
+
+// NotifyIfRecovered invia la notifica di ripristino se il sensore era stato segnalato come unhealthy o rimosso.
+func NotifyIfRecovered(ctx context.Context, sensorID string) {
+	last, err := storage.GetLastNotification(ctx, sensorID)
+	if err != nil {
+		logger.Log.Error("Error getting last notification from Redis for sensor ", sensorID, ": ", err)
+		return
+	}
+	if last != types.UnhealthySensorNotification && last != types.RemovedSensorNotification {
+		return
+	}
+	NotifySensor(ctx, sensorID, types.RecoveredSensorNotification)
+}
+
+// subject restituisce l'oggetto testuale di una notifica.
+func subject(notification types.SensorNotification) string {
+	return fmt.Sprintf("[SensorContinuum] Sensor %s %s (%s/%s)",
+		notification.SensorID, notification.Type, notification.EdgeMacrozone, notification.EdgeZone)
+}
+
+// body restituisce il testo di una notifica.
+func body(notification types.SensorNotification) string {
+	var description string
+	switch notification.Type {
+	case types.UnhealthySensorNotification:
+		description = "has not sent data for too long and has been marked as unhealthy"
+	case types.RemovedSensorNotification:
+		description = "has been inactive for too long and has been removed from the edge hub cache"
+	case types.RecoveredSensorNotification:
+		description = "is sending data again"
+	default:
+		description = "changed state: " + string(notification.Type)
+	}
+	return fmt.Sprintf("Sensor %s in macrozone %s, zone %s %s.\nEdge hub: %s\nTime: %s\n",
+		notification.SensorID, notification.EdgeMacrozone, notification.EdgeZone, description,
+		notification.HubID, time.Unix(notification.Timestamp, 0).UTC().Format(time.RFC3339))
+}
@@ -0,0 +1,207 @@
+package notification
+
+import (
+	"SensorContinuum/pkg/types"
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testNotification() types.SensorNotification {
+	return types.SensorNotification{
+		Type:          types.UnhealthySensorNotification,
+		EdgeMacrozone: "build-0001",
+		EdgeZone:      "floor-001",
+		HubID:         "edge-hub-1",
+		SensorID:      "sensor-1",
+		Timestamp:     time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC).Unix(),
+	}
+}
+
+// smtpSession contiene i comandi e il messaggio ricevuti dal server SMTP fittizio.
+type smtpSession struct {
+	from string
+	to   []string
+	data string
+}
+
+// startFakeSMTPServer avvia un server SMTP minimale su una porta locale, senza STARTTLS né autenticazione.
+// La sessione ricevuta viene inviata sul canale restituito alla chiusura della connessione.
+func startFakeSMTPServer(t *testing.T) (string, string, <-chan smtpSession) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	sessions := make(chan smtpSession, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var session smtpSession
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost ESMTP fake")
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			command := strings.ToUpper(line)
+			switch {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(command, "MAIL FROM:"):
+				session.from = strings.Trim(line[len("MAIL FROM:"):], "<>")
+				reply("250 OK")
+			case strings.HasPrefix(command, "RCPT TO:"):
+				session.to = append(session.to, strings.Trim(line[len("RCPT TO:"):], "<>"))
+				reply("250 OK")
+			case command == "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				var data strings.Builder
+				for {
+					dataLine, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if dataLine == ".\r\n" {
+						break
+					}
+					data.WriteString(dataLine)
+				}
+				session.data = data.String()
+				reply("250 OK")
+			case command == "QUIT":
+				reply("221 Bye")
+				sessions <- session
+				return
+			default:
+				reply("502 Command not implemented")
+			}
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	return host, port, sessions
+}
+
+func TestSMTPNotifierSendsMail(t *testing.T) {
+	host, port, sessions := startFakeSMTPServer(t)
+	notifier := &SMTPNotifier{
+		Host: host,
+		Port: port,
+		From: "hub@sensor-continuum.local",
+		To:   []string{"ops@sensor-continuum.local", "oncall@sensor-continuum.local"},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := notifier.Notify(ctx, testNotification()); err != nil {
+		t.Fatalf("Notify returned error: %v", err)
+	}
+
+	select {
+	case session := <-sessions:
+		if session.from != notifier.From {
+			t.Errorf("MAIL FROM = %q, want %q", session.from, notifier.From)
+		}
+		if strings.Join(session.to, ",") != strings.Join(notifier.To, ",") {
+			t.Errorf("RCPT TO = %v, want %v", session.to, notifier.To)
+		}
+		if !strings.Contains(session.data, "Subject: [SensorContinuum] Sensor sensor-1 unhealthy (build-0001/floor-001)") {
+			t.Errorf("message does not contain the expected subject:\n%s", session.data)
+		}
+		if !strings.Contains(session.data, "has been marked as unhealthy") {
+			t.Errorf("message does not contain the notification body:\n%s", session.data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("fake SMTP server did not receive the message")
+	}
+}
+
+func TestSMTPNotifierUnreachableServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	_ = listener.Close()
+
+	notifier := &SMTPNotifier{Host: host, Port: port, From: "hub@sensor-continuum.local", To: []string{"ops@sensor-continuum.local"}}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := notifier.Notify(ctx, testNotification()); err == nil {
+		t.Fatal("Notify succeeded without a server")
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{name: "ok", status: http.StatusOK},
+		{name: "no content", status: http.StatusNoContent},
+		{name: "server error", status: http.StatusInternalServerError, wantErr: true},
+		{name: "bad request", status: http.StatusBadRequest, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received webhookPayload
+			var contentType string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contentType = r.Header.Get("Content-Type")
+				if r.Method != http.MethodPost {
+					t.Errorf("method = %s, want POST", r.Method)
+				}
+				if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+					t.Errorf("invalid webhook payload: %v", err)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			notifier := &WebhookNotifier{URL: server.URL, Client: server.Client()}
+			err := notifier.Notify(context.Background(), testNotification())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Notify error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if contentType != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", contentType)
+			}
+			if received.SensorID != "sensor-1" || received.Type != types.UnhealthySensorNotification {
+				t.Errorf("unexpected payload: %+v", received)
+			}
+			if received.Subject != subject(testNotification()) || received.Text != body(testNotification()) {
+				t.Errorf("payload subject or text do not match the notification: %+v", received)
+			}
+		})
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	if !isTerminal(types.RemovedSensorNotification) {
+		t.Error("removed notification must bypass the rate limit")
+	}
+	for _, notificationType := range []types.NotificationType{types.UnhealthySensorNotification, types.RecoveredSensorNotification} {
+		if isTerminal(notificationType) {
+			t.Errorf("%s notification must be rate limited", notificationType)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package notification
+
+import (
+	"SensorContinuum/internal/edge-hub/environment"
+	"SensorContinuum/pkg/types"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPNotifier invia le notifiche via e-mail tramite un server SMTP.
+// Se il server lo supporta, la connessione viene cifrata con STARTTLS.
+type SMTPNotifier struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// NewSMTPNotifier crea un SMTPNotifier a partire dalla configurazione dell'ambiente.
+func NewSMTPNotifier() *SMTPNotifier {
+	return &SMTPNotifier{
+		Host:     environment.SMTPHost,
+		Port:     environment.SMTPPort,
+		Username: environment.SMTPUsername,
+		Password: environment.SMTPPassword,
+		From:     environment.SMTPFrom,
+		To:       environment.SMTPTo,
+	}
+}
+
+func (n *SMTPNotifier) Name() string {
+	return string(environment.SMTPNotificationChannel)
+}
+
+func (n *SMTPNotifier) Notify(ctx context.Context, notification types.SensorNotification) error {
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(n.Host, n.Port))
+	if err != nil {
+		return err
+	}
+	// La scadenza del contesto limita l'intera conversazione con il server
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, n.Host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: n.Host}); err != nil {
+			return err
+		}
+	}
+	if n.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.Username, n.Password, n.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(n.From); err != nil {
+		return err
+	}
+	for _, to := range n.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(n.message(notification)); err != nil {
+		_ = writer.Close()
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// message costruisce il messaggio e-mail (header e corpo) della notifica.
+func (n *SMTPNotifier) message(notification types.SensorNotification) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", n.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(n.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", subject(notification))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().UTC().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(body(notification), "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -0,0 +1,64 @@
+package notification
+
+import (
+	"SensorContinuum/internal/edge-hub/environment"
+	"SensorContinuum/pkg/types"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// WebhookNotifier invia le notifiche tramite una richiesta HTTP POST con payload JSON.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// webhookPayload è il corpo JSON inviato al webhook: la notifica, con oggetto e testo già formattati.
+type webhookPayload struct {
+	types.SensorNotification
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+}
+
+// NewWebhookNotifier crea un WebhookNotifier a partire dalla configurazione dell'ambiente.
+func NewWebhookNotifier() *WebhookNotifier {
+	return &WebhookNotifier{
+		URL:    environment.NotificationWebhookURL,
+		Client: &http.Client{Timeout: environment.NotificationTimeout},
+	}
+}
+
+func (n *WebhookNotifier) Name() string {
+	return string(environment.WebhookNotificationChannel)
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, notification types.SensorNotification) error {
+	payload, err := json.Marshal(webhookPayload{
+		SensorNotification: notification,
+		Subject:            subject(notification),
+		Text:               body(notification),
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %s", resp.Status)
+	}
+	return nil
+}
@@ -2,26 +2,49 @@ package aggregation
 
 import (
 	"SensorContinuum/pkg/types"
+	"math"
 	"time"
 )
 
-// AverageInMinute calcola la media dei valori del minuto corrente.
-func AverageInMinute(readings []types.SensorData, minute time.Time) float64 {
-	if len(readings) == 0 {
-		return 0
-	}
-	var sum float64
-	var count int
+// SummarizeMinute calcola le statistiche (min, max, media, deviazione standard, prima e ultima lettura)
+// delle letture del minuto specificato. Le letture fuori dal minuto vengono ignorate.
+// Restituisce un riepilogo con Count pari a 0 se non ci sono letture nel minuto.
+func SummarizeMinute(readings []types.SensorData, minute time.Time) types.SensorMinuteSummary {
+	var summary types.SensorMinuteSummary
+	minuteStart := minute.Truncate(time.Minute).Unix()
+	minuteEnd := minuteStart + int64(time.Minute.Seconds())
+
+	var sum, sumSquares float64
+	var firstTime, lastTime int64
 	for _, d := range readings {
-		t := time.Unix(d.Timestamp, 0).UTC()
-		if t.Year() == minute.Year() && t.Month() == minute.Month() && t.Day() == minute.Day() &&
-			t.Hour() == minute.Hour() && t.Minute() == minute.Minute() {
-			sum += d.Data
-			count++
+		if d.Timestamp < minuteStart || d.Timestamp >= minuteEnd {
+			continue
+		}
+		if summary.Count == 0 {
+			summary.Min = d.Data
+			summary.Max = d.Data
+			summary.First, firstTime = d.Data, d.Timestamp
+			summary.Last, lastTime = d.Data, d.Timestamp
 		}
+		summary.Min = math.Min(summary.Min, d.Data)
+		summary.Max = math.Max(summary.Max, d.Data)
+		if d.Timestamp < firstTime {
+			summary.First, firstTime = d.Data, d.Timestamp
+		}
+		if d.Timestamp >= lastTime {
+			summary.Last, lastTime = d.Data, d.Timestamp
+		}
+		sum += d.Data
+		sumSquares += d.Data * d.Data
+		summary.Count++
 	}
-	if count == 0 {
-		return 0
+	if summary.Count == 0 {
+		return summary
 	}
-	return sum / float64(count)
+
+	n := float64(summary.Count)
+	summary.Mean = sum / n
+	// Deviazione standard della popolazione, limitata a 0 per gli errori di arrotondamento
+	summary.StdDev = math.Sqrt(math.Max(sumSquares/n-summary.Mean*summary.Mean, 0))
+	return summary
 }
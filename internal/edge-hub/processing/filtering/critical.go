@@ -0,0 +1,66 @@
+package filtering
+
+import (
+	"SensorContinuum/pkg/types"
+	"errors"
+)
+
+// CriticalRule è una soglia oltre la quale una lettura è critica e viene inoltrata nella fast lane,
+// senza attendere l'aggregazione e anche se il rilevamento degli outlier la considera anomala.
+// Una regola può definire una soglia superiore (Above), inferiore (Below) o entrambe.
+type CriticalRule struct {
+	Above    *float64            `json:"above,omitempty"`
+	Below    *float64            `json:"below,omitempty"`
+	Severity types.EventSeverity `json:"severity,omitempty"`
+}
+
+// validate controlla la regola e imposta la gravità di default.
+func (r *CriticalRule) validate() error {
+	if r.Above == nil && r.Below == nil {
+		return errors.New("critical rule must set above or below")
+	}
+	if r.Severity == "" {
+		r.Severity = types.CriticalSeverity
+	}
+	if r.Severity.Rank() == 0 {
+		return errors.New("invalid critical rule severity: " + string(r.Severity))
+	}
+	return nil
+}
+
+// match controlla se il valore supera una soglia della regola, restituendo la condizione e la soglia superate.
+func (r CriticalRule) match(value float64) (types.ThresholdCondition, float64, bool) {
+	if r.Above != nil && value > *r.Above {
+		return types.AboveThreshold, *r.Above, true
+	}
+	if r.Below != nil && value < *r.Below {
+		return types.BelowThreshold, *r.Below, true
+	}
+	return "", 0, false
+}
+
+// MatchCriticalRules controlla la lettura con le regole critiche del profilo.
+// Se più regole sono soddisfatte, l'evento restituito è quello della regola più grave.
+func (p Profile) MatchCriticalRules(data types.SensorData) (types.CriticalEvent, bool) {
+	var event types.CriticalEvent
+	found := false
+	for _, rule := range p.CriticalRules {
+		condition, threshold, ok := rule.match(data.Data)
+		if !ok || (found && rule.Severity.Rank() <= event.Severity.Rank()) {
+			continue
+		}
+		event = types.CriticalEvent{
+			EdgeMacrozone: data.EdgeMacrozone,
+			EdgeZone:      data.EdgeZone,
+			SensorID:      data.SensorID,
+			Timestamp:     data.Timestamp,
+			Type:          data.Type,
+			Data:          data.Data,
+			Severity:      rule.Severity,
+			Condition:     condition,
+			Threshold:     threshold,
+		}
+		found = true
+	}
+	return event, found
+}
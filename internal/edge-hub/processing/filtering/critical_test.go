@@ -0,0 +1,83 @@
+package filtering
+
+import (
+	"SensorContinuum/pkg/types"
+	"testing"
+)
+
+func threshold(value float64) *float64 {
+	return &value
+}
+
+func TestMatchCriticalRules(t *testing.T) {
+	profile := Profile{CriticalRules: []CriticalRule{
+		{Above: threshold(40), Severity: types.CriticalSeverity},
+		{Above: threshold(60), Severity: types.EmergencySeverity},
+		{Below: threshold(5), Severity: types.CriticalSeverity},
+		{Below: threshold(-10), Severity: types.EmergencySeverity},
+		{Above: threshold(50), Below: threshold(0), Severity: types.CriticalSeverity},
+	}}
+
+	tests := []struct {
+		name          string
+		value         float64
+		wantMatch     bool
+		wantSeverity  types.EventSeverity
+		wantCondition types.ThresholdCondition
+		wantThreshold float64
+	}{
+		{name: "normal value", value: 20},
+		{name: "on the above threshold", value: 40},
+		{name: "on the below threshold", value: 5},
+		{name: "above", value: 45, wantMatch: true, wantSeverity: types.CriticalSeverity, wantCondition: types.AboveThreshold, wantThreshold: 40},
+		{name: "below", value: 3, wantMatch: true, wantSeverity: types.CriticalSeverity, wantCondition: types.BelowThreshold, wantThreshold: 5},
+		// Con più regole soddisfatte vince la più grave, anche se è definita dopo
+		{name: "above emergency", value: 70, wantMatch: true, wantSeverity: types.EmergencySeverity, wantCondition: types.AboveThreshold, wantThreshold: 60},
+		{name: "below emergency", value: -20, wantMatch: true, wantSeverity: types.EmergencySeverity, wantCondition: types.BelowThreshold, wantThreshold: -10},
+		// A parità di gravità resta la prima regola soddisfatta
+		{name: "same severity", value: 55, wantMatch: true, wantSeverity: types.CriticalSeverity, wantCondition: types.AboveThreshold, wantThreshold: 40},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := types.SensorData{EdgeMacrozone: "build-0001", EdgeZone: "floor-001", SensorID: "sensor-1", Timestamp: 1000, Type: "temperature", Data: tt.value}
+			event, ok := profile.MatchCriticalRules(data)
+			if ok != tt.wantMatch {
+				t.Fatalf("MatchCriticalRules(%v) match = %v, want %v", tt.value, ok, tt.wantMatch)
+			}
+			if !ok {
+				return
+			}
+			if event.Severity != tt.wantSeverity || event.Condition != tt.wantCondition || event.Threshold != tt.wantThreshold {
+				t.Fatalf("MatchCriticalRules(%v) = %s %s %v, want %s %s %v", tt.value, event.Severity, event.Condition, event.Threshold, tt.wantSeverity, tt.wantCondition, tt.wantThreshold)
+			}
+			if event.SensorID != data.SensorID || event.EdgeMacrozone != data.EdgeMacrozone || event.EdgeZone != data.EdgeZone ||
+				event.Timestamp != data.Timestamp || event.Type != data.Type || event.Data != data.Data {
+				t.Fatalf("MatchCriticalRules(%v) = %+v, does not match the reading %+v", tt.value, event, data)
+			}
+		})
+	}
+
+	if _, ok := (Profile{}).MatchCriticalRules(types.SensorData{Data: 1000}); ok {
+		t.Error("MatchCriticalRules matched a profile without critical rules")
+	}
+}
+
+func TestCriticalRuleValidate(t *testing.T) {
+	rule := CriticalRule{Above: threshold(40)}
+	if err := rule.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if rule.Severity != types.CriticalSeverity {
+		t.Errorf("default severity = %s, want %s", rule.Severity, types.CriticalSeverity)
+	}
+
+	for _, rule := range []CriticalRule{
+		{Severity: types.CriticalSeverity},
+		{Below: threshold(0), Severity: "warning"},
+	} {
+		if err := rule.validate(); err == nil {
+			t.Errorf("validate accepted %+v", rule)
+		}
+	}
+}
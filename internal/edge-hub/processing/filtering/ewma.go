@@ -0,0 +1,62 @@
+package filtering
+
+import (
+	"SensorContinuum/internal/edge-hub/environment"
+	"SensorContinuum/pkg/logger"
+	"SensorContinuum/pkg/types"
+	"math"
+)
+
+// EWMADetector considera outlier i valori che si discostano dalla media mobile esponenziale
+// di più di Factor deviazioni standard (anch'esse pesate esponenzialmente).
+// Dando più peso ai campioni recenti, segue meglio i trend lenti (es. il cambio d'ora)
+// rispetto a una media calcolata su tutta la finestra.
+type EWMADetector struct {
+	MinSamples int
+	// Alpha è il peso dato al campione più recente.
+	Alpha  float64
+	Factor float64
+}
+
+// Evaluate controlla se un dato è un outlier basandosi sulla storia recente.
+func (d EWMADetector) Evaluate(data types.SensorData, historyReadings []types.SensorData) Result {
+
+	if !hasEnoughSamples(data, historyReadings, d.MinSamples) {
+		return Result{Detector: environment.EWMADetector, Samples: len(historyReadings)}
+	}
+
+	// 1. Calcola media e varianza esponenziali partendo dalla lettura più vecchia
+	alpha := d.Alpha
+	last := len(historyReadings) - 1
+	mean := historyReadings[last].Data
+	variance := 0.0
+	for i := last - 1; i >= 0; i-- {
+		diff := historyReadings[i].Data - mean
+		incr := alpha * diff
+		mean += incr
+		variance = (1 - alpha) * (variance + diff*incr)
+	}
+	stdDev := math.Sqrt(variance)
+
+	// 2. Calcola i limiti di accettazione
+	lowerBound := mean - d.Factor*stdDev
+	upperBound := mean + d.Factor*stdDev
+
+	logger.Log.Debug("Outlier check (EWMA) for sensor ", data.SensorID)
+	logger.Log.Debug(" - Current value: ", data.Data)
+	logger.Log.Debug(" - EWMA: ", mean)
+	logger.Log.Debug(" - EWM StdDev: ", stdDev, " => ", d.Factor, " * StdDev = ", d.Factor*stdDev)
+	logger.Log.Debug(" - LowerBound: ", lowerBound)
+	logger.Log.Debug(" - UpperBound: ", upperBound)
+
+	// 3. Controlla se il nuovo dato è fuori dai limiti
+	return Result{
+		Outlier:    data.Data < lowerBound || data.Data > upperBound,
+		Detector:   environment.EWMADetector,
+		LowerBound: lowerBound,
+		UpperBound: upperBound,
+		Center:     mean,
+		Spread:     stdDev,
+		Samples:    len(historyReadings),
+	}
+}
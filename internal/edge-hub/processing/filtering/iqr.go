@@ -0,0 +1,50 @@
+package filtering
+
+import (
+	"SensorContinuum/internal/edge-hub/environment"
+	"SensorContinuum/pkg/logger"
+	"SensorContinuum/pkg/types"
+)
+
+// IQRDetector considera outlier i valori esterni all'intervallo
+// [Q1 - Factor·IQR, Q3 + Factor·IQR] calcolato sulla storia recente.
+type IQRDetector struct {
+	MinSamples int
+	Factor     float64
+}
+
+// Evaluate controlla se un dato è un outlier basandosi sulla storia recente.
+func (d IQRDetector) Evaluate(data types.SensorData, historyReadings []types.SensorData) Result {
+
+	if !hasEnoughSamples(data, historyReadings, d.MinSamples) {
+		return Result{Detector: environment.IQRDetector, Samples: len(historyReadings)}
+	}
+
+	// 1. Calcola primo e terzo quartile
+	values := sortedValues(historyReadings)
+	q1 := quantile(values, 0.25)
+	q3 := quantile(values, 0.75)
+	median := quantile(values, 0.5)
+	iqr := q3 - q1
+
+	// 2. Calcola i limiti di accettazione
+	lowerBound := q1 - d.Factor*iqr
+	upperBound := q3 + d.Factor*iqr
+
+	logger.Log.Debug("Outlier check (IQR) for sensor ", data.SensorID)
+	logger.Log.Debug(" - Current value: ", data.Data)
+	logger.Log.Debug(" - Q1: ", q1, ", Q3: ", q3, ", IQR: ", iqr)
+	logger.Log.Debug(" - LowerBound: ", lowerBound)
+	logger.Log.Debug(" - UpperBound: ", upperBound)
+
+	// 3. Controlla se il nuovo dato è fuori dai limiti
+	return Result{
+		Outlier:    data.Data < lowerBound || data.Data > upperBound,
+		Detector:   environment.IQRDetector,
+		LowerBound: lowerBound,
+		UpperBound: upperBound,
+		Center:     median,
+		Spread:     iqr,
+		Samples:    len(historyReadings),
+	}
+}
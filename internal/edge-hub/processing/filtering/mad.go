@@ -0,0 +1,59 @@
+package filtering
+
+import (
+	"SensorContinuum/internal/edge-hub/environment"
+	"SensorContinuum/pkg/logger"
+	"SensorContinuum/pkg/types"
+	"math"
+	"sort"
+)
+
+// MADDetector implementa il filtro di Hampel: considera outlier i valori che si discostano
+// dalla mediana della storia recente di più di Factor volte la MAD scalata.
+// Mediana e MAD sono robuste agli outlier già presenti nella finestra, a differenza di media e σ.
+type MADDetector struct {
+	MinSamples int
+	Factor     float64
+}
+
+// Evaluate controlla se un dato è un outlier basandosi sulla storia recente.
+func (d MADDetector) Evaluate(data types.SensorData, historyReadings []types.SensorData) Result {
+
+	if !hasEnoughSamples(data, historyReadings, d.MinSamples) {
+		return Result{Detector: environment.MADDetector, Samples: len(historyReadings)}
+	}
+
+	// 1. Calcola la mediana della storia
+	values := sortedValues(historyReadings)
+	median := quantile(values, 0.5)
+
+	// 2. Calcola la mediana delle deviazioni assolute dalla mediana (MAD)
+	deviations := make([]float64, len(values))
+	for i, v := range values {
+		deviations[i] = math.Abs(v - median)
+	}
+	sort.Float64s(deviations)
+	mad := environment.FilteringMADScale * quantile(deviations, 0.5)
+
+	// 3. Calcola i limiti di accettazione
+	lowerBound := median - d.Factor*mad
+	upperBound := median + d.Factor*mad
+
+	logger.Log.Debug("Outlier check (MAD) for sensor ", data.SensorID)
+	logger.Log.Debug(" - Current value: ", data.Data)
+	logger.Log.Debug(" - Median: ", median)
+	logger.Log.Debug(" - MAD: ", mad, " => ", d.Factor, " * MAD = ", d.Factor*mad)
+	logger.Log.Debug(" - LowerBound: ", lowerBound)
+	logger.Log.Debug(" - UpperBound: ", upperBound)
+
+	// 4. Controlla se il nuovo dato è fuori dai limiti
+	return Result{
+		Outlier:    data.Data < lowerBound || data.Data > upperBound,
+		Detector:   environment.MADDetector,
+		LowerBound: lowerBound,
+		UpperBound: upperBound,
+		Center:     median,
+		Spread:     mad,
+		Samples:    len(historyReadings),
+	}
+}
@@ -4,48 +4,77 @@ import (
 	"SensorContinuum/internal/edge-hub/environment"
 	"SensorContinuum/pkg/logger"
 	"SensorContinuum/pkg/types"
-	"math"
+	"sort"
 )
 
-// IsOutlier controlla se un dato è un outlier basandosi sulla storia recente.
-func IsOutlier(data types.SensorData, historyReadings []types.SensorData) bool {
+// Detector rappresenta un algoritmo di rilevamento degli outlier.
+// La storia recente è ordinata dalla lettura più recente alla più vecchia,
+// così come viene restituita dalla cache Redis.
+type Detector interface {
+	Evaluate(data types.SensorData, historyReadings []types.SensorData) Result
+}
+
+// Result contiene l'esito della valutazione di un detector,
+// con i limiti e le statistiche utilizzati per la decisione.
+type Result struct {
+	Outlier  bool
+	Detector environment.DetectorType
+	// LowerBound e UpperBound sono i limiti di accettazione calcolati sulla storia recente.
+	LowerBound float64
+	UpperBound float64
+	// Center è il valore centrale della storia (media, mediana o media esponenziale).
+	Center float64
+	// Spread è la dispersione della storia (deviazione standard, MAD o IQR).
+	Spread float64
+	// Samples è il numero di campioni storici utilizzati.
+	Samples int
+}
 
-	// Se non abbiamo abbastanza dati, non possiamo fare un calcolo significativo.
-	if len(historyReadings) < environment.FilteringMinSamples {
+// NewDetector restituisce il detector specificato dal profilo, configurato con i suoi parametri.
+// Se il tipo non è riconosciuto viene utilizzato il detector z-score.
+func NewDetector(p Profile) Detector {
+	switch p.Detector {
+	case environment.MADDetector:
+		return MADDetector{MinSamples: p.MinSamples, Factor: p.MADFactor}
+	case environment.IQRDetector:
+		return IQRDetector{MinSamples: p.MinSamples, Factor: p.IQRFactor}
+	case environment.EWMADetector:
+		return EWMADetector{MinSamples: p.MinSamples, Alpha: p.EWMAAlpha, Factor: p.EWMAFactor}
+	default:
+		return ZScoreDetector{MinSamples: p.MinSamples, Factor: p.StdDevFactor}
+	}
+}
+
+// hasEnoughSamples controlla se la storia contiene abbastanza campioni per un calcolo significativo.
+func hasEnoughSamples(data types.SensorData, historyReadings []types.SensorData, minSamples int) bool {
+	if len(historyReadings) < minSamples {
 		logger.Log.Info("Not enough data to calculate outliers for sensor ", data.SensorID, ". Current count:", len(historyReadings))
 		return false
 	}
+	return true
+}
 
-	// 1. Calcola la somma e la somma dei quadrati per media e varianza
-	var sum, sumSq float64
+// sortedValues restituisce i valori della storia ordinati in modo crescente.
+func sortedValues(historyReadings []types.SensorData) []float64 {
+	values := make([]float64, 0, len(historyReadings))
 	for _, reading := range historyReadings {
-		sum += reading.Data
-		sumSq += reading.Data * reading.Data
+		values = append(values, reading.Data)
 	}
-	n := float64(len(historyReadings))
+	sort.Float64s(values)
+	return values
+}
 
-	// 2. Calcola media e deviazione standard
-	mean := sum / n
-	// Varianza = E[X^2] - (E[X])^2
-	variance := (sumSq / n) - (mean * mean)
-	// Se la varianza è negativa (possibile per errori di floating point), la consideriamo zero.
-	if variance < 0 {
-		variance = 0
+// quantile calcola il quantile q di un insieme di valori già ordinati,
+// interpolando linearmente tra i due campioni più vicini.
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
 	}
-	stdDev := math.Sqrt(variance)
-
-	// 3. Calcola i limiti di accettazione
-	lowerBound := mean - environment.FilteringStdDevFactor*stdDev
-	upperBound := mean + environment.FilteringStdDevFactor*stdDev
-
-	logger.Log.Debug("Outlier check for sensor ", data.SensorID)
-	logger.Log.Debug(" - Courrent value: ", data.Data)
-	logger.Log.Debug(" - Mean: ", mean)
-	logger.Log.Debug(" - StdDev: ", stdDev, " => ", environment.FilteringStdDevFactor, " * StdDev = ", environment.FilteringStdDevFactor*stdDev)
-	logger.Log.Debug(" - LowerBound: ", lowerBound)
-	logger.Log.Debug(" - UpperBound: ", upperBound)
-
-	// 4. Controlla se il nuovo dato è fuori dai limiti
-	return data.Data < lowerBound || data.Data > upperBound
-
+	pos := q * float64(len(sorted)-1)
+	lower := int(pos)
+	if lower+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	frac := pos - float64(lower)
+	return sorted[lower] + frac*(sorted[lower+1]-sorted[lower])
 }
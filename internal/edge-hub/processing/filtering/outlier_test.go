@@ -0,0 +1,132 @@
+package filtering
+
+import (
+	"SensorContinuum/configs/simulation"
+	"SensorContinuum/internal/edge-hub/environment"
+	"SensorContinuum/pkg/types"
+	"math/rand"
+	"testing"
+)
+
+// simulatedReading genera una lettura con lo stesso modello del simulatore del Sensor Agent:
+// un valore normale attorno alla media e, con probabilità OUTLIER_PROBABILITY,
+// uno scostamento moltiplicato per OUTLIER_MULTIPLIER.
+func simulatedReading(rng *rand.Rand, mean, std float64) (float64, bool) {
+	tmp := rng.NormFloat64() * std
+	outlier := false
+	if rng.Float64() < simulation.OUTLIER_PROBABILITY {
+		tmp *= simulation.OUTLIER_MULTIPLIER
+		tmp += simulation.OUTLIER_ADDITION
+		outlier = true
+	}
+	return tmp + mean, outlier
+}
+
+// replay fa passare n letture simulate dal detector, mantenendo la storia come l'Edge Hub:
+// dalla lettura più recente alla più vecchia, al più windowSize letture, senza gli outlier scartati.
+// Restituisce la frazione di outlier rilevati e la frazione di letture valide scartate.
+func replay(detector Detector, seed int64, n, windowSize int) (float64, float64) {
+	rng := rand.New(rand.NewSource(seed))
+	history := make([]types.SensorData, 0, windowSize)
+
+	var outliers, detected, valid, falsePositives int
+	for i := 0; i < n; i++ {
+		value, outlier := simulatedReading(rng, 20, 1.5)
+		data := types.SensorData{SensorID: "sensor-1", Type: "temperature", Timestamp: int64(i), Data: value}
+
+		result := detector.Evaluate(data, history)
+		// Le prime letture servono solo a riempire la storia
+		if len(history) >= windowSize {
+			if outlier {
+				outliers++
+				if result.Outlier {
+					detected++
+				}
+			} else {
+				valid++
+				if result.Outlier {
+					falsePositives++
+				}
+			}
+		}
+		if result.Outlier {
+			continue
+		}
+
+		history = append([]types.SensorData{data}, history...)
+		if len(history) > windowSize {
+			history = history[:windowSize]
+		}
+	}
+	return float64(detected) / float64(outliers), float64(falsePositives) / float64(valid)
+}
+
+func TestDetectorsOnSimulatedOutliers(t *testing.T) {
+	tests := []struct {
+		name             string
+		detector         Detector
+		minDetectionRate float64
+		maxFalsePositive float64
+	}{
+		{
+			name:             string(environment.ZScoreDetector),
+			detector:         ZScoreDetector{MinSamples: environment.FilteringMinSamples, Factor: environment.FilteringStdDevFactor},
+			minDetectionRate: 0.80,
+			maxFalsePositive: 0.02,
+		},
+		{
+			name:             string(environment.MADDetector),
+			detector:         MADDetector{MinSamples: environment.FilteringMinSamples, Factor: environment.FilteringMADFactor},
+			minDetectionRate: 0.80,
+			maxFalsePositive: 0.02,
+		},
+		{
+			name:             string(environment.IQRDetector),
+			detector:         IQRDetector{MinSamples: environment.FilteringMinSamples, Factor: environment.FilteringIQRFactor},
+			minDetectionRate: 0.80,
+			maxFalsePositive: 0.03,
+		},
+		{
+			name:             string(environment.EWMADetector),
+			detector:         EWMADetector{MinSamples: environment.FilteringMinSamples, Alpha: environment.FilteringEWMAAlpha, Factor: environment.FilteringEWMAFactor},
+			minDetectionRate: 0.80,
+			// Con alpha 0.3 la varianza esponenziale pesa pochi campioni ed è instabile:
+			// il detector scarta circa il 10% delle letture valide
+			maxFalsePositive: 0.12,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			detectionRate, falsePositiveRate := replay(tt.detector, 42, 20000, environment.HistoryWindowSize)
+			t.Logf("detection rate %.4f, false positive rate %.4f", detectionRate, falsePositiveRate)
+			if detectionRate < tt.minDetectionRate {
+				t.Errorf("detection rate %.4f below %.2f", detectionRate, tt.minDetectionRate)
+			}
+			if falsePositiveRate > tt.maxFalsePositive {
+				t.Errorf("false positive rate %.4f above %.2f", falsePositiveRate, tt.maxFalsePositive)
+			}
+		})
+	}
+}
+
+func TestDetectorsNeedMinSamples(t *testing.T) {
+	history := []types.SensorData{{Data: 20}, {Data: 21}}
+	data := types.SensorData{SensorID: "sensor-1", Data: 1000}
+
+	detectors := []Detector{
+		ZScoreDetector{MinSamples: 5, Factor: 3},
+		MADDetector{MinSamples: 5, Factor: 3},
+		IQRDetector{MinSamples: 5, Factor: 1.5},
+		EWMADetector{MinSamples: 5, Alpha: 0.3, Factor: 3},
+	}
+	for _, detector := range detectors {
+		result := detector.Evaluate(data, history)
+		if result.Outlier {
+			t.Errorf("%T flagged an outlier with only %d samples", detector, len(history))
+		}
+		if result.Samples != len(history) {
+			t.Errorf("%T reported %d samples, want %d", detector, result.Samples, len(history))
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package filtering
+
+import (
+	"SensorContinuum/internal/edge-hub/environment"
+	"SensorContinuum/pkg/logger"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Profile contiene i parametri di filtraggio per una tipologia di sensore.
+// Un profilo è identificato dal tipo di sensore (es. "temperature") e,
+// opzionalmente, dal sensore di riferimento (es. "dht22").
+// I parametri non specificati assumono i valori di default dell'ambiente.
+type Profile struct {
+	Type      string `json:"type"`
+	Reference string `json:"reference,omitempty"`
+
+	// WindowSize è il numero di campioni storici mantenuti in cache per il sensore.
+	WindowSize int `json:"window_size,omitempty"`
+	// MinSamples è il numero minimo di campioni necessari per il rilevamento degli outlier.
+	MinSamples int `json:"min_samples,omitempty"`
+
+	Detector     environment.DetectorType `json:"detector,omitempty"`
+	StdDevFactor float64                  `json:"std_dev_factor,omitempty"`
+	MADFactor    float64                  `json:"mad_factor,omitempty"`
+	IQRFactor    float64                  `json:"iqr_factor,omitempty"`
+	EWMAAlpha    float64                  `json:"ewma_alpha,omitempty"`
+	EWMAFactor   float64                  `json:"ewma_factor,omitempty"`
+
+	// MinValue e MaxValue sono i limiti fisici del valore misurato.
+	// I valori esterni a questi limiti vengono scartati prima di qualsiasi analisi statistica.
+	MinValue *float64 `json:"min_value,omitempty"`
+	MaxValue *float64 `json:"max_value,omitempty"`
+
+	// CriticalRules sono le soglie oltre le quali una lettura fisicamente valida è critica.
+	CriticalRules []CriticalRule `json:"critical_rules,omitempty"`
+
+	detector Detector
+}
+
+// profileFile rappresenta il contenuto del file dei profili.
+type profileFile struct {
+	Profiles []Profile `json:"profiles"`
+}
+
+// defaultProfile è il profilo utilizzato per i sensori che non hanno un profilo dedicato.
+var defaultProfile = newDefaultProfile()
+
+// profiles contiene i profili caricati, indicizzati per tipo e riferimento.
+var profiles = map[string]Profile{}
+
+func newDefaultProfile() Profile {
+	p := Profile{}
+	p.applyDefaults()
+	return p
+}
+
+// applyDefaults completa i parametri non specificati con i valori di default
+// e istanzia il detector corrispondente.
+func (p *Profile) applyDefaults() {
+	if p.WindowSize <= 0 {
+		p.WindowSize = environment.HistoryWindowSize
+	}
+	if p.MinSamples <= 0 {
+		p.MinSamples = environment.FilteringMinSamples
+	}
+	if p.Detector == "" {
+		p.Detector = environment.FilteringDetector
+	}
+	if p.StdDevFactor <= 0 {
+		p.StdDevFactor = environment.FilteringStdDevFactor
+	}
+	if p.MADFactor <= 0 {
+		p.MADFactor = environment.FilteringMADFactor
+	}
+	if p.IQRFactor <= 0 {
+		p.IQRFactor = environment.FilteringIQRFactor
+	}
+	if p.EWMAAlpha <= 0 || p.EWMAAlpha > 1 {
+		p.EWMAAlpha = environment.FilteringEWMAAlpha
+	}
+	if p.EWMAFactor <= 0 {
+		p.EWMAFactor = environment.FilteringEWMAFactor
+	}
+	p.detector = NewDetector(*p)
+}
+
+// GetDetector restituisce il detector configurato per il profilo.
+func (p Profile) GetDetector() Detector {
+	if p.detector == nil {
+		return NewDetector(p)
+	}
+	return p.detector
+}
+
+// IsPhysicallyValid controlla che il valore rientri nei limiti fisici del profilo.
+func (p Profile) IsPhysicallyValid(value float64) bool {
+	if p.MinValue != nil && value < *p.MinValue {
+		return false
+	}
+	if p.MaxValue != nil && value > *p.MaxValue {
+		return false
+	}
+	return true
+}
+
+func profileKey(sensorType, reference string) string {
+	if reference == "" {
+		return sensorType
+	}
+	return sensorType + "/" + reference
+}
+
+// LoadProfiles carica i profili di filtraggio dal file JSON specificato.
+// Se il percorso è vuoto vengono utilizzati solo i parametri di default.
+func LoadProfiles(path string) error {
+
+	defaultProfile = newDefaultProfile()
+	profiles = map[string]Profile{}
+
+	if path == "" {
+		logger.Log.Info("No filtering profiles file provided, using default profile")
+		return nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read filtering profiles file: %w", err)
+	}
+
+	var file profileFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return fmt.Errorf("failed to parse filtering profiles file: %w", err)
+	}
+
+	for _, p := range file.Profiles {
+		if p.Type == "" {
+			return errors.New("invalid filtering profile: type must be set")
+		}
+		switch p.Detector {
+		case "", environment.ZScoreDetector, environment.MADDetector, environment.IQRDetector, environment.EWMADetector:
+		default:
+			return errors.New("invalid detector for filtering profile " + profileKey(p.Type, p.Reference) + ": " + string(p.Detector))
+		}
+		if p.MinValue != nil && p.MaxValue != nil && *p.MinValue > *p.MaxValue {
+			return errors.New("invalid filtering profile " + profileKey(p.Type, p.Reference) + ": min_value greater than max_value")
+		}
+		for i := range p.CriticalRules {
+			if err := p.CriticalRules[i].validate(); err != nil {
+				return errors.New("invalid filtering profile " + profileKey(p.Type, p.Reference) + ": " + err.Error())
+			}
+		}
+		p.applyDefaults()
+		profiles[profileKey(p.Type, p.Reference)] = p
+		logger.Log.Info("Loaded filtering profile ", profileKey(p.Type, p.Reference), " (detector: ", p.Detector, ", window: ", p.WindowSize, ")")
+	}
+
+	return nil
+}
+
+// GetProfile restituisce il profilo più specifico per il tipo e il riferimento del sensore:
+// prima quello per tipo e riferimento, poi quello per il solo tipo, infine quello di default.
+func GetProfile(sensorType, reference string) Profile {
+	if reference != "" {
+		if p, ok := profiles[profileKey(sensorType, reference)]; ok {
+			return p
+		}
+	}
+	if p, ok := profiles[profileKey(sensorType, "")]; ok {
+		return p
+	}
+	return defaultProfile
+}
@@ -0,0 +1,65 @@
+package filtering
+
+import (
+	"SensorContinuum/internal/edge-hub/environment"
+	"SensorContinuum/pkg/logger"
+	"SensorContinuum/pkg/types"
+	"math"
+)
+
+// ZScoreDetector considera outlier i valori che si discostano dalla media
+// della storia recente di più di Factor deviazioni standard.
+type ZScoreDetector struct {
+	MinSamples int
+	Factor     float64
+}
+
+// Evaluate controlla se un dato è un outlier basandosi sulla storia recente.
+func (d ZScoreDetector) Evaluate(data types.SensorData, historyReadings []types.SensorData) Result {
+
+	// Se non abbiamo abbastanza dati, non possiamo fare un calcolo significativo.
+	if !hasEnoughSamples(data, historyReadings, d.MinSamples) {
+		return Result{Detector: environment.ZScoreDetector, Samples: len(historyReadings)}
+	}
+
+	// 1. Calcola la somma e la somma dei quadrati per media e varianza
+	var sum, sumSq float64
+	for _, reading := range historyReadings {
+		sum += reading.Data
+		sumSq += reading.Data * reading.Data
+	}
+	n := float64(len(historyReadings))
+
+	// 2. Calcola media e deviazione standard
+	mean := sum / n
+	// Varianza = E[X^2] - (E[X])^2
+	variance := (sumSq / n) - (mean * mean)
+	// Se la varianza è negativa (possibile per errori di floating point), la consideriamo zero.
+	if variance < 0 {
+		variance = 0
+	}
+	stdDev := math.Sqrt(variance)
+
+	// 3. Calcola i limiti di accettazione
+	lowerBound := mean - d.Factor*stdDev
+	upperBound := mean + d.Factor*stdDev
+
+	logger.Log.Debug("Outlier check for sensor ", data.SensorID)
+	logger.Log.Debug(" - Courrent value: ", data.Data)
+	logger.Log.Debug(" - Mean: ", mean)
+	logger.Log.Debug(" - StdDev: ", stdDev, " => ", d.Factor, " * StdDev = ", d.Factor*stdDev)
+	logger.Log.Debug(" - LowerBound: ", lowerBound)
+	logger.Log.Debug(" - UpperBound: ", upperBound)
+
+	// 4. Controlla se il nuovo dato è fuori dai limiti
+	return Result{
+		Outlier:    data.Data < lowerBound || data.Data > upperBound,
+		Detector:   environment.ZScoreDetector,
+		LowerBound: lowerBound,
+		UpperBound: upperBound,
+		Center:     mean,
+		Spread:     stdDev,
+		Samples:    len(historyReadings),
+	}
+
+}
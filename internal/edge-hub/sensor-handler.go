@@ -3,52 +3,369 @@ package edge_hub
 import (
 	"SensorContinuum/internal/edge-hub/comunication"
 	"SensorContinuum/internal/edge-hub/environment"
+	"SensorContinuum/internal/edge-hub/notification"
 	"SensorContinuum/internal/edge-hub/processing/aggregation"
 	"SensorContinuum/internal/edge-hub/processing/filtering"
 	"SensorContinuum/internal/edge-hub/storage"
 	"SensorContinuum/pkg/logger"
 	"SensorContinuum/pkg/types"
 	"context"
+	"sync"
 	"time"
 )
 
+// sensorReference è il riferimento di un sensore mantenuto in memoria, con l'istante in cui è stato letto da Redis.
+type sensorReference struct {
+	reference string
+	loadedAt  time.Time
+}
+
+// sensorReferences è la cache locale dei riferimenti dei sensori, usata per selezionare il profilo di filtraggio
+// senza dover interrogare Redis per ogni lettura. Ogni riferimento, o la sua assenza per i sensori non registrati,
+// resta in memoria per SensorReferenceCacheTTL; la registrazione e la dismissione di un sensore lo invalidano subito.
+var sensorReferences = struct {
+	sync.Mutex
+	entries  map[string]sensorReference
+	prunedAt time.Time
+}{
+	entries: make(map[string]sensorReference),
+}
+
+// getSensorReference restituisce il riferimento del sensore, vuoto se il sensore non è registrato o non ne ha uno.
+// Ad ogni intervallo SensorReferenceCacheTTL vengono rimossi i riferimenti scaduti, compresi quelli dei sensori dismessi.
+func getSensorReference(ctx context.Context, sensorID string) string {
+	now := time.Now()
+	sensorReferences.Lock()
+	if now.Sub(sensorReferences.prunedAt) >= environment.SensorReferenceCacheTTL {
+		for id, cached := range sensorReferences.entries {
+			if now.Sub(cached.loadedAt) >= environment.SensorReferenceCacheTTL {
+				delete(sensorReferences.entries, id)
+			}
+		}
+		sensorReferences.prunedAt = now
+	}
+	cached, ok := sensorReferences.entries[sensorID]
+	sensorReferences.Unlock()
+	if ok && now.Sub(cached.loadedAt) < environment.SensorReferenceCacheTTL {
+		return cached.reference
+	}
+
+	sensor, _, err := storage.GetSensor(ctx, sensorID)
+	if err != nil {
+		logger.Log.Error("Error getting sensor metadata from Redis: ", err)
+		return cached.reference
+	}
+
+	sensorReferences.Lock()
+	sensorReferences.entries[sensorID] = sensorReference{reference: sensor.Reference, loadedAt: now}
+	sensorReferences.Unlock()
+	return sensor.Reference
+}
+
+// invalidateSensorReference rimuove il riferimento del sensore dalla cache locale,
+// in modo che la lettura successiva utilizzi il profilo corrispondente alla registrazione più recente.
+func invalidateSensorReference(sensorID string) {
+	sensorReferences.Lock()
+	delete(sensorReferences.entries, sensorID)
+	sensorReferences.Unlock()
+}
+
 // FilterSensorData orchestra il filtraggio dei dati dei sensori.
-func FilterSensorData(sensorDataChannel chan types.SensorData) {
+// I dati scartati vengono salvati in cache e inviati sul canale rejectedDataChannel,
+// in modo che le decisioni del filtro possano essere verificate ai livelli superiori.
+// Le letture che superano una soglia critica del profilo vengono salvate in Redis e segnalate sul canale criticalEventSignal,
+// senza attendere la pubblicazione.
+func FilterSensorData(sensorDataChannel <-chan types.SensorData, rejectedDataChannel chan types.RejectedSensorData, criticalEventSignal chan struct{}) {
 	storage.InitRedisConnection()
 	ctx := context.Background()
 
+	// I sensori con letture scartate in attesa prima di un riavvio mantengono l'ordine di inoltro
+	if sensorIDs, err := storage.GetPendingRejectedSensors(ctx); err != nil {
+		logger.Log.Error("Error getting sensors with pending rejected data from Redis: ", err)
+	} else {
+		rejectedBacklog.Lock()
+		for _, sensorID := range sensorIDs {
+			rejectedBacklog.sensors[sensorID] = true
+		}
+		rejectedBacklog.Unlock()
+	}
+
 	for data := range sensorDataChannel {
 		logger.Log.Info("Processing data for sensor ", data.SensorID, " - value: ", data.Data, ", timestamp: ", data.Timestamp)
 
-		// 1. Recupera la storia dal Redis
-		readings, err := storage.GetSensorHistory(ctx, data.SensorID, environment.HistoryWindowSize)
+		// Aggiorna l'ultima lettura del sensore, riportandolo nello stato active se necessario
+		if prev, transitioned, err := storage.TouchSensorState(ctx, data.SensorID, data.Timestamp); err != nil {
+			logger.Log.Error("Error updating sensor state in Redis: ", err)
+		} else if transitioned {
+			logger.Log.Info("Sensor ", data.SensorID, " transitioned from ", prev, " to ", types.SensorActive)
+			publishSensorStateEvent(data.SensorID, prev, types.SensorActive, data.Timestamp)
+		}
+
+		// 1. Seleziona il profilo di filtraggio in base al tipo e al riferimento del sensore
+		profile := filtering.GetProfile(data.Type, getSensorReference(ctx, data.SensorID))
+
+		// 2. Scarta subito i valori fisicamente impossibili, senza calcolare alcuna statistica
+		if !profile.IsPhysicallyValid(data.Data) {
+			logger.Log.Warn("Physically invalid value discarded for sensor ", data.SensorID, " - value: ", data.Data, ", timestamp: ", data.Timestamp)
+			rejected := newRejectedSensorData(data, types.PhysicalBoundsRejection)
+			rejected.LowerBound = profile.MinValue
+			rejected.UpperBound = profile.MaxValue
+			quarantineSensorData(ctx, rejected, rejectedDataChannel)
+			continue
+		}
+
+		// 3. Recupera la storia dal Redis
+		readings, err := storage.GetSensorHistory(ctx, data.SensorID, profile.WindowSize)
 		if err != nil {
 			logger.Log.Error("Error getting sensor history from Redis: ", err)
+			// Una lettura critica viene inoltrata anche senza storia, senza l'esito del rilevamento degli outlier
+			if event, critical := profile.MatchCriticalRules(data); critical {
+				forwardCriticalEvent(ctx, event, criticalEventSignal)
+			}
 			continue
 		}
 
-		// 2. Controlla se il dato è un outlier BASANDOSI sulla storia attuale (PRIMA di aggiungere il nuovo dato)
-		isOutlier := filtering.IsOutlier(data, readings)
+		// 4. Controlla se il dato è un outlier BASANDOSI sulla storia attuale (PRIMA di aggiungere il nuovo dato)
+		// e se supera una soglia critica del profilo
+		verdict := evaluateReading(profile, data, readings)
+
+		// 5. Le letture critiche seguono la fast lane: vengono inoltrate subito, anche se sono outlier
+		// (un'emergenza è per sua natura un valore anomalo), e non entrano nella storia e nell'aggregazione
+		if verdict.critical {
+			forwardCriticalEvent(ctx, verdict.event, criticalEventSignal)
+			continue
+		}
 
-		// 3. IN BASE AL RISULTATO del controllo, decidiamo se scartare il dato.
-		if isOutlier {
+		// 6. IN BASE AL RISULTATO del controllo, decidiamo se scartare il dato.
+		result := verdict.result
+		if result.Outlier {
 			logger.Log.Warn("Outlier detected and discarded for sensor ", data.SensorID, " - value: ", data.Data, ", timestamp: ", data.Timestamp)
+			rejected := newRejectedSensorData(data, types.OutlierRejection)
+			rejected.Detector = string(result.Detector)
+			rejected.LowerBound = &result.LowerBound
+			rejected.UpperBound = &result.UpperBound
+			rejected.Center = &result.Center
+			rejected.Spread = &result.Spread
+			rejected.Samples = result.Samples
+			quarantineSensorData(ctx, rejected, rejectedDataChannel)
 			continue
 		}
 
-		// 4. Se il dato è valido, procedi con l'elaborazione successiva.
+		// 7. Se il dato è valido, procedi con l'elaborazione successiva.
 		logger.Log.Info("Data is valid for sensor: ", data.SensorID)
 
-		// 5. Aggiungi il nuovo dato alla storia su Redis se non è un outlier.
-		if err := storage.AddSensorHistory(ctx, data); err != nil {
+		// 8. Aggiungi il nuovo dato alla storia su Redis se non è un outlier.
+		if err := storage.AddSensorHistory(ctx, data, profile.WindowSize); err != nil {
 			logger.Log.Error("Error saving sensor data to Redis: ", err)
 			continue
 		}
+
+		// 9. Se il dato appartiene a un minuto già aggregato, richiedi il ricalcolo del riepilogo
+		trackLateReading(ctx, data.SensorID, data.Timestamp)
+	}
+}
+
+// readingVerdict è l'esito del filtro per una lettura entro i limiti fisici.
+type readingVerdict struct {
+	// result è l'esito del rilevamento degli outlier sulla storia del sensore.
+	result filtering.Result
+	// critical indica che la lettura supera una soglia critica e segue la fast lane con l'evento event.
+	critical bool
+	event    types.CriticalEvent
+}
+
+// evaluateReading valuta una lettura entro i limiti fisici con il detector e le regole critiche del profilo.
+// Una lettura critica segue la fast lane anche se è un outlier: l'esito del detector viene registrato nell'evento,
+// in modo che i falsi allarmi possano essere verificati ai livelli superiori.
+func evaluateReading(profile filtering.Profile, data types.SensorData, readings []types.SensorData) readingVerdict {
+	verdict := readingVerdict{result: profile.GetDetector().Evaluate(data, readings)}
+	verdict.event, verdict.critical = profile.MatchCriticalRules(data)
+	if verdict.critical {
+		outlier := verdict.result.Outlier
+		verdict.event.Outlier = &outlier
+		verdict.event.Detector = string(verdict.result.Detector)
+	}
+	return verdict
+}
+
+// forwardCriticalEvent salva la lettura critica in Redis e la segnala al dispatcher delle letture critiche.
+// Il filtro non attende la pubblicazione: se il segnale precedente non è ancora stato letto, il dispatcher
+// pubblicherà anche questa lettura. Se Redis non è disponibile la lettura viene pubblicata direttamente, senza ritentare.
+func forwardCriticalEvent(ctx context.Context, event types.CriticalEvent, criticalEventSignal chan struct{}) {
+	event.DetectedAt = time.Now().UTC().UnixMilli()
+	logger.Log.Warn("Critical value detected for sensor ", event.SensorID, " - value: ", event.Data, ", severity: ", event.Severity, ", threshold: ", event.Threshold)
+
+	if err := storage.AddPendingCriticalEvent(ctx, event); err != nil {
+		logger.Log.Error("Error saving critical event in Redis, publishing it directly: ", err)
+		go func() {
+			if err := comunication.PublishCriticalEvent(event); err != nil {
+				logger.Log.Error("Critical event from sensor ", event.SensorID, " - value: ", event.Data, ", timestamp: ", event.Timestamp, " lost: ", err)
+			}
+		}()
+		return
+	}
+
+	select {
+	case criticalEventSignal <- struct{}{}:
+	default:
+	}
+}
+
+// DispatchCriticalEvents pubblica le letture critiche salvate in Redis dal filtro, dalla più vecchia,
+// appena vengono segnalate sul canale criticalEventSignal e ogni CriticalEventPollInterval.
+// Una lettura viene rimossa da Redis solo dopo la conferma del broker: se la pubblicazione fallisce,
+// il dispatcher la ritenta con un'attesa crescente, mentre il filtro continua a salvare le nuove letture critiche.
+func DispatchCriticalEvents(criticalEventSignal <-chan struct{}) {
+	storage.InitRedisConnection()
+	ctx := context.Background()
+
+	ticker := time.NewTicker(environment.CriticalEventPollInterval)
+	defer ticker.Stop()
+	delay := environment.PublishRetryMinDelay
+	for {
+		if dispatchPendingCriticalEvents(ctx) {
+			delay = environment.PublishRetryMinDelay
+			select {
+			case <-criticalEventSignal:
+			case <-ticker.C:
+			}
+			continue
+		}
+		logger.Log.Error("Failed to dispatch pending critical events. Retrying in ", delay.String())
+		time.Sleep(delay)
+		delay = min(2*delay, environment.PublishRetryMaxDelay)
+	}
+}
+
+// dispatchPendingCriticalEvents pubblica tutte le letture critiche in attesa in Redis.
+// Si ferma al primo errore, restituendo false: le letture non pubblicate restano in Redis.
+func dispatchPendingCriticalEvents(ctx context.Context) bool {
+	for {
+		events, err := storage.GetPendingCriticalEvents(ctx, environment.CriticalEventBatchSize)
+		if err != nil {
+			logger.Log.Error("Error getting pending critical events from Redis: ", err)
+			return false
+		}
+		if len(events) == 0 {
+			return true
+		}
+
+		for _, pending := range events {
+			if err := comunication.PublishCriticalEvent(pending.Event); err != nil {
+				logger.Log.Error("Failed to publish critical event from sensor ", pending.Event.SensorID, " - value: ", pending.Event.Data, ", timestamp: ", pending.Event.Timestamp, ": ", err)
+				return false
+			}
+			// Se la rimozione fallisce la lettura viene pubblicata di nuovo: il Proximity Hub la riceve almeno una volta
+			if err := storage.MarkCriticalEventSent(ctx, pending); err != nil {
+				logger.Log.Error("Failed to remove published critical event of sensor ", pending.Event.SensorID, " from Redis: ", err)
+				return false
+			}
+		}
+	}
+}
+
+// newRejectedSensorData crea il record di scarto per una lettura.
+func newRejectedSensorData(data types.SensorData, reason types.RejectionReason) types.RejectedSensorData {
+	return types.RejectedSensorData{
+		EdgeMacrozone: data.EdgeMacrozone,
+		EdgeZone:      data.EdgeZone,
+		SensorID:      data.SensorID,
+		Timestamp:     data.Timestamp,
+		Type:          data.Type,
+		Data:          data.Data,
+		Reason:        reason,
+		RejectedAt:    time.Now().UTC().Unix(),
+	}
+}
+
+// rejectedBacklog contiene i sensori con letture scartate in attesa in Redis, da inoltrare con ReplayRejectedSensorData.
+// Finché un sensore ha letture in attesa, anche le sue letture scartate successive restano in attesa:
+// le letture in attesa sono così sempre le più recenti della lista del sensore e vengono inoltrate in ordine.
+var rejectedBacklog = struct {
+	sync.Mutex
+	sensors map[string]bool
+}{
+	sensors: make(map[string]bool),
+}
+
+// quarantineSensorData salva la lettura scartata nella cache Redis e la inoltra sul canale dei dati scartati.
+// Il filtro non attende il canale: se è pieno, la lettura salvata resta in attesa in Redis e viene inoltrata in seguito.
+func quarantineSensorData(ctx context.Context, rejected types.RejectedSensorData, rejectedDataChannel chan types.RejectedSensorData) {
+	if err := storage.AddRejectedSensorData(ctx, rejected); err != nil {
+		logger.Log.Error("Error saving rejected sensor data to Redis: ", err)
+		select {
+		case rejectedDataChannel <- rejected:
+			logger.Log.Debug("Sent rejected data to channel for sensor: ", rejected.SensorID)
+		default:
+			logger.Log.Error("Rejected data channel is full and rejected data is not saved. Discarding rejected data from sensor: ", rejected.SensorID)
+		}
+		return
+	}
+	trackLateReading(ctx, rejected.SensorID, rejected.Timestamp)
+
+	rejectedBacklog.Lock()
+	defer rejectedBacklog.Unlock()
+	if !rejectedBacklog.sensors[rejected.SensorID] {
+		select {
+		case rejectedDataChannel <- rejected:
+			logger.Log.Debug("Sent rejected data to channel for sensor: ", rejected.SensorID)
+			return
+		default:
+			logger.Log.Warn("Rejected data channel is full. Rejected data from sensor ", rejected.SensorID, " will be replayed from Redis")
+		}
+	}
+	if err := storage.AddPendingRejectedSensorData(ctx, rejected.SensorID); err != nil {
+		logger.Log.Error("Error marking rejected data of sensor ", rejected.SensorID, " as pending: ", err)
+		return
+	}
+	rejectedBacklog.sensors[rejected.SensorID] = true
+}
+
+// ReplayRejectedSensorData inoltra sul canale dei dati scartati, ogni RejectedReplayInterval, le letture scartate
+// rimaste in attesa in Redis perché il canale era pieno, comprese quelle rimaste in attesa prima di un riavvio.
+// L'invio sul canale è bloccante: a differenza del filtro, questa goroutine può attendere il publisher.
+func ReplayRejectedSensorData(rejectedDataChannel chan types.RejectedSensorData) {
+	storage.InitRedisConnection()
+	ctx := context.Background()
+
+	ticker := time.NewTicker(environment.RejectedReplayInterval)
+	defer ticker.Stop()
+	for {
+		sensorIDs, err := storage.GetPendingRejectedSensors(ctx)
+		if err != nil {
+			logger.Log.Error("Error getting sensors with pending rejected data from Redis: ", err)
+		}
+
+		for _, sensorID := range sensorIDs {
+			rejectedBacklog.Lock()
+			readings, evicted, err := storage.PopPendingRejectedSensorData(ctx, sensorID)
+			if err == nil {
+				delete(rejectedBacklog.sensors, sensorID)
+			}
+			rejectedBacklog.Unlock()
+			if err != nil {
+				logger.Log.Error("Error getting pending rejected data of sensor ", sensorID, " from Redis: ", err)
+				continue
+			}
+			if evicted > 0 {
+				logger.Log.Warn(evicted, " pending rejected readings of sensor ", sensorID, " exceeded RejectedWindowSize and were lost")
+			}
+
+			logger.Log.Info("Replaying ", len(readings), " rejected readings of sensor ", sensorID)
+			for _, rejected := range readings {
+				rejectedDataChannel <- rejected
+			}
+		}
+
+		<-ticker.C
 	}
 }
 
 // AggregateAllSensorsData esegue l'aggregazione per tutti i sensori presenti in Redis.
-func AggregateAllSensorsData(filteredDataChannel chan types.SensorData) {
+// Aggrega tutti i minuti successivi al watermark fino al minuto corrente (considerando l'offset),
+// recuperando quelli saltati durante un cambio di leader, poi ricalcola i minuti già aggregati, entro AggregationAllowedLateness, che hanno ricevuto letture in ritardo.
+// I riepiloghi vengono salvati nell'outbox, da cui il dispatcher li invia al Proximity Hub.
+func AggregateAllSensorsData() {
 	storage.InitRedisConnection()
 	ctx := context.Background()
 
@@ -67,68 +384,163 @@ func AggregateAllSensorsData(filteredDataChannel chan types.SensorData) {
 	sensorIDs, err := storage.GetAllSensorIDs(ctx)
 	if err != nil {
 		logger.Log.Error("Error getting sensor IDs from Redis: ", err)
+		return
 	}
 
-	var results []types.SensorData
+	// Recupera l'ultimo minuto aggregato
+	watermark, found, err := storage.GetAggregationWatermark(ctx)
+	if err != nil {
+		logger.Log.Error("Error getting aggregation watermark from Redis: ", err)
+		return
+	}
 
 	// Calcola l'inizio del minuto corrente considerando l'offset
 	// Ad esempio, se ora sono le 12:34:45 e l'offset è -2min,
-	// minuteStart sarà 12:32:00 e aggrego i dati tra 12:32:00 e 12:32:59
+	// targetMinute sarà 12:32:00 e aggrego i dati tra 12:32:00 e 12:32:59
 	now := time.Now().UTC()
-	minuteStart := now.Add(environment.AggregationFetchOffset).Truncate(time.Minute)
+	targetMinute := now.Add(environment.AggregationFetchOffset).Truncate(time.Minute)
+
+	// Aggrega i minuti successivi al watermark, cioè all'ultimo minuto aggregato. Se il leader precedente
+	// si è fermato, il nuovo leader recupera tutti i minuti saltati ancora presenti nella storia dei sensori
+	startMinute := targetMinute
+	if found {
+		startMinute = watermark.Add(time.Minute)
+		if earliest := targetMinute.Add(-environment.HistoryMaxAge); startMinute.Before(earliest) {
+			startMinute = earliest
+		}
+		if startMinute.Before(targetMinute) {
+			logger.Log.Info("Catching up aggregation from ", startMinute.Format(time.RFC3339), ", last aggregated minute: ", watermark.Format(time.RFC3339))
+		}
+	}
 
-	logger.Log.Info("Starting aggregation for all sensors at ", minuteStart.Format(time.RFC3339))
+	for minute := startMinute; !minute.After(targetMinute); minute = minute.Add(time.Minute) {
+		logger.Log.Info("Starting aggregation for all sensors at ", minute.Format(time.RFC3339))
+		for _, sensorID := range sensorIDs {
+			// Se il riepilogo non può essere salvato nell'outbox il watermark non viene aggiornato:
+			// l'aggregazione riprende da questo minuto alla prossima esecuzione
+			if !aggregateSensorMinute(ctx, sensorID, minute) {
+				logger.Log.Warn("Aggregation will resume from ", minute.Format(time.RFC3339), " at next tick")
+				return
+			}
+		}
+		if err := storage.SetAggregationWatermark(ctx, minute); err != nil {
+			logger.Log.Error("Error updating aggregation watermark in Redis: ", err)
+			return
+		}
+		watermark, found = minute, true
+	}
 
-	for _, sensorID := range sensorIDs {
+	if !found || environment.AggregationAllowedLateness == 0 {
+		return
+	}
 
-		// Recupera le letture del sensore per il minuto specificato
-		readings, err := storage.GetSensorHistoryByMinute(ctx, sensorID, minuteStart)
+	// Ricalcola i minuti già aggregati che hanno ricevuto letture in ritardo
+	for minute := watermark.Add(-environment.AggregationAllowedLateness); !minute.After(watermark); minute = minute.Add(time.Minute) {
+		lateSensorIDs, err := storage.PopLateSensors(ctx, minute)
 		if err != nil {
-			logger.Log.Error("Error getting sensor history from Redis for sensor ", sensorID, ": ", err)
+			logger.Log.Error("Error getting late sensors from Redis for minute ", minute.Format(time.RFC3339), ": ", err)
 			continue
 		}
-
-		// Se non ci sono letture valide, salta questo sensore
-		if len(readings) == 0 {
-			logger.Log.Warn("No valid readings found for sensor " + sensorID + " in the current minute")
-			continue
+		for _, sensorID := range lateSensorIDs {
+			logger.Log.Info("Late readings for sensor " + sensorID + ", re-aggregating minute " + minute.Format(time.RFC3339))
+			if !aggregateSensorMinute(ctx, sensorID, minute) {
+				// Il minuto verrà ricalcolato alla prossima esecuzione
+				if err := storage.MarkLateReading(ctx, sensorID, minute); err != nil {
+					logger.Log.Error("Error marking late readings in Redis for sensor ", sensorID, ": ", err)
+				}
+			}
 		}
+	}
+}
 
-		// Calcola la media delle letture per il minuto specificato
-		avg := aggregation.AverageInMinute(readings, minuteStart)
-		edgeMacrozone := readings[0].EdgeMacrozone
-		edgeZone := readings[0].EdgeZone
-		sensorType := readings[0].Type
+// aggregateSensorMinute calcola il riepilogo delle letture di un sensore nel minuto specificato
+// e lo salva nell'outbox dei riepiloghi da inviare. Se il riepilogo del minuto era già stato inviato,
+// il nuovo riepilogo viene marcato come revisione.
+// Restituisce false solo se il riepilogo non è stato salvato nell'outbox.
+func aggregateSensorMinute(ctx context.Context, sensorID string, minute time.Time) bool {
 
-		// Crea il risultato dell'aggregazione
-		result := types.SensorData{
-			EdgeMacrozone: edgeMacrozone,
-			EdgeZone:      edgeZone,
-			SensorID:      sensorID,
-			Data:          avg,
-			Timestamp:     minuteStart.Unix(),
-			Type:          sensorType,
-		}
-		logger.Log.Info("Average for minute ", minuteStart.Format(time.RFC3339), " sensor "+sensorID+": ", avg)
+	// Recupera le letture del sensore per il minuto specificato
+	readings, err := storage.GetSensorHistoryByMinute(ctx, sensorID, minute)
+	if err != nil {
+		logger.Log.Error("Error getting sensor history from Redis for sensor ", sensorID, ": ", err)
+		return true
+	}
 
-		// Invia il risultato al canale di dati filtrati
-		select {
-		// invia il risultato al canale filteredDataChannel
-		case filteredDataChannel <- result:
-			logger.Log.Debug("Sent aggregated data for sensor: ", sensorID)
-		default:
-			logger.Log.Warn("Filtered data channel is full, discarding aggregated data for sensor: ", sensorID)
-		}
+	// Se non ci sono letture valide, salta questo sensore
+	if len(readings) == 0 {
+		logger.Log.Warn("No valid readings found for sensor " + sensorID + " in minute " + minute.Format(time.RFC3339))
+		return true
+	}
+
+	// Calcola le statistiche delle letture per il minuto specificato
+	result := aggregation.SummarizeMinute(readings, minute)
+	result.EdgeMacrozone = readings[0].EdgeMacrozone
+	result.EdgeZone = readings[0].EdgeZone
+	result.SensorID = sensorID
+	result.Timestamp = minute.Unix()
+	result.Type = readings[0].Type
 
-		// Aggiungi il risultato all'elenco dei risultati
-		// per eventuali operazioni successive
-		results = append(results, result)
+	// Aggiunge il numero di letture scartate dal filtro nello stesso minuto
+	rejected, err := storage.GetRejectedCountByMinute(ctx, sensorID, minute)
+	if err != nil {
+		logger.Log.Error("Error getting rejected count from Redis for sensor ", sensorID, ": ", err)
 	}
+	result.Rejected = rejected
+
+	// Recupera il numero di revisione del riepilogo
+	revision, err := storage.GetSummaryRevision(ctx, sensorID, minute)
+	if err != nil {
+		logger.Log.Error("Error getting summary revision from Redis for sensor ", sensorID, ": ", err)
+	}
+	result.Revision = revision
+	logger.Log.Info("Summary for minute ", minute.Format(time.RFC3339), " sensor "+sensorID+": mean ", result.Mean, ", count ", result.Count, ", rejected ", result.Rejected, ", revision ", result.Revision)
+
+	// Salva il risultato nell'outbox, da cui viene inviato al Proximity Hub anche dopo un riavvio dell'hub
+	if err := storage.AddPendingSummary(ctx, result); err != nil {
+		logger.Log.Error("Error saving aggregated data in outbox for sensor ", sensorID, ": ", err)
+		return false
+	}
+	logger.Log.Debug("Saved aggregated data in outbox for sensor: ", sensorID)
+
+	// Registra l'invio solo dopo il salvataggio nell'outbox, così la revisione successiva sarà maggiore di questa
+	if err := storage.MarkSummaryEmitted(ctx, sensorID, minute); err != nil {
+		logger.Log.Error("Error marking summary as emitted in Redis for sensor ", sensorID, ": ", err)
+	}
+	return true
+}
 
+// trackLateReading segnala all'aggregatore le letture (valide o scartate) che appartengono a un minuto già aggregato,
+// in modo che il riepilogo venga ricalcolato. Le letture più vecchie della finestra di ritardo consentita vengono ignorate.
+func trackLateReading(ctx context.Context, sensorID string, timestamp int64) {
+	if environment.AggregationAllowedLateness == 0 {
+		return
+	}
+	watermark, found, err := storage.GetAggregationWatermark(ctx)
+	if err != nil {
+		logger.Log.Error("Error getting aggregation watermark from Redis: ", err)
+		return
+	}
+	minute := time.Unix(timestamp, 0).UTC().Truncate(time.Minute)
+	if !found || minute.After(watermark) {
+		return
+	}
+	if minute.Before(watermark.Add(-environment.AggregationAllowedLateness)) {
+		logger.Log.Warn("Reading for sensor " + sensorID + " is too late for re-aggregation (minute " + minute.Format(time.RFC3339) + ")")
+		return
+	}
+	if err := storage.MarkLateReading(ctx, sensorID, minute); err != nil {
+		logger.Log.Error("Error marking late reading in Redis for sensor ", sensorID, ": ", err)
+	}
 }
 
-// CleanUnhealthySensors rimuove i sensori che non comunicano da troppo tempo.
-func CleanUnhealthySensors() (unhealthySensors []string, removedSensors []string) {
+// CleanUnhealthySensors aggiorna lo stato del ciclo di vita dei sensori in base al tempo trascorso dall'ultima lettura
+// e dall'ultimo heartbeat.
+// I sensori che diventano unhealthy perdono la storia delle letture, quelli dismessi vengono rimossi dalla cache.
+// Ogni transizione viene pubblicata verso il Proximity Hub.
+// Oltre ai sensori diventati unhealthy, vengono restituiti quelli che restano unhealthy, in modo che una notifica
+// posticipata dal limite di frequenza venga inviata al controllo successivo, e quelli attivi (activeSensors),
+// per notificare il ripristino dei sensori segnalati in precedenza.
+func CleanUnhealthySensors() (unhealthySensors []string, removedSensors []string, activeSensors []string) {
 	storage.InitRedisConnection()
 	ctx := context.Background()
 
@@ -140,44 +552,63 @@ func CleanUnhealthySensors() (unhealthySensors []string, removedSensors []string
 	}
 
 	// Controlla lo stato di ogni sensore
+	now := time.Now().UTC()
 	for _, sensorID := range sensorIDs {
-		readings, err := storage.GetSensorHistory(ctx, sensorID, environment.HistoryWindowSize)
+		info, found, err := storage.GetSensorState(ctx, sensorID)
 		if err != nil {
-			logger.Log.Error("Error getting sensor history from Redis for sensor ", sensorID, ": ", err)
+			logger.Log.Error("Error getting sensor state from Redis for sensor ", sensorID, ": ", err)
 			continue
 		}
 
-		// Trova il timestamp più recente tra le letture
-		latestTime := time.Now().UTC().Add(-environment.RegistrationSensorTimeout).Truncate(environment.RegistrationSensorTimeout)
-		for _, reading := range readings {
-			logger.Log.Debug("Sensor ", sensorID, " reading timestamp: ", time.Unix(reading.Timestamp, 0).UTC().Format(time.RFC3339))
-			t := time.Unix(reading.Timestamp, 0).UTC()
-			if t.After(latestTime) {
-				latestTime = t
+		// I sensori presenti in cache prima dell'introduzione del ciclo di vita vengono inizializzati dalla loro storia
+		if !found {
+			info, err = initSensorState(ctx, sensorID, now)
+			if err != nil {
+				logger.Log.Error("Error initializing sensor state in Redis for sensor ", sensorID, ": ", err)
+				continue
 			}
 		}
 
+		next := nextSensorState(info, now)
+		if next == info.State {
+			logger.Log.Info("Checked sensor " + sensorID + " for healthy. State: " + string(info.State))
+			switch next {
+			case types.SensorActive:
+				activeSensors = append(activeSensors, sensorID)
+			case types.SensorUnhealthy:
+				unhealthySensors = append(unhealthySensors, sensorID)
+			}
+			continue
+		}
+
+		// La transizione fallisce se nel frattempo il filtro ha ricevuto una lettura e riportato il sensore ad active
+		ok, err := storage.TransitionSensorState(ctx, sensorID, info.State, next, 0)
+		if err != nil {
+			logger.Log.Error("Error updating sensor state in Redis for sensor ", sensorID, ": ", err)
+			continue
+		}
+		if !ok {
+			logger.Log.Debug("Sensor ", sensorID, " state changed concurrently, skipping transition to ", next)
+			continue
+		}
+		logger.Log.Warn("Sensor "+sensorID+" transitioned from ", info.State, " to ", next, " (last seen: ", time.Unix(info.LastSeen, 0).UTC().Format(time.RFC3339), ")")
+		publishSensorStateEvent(sensorID, info.State, next, info.LastSeen)
+
+		switch next {
 		// Caso: sensore non comunica da troppo tempo (UnhealthySensorTimeout) -> rimuovo la storia del sensore
-		if time.Since(latestTime) > environment.UnhealthySensorTimeout {
-			logger.Log.Warn("Sensor "+sensorID+" inactive for too times (", latestTime.Format(time.RFC3339), "). Removing history from Redis.")
+		case types.SensorUnhealthy:
 			if err := storage.RemoveSensorHistory(ctx, sensorID); err != nil {
 				logger.Log.Error("Error removing sensor ", sensorID, " from Redis: ", err)
 			}
 			unhealthySensors = append(unhealthySensors, sensorID)
-			continue
-		}
-
 		// Caso: sensore non comunica da troppo tempo (RegistrationSensorTimeout) -> rimuovo il sensore
-		if time.Since(latestTime) > environment.RegistrationSensorTimeout {
-			logger.Log.Warn("Sensor " + sensorID + " inactive for too times. Removing from Redis.")
+		case types.SensorDecommissioned:
 			if err := storage.RemoveSensor(ctx, sensorID); err != nil {
 				logger.Log.Error("Error removing sensor ", sensorID, " from Redis: ", err)
 			}
+			invalidateSensorReference(sensorID)
 			removedSensors = append(removedSensors, sensorID)
-			continue
 		}
-
-		logger.Log.Info("Checked sensor "+sensorID+" for healthy. Readings count: ", len(readings))
 	}
 
 	logger.Log.Info("Cleaned up unhealthy sensors. Total sensors checked: ", len(sensorIDs))
@@ -191,7 +622,101 @@ func CleanUnhealthySensors() (unhealthySensors []string, removedSensors []string
 	} else {
 		logger.Log.Info("No sensors removed.")
 	}
-	return unhealthySensors, removedSensors
+	return unhealthySensors, removedSensors, activeSensors
+}
+
+// sensorStateRank restituisce la posizione di uno stato nel ciclo di vita del sensore.
+// Il cleaner fa avanzare i sensori solo verso stati successivi.
+func sensorStateRank(state types.SensorState) int {
+	switch state {
+	case types.SensorActive:
+		return 1
+	case types.SensorSilent:
+		return 2
+	case types.SensorUnhealthy:
+		return 3
+	case types.SensorDecommissioned:
+		return 4
+	default:
+		return 0
+	}
+}
+
+// nextSensorState calcola lo stato in cui deve trovarsi un sensore in base al tempo trascorso dall'ultima lettura
+// o, se il sensore non ha mai inviato dati, dalla registrazione.
+// Un sensore che invia heartbeat è ancora in funzione: senza letture recenti diventa silent, ma non unhealthy né dismesso.
+// Il timeout per lo stato silent tiene conto dell'intervallo di campionamento riportato negli heartbeat.
+func nextSensorState(info storage.SensorStateInfo, now time.Time) types.SensorState {
+	reference := info.LastSeen
+	if reference == 0 {
+		reference = info.Since
+	}
+	elapsed := now.Sub(time.Unix(reference, 0))
+
+	// Tempo trascorso dall'ultimo segno di vita, lettura o heartbeat
+	alive := elapsed
+	if info.LastHeartbeat > reference {
+		alive = now.Sub(time.Unix(info.LastHeartbeat, 0))
+	}
+
+	silentTimeout := max(environment.SilentSensorTimeout, environment.SilentSamplingIntervals*info.SamplingInterval)
+
+	var target types.SensorState
+	switch {
+	case alive > environment.RegistrationSensorTimeout:
+		target = types.SensorDecommissioned
+	case info.State == types.SensorRegistered:
+		// Un sensore registrato resta tale finché non invia dati o non scade la registrazione
+		target = types.SensorRegistered
+	case alive > environment.UnhealthySensorTimeout:
+		target = types.SensorUnhealthy
+	case elapsed > silentTimeout:
+		target = types.SensorSilent
+	default:
+		target = types.SensorActive
+	}
+
+	if sensorStateRank(target) > sensorStateRank(info.State) {
+		return target
+	}
+	return info.State
+}
+
+// initSensorState inizializza lo stato di un sensore senza ciclo di vita in cache:
+// active se ha letture in storia, registered altrimenti.
+func initSensorState(ctx context.Context, sensorID string, now time.Time) (storage.SensorStateInfo, error) {
+	readings, err := storage.GetSensorHistory(ctx, sensorID, 1)
+	if err != nil {
+		return storage.SensorStateInfo{}, err
+	}
+	info := storage.SensorStateInfo{State: types.SensorRegistered, Since: now.Unix()}
+	if len(readings) > 0 {
+		info.State = types.SensorActive
+		info.LastSeen = readings[0].Timestamp
+	}
+	if _, err := storage.TransitionSensorState(ctx, sensorID, "", info.State, info.LastSeen); err != nil {
+		return storage.SensorStateInfo{}, err
+	}
+	logger.Log.Info("Initialized state of sensor " + sensorID + " as " + string(info.State))
+	publishSensorStateEvent(sensorID, "", info.State, info.LastSeen)
+	return info, nil
+}
+
+// publishSensorStateEvent pubblica una transizione di stato di un sensore verso il Proximity Hub.
+func publishSensorStateEvent(sensorID string, from, to types.SensorState, lastSeen int64) {
+	event := types.SensorStateEvent{
+		EdgeMacrozone: environment.EdgeMacrozone,
+		EdgeZone:      environment.EdgeZone,
+		SensorID:      sensorID,
+		HubID:         environment.HubID,
+		From:          from,
+		To:            to,
+		Timestamp:     time.Now().UTC().Unix(),
+		LastSeen:      lastSeen,
+	}
+	if err := comunication.PublishSensorStateEvent(event); err != nil {
+		logger.Log.Error("Error publishing state event for sensor ", sensorID, ": ", err)
+	}
 }
 
 // ProcessSensorConfigurationMessages gestisce i messaggi di configurazione dei sensori.
@@ -206,28 +731,56 @@ func ProcessSensorConfigurationMessages(sensorConfigurationMessageChannel, hubCo
 		switch configMsg.MsgType {
 		case types.NewSensorMsgType:
 
-			// Aggiungi il sensore al database se non esiste già
-			sensor := types.Sensor{
-				Id:            configMsg.SensorID,
-				ZoneName:      configMsg.EdgeZone,
-				MacrozoneName: configMsg.EdgeMacrozone,
-				Type:          configMsg.SensorType,
-				Reference:     configMsg.SensorReference,
+			// Un Sensor Agent con più canali registra ogni canale come un sensore distinto
+			allExist := true
+			for _, channelMsg := range configMsg.ChannelMessages() {
+
+				// Aggiungi il sensore al database se non esiste già
+				sensor := types.Sensor{
+					Id:            channelMsg.SensorID,
+					ZoneName:      channelMsg.EdgeZone,
+					MacrozoneName: channelMsg.EdgeMacrozone,
+					Type:          channelMsg.SensorType,
+					Reference:     channelMsg.SensorReference,
+					PublicKey:     channelMsg.PublicKey,
+				}
+
+				// Aggiungo il sensore solo se non esiste già
+				// Se il sensore è nuovo, inoltro il messaggio di configurazione all'hub
+				// Altrimenti, scarto il messaggio di configurazione
+				if exists, err := storage.AddSensor(ctx, sensor); err != nil {
+					logger.Log.Error("Error adding sensor configuration: ", err)
+					allExist = false
+				} else if !exists {
+					logger.Log.Info("Sensor configuration added for sensor: ", channelMsg.SensorID)
+					invalidateSensorReference(channelMsg.SensorID)
+					registerSensorState(ctx, channelMsg.SensorID)
+					hubConfigurationMessageChannel <- channelMsg
+					allExist = false
+				} else {
+					logger.Log.Info("Sensor configuration already exists for sensor: ", channelMsg.SensorID)
+					// Un sensore registrato di nuovo con un altro riferimento cambia profilo di filtraggio
+					if changed, err := storage.SetSensorReference(ctx, channelMsg.SensorID, channelMsg.SensorReference); err != nil {
+						logger.Log.Error("Error setting reference for sensor ", channelMsg.SensorID, ": ", err)
+					} else if changed {
+						logger.Log.Info("Reference of sensor ", channelMsg.SensorID, " changed to: ", channelMsg.SensorReference)
+						invalidateSensorReference(channelMsg.SensorID)
+					}
+					// Un sensore registrato senza chiave può aggiungerla, ma non sostituirla
+					if channelMsg.PublicKey != "" {
+						if set, err := storage.SetSensorPublicKey(ctx, channelMsg.SensorID, channelMsg.PublicKey); err != nil {
+							logger.Log.Error("Error setting public key for sensor ", channelMsg.SensorID, ": ", err)
+						} else if set {
+							logger.Log.Info("Public key registered for sensor: ", channelMsg.SensorID)
+						}
+					}
+				}
 			}
 
-			// Aggiungo il sensore solo se non esiste già
-			// Se il sensore è nuovo, inoltro il messaggio di configurazione all'hub
-			// Altrimenti, scarto il messaggio di configurazione
-			// In entrambi i casi, pulisco il messaggio di configurazione
+			// Se tutti i canali sono già registrati, pulisco il messaggio di configurazione
 			// per evitare di ritrasmetterlo in futuro
 			// (ad esempio, se il sensore si riavvia e invia di nuovo il messaggio di configurazione)
-			if exists, err := storage.AddSensor(ctx, sensor); err != nil {
-				logger.Log.Error("Error adding sensor configuration: ", err)
-			} else if !exists {
-				logger.Log.Info("Sensor configuration added for sensor: ", configMsg.SensorID)
-				hubConfigurationMessageChannel <- configMsg
-			} else {
-				logger.Log.Info("Sensor configuration already exists for sensor: ", configMsg.SensorID)
+			if allExist {
 				comunication.CleanRetentionConfigurationMessage(configMsg)
 			}
 		default:
@@ -236,6 +789,121 @@ func ProcessSensorConfigurationMessages(sensorConfigurationMessageChannel, hubCo
 	}
 }
 
+// ProcessSensorHeartbeats registra gli heartbeat dei sensori, utilizzati da CleanUnhealthySensors
+// per distinguere i sensori in funzione ma senza letture recenti da quelli non più raggiungibili.
+func ProcessSensorHeartbeats(sensorHeartbeatChannel chan types.HeartbeatMsg) {
+	storage.InitRedisConnection()
+	ctx := context.Background()
+
+	for heartbeat := range sensorHeartbeatChannel {
+		logger.Log.Debug("Processing heartbeat for sensor: ", heartbeat.SensorID, " (uptime: ", heartbeat.Uptime, "s, buffer depth: ", heartbeat.BufferDepth, ", version: ", heartbeat.Version, ")")
+
+		if heartbeat.LastPublishError != "" {
+			logger.Log.Warn("Sensor ", heartbeat.SensorID, " reported a publish error: ", heartbeat.LastPublishError)
+		}
+
+		for _, sensorID := range heartbeat.SensorIDs() {
+			if found, err := storage.RecordSensorHeartbeat(ctx, sensorID, heartbeat.Timestamp, heartbeat.SamplingInterval); err != nil {
+				logger.Log.Error("Error recording heartbeat in Redis for sensor ", sensorID, ": ", err)
+			} else if !found {
+				logger.Log.Debug("Heartbeat from sensor without state, skipping: ", sensorID)
+			}
+		}
+	}
+}
+
+// ProcessSensorCommands consegna ai sensori della zona i comandi ricevuti dal Proximity Fog Hub
+// e conferma la consegna. I comandi per sensori non presenti nella cache vengono rifiutati.
+func ProcessSensorCommands(commandChannel chan types.SensorCommand) {
+	storage.InitRedisConnection()
+	ctx := context.Background()
+
+	for command := range commandChannel {
+		logger.Log.Info("Processing command ", command.ID, " for sensor: ", command.SensorID)
+
+		// Solo un'istanza dell'hub consegna il comando
+		claimed, err := storage.ClaimSensorCommand(ctx, command.ID)
+		if err != nil {
+			logger.Log.Error("Error claiming command ", command.ID, ": ", err)
+			continue
+		}
+		if !claimed {
+			logger.Log.Debug("Command already claimed by another hub instance: ", command.ID)
+			continue
+		}
+
+		var ack types.CommandAck
+		if _, found, err := storage.GetSensor(ctx, command.SensorID); err != nil {
+			logger.Log.Error("Error getting sensor from Redis for command ", command.ID, ": ", err)
+			releaseSensorCommand(ctx, command)
+			continue
+		} else if !found {
+			logger.Log.Warn("Command ", command.ID, " refused, unknown sensor: ", command.SensorID)
+			ack = types.NewCommandAck(command, types.CommandFailed, "unknown sensor")
+		} else if err := command.Validate(); err != nil {
+			logger.Log.Warn("Command ", command.ID, " refused: ", err)
+			ack = types.NewCommandAck(command, types.CommandFailed, err.Error())
+		} else if err := comunication.PublishSensorCommand(command); err != nil {
+			// Il comando resta conservato dal broker e verrà consegnato alla prossima ricezione
+			logger.Log.Error("Error delivering command ", command.ID, " to sensor ", command.SensorID, ": ", err)
+			releaseSensorCommand(ctx, command)
+			continue
+		} else {
+			logger.Log.Info("Command ", command.ID, " delivered to sensor: ", command.SensorID)
+			ack = types.NewCommandAck(command, types.CommandDelivered, "")
+		}
+
+		ack.HubID = environment.HubID
+		if err := comunication.PublishCommandAck(ack); err != nil {
+			logger.Log.Error("Error publishing ack for command ", command.ID, ": ", err)
+		}
+		comunication.CleanRetentionSensorCommand(command)
+	}
+}
+
+// releaseSensorCommand rilascia la presa in carico di un comando che non è stato possibile consegnare.
+func releaseSensorCommand(ctx context.Context, command types.SensorCommand) {
+	if err := storage.ReleaseSensorCommand(ctx, command.ID); err != nil {
+		logger.Log.Error("Error releasing command ", command.ID, ": ", err)
+	}
+}
+
+// ProcessCommandAcks inoltra al Proximity Fog Hub le conferme dei comandi inviate dai sensori.
+func ProcessCommandAcks(commandAckChannel chan types.CommandAck) {
+	for ack := range commandAckChannel {
+		if ack.CommandID == "" {
+			logger.Log.Warn("Received empty command ack, skipping...")
+			continue
+		}
+		logger.Log.Info("Command ack received from sensor ", ack.SensorID, ", command: ", ack.CommandID, ", status: ", ack.Status)
+		ack.HubID = environment.HubID
+		if err := comunication.PublishCommandAck(ack); err != nil {
+			logger.Log.Error("Error publishing ack for command ", ack.CommandID, ": ", err)
+		}
+	}
+}
+
+// registerSensorState porta nello stato registered un sensore appena aggiunto alla cache,
+// se non ha ancora uno stato o se era stato dismesso.
+func registerSensorState(ctx context.Context, sensorID string) {
+	info, found, err := storage.GetSensorState(ctx, sensorID)
+	if err != nil {
+		logger.Log.Error("Error getting sensor state from Redis for sensor ", sensorID, ": ", err)
+		return
+	}
+	if found && info.State != types.SensorDecommissioned {
+		return
+	}
+	ok, err := storage.TransitionSensorState(ctx, sensorID, info.State, types.SensorRegistered, 0)
+	if err != nil {
+		logger.Log.Error("Error updating sensor state in Redis for sensor ", sensorID, ": ", err)
+		return
+	}
+	if ok {
+		publishSensorStateEvent(sensorID, info.State, types.SensorRegistered, info.LastSeen)
+	}
+}
+
 // NotifyUnhealthySensors invia notifiche per i sensori non sani.
 func NotifyUnhealthySensors(unhealthySensors []string) {
 	if len(unhealthySensors) == 0 {
@@ -243,9 +911,18 @@ func NotifyUnhealthySensors(unhealthySensors []string) {
 		return
 	}
 
+	ctx := context.Background()
 	for _, sensorID := range unhealthySensors {
-		logger.Log.Warn("Notifying about unhealthy sensor: ", sensorID)
-		// TODO: Implement the actual notification logic
+		notification.NotifySensor(ctx, sensorID, types.UnhealthySensorNotification)
+	}
+}
+
+// NotifyRecoveredSensors invia la notifica di ripristino per i sensori attivi che erano stati segnalati come unhealthy o rimossi.
+// Il controllo viene eseguito dal cleaner, e non dal filtro ad ogni lettura, per non interrogare Redis per ogni dato ricevuto.
+func NotifyRecoveredSensors(activeSensors []string) {
+	ctx := context.Background()
+	for _, sensorID := range activeSensors {
+		notification.NotifyIfRecovered(ctx, sensorID)
 	}
 }
 
@@ -256,8 +933,8 @@ func NotifyRemovedSensors(removedSensors []string) {
 		return
 	}
 
+	ctx := context.Background()
 	for _, sensorID := range removedSensors {
-		logger.Log.Warn("Notifying about removed sensor: ", sensorID)
-		// TODO: Implement the actual notification logic
+		notification.NotifySensor(ctx, sensorID, types.RemovedSensorNotification)
 	}
 }
@@ -0,0 +1,72 @@
+package edge_hub
+
+import (
+	"SensorContinuum/internal/edge-hub/environment"
+	"SensorContinuum/internal/edge-hub/processing/filtering"
+	"SensorContinuum/pkg/types"
+	"testing"
+)
+
+func threshold(value float64) *float64 {
+	return &value
+}
+
+// history restituisce la storia di un sensore, dalla lettura più recente alla più vecchia, con i valori indicati.
+func history(values ...float64) []types.SensorData {
+	readings := make([]types.SensorData, 0, len(values))
+	for i, value := range values {
+		readings = append(readings, types.SensorData{SensorID: "sensor-1", Timestamp: int64(1000 - i), Type: "temperature", Data: value})
+	}
+	return readings
+}
+
+func TestEvaluateReading(t *testing.T) {
+	profile := filtering.Profile{
+		Type:          "temperature",
+		MinSamples:    5,
+		Detector:      environment.ZScoreDetector,
+		StdDevFactor:  3,
+		CriticalRules: []filtering.CriticalRule{{Above: threshold(50), Severity: types.EmergencySeverity}},
+	}
+	// Una storia stabile intorno a 20 gradi e una in crescita fino alla soglia critica
+	stable := history(20, 20.5, 19.5, 20, 20.2, 19.8, 20.1, 19.9)
+	rising := history(49, 47, 45, 43, 41, 39, 37, 35)
+
+	tests := []struct {
+		name         string
+		value        float64
+		readings     []types.SensorData
+		wantCritical bool
+		wantOutlier  bool
+	}{
+		{name: "normal value", value: 20.3, readings: stable},
+		{name: "outlier below the critical threshold", value: 35, readings: stable, wantOutlier: true},
+		// Il rilevamento degli outlier non blocca la fast lane, ma il suo esito viene registrato
+		{name: "critical outlier", value: 80, readings: stable, wantCritical: true, wantOutlier: true},
+		{name: "critical plausible value", value: 51, readings: rising, wantCritical: true},
+		// Senza storia sufficiente il detector non segnala outlier
+		{name: "critical without history", value: 80, readings: history(20, 21), wantCritical: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := types.SensorData{SensorID: "sensor-1", Timestamp: 1001, Type: "temperature", Data: tt.value}
+			verdict := evaluateReading(profile, data, tt.readings)
+			if verdict.critical != tt.wantCritical || verdict.result.Outlier != tt.wantOutlier {
+				t.Fatalf("evaluateReading(%v) = critical %v, outlier %v; want %v, %v", tt.value, verdict.critical, verdict.result.Outlier, tt.wantCritical, tt.wantOutlier)
+			}
+			if !verdict.critical {
+				return
+			}
+			if verdict.event.Severity != types.EmergencySeverity || verdict.event.Data != tt.value {
+				t.Errorf("critical event = %+v", verdict.event)
+			}
+			if verdict.event.Outlier == nil || *verdict.event.Outlier != tt.wantOutlier {
+				t.Errorf("critical event outlier = %v, want %v", verdict.event.Outlier, tt.wantOutlier)
+			}
+			if verdict.event.Detector != string(environment.ZScoreDetector) {
+				t.Errorf("critical event detector = %q, want %q", verdict.event.Detector, environment.ZScoreDetector)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"SensorContinuum/internal/edge-hub/environment"
+	"SensorContinuum/pkg/types"
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// historyReadingHeaderSize è la dimensione della parte fissa di una lettura codificata:
+// 8 byte per il timestamp e 8 byte per il valore.
+const historyReadingHeaderSize = 16
+
+// encodeHistoryReading codifica una lettura nel formato binario compatto usato nella storia del sensore:
+// timestamp (int64 big endian), valore (float64 big endian) e tipo del sensore.
+// L'ID del sensore è già contenuto nella chiave, mentre macrozona e zona coincidono con quelle dell'hub.
+// Letture identiche (stesso timestamp, valore e tipo) producono lo stesso membro e vengono quindi deduplicate.
+func encodeHistoryReading(data types.SensorData) string {
+	b := make([]byte, historyReadingHeaderSize, historyReadingHeaderSize+len(data.Type))
+	binary.BigEndian.PutUint64(b[0:8], uint64(data.Timestamp))
+	binary.BigEndian.PutUint64(b[8:16], math.Float64bits(data.Data))
+	b = append(b, data.Type...)
+	return string(b)
+}
+
+// decodeHistoryReading decodifica una lettura salvata con encodeHistoryReading.
+func decodeHistoryReading(sensorID string, member string) (types.SensorData, error) {
+	if len(member) < historyReadingHeaderSize {
+		return types.SensorData{}, errors.New("invalid history reading: too short")
+	}
+	b := []byte(member)
+	return types.SensorData{
+		EdgeMacrozone: environment.EdgeMacrozone,
+		EdgeZone:      environment.EdgeZone,
+		SensorID:      sensorID,
+		Timestamp:     int64(binary.BigEndian.Uint64(b[0:8])),
+		Data:          math.Float64frombits(binary.BigEndian.Uint64(b[8:16])),
+		Type:          string(b[historyReadingHeaderSize:]),
+	}, nil
+}
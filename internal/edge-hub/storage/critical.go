@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"SensorContinuum/pkg/logger"
+	"SensorContinuum/pkg/types"
+	"context"
+	"encoding/json"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// criticalEventsKey è la lista Redis delle letture critiche in attesa di essere pubblicate, dalla più vecchia.
+// Il filtro aggiunge le letture in coda senza attendere il broker; il dispatcher le rimuove solo dopo la conferma.
+const criticalEventsKey = "critical:pending"
+
+// criticalEventsDeadLetterKey è la lista Redis delle letture critiche che non possono essere decodificate.
+// Vengono conservate per l'analisi, ma non bloccano la pubblicazione delle letture successive.
+const criticalEventsDeadLetterKey = "critical:dead-letter"
+
+// PendingCriticalEvent è una lettura critica in attesa di essere pubblicata, con il payload con cui è stata salvata.
+type PendingCriticalEvent struct {
+	Payload string
+	Event   types.CriticalEvent
+}
+
+// AddPendingCriticalEvent salva una lettura critica in Redis, da cui viene pubblicata dal dispatcher delle letture critiche.
+func AddPendingCriticalEvent(ctx context.Context, event types.CriticalEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return RedisClient.RPush(ctx, criticalEventsKey, payload).Err()
+}
+
+// GetPendingCriticalEvents recupera al più n letture critiche in attesa, a partire dalla più vecchia.
+// Le letture che non possono essere decodificate vengono spostate in criticalEventsDeadLetterKey e non vengono restituite.
+func GetPendingCriticalEvents(ctx context.Context, n int) ([]PendingCriticalEvent, error) {
+	values, err := RedisClient.LRange(ctx, criticalEventsKey, 0, int64(n-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]PendingCriticalEvent, 0, len(values))
+	for _, payload := range values {
+		var event types.CriticalEvent
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			logger.Log.Error("Invalid pending critical event, moving it to ", criticalEventsDeadLetterKey, ": ", err)
+			_, err := RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.RPush(ctx, criticalEventsDeadLetterKey, payload)
+				pipe.LRem(ctx, criticalEventsKey, 1, payload)
+				return nil
+			})
+			if err != nil {
+				logger.Log.Error("Error moving invalid critical event out of ", criticalEventsKey, ": ", err)
+			}
+			continue
+		}
+		events = append(events, PendingCriticalEvent{Payload: payload, Event: event})
+	}
+	return events, nil
+}
+
+// MarkCriticalEventSent rimuove da Redis una lettura critica pubblicata e confermata dal broker.
+// Viene rimossa solo la prima occorrenza del payload, cioè la lettura più vecchia tra quelle identiche.
+func MarkCriticalEventSent(ctx context.Context, event PendingCriticalEvent) error {
+	return RedisClient.LRem(ctx, criticalEventsKey, 1, event.Payload).Err()
+}
+
+// CountPendingCriticalEvents restituisce il numero di letture critiche in attesa di essere pubblicate.
+func CountPendingCriticalEvents(ctx context.Context) (int64, error) {
+	return RedisClient.LLen(ctx, criticalEventsKey).Result()
+}
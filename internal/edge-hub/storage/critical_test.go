@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"SensorContinuum/pkg/types"
+	"context"
+	"testing"
+)
+
+func TestPendingCriticalEvents(t *testing.T) {
+	redisServer(t)
+	ctx := context.Background()
+
+	// Due letture identiche e una diversa, nell'ordine di rilevamento
+	events := []types.CriticalEvent{
+		{SensorID: "sensor-1", Timestamp: 1, Data: 80, Severity: types.EmergencySeverity},
+		{SensorID: "sensor-1", Timestamp: 1, Data: 80, Severity: types.EmergencySeverity},
+		{SensorID: "sensor-2", Timestamp: 2, Data: -20, Severity: types.CriticalSeverity},
+	}
+	for _, event := range events {
+		if err := AddPendingCriticalEvent(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pending, err := GetPendingCriticalEvents(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 2 || pending[0].Event.SensorID != "sensor-1" || pending[1].Event.SensorID != "sensor-1" {
+		t.Fatalf("GetPendingCriticalEvents = %+v, want the two oldest events", pending)
+	}
+
+	// La conferma rimuove una sola occorrenza di una lettura duplicata
+	if err := MarkCriticalEventSent(ctx, pending[0]); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := CountPendingCriticalEvents(ctx); err != nil || count != 2 {
+		t.Fatalf("CountPendingCriticalEvents = %d, %v; want 2", count, err)
+	}
+	if err := MarkCriticalEventSent(ctx, pending[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err = GetPendingCriticalEvents(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].Event.SensorID != "sensor-2" {
+		t.Fatalf("GetPendingCriticalEvents after sending = %+v, want sensor-2", pending)
+	}
+}
+
+func TestGetPendingCriticalEventsInvalidEntry(t *testing.T) {
+	redisServer(t)
+	ctx := context.Background()
+
+	if err := RedisClient.RPush(ctx, criticalEventsKey, "{invalid").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddPendingCriticalEvent(ctx, types.CriticalEvent{SensorID: "sensor-1", Timestamp: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// La lettura non valida non blocca quella successiva e viene spostata tra i dead letter
+	pending, err := GetPendingCriticalEvents(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].Event.SensorID != "sensor-1" {
+		t.Fatalf("GetPendingCriticalEvents = %+v, want sensor-1", pending)
+	}
+	if count, err := CountPendingCriticalEvents(ctx); err != nil || count != 1 {
+		t.Fatalf("CountPendingCriticalEvents = %d, %v; want 1", count, err)
+	}
+	if dead, err := RedisClient.LRange(ctx, criticalEventsDeadLetterKey, 0, -1).Result(); err != nil || len(dead) != 1 || dead[0] != "{invalid" {
+		t.Fatalf("dead letter = %v, %v; want the invalid payload", dead, err)
+	}
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"SensorContinuum/pkg/logger"
+	"SensorContinuum/pkg/types"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// filteredDataOutboxKey è la hash Redis con i riepiloghi al minuto in attesa di essere inviati al Proximity Hub,
+// indicizzati per sensore e minuto. Un riepilogo ricalcolato sostituisce quello dello stesso minuto non ancora inviato.
+const filteredDataOutboxKey = "outbox:filtered-data"
+
+// filteredDataOutboxOrderKey è il sorted set degli identificativi dei riepiloghi in attesa, con score pari al minuto,
+// in modo che vengano inviati a partire dal più vecchio.
+const filteredDataOutboxOrderKey = "outbox:filtered-data:order"
+
+// filteredDataDeadLetterKey è la hash Redis con i riepiloghi dell'outbox che non possono essere decodificati,
+// indicizzati come nell'outbox. Vengono conservati per l'analisi, ma non bloccano l'invio dei riepiloghi successivi.
+const filteredDataDeadLetterKey = "outbox:filtered-data:dead-letter"
+
+// markSummarySentScript rimuove un riepilogo dall'outbox solo se non è stato sostituito nel frattempo da una nuova revisione.
+// ARGV: identificativo del riepilogo, payload inviato.
+var markSummarySentScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+redis.call('HDEL', KEYS[1], ARGV[1])
+redis.call('ZREM', KEYS[2], ARGV[1])
+return 1
+`)
+
+// deadLetterSummaryScript sposta un riepilogo non decodificabile dall'outbox alla hash dei dead letter,
+// solo se non è stato sostituito nel frattempo da una nuova revisione.
+// ARGV: identificativo del riepilogo, payload letto.
+var deadLetterSummaryScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+redis.call('HSET', KEYS[3], ARGV[1], ARGV[2])
+redis.call('HDEL', KEYS[1], ARGV[1])
+redis.call('ZREM', KEYS[2], ARGV[1])
+return 1
+`)
+
+// PendingSummary è un riepilogo al minuto salvato nell'outbox, con il payload con cui è stato salvato.
+type PendingSummary struct {
+	ID      string
+	Payload string
+	Summary types.SensorMinuteSummary
+}
+
+// summaryOutboxID restituisce l'identificativo nell'outbox del riepilogo di un sensore per un minuto.
+func summaryOutboxID(summary types.SensorMinuteSummary) string {
+	return fmt.Sprintf("%s:%d", summary.SensorID, summary.Timestamp)
+}
+
+// AddPendingSummary salva un riepilogo al minuto nell'outbox, da cui viene inviato al Proximity Hub dal dispatcher.
+func AddPendingSummary(ctx context.Context, summary types.SensorMinuteSummary) error {
+	payload, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	id := summaryOutboxID(summary)
+	_, err = RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, filteredDataOutboxKey, id, payload)
+		pipe.ZAdd(ctx, filteredDataOutboxOrderKey, redis.Z{Score: float64(summary.Timestamp), Member: id})
+		return nil
+	})
+	return err
+}
+
+// GetPendingSummaries recupera al più n riepiloghi in attesa, a partire dal minuto più vecchio.
+// I riepiloghi che non possono essere decodificati vengono spostati in filteredDataDeadLetterKey e non vengono restituiti.
+func GetPendingSummaries(ctx context.Context, n int) ([]PendingSummary, error) {
+	ids, err := RedisClient.ZRange(ctx, filteredDataOutboxOrderKey, 0, int64(n-1)).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	values, err := RedisClient.HMGet(ctx, filteredDataOutboxKey, ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]PendingSummary, 0, len(ids))
+	for i, value := range values {
+		payload, ok := value.(string)
+		if !ok {
+			// Identificativo senza riepilogo, rimosso in modo non atomico: lo elimina dall'ordine
+			if err := RedisClient.ZRem(ctx, filteredDataOutboxOrderKey, ids[i]).Err(); err != nil {
+				logger.Log.Error("Error removing missing summary ", ids[i], " from outbox order: ", err)
+			}
+			continue
+		}
+		var summary types.SensorMinuteSummary
+		if err := json.Unmarshal([]byte(payload), &summary); err != nil {
+			// Un riepilogo non valido non deve bloccare l'outbox: viene spostato tra i dead letter
+			logger.Log.Error("Invalid pending summary ", ids[i], ", moving it to ", filteredDataDeadLetterKey, ": ", err)
+			keys := []string{filteredDataOutboxKey, filteredDataOutboxOrderKey, filteredDataDeadLetterKey}
+			if err := deadLetterSummaryScript.Run(ctx, RedisClient, keys, ids[i], payload).Err(); err != nil {
+				logger.Log.Error("Error moving invalid summary ", ids[i], " out of outbox: ", err)
+			}
+			continue
+		}
+		summaries = append(summaries, PendingSummary{ID: ids[i], Payload: payload, Summary: summary})
+	}
+	return summaries, nil
+}
+
+// MarkSummarySent rimuove dall'outbox un riepilogo inviato e confermato dal broker.
+// Se nel frattempo il riepilogo è stato sostituito da una nuova revisione, questa resta in attesa.
+func MarkSummarySent(ctx context.Context, summary PendingSummary) error {
+	return markSummarySentScript.Run(ctx, RedisClient, []string{filteredDataOutboxKey, filteredDataOutboxOrderKey}, summary.ID, summary.Payload).Err()
+}
+
+// CountPendingSummaries restituisce il numero di riepiloghi in attesa di essere inviati.
+func CountPendingSummaries(ctx context.Context) (int64, error) {
+	return RedisClient.HLen(ctx, filteredDataOutboxKey).Result()
+}
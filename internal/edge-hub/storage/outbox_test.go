@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"SensorContinuum/pkg/types"
+	"context"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// pendingSummaries recupera i riepiloghi in attesa, fallendo il test in caso di errore.
+func pendingSummaries(t *testing.T) []PendingSummary {
+	t.Helper()
+	summaries, err := GetPendingSummaries(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return summaries
+}
+
+func TestMarkSummarySentReplacedRevision(t *testing.T) {
+	redisServer(t)
+	ctx := context.Background()
+
+	summary := types.SensorMinuteSummary{SensorID: "sensor-1", Timestamp: 60, Mean: 20}
+	if err := AddPendingSummary(ctx, summary); err != nil {
+		t.Fatal(err)
+	}
+	sent := pendingSummaries(t)
+	if len(sent) != 1 {
+		t.Fatalf("pending summaries = %+v, want 1", sent)
+	}
+
+	// Mentre il riepilogo è in volo viene ricalcolato con una nuova revisione dello stesso minuto
+	summary.Mean, summary.Revision = 21, 1
+	if err := AddPendingSummary(ctx, summary); err != nil {
+		t.Fatal(err)
+	}
+	if err := MarkSummarySent(ctx, sent[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	// La conferma della vecchia revisione non rimuove quella nuova
+	pending := pendingSummaries(t)
+	if len(pending) != 1 || pending[0].ID != sent[0].ID || pending[0].Summary.Revision != 1 || pending[0].Summary.Mean != 21 {
+		t.Fatalf("pending summaries after the old revision was sent = %+v, want revision 1", pending)
+	}
+
+	if err := MarkSummarySent(ctx, pending[0]); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := CountPendingSummaries(ctx); err != nil || count != 0 {
+		t.Fatalf("CountPendingSummaries = %d, %v; want 0", count, err)
+	}
+	if ids, err := RedisClient.ZRange(ctx, filteredDataOutboxOrderKey, 0, -1).Result(); err != nil || len(ids) != 0 {
+		t.Fatalf("outbox order = %v, %v; want empty", ids, err)
+	}
+}
+
+func TestGetPendingSummariesInvalidEntry(t *testing.T) {
+	redisServer(t)
+	ctx := context.Background()
+
+	// Un riepilogo non decodificabile precede quelli validi nell'ordine di invio
+	if err := RedisClient.HSet(ctx, filteredDataOutboxKey, "sensor-1:0", "{invalid").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := RedisClient.ZAdd(ctx, filteredDataOutboxOrderKey, redis.Z{Score: 0, Member: "sensor-1:0"}).Err(); err != nil {
+		t.Fatal(err)
+	}
+	for _, timestamp := range []int64{60, 120} {
+		if err := AddPendingSummary(ctx, types.SensorMinuteSummary{SensorID: "sensor-1", Timestamp: timestamp}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pending := pendingSummaries(t)
+	if len(pending) != 2 || pending[0].Summary.Timestamp != 60 || pending[1].Summary.Timestamp != 120 {
+		t.Fatalf("pending summaries = %+v, want minutes 60 and 120", pending)
+	}
+
+	// Il riepilogo non valido è stato spostato tra i dead letter
+	if payload, err := RedisClient.HGet(ctx, filteredDataDeadLetterKey, "sensor-1:0").Result(); err != nil || payload != "{invalid" {
+		t.Fatalf("dead letter = %q, %v; want the invalid payload", payload, err)
+	}
+	if count, err := CountPendingSummaries(ctx); err != nil || count != 2 {
+		t.Fatalf("CountPendingSummaries = %d, %v; want 2", count, err)
+	}
+	if ids, err := RedisClient.ZRange(ctx, filteredDataOutboxOrderKey, 0, -1).Result(); err != nil || len(ids) != 2 {
+		t.Fatalf("outbox order = %v, %v; want 2 summaries", ids, err)
+	}
+}
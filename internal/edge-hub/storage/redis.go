@@ -6,7 +6,9 @@ import (
 	"SensorContinuum/pkg/types"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,6 +18,67 @@ import (
 
 const sensorMetadataKey = "sensor:%s:metadata"
 const sensorHistoryKey = "sensor:%s:history"
+const sensorRejectedKey = "sensor:%s:rejected"
+
+// sensorRejectedCountKey è il contatore delle letture scartate di un sensore in un minuto (timestamp di inizio del minuto).
+const sensorRejectedCountKey = "sensor:%s:rejected:%d"
+
+// rejectedPendingKey è la hash dei sensori con letture scartate salvate ma non ancora inoltrate al Proximity Hub,
+// con il numero di letture in attesa, che sono le più recenti della lista sensorRejectedKey del sensore.
+const rejectedPendingKey = "rejected:pending"
+
+// sensorIndexKey è il set Redis che contiene gli ID di tutti i sensori con metadati o storia in cache.
+// Sostituisce la scansione con KEYS, che blocca Redis e cresce con la dimensione del keyspace.
+const sensorIndexKey = "sensors:index"
+
+// sensorIndexMigratedKey indica che l'indice è già stato popolato a partire dalle chiavi esistenti.
+const sensorIndexMigratedKey = "sensors:index:migrated"
+
+// sensorHistoryMigratedKey indica che le storie salvate come liste JSON sono già state convertite in sorted set.
+const sensorHistoryMigratedKey = "sensors:history:migrated"
+
+// sensorNotificationKey contiene il tipo dell'ultima notifica inviata per un sensore, usato per non ripetere la stessa notifica.
+const sensorNotificationKey = "sensor:%s:notification"
+
+// sensorNotificationRateKey è presente finché non è trascorso NotificationRateLimit dall'ultima notifica del sensore.
+const sensorNotificationRateKey = "sensor:%s:notification:rate"
+
+// aggregationWatermarkKey contiene il timestamp dell'ultimo minuto aggregato (watermark dell'aggregatore).
+// È condiviso tra le istanze, in modo che un nuovo leader riprenda l'aggregazione da dove si è fermato il precedente.
+const aggregationWatermarkKey = "aggregation:last_aggregated_minute"
+
+// aggregationEmittedKey è la hash dei sensori il cui riepilogo è stato inviato per un minuto,
+// con il numero di invii effettuati (il primo invio è la revisione 0).
+const aggregationEmittedKey = "aggregation:emitted:%d"
+
+// aggregationLateKey è il set dei sensori che hanno ricevuto letture in ritardo per un minuto già aggregato.
+const aggregationLateKey = "aggregation:late:%d"
+
+// sensorCommandClaimKey indica che un comando è già stato preso in carico da un'istanza dell'hub.
+// Tutte le istanze della zona ricevono i comandi conservati dal broker, ma solo una li consegna al sensore.
+const sensorCommandClaimKey = "command:%s:claimed"
+
+// sensorCommandClaimTTL specifica per quanto tempo viene mantenuta la presa in carico di un comando.
+const sensorCommandClaimTTL = 24 * time.Hour
+
+// sensorNonceKey indica che una lettura firmata con il nonce indicato è già stata ricevuta da un sensore.
+// È condivisa tra le istanze del servizio di filtraggio, in modo che una lettura ripetuta venga riconosciuta
+// da qualunque istanza la riceva, e scade quando la firma della lettura non è più accettata.
+const sensorNonceKey = "sensor:%s:nonce:%d"
+
+// sensorIndexScanCount è il numero di chiavi richieste a Redis per ogni iterazione di SCAN.
+const sensorIndexScanCount = 500
+
+// removeSensorKeyScript rimuove una chiave del sensore e, se non esiste più
+// l'altra chiave (metadati o storia), rimuove il sensore dall'indice.
+// L'esecuzione come script garantisce l'atomicità rispetto agli inserimenti concorrenti.
+var removeSensorKeyScript = redis.NewScript(`
+redis.call('DEL', unpack(KEYS, 1, #KEYS - 2))
+if redis.call('EXISTS', KEYS[#KEYS - 1]) == 0 then
+	redis.call('SREM', KEYS[#KEYS], ARGV[1])
+end
+return 1
+`)
 
 var RedisClient *redis.Client
 
@@ -29,6 +92,120 @@ func InitRedisConnection() {
 		logger.Log.Error("Failed to connect to Redis: ", err)
 		panic(fmt.Sprintf("Failed to connect to Redis at %s:%s", environment.RedisAddress, environment.RedisPort))
 	}
+	if err := ensureSensorIndex(context.Background()); err != nil {
+		logger.Log.Error("Failed to build sensor index: ", err)
+	}
+	if err := ensureSensorHistoryFormat(context.Background()); err != nil {
+		logger.Log.Error("Failed to migrate sensor history: ", err)
+	}
+}
+
+// ensureSensorIndex popola l'indice dei sensori a partire dalle chiavi già presenti in cache,
+// se non è già stato fatto. Permette di migrare le cache create prima dell'introduzione dell'indice.
+func ensureSensorIndex(ctx context.Context) error {
+	migrated, err := RedisClient.Exists(ctx, sensorIndexMigratedKey).Result()
+	if err != nil {
+		return err
+	}
+	if migrated > 0 {
+		return nil
+	}
+	logger.Log.Info("Sensor index not found, backfilling from existing keys")
+	count, err := BackfillSensorIndex(ctx)
+	if err != nil {
+		return err
+	}
+	logger.Log.Info("Sensor index backfilled with ", count, " sensors")
+	return RedisClient.Set(ctx, sensorIndexMigratedKey, time.Now().UTC().Unix(), 0).Err()
+}
+
+// ensureSensorHistoryFormat converte le storie dei sensori salvate come liste JSON nel formato a sorted set,
+// se non è già stato fatto. Permette di migrare le cache create prima dell'indicizzazione per timestamp.
+func ensureSensorHistoryFormat(ctx context.Context) error {
+	migrated, err := RedisClient.Exists(ctx, sensorHistoryMigratedKey).Result()
+	if err != nil {
+		return err
+	}
+	if migrated > 0 {
+		return nil
+	}
+	logger.Log.Info("Sensor history format not migrated, converting existing lists")
+	count, err := MigrateSensorHistory(ctx)
+	if err != nil {
+		return err
+	}
+	logger.Log.Info("Sensor history migrated for ", count, " sensors")
+	return RedisClient.Set(ctx, sensorHistoryMigratedKey, time.Now().UTC().Unix(), 0).Err()
+}
+
+// MigrateSensorHistory converte in sorted set tutte le storie dei sensori ancora salvate come liste JSON.
+// Utilizza SCAN in modo incrementale filtrando le sole chiavi di tipo lista. L'operazione è idempotente.
+func MigrateSensorHistory(ctx context.Context) (int, error) {
+	count := 0
+	iter := RedisClient.ScanType(ctx, 0, "sensor:*:history", sensorIndexScanCount, "list").Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		sensorID := strings.TrimSuffix(strings.TrimPrefix(key, "sensor:"), ":history")
+		vals, err := RedisClient.LRange(ctx, key, 0, -1).Result()
+		if err != nil {
+			return count, err
+		}
+		members := make([]redis.Z, 0, len(vals))
+		for _, v := range vals {
+			var d types.SensorData
+			if err := json.Unmarshal([]byte(v), &d); err != nil {
+				logger.Log.Error("Error unmarshalling sensor data: ", err)
+				continue
+			}
+			members = append(members, redis.Z{Score: float64(d.Timestamp), Member: encodeHistoryReading(d)})
+		}
+		// La lista viene sostituita dal sorted set in un'unica transazione
+		_, err = RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			if len(members) > 0 {
+				pipe.ZAdd(ctx, key, members...)
+			}
+			return nil
+		})
+		if err != nil {
+			return count, err
+		}
+		logger.Log.Debug("Migrated ", len(members), " readings for sensor ", sensorID)
+		count++
+	}
+	if err := iter.Err(); err != nil {
+		return count, err
+	}
+	return count, nil
+}
+
+// BackfillSensorIndex aggiunge all'indice tutti i sensori che hanno metadati o storia in cache.
+// Utilizza SCAN in modo incrementale per non bloccare Redis. L'operazione è idempotente.
+func BackfillSensorIndex(ctx context.Context) (int, error) {
+	set := mapset.NewSet[string]()
+	for _, pattern := range []string{"sensor:*:metadata", "sensor:*:history"} {
+		iter := RedisClient.Scan(ctx, 0, pattern, sensorIndexScanCount).Iterator()
+		for iter.Next(ctx) {
+			sensorID := strings.TrimPrefix(iter.Val(), "sensor:")
+			sensorID = strings.TrimSuffix(sensorID, ":metadata")
+			sensorID = strings.TrimSuffix(sensorID, ":history")
+			set.Add(sensorID)
+		}
+		if err := iter.Err(); err != nil {
+			return 0, err
+		}
+	}
+	if set.Cardinality() == 0 {
+		return 0, nil
+	}
+	members := make([]interface{}, 0, set.Cardinality())
+	for _, id := range set.ToSlice() {
+		members = append(members, id)
+	}
+	if err := RedisClient.SAdd(ctx, sensorIndexKey, members...).Err(); err != nil {
+		return 0, err
+	}
+	return set.Cardinality(), nil
 }
 
 // TryOrRenewLeader prova ad acquisire il lock di leader election
@@ -65,6 +242,79 @@ func TryOrRenewLeader(ctx context.Context) (bool, error) {
 	return false, nil
 }
 
+// aggregationStateTTL restituisce per quanto tempo mantenere lo stato dell'aggregazione di un minuto:
+// il minuto può essere ricalcolato fino a AggregationAllowedLateness dopo la sua aggregazione,
+// che avviene con un ritardo pari a AggregationFetchOffset.
+func aggregationStateTTL() time.Duration {
+	return environment.AggregationAllowedLateness - environment.AggregationFetchOffset + environment.AggregationInterval
+}
+
+// GetAggregationWatermark recupera l'ultimo minuto aggregato.
+// Restituisce false se nessun minuto è ancora stato aggregato.
+func GetAggregationWatermark(ctx context.Context) (time.Time, bool, error) {
+	val, err := RedisClient.Get(ctx, aggregationWatermarkKey).Int64()
+	if errors.Is(err, redis.Nil) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return time.Unix(val, 0).UTC(), true, nil
+}
+
+// SetAggregationWatermark aggiorna l'ultimo minuto aggregato.
+func SetAggregationWatermark(ctx context.Context, minute time.Time) error {
+	return RedisClient.Set(ctx, aggregationWatermarkKey, minute.Truncate(time.Minute).Unix(), 0).Err()
+}
+
+// GetSummaryRevision restituisce il numero di revisione del prossimo riepilogo di un sensore
+// per il minuto specificato, cioè il numero di riepiloghi già inviati (0 per il primo invio).
+func GetSummaryRevision(ctx context.Context, sensorID string, minute time.Time) (int, error) {
+	key := fmt.Sprintf(aggregationEmittedKey, minute.Truncate(time.Minute).Unix())
+	revision, err := RedisClient.HGet(ctx, key, sensorID).Int()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return revision, err
+}
+
+// MarkSummaryEmitted registra l'invio del riepilogo di un sensore per il minuto specificato.
+// Va chiamata solo dopo che il riepilogo è stato salvato nell'outbox, in modo che un riepilogo
+// non inviato non consumi un numero di revisione.
+func MarkSummaryEmitted(ctx context.Context, sensorID string, minute time.Time) error {
+	key := fmt.Sprintf(aggregationEmittedKey, minute.Truncate(time.Minute).Unix())
+	pipe := RedisClient.TxPipeline()
+	pipe.HIncrBy(ctx, key, sensorID, 1)
+	pipe.Expire(ctx, key, aggregationStateTTL())
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// MarkLateReading segnala che un sensore ha ricevuto una lettura in ritardo per un minuto già aggregato.
+func MarkLateReading(ctx context.Context, sensorID string, minute time.Time) error {
+	key := fmt.Sprintf(aggregationLateKey, minute.Truncate(time.Minute).Unix())
+	pipe := RedisClient.TxPipeline()
+	pipe.SAdd(ctx, key, sensorID)
+	pipe.Expire(ctx, key, aggregationStateTTL())
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// PopLateSensors recupera e rimuove i sensori con letture in ritardo per il minuto specificato.
+func PopLateSensors(ctx context.Context, minute time.Time) ([]string, error) {
+	key := fmt.Sprintf(aggregationLateKey, minute.Truncate(time.Minute).Unix())
+	var members *redis.StringSliceCmd
+	_, err := RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		members = pipe.SMembers(ctx, key)
+		pipe.Del(ctx, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return members.Val(), nil
+}
+
 // AddSensor Aggiunge un nuovo sensore alla cache Redis.
 // Controlla se il sensore esiste già prima di aggiungerlo
 func AddSensor(ctx context.Context, sensor types.Sensor) (bool, error) {
@@ -74,10 +324,17 @@ func AddSensor(ctx context.Context, sensor types.Sensor) (bool, error) {
 		return false, err
 	}
 	// SETNX: aggiunge solo se la chiave non esiste
-	added, err := RedisClient.SetNX(ctx, key, b, 0).Result()
+	// L'indice viene aggiornato nella stessa transazione
+	var setNX *redis.BoolCmd
+	_, err = RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		setNX = pipe.SetNX(ctx, key, b, 0)
+		pipe.SAdd(ctx, sensorIndexKey, sensor.Id)
+		return nil
+	})
 	if err != nil {
 		return false, err
 	}
+	added := setNX.Val()
 	if !added {
 		return true, nil // già esiste
 	}
@@ -85,99 +342,284 @@ func AddSensor(ctx context.Context, sensor types.Sensor) (bool, error) {
 	return false, nil
 }
 
-// AddSensorHistory Salva un nuovo dato SensorData nella lista Redis del sensore.
-func AddSensorHistory(ctx context.Context, data types.SensorData) error {
+// setSensorPublicKeyScript imposta la chiave pubblica di firma di un sensore registrato, solo se non ne ha già una.
+// Restituisce 0 se il sensore non è registrato o ha già una chiave.
+// ARGV: chiave pubblica in base64.
+var setSensorPublicKeyScript = redis.NewScript(`
+local raw = redis.call('GET', KEYS[1])
+if not raw then
+	return 0
+end
+local sensor = cjson.decode(raw)
+if type(sensor['public_key']) == 'string' and sensor['public_key'] ~= '' then
+	return 0
+end
+sensor['public_key'] = ARGV[1]
+redis.call('SET', KEYS[1], cjson.encode(sensor), 'KEEPTTL')
+return 1
+`)
+
+// SetSensorPublicKey imposta la chiave pubblica di firma di un sensore già registrato senza chiave,
+// ad esempio un sensore che ha abilitato la firma dopo la prima registrazione.
+// La chiave di un sensore non viene mai sostituita: per cambiarla il sensore deve essere rimosso e registrato di nuovo.
+// Restituisce true se la chiave è stata impostata.
+func SetSensorPublicKey(ctx context.Context, sensorID string, publicKey string) (bool, error) {
+	key := fmt.Sprintf(sensorMetadataKey, sensorID)
+	set, err := setSensorPublicKeyScript.Run(ctx, RedisClient, []string{key}, publicKey).Int()
+	if err != nil {
+		return false, err
+	}
+	return set == 1, nil
+}
+
+// setSensorReferenceScript aggiorna il riferimento di un sensore registrato, solo se è diverso da quello salvato.
+// Restituisce 0 se il sensore non è registrato o il riferimento non cambia.
+// ARGV: riferimento del sensore.
+var setSensorReferenceScript = redis.NewScript(`
+local raw = redis.call('GET', KEYS[1])
+if not raw then
+	return 0
+end
+local sensor = cjson.decode(raw)
+local reference = sensor['reference']
+if type(reference) ~= 'string' then
+	reference = ''
+end
+if reference == ARGV[1] then
+	return 0
+end
+sensor['reference'] = ARGV[1]
+redis.call('SET', KEYS[1], cjson.encode(sensor), 'KEEPTTL')
+return 1
+`)
+
+// SetSensorReference aggiorna il riferimento di un sensore già registrato, ad esempio quando il sensore
+// viene spostato e registrato di nuovo con un altro riferimento.
+// Restituisce true se il riferimento è cambiato.
+func SetSensorReference(ctx context.Context, sensorID string, reference string) (bool, error) {
+	key := fmt.Sprintf(sensorMetadataKey, sensorID)
+	set, err := setSensorReferenceScript.Run(ctx, RedisClient, []string{key}, reference).Int()
+	if err != nil {
+		return false, err
+	}
+	return set == 1, nil
+}
+
+// GetSensor Recupera i metadati di un sensore dalla cache Redis.
+// Restituisce false se il sensore non è registrato.
+func GetSensor(ctx context.Context, sensorID string) (types.Sensor, bool, error) {
+	key := fmt.Sprintf(sensorMetadataKey, sensorID)
+	val, err := RedisClient.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return types.Sensor{}, false, nil
+	}
+	if err != nil {
+		return types.Sensor{}, false, err
+	}
+	var sensor types.Sensor
+	if err := json.Unmarshal([]byte(val), &sensor); err != nil {
+		return types.Sensor{}, false, err
+	}
+	return sensor, true, nil
+}
+
+// AddSensorHistory Salva un nuovo dato SensorData nel sorted set Redis del sensore, con score pari al timestamp.
+// Mantiene al più windowSize letture e rimuove quelle più vecchie di HistoryMaxAge rispetto alla lettura inserita.
+func AddSensorHistory(ctx context.Context, data types.SensorData, windowSize int) error {
 	key := fmt.Sprintf(sensorHistoryKey, data.SensorID)
+	minScore := data.Timestamp - int64(environment.HistoryMaxAge.Seconds())
+	pipe := RedisClient.TxPipeline()
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(data.Timestamp), Member: encodeHistoryReading(data)})
+	pipe.ZRemRangeByRank(ctx, key, 0, int64(-windowSize-1))
+	pipe.ZRemRangeByScore(ctx, key, "-inf", "("+strconv.FormatInt(minScore, 10))
+	pipe.SAdd(ctx, sensorIndexKey, data.SensorID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// AddRejectedSensorData Salva una lettura scartata dal filtro nella lista Redis del sensore,
+// mantenendo al più RejectedWindowSize letture, e incrementa il contatore degli scarti del minuto.
+func AddRejectedSensorData(ctx context.Context, data types.RejectedSensorData) error {
+	key := fmt.Sprintf(sensorRejectedKey, data.SensorID)
 	b, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
+	minute := time.Unix(data.Timestamp, 0).UTC().Truncate(time.Minute).Unix()
+	countKey := fmt.Sprintf(sensorRejectedCountKey, data.SensorID, minute)
 	pipe := RedisClient.Pipeline()
 	pipe.LPush(ctx, key, b)
-	pipe.LTrim(ctx, key, 0, int64(environment.HistoryWindowSize-1))
+	pipe.LTrim(ctx, key, 0, int64(environment.RejectedWindowSize-1))
+	pipe.Incr(ctx, countKey)
+	pipe.Expire(ctx, countKey, environment.RejectedCountTTL)
 	_, err = pipe.Exec(ctx)
 	return err
 }
 
-// GetSensorHistory Recupera le ultime n letture per un dato sensore.
-func GetSensorHistory(ctx context.Context, sensorID string, n int) ([]types.SensorData, error) {
-	key := fmt.Sprintf(sensorHistoryKey, sensorID)
-	vals, err := RedisClient.LRange(ctx, key, 0, int64(n-1)).Result()
+// AddPendingRejectedSensorData segna come da inoltrare la lettura scartata più recente del sensore,
+// già salvata con AddRejectedSensorData ma non consegnata al canale dei dati scartati.
+func AddPendingRejectedSensorData(ctx context.Context, sensorID string) error {
+	return RedisClient.HIncrBy(ctx, rejectedPendingKey, sensorID, 1).Err()
+}
+
+// GetPendingRejectedSensors restituisce gli ID dei sensori con letture scartate in attesa di essere inoltrate.
+func GetPendingRejectedSensors(ctx context.Context) ([]string, error) {
+	return RedisClient.HKeys(ctx, rejectedPendingKey).Result()
+}
+
+// popPendingRejectedScript restituisce il numero di letture scartate in attesa del sensore e le letture
+// ancora presenti nella lista, dalla più recente, azzerando il contatore.
+// KEYS: lista delle letture scartate, hash delle letture in attesa. ARGV: ID del sensore.
+var popPendingRejectedScript = redis.NewScript(`
+local pending = tonumber(redis.call('HGET', KEYS[2], ARGV[1]) or '0')
+redis.call('HDEL', KEYS[2], ARGV[1])
+if pending <= 0 then
+	return {0, {}}
+end
+return {pending, redis.call('LRANGE', KEYS[1], 0, pending - 1)}
+`)
+
+// PopPendingRejectedSensorData recupera le letture scartate del sensore in attesa di essere inoltrate, dalla più vecchia,
+// e restituisce anche quante letture in attesa sono già state rimosse dalla lista perché oltre RejectedWindowSize.
+func PopPendingRejectedSensorData(ctx context.Context, sensorID string) ([]types.RejectedSensorData, int, error) {
+	key := fmt.Sprintf(sensorRejectedKey, sensorID)
+	res, err := popPendingRejectedScript.Run(ctx, RedisClient, []string{key, rejectedPendingKey}, sensorID).Slice()
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
-	readings := make([]types.SensorData, 0, len(vals))
-	for _, v := range vals {
-		var d types.SensorData
-		if err := json.Unmarshal([]byte(v), &d); err != nil {
-			logger.Log.Error("Error unmarshalling sensor data: ", err)
-			continue
+	pending, _ := res[0].(int64)
+	vals, _ := res[1].([]interface{})
 
+	readings := make([]types.RejectedSensorData, 0, len(vals))
+	for i := len(vals) - 1; i >= 0; i-- {
+		val, _ := vals[i].(string)
+		var data types.RejectedSensorData
+		if err := json.Unmarshal([]byte(val), &data); err != nil {
+			logger.Log.Error("Error decoding rejected sensor data for sensor ", sensorID, ": ", err)
+			continue
 		}
-		readings = append(readings, d)
+		readings = append(readings, data)
+	}
+	return readings, int(pending) - len(vals), nil
+}
+
+// GetSensorHistory Recupera le ultime n letture per un dato sensore, dalla più recente.
+func GetSensorHistory(ctx context.Context, sensorID string, n int) ([]types.SensorData, error) {
+	key := fmt.Sprintf(sensorHistoryKey, sensorID)
+	vals, err := RedisClient.ZRevRange(ctx, key, 0, int64(n-1)).Result()
+	if err != nil {
+		return nil, err
 	}
-	return readings, nil
+	return decodeHistoryReadings(sensorID, vals), nil
 }
 
 // GetSensorHistoryByMinute recupera le letture per un dato sensore che corrispondono al minuto specificato.
 // Se ad esempio il minuto è 2024-10-05 14:23, recupera tutte le letture tra 2024-10-05 14:23:00 e 2024-10-05 14:23:59.
+// Le letture sono indicizzate per timestamp, quindi vengono lette solo quelle del minuto richiesto.
 func GetSensorHistoryByMinute(ctx context.Context, sensorID string, minute time.Time) ([]types.SensorData, error) {
 	key := fmt.Sprintf(sensorHistoryKey, sensorID)
-	vals, err := RedisClient.LRange(ctx, key, 0, int64(environment.HistoryWindowSize-1)).Result()
+	minuteStart := minute.Truncate(time.Minute).Unix()
+	vals, err := RedisClient.ZRangeByScore(ctx, key, &redis.ZRangeBy{
+		Min: strconv.FormatInt(minuteStart, 10),
+		Max: "(" + strconv.FormatInt(minuteStart+int64(time.Minute.Seconds()), 10),
+	}).Result()
 	if err != nil {
 		return nil, err
 	}
 
 	logger.Log.Debug("Retrieved ", len(vals), " readings for sensor ", sensorID, " at minute ", minute)
 
+	return decodeHistoryReadings(sensorID, vals), nil
+}
+
+// decodeHistoryReadings decodifica le letture della storia di un sensore, scartando quelle non valide.
+func decodeHistoryReadings(sensorID string, vals []string) []types.SensorData {
 	readings := make([]types.SensorData, 0, len(vals))
 	for _, v := range vals {
-		var d types.SensorData
-		if err := json.Unmarshal([]byte(v), &d); err == nil {
-			t := time.Unix(d.Timestamp, 0).UTC()
-			logger.Log.Debug("Checking reading timestamp: ", t, " against minute: ", minute)
-			if t.Year() == minute.Year() && t.Month() == minute.Month() && t.Day() == minute.Day() &&
-				t.Hour() == minute.Hour() && t.Minute() == minute.Minute() {
-				readings = append(readings, d)
-			}
-		} else {
-			logger.Log.Error("Error unmarshalling sensor data: ", err)
+		d, err := decodeHistoryReading(sensorID, v)
+		if err != nil {
+			logger.Log.Error("Error decoding sensor data: ", err)
 			continue
 		}
+		readings = append(readings, d)
 	}
-	return readings, nil
+	return readings
 }
 
-// GetAllSensorIDs Recupera tutti gli ID dei sensori presenti in Redis.
-func GetAllSensorIDs(ctx context.Context) ([]string, error) {
-	set := mapset.NewSet[string]()
-	keysMeta, err := RedisClient.Keys(ctx, "sensor:*:metadata").Result()
-	if err != nil {
-		return nil, err
-	}
-	for _, key := range keysMeta {
-		sensorID := strings.TrimPrefix(key, "sensor:")
-		sensorID = strings.TrimSuffix(sensorID, ":metadata")
-		set.Append(sensorID)
+// GetRejectedCountByMinute recupera il numero di letture di un sensore scartate dal filtro nel minuto specificato.
+func GetRejectedCountByMinute(ctx context.Context, sensorID string, minute time.Time) (int, error) {
+	key := fmt.Sprintf(sensorRejectedCountKey, sensorID, minute.Truncate(time.Minute).Unix())
+	count, err := RedisClient.Get(ctx, key).Int()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
 	}
+	return count, err
+}
 
-	keysHist, err := RedisClient.Keys(ctx, "sensor:*:history").Result()
-	if err != nil {
-		return nil, err
+// GetLastNotification recupera il tipo dell'ultima notifica inviata per un sensore.
+// Restituisce una stringa vuota se non è stata inviata alcuna notifica o se il sensore è tornato attivo.
+func GetLastNotification(ctx context.Context, sensorID string) (types.NotificationType, error) {
+	key := fmt.Sprintf(sensorNotificationKey, sensorID)
+	val, err := RedisClient.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
 	}
-	for _, key := range keysHist {
-		sensorID := strings.TrimPrefix(key, "sensor:")
-		sensorID = strings.TrimSuffix(sensorID, ":history")
-		set.Append(sensorID)
+	return types.NotificationType(val), err
+}
+
+// SetLastNotification salva il tipo dell'ultima notifica inviata per un sensore.
+func SetLastNotification(ctx context.Context, sensorID string, notificationType types.NotificationType) error {
+	key := fmt.Sprintf(sensorNotificationKey, sensorID)
+	return RedisClient.Set(ctx, key, string(notificationType), 0).Err()
+}
+
+// ClearLastNotification rimuove lo stato delle notifiche di un sensore tornato attivo.
+func ClearLastNotification(ctx context.Context, sensorID string) error {
+	key := fmt.Sprintf(sensorNotificationKey, sensorID)
+	return RedisClient.Del(ctx, key).Err()
+}
+
+// TryAcquireNotificationSlot verifica che sia trascorso NotificationRateLimit dall'ultima notifica del sensore
+// e, in tal caso, riserva l'invio della notifica corrente.
+func TryAcquireNotificationSlot(ctx context.Context, sensorID string) (bool, error) {
+	if environment.NotificationRateLimit == 0 {
+		return true, nil
 	}
+	key := fmt.Sprintf(sensorNotificationRateKey, sensorID)
+	return RedisClient.SetNX(ctx, key, time.Now().UTC().Unix(), environment.NotificationRateLimit).Result()
+}
+
+// ClaimSensorCommand prende in carico un comando per questa istanza dell'hub.
+// Restituisce false se il comando è già stato preso in carico da un'altra istanza.
+func ClaimSensorCommand(ctx context.Context, commandID string) (bool, error) {
+	key := fmt.Sprintf(sensorCommandClaimKey, commandID)
+	return RedisClient.SetNX(ctx, key, environment.HubID, sensorCommandClaimTTL).Result()
+}
+
+// ReleaseSensorCommand rilascia la presa in carico di un comando non consegnato,
+// così il comando potrà essere consegnato alla prossima ricezione.
+func ReleaseSensorCommand(ctx context.Context, commandID string) error {
+	key := fmt.Sprintf(sensorCommandClaimKey, commandID)
+	return RedisClient.Del(ctx, key).Err()
+}
 
-	return set.ToSlice(), nil
+// RecordSensorNonce registra il nonce di una lettura firmata di un sensore, mantenendolo per ttl.
+// Restituisce false se il nonce era già stato registrato, cioè se la lettura è ripetuta.
+func RecordSensorNonce(ctx context.Context, sensorID string, nonce uint64, ttl time.Duration) (bool, error) {
+	key := fmt.Sprintf(sensorNonceKey, sensorID, nonce)
+	return RedisClient.SetNX(ctx, key, 1, ttl).Result()
+}
+
+// GetAllSensorIDs Recupera tutti gli ID dei sensori presenti in Redis dall'indice dei sensori.
+func GetAllSensorIDs(ctx context.Context) ([]string, error) {
+	return RedisClient.SMembers(ctx, sensorIndexKey).Result()
 }
 
 // RemoveSensorHistory Rimuove la cronologia delle letture di un sensore.
 func RemoveSensorHistory(ctx context.Context, sensorID string) error {
 	key := fmt.Sprintf(sensorHistoryKey, sensorID)
-	_, err := RedisClient.Del(ctx, key).Result()
+	metadataKey := fmt.Sprintf(sensorMetadataKey, sensorID)
+	err := removeSensorKeyScript.Run(ctx, RedisClient, []string{key, metadataKey, sensorIndexKey}, sensorID).Err()
 	if err != nil {
 		logger.Log.Error("Error removing sensor history for sensor ", sensorID, ": ", err)
 		return err
@@ -186,14 +628,20 @@ func RemoveSensorHistory(ctx context.Context, sensorID string) error {
 	return nil
 }
 
-// RemoveSensor Rimuove un sensore dalla cache Redis.
+// RemoveSensor Rimuove un sensore dalla cache Redis, insieme alle sue letture scartate.
 func RemoveSensor(ctx context.Context, sensorID string) error {
 	key := fmt.Sprintf(sensorMetadataKey, sensorID)
-	_, err := RedisClient.Del(ctx, key).Result()
+	rejectedKey := fmt.Sprintf(sensorRejectedKey, sensorID)
+	historyKey := fmt.Sprintf(sensorHistoryKey, sensorID)
+	err := removeSensorKeyScript.Run(ctx, RedisClient, []string{key, rejectedKey, historyKey, sensorIndexKey}, sensorID).Err()
 	if err != nil {
 		logger.Log.Error("Error removing sensor ", sensorID, ": ", err)
 		return err
 	}
+	// Le letture scartate in attesa di essere inoltrate sono state rimosse insieme alla lista
+	if err := RedisClient.HDel(ctx, rejectedPendingKey, sensorID).Err(); err != nil {
+		logger.Log.Error("Error removing pending rejected data of sensor ", sensorID, ": ", err)
+	}
 	logger.Log.Info("Removed sensor ", sensorID)
 	return nil
 }
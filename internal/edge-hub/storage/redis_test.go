@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"SensorContinuum/internal/edge-hub/environment"
+	"SensorContinuum/pkg/types"
+	"context"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisServer avvia un'istanza temporanea di Redis, senza persistenza, e vi collega RedisClient.
+// Il test viene saltato se redis-server non è installato.
+func redisServer(t *testing.T) {
+	t.Helper()
+	binary, err := exec.LookPath("redis-server")
+	if err != nil {
+		t.Skip("redis-server not installed")
+	}
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	_ = listener.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, binary, "--bind", "127.0.0.1", "--port", strconv.Itoa(port), "--save", "", "--appendonly", "no", "--dir", t.TempDir())
+	var output strings.Builder
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Start(); err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+
+	previous := RedisClient
+	RedisClient = redis.NewClient(&redis.Options{Addr: "127.0.0.1:" + strconv.Itoa(port)})
+	t.Cleanup(func() {
+		_ = RedisClient.Close()
+		RedisClient = previous
+		cancel()
+		_ = cmd.Wait()
+		if t.Failed() {
+			t.Log("redis-server output:\n", output.String())
+		}
+	})
+
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		if err := RedisClient.Ping(context.Background()).Err(); err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("redis-server did not start listening on port ", port)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestSetSensorReference(t *testing.T) {
+	redisServer(t)
+	ctx := context.Background()
+
+	if changed, err := SetSensorReference(ctx, "sensor-1", "room-1"); err != nil || changed {
+		t.Fatalf("SetSensorReference on an unregistered sensor = %v, %v; want false", changed, err)
+	}
+
+	sensor := types.Sensor{Id: "sensor-1", Type: "temperature", Reference: "room-1", PublicKey: "key"}
+	if _, err := AddSensor(ctx, sensor); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		reference   string
+		wantChanged bool
+	}{
+		{reference: "room-1", wantChanged: false},
+		{reference: "room-2", wantChanged: true},
+		{reference: "room-2", wantChanged: false},
+		{reference: "", wantChanged: true},
+	}
+	for _, tt := range tests {
+		changed, err := SetSensorReference(ctx, "sensor-1", tt.reference)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed != tt.wantChanged {
+			t.Errorf("SetSensorReference(%q) = %v, want %v", tt.reference, changed, tt.wantChanged)
+		}
+		got, found, err := GetSensor(ctx, "sensor-1")
+		if err != nil || !found {
+			t.Fatalf("GetSensor = %v, %v", found, err)
+		}
+		// Gli altri metadati del sensore restano invariati
+		if got.Reference != tt.reference || got.Type != sensor.Type || got.PublicKey != sensor.PublicKey {
+			t.Errorf("sensor after SetSensorReference(%q) = %+v", tt.reference, got)
+		}
+	}
+}
+
+func TestPopPendingRejectedSensorData(t *testing.T) {
+	redisServer(t)
+	ctx := context.Background()
+
+	add := func(timestamp int64, pending bool) {
+		t.Helper()
+		if err := AddRejectedSensorData(ctx, types.RejectedSensorData{SensorID: "sensor-1", Timestamp: timestamp, Reason: types.OutlierRejection}); err != nil {
+			t.Fatal(err)
+		}
+		if pending {
+			if err := AddPendingRejectedSensorData(ctx, "sensor-1"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Le prime letture sono state consegnate al canale, le ultime due sono rimaste in attesa
+	add(1, false)
+	add(2, false)
+	add(3, true)
+	add(4, true)
+
+	sensorIDs, err := GetPendingRejectedSensors(ctx)
+	if err != nil || len(sensorIDs) != 1 || sensorIDs[0] != "sensor-1" {
+		t.Fatalf("GetPendingRejectedSensors = %v, %v; want [sensor-1]", sensorIDs, err)
+	}
+
+	readings, evicted, err := PopPendingRejectedSensorData(ctx, "sensor-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if evicted != 0 || len(readings) != 2 || readings[0].Timestamp != 3 || readings[1].Timestamp != 4 {
+		t.Fatalf("PopPendingRejectedSensorData = %+v, %d evicted; want timestamps [3 4] from the oldest", readings, evicted)
+	}
+
+	// Il contatore viene azzerato: le letture non vengono inoltrate due volte
+	if readings, _, err := PopPendingRejectedSensorData(ctx, "sensor-1"); err != nil || len(readings) != 0 {
+		t.Fatalf("second PopPendingRejectedSensorData = %+v, %v; want no readings", readings, err)
+	}
+	if sensorIDs, err := GetPendingRejectedSensors(ctx); err != nil || len(sensorIDs) != 0 {
+		t.Fatalf("GetPendingRejectedSensors after pop = %v, %v; want none", sensorIDs, err)
+	}
+}
+
+func TestPopPendingRejectedSensorDataEvicted(t *testing.T) {
+	redisServer(t)
+	ctx := context.Background()
+
+	// Più letture in attesa di quante ne contenga la lista del sensore
+	for i := 0; i < environment.RejectedWindowSize+5; i++ {
+		if err := AddRejectedSensorData(ctx, types.RejectedSensorData{SensorID: "sensor-1", Timestamp: int64(i)}); err != nil {
+			t.Fatal(err)
+		}
+		if err := AddPendingRejectedSensorData(ctx, "sensor-1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	readings, evicted, err := PopPendingRejectedSensorData(ctx, "sensor-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if evicted != 5 || len(readings) != environment.RejectedWindowSize {
+		t.Fatalf("PopPendingRejectedSensorData = %d readings, %d evicted; want %d readings, 5 evicted", len(readings), evicted, environment.RejectedWindowSize)
+	}
+	if readings[0].Timestamp != 5 {
+		t.Fatalf("oldest replayed reading = %d, want 5", readings[0].Timestamp)
+	}
+}
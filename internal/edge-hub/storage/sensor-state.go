@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"SensorContinuum/internal/edge-hub/environment"
+	"SensorContinuum/pkg/types"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// sensorStateKey è la hash Redis con lo stato del ciclo di vita di un sensore:
+// stato corrente, istante dell'ultima transizione, timestamp dell'ultima lettura ricevuta,
+// timestamp dell'ultimo heartbeat e intervallo di campionamento riportato dal sensore.
+const sensorStateKey = "sensor:%s:state"
+
+// touchSensorStateScript aggiorna l'ultima lettura di un sensore e, se il sensore non è attivo,
+// lo porta nello stato active. Restituisce lo stato precedente in caso di transizione, nil altrimenti.
+// ARGV: istante corrente, timestamp della lettura.
+var touchSensorStateScript = redis.NewScript(`
+local lastSeen = tonumber(redis.call('HGET', KEYS[1], 'last_seen') or '0')
+if tonumber(ARGV[2]) > lastSeen then
+	redis.call('HSET', KEYS[1], 'last_seen', ARGV[2])
+end
+local state = redis.call('HGET', KEYS[1], 'state') or ''
+if state == 'active' then
+	return false
+end
+redis.call('HSET', KEYS[1], 'state', 'active', 'since', ARGV[1])
+redis.call('PERSIST', KEYS[1])
+return state
+`)
+
+// recordSensorHeartbeatScript aggiorna l'ultimo heartbeat e l'intervallo di campionamento di un sensore,
+// solo se lo stato del sensore è già stato inizializzato. Restituisce 0 se il sensore non ha uno stato.
+// ARGV: timestamp dell'heartbeat, intervallo di campionamento in millisecondi.
+var recordSensorHeartbeatScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+local lastHeartbeat = tonumber(redis.call('HGET', KEYS[1], 'last_heartbeat') or '0')
+if tonumber(ARGV[1]) > lastHeartbeat then
+	redis.call('HSET', KEYS[1], 'last_heartbeat', ARGV[1])
+end
+redis.call('HSET', KEYS[1], 'sampling_interval', ARGV[2])
+return 1
+`)
+
+// transitionSensorStateScript porta un sensore dallo stato atteso al nuovo stato.
+// Se lo stato corrente è diverso da quello atteso (es. il sensore è tornato attivo nel frattempo)
+// la transizione non viene eseguita e lo script restituisce 0.
+// ARGV: stato atteso, nuovo stato, istante corrente, TTL in secondi (0 per nessuna scadenza), ultima lettura (opzionale).
+var transitionSensorStateScript = redis.NewScript(`
+local state = redis.call('HGET', KEYS[1], 'state') or ''
+if state ~= ARGV[1] then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'state', ARGV[2], 'since', ARGV[3])
+if ARGV[5] ~= '' then
+	redis.call('HSET', KEYS[1], 'last_seen', ARGV[5])
+end
+if tonumber(ARGV[4]) > 0 then
+	redis.call('EXPIRE', KEYS[1], ARGV[4])
+else
+	redis.call('PERSIST', KEYS[1])
+end
+return 1
+`)
+
+// SensorStateInfo contiene lo stato del ciclo di vita di un sensore salvato in cache.
+type SensorStateInfo struct {
+	State         types.SensorState
+	Since         int64
+	LastSeen      int64
+	LastHeartbeat int64
+	// SamplingInterval è l'intervallo di campionamento riportato negli heartbeat, zero se sconosciuto
+	SamplingInterval time.Duration
+}
+
+// GetSensorState recupera lo stato del ciclo di vita di un sensore.
+// Restituisce false se lo stato del sensore non è ancora stato inizializzato.
+func GetSensorState(ctx context.Context, sensorID string) (SensorStateInfo, bool, error) {
+	key := fmt.Sprintf(sensorStateKey, sensorID)
+	vals, err := RedisClient.HGetAll(ctx, key).Result()
+	if err != nil {
+		return SensorStateInfo{}, false, err
+	}
+	if len(vals) == 0 {
+		return SensorStateInfo{}, false, nil
+	}
+	info := SensorStateInfo{State: types.SensorState(vals["state"])}
+	info.Since, _ = strconv.ParseInt(vals["since"], 10, 64)
+	info.LastSeen, _ = strconv.ParseInt(vals["last_seen"], 10, 64)
+	info.LastHeartbeat, _ = strconv.ParseInt(vals["last_heartbeat"], 10, 64)
+	samplingInterval, _ := strconv.ParseInt(vals["sampling_interval"], 10, 64)
+	info.SamplingInterval = time.Duration(samplingInterval) * time.Millisecond
+	return info, true, nil
+}
+
+// RecordSensorHeartbeat registra un heartbeat del sensore, con l'intervallo di campionamento riportato in millisecondi.
+// Un heartbeat non modifica lo stato del sensore, che diventa active solo ricevendo letture.
+// Restituisce false se lo stato del sensore non è ancora stato inizializzato (es. sensore non registrato).
+func RecordSensorHeartbeat(ctx context.Context, sensorID string, timestamp int64, samplingInterval int64) (bool, error) {
+	key := fmt.Sprintf(sensorStateKey, sensorID)
+	ok, err := recordSensorHeartbeatScript.Run(ctx, RedisClient, []string{key}, timestamp, samplingInterval).Int()
+	if err != nil {
+		return false, err
+	}
+	return ok == 1, nil
+}
+
+// TouchSensorState registra una lettura del sensore e lo porta nello stato active.
+// Restituisce lo stato precedente e true se è avvenuta una transizione.
+func TouchSensorState(ctx context.Context, sensorID string, timestamp int64) (types.SensorState, bool, error) {
+	key := fmt.Sprintf(sensorStateKey, sensorID)
+	now := time.Now().UTC().Unix()
+	prev, err := touchSensorStateScript.Run(ctx, RedisClient, []string{key}, now, timestamp).Text()
+	if errors.Is(err, redis.Nil) {
+		return types.SensorActive, false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return types.SensorState(prev), true, nil
+}
+
+// TransitionSensorState porta un sensore dallo stato from allo stato to.
+// Lo stato di un sensore dismesso viene mantenuto per DecommissionedSensorStateTTL.
+// Se lastSeen è maggiore di zero, aggiorna anche il timestamp dell'ultima lettura.
+// Restituisce false se il sensore non si trovava nello stato from.
+func TransitionSensorState(ctx context.Context, sensorID string, from, to types.SensorState, lastSeen int64) (bool, error) {
+	key := fmt.Sprintf(sensorStateKey, sensorID)
+	now := time.Now().UTC().Unix()
+	var ttl int64
+	if to == types.SensorDecommissioned {
+		ttl = int64(environment.DecommissionedSensorStateTTL.Seconds())
+	}
+	lastSeenArg := ""
+	if lastSeen > 0 {
+		lastSeenArg = strconv.FormatInt(lastSeen, 10)
+	}
+	ok, err := transitionSensorStateScript.Run(ctx, RedisClient, []string{key}, string(from), string(to), now, ttl, lastSeenArg).Int()
+	if err != nil {
+		return false, err
+	}
+	return ok == 1, nil
+}
@@ -6,6 +6,7 @@ import (
 	"SensorContinuum/pkg/types"
 	"SensorContinuum/pkg/utils"
 	"context"
+	"encoding/json"
 	"time"
 
 	"github.com/segmentio/kafka-go"
@@ -17,12 +18,27 @@ var kafkaRealTimeDataReader *kafka.Reader = nil
 // kafkaStatisticsDataReader è il lettore Kafka per i dati statistici aggregati.
 var kafkaStatisticsDataReader *kafka.Reader = nil
 
+// kafkaRejectedDataReader è il lettore Kafka per i dati scartati dal filtro degli Edge Hub.
+var kafkaRejectedDataReader *kafka.Reader = nil
+
+// kafkaCriticalEventsReader è il lettore Kafka per le letture critiche rilevate dagli Edge Hub.
+var kafkaCriticalEventsReader *kafka.Reader = nil
+
 // kafkaConfigurationReader è il lettore Kafka per i messaggi di configurazione.
 var kafkaConfigurationReader *kafka.Reader = nil
 
 // kafkaHeartbeatReader è il lettore Kafka per i messaggi di heartbeat.
 var kafkaHeartbeatReader *kafka.Reader = nil
 
+// kafkaSensorStateReader è il lettore Kafka per le transizioni di stato dei sensori.
+var kafkaSensorStateReader *kafka.Reader = nil
+
+// kafkaCommandAckReader è il lettore Kafka per le conferme dei comandi inviati ai sensori.
+var kafkaCommandAckReader *kafka.Reader = nil
+
+// commandKafkaWriter è lo scrittore Kafka per i comandi destinati ai sensori.
+var commandKafkaWriter *kafka.Writer = nil
+
 // connectRealTimeData si connette a Kafka per leggere i dati in tempo reale.
 func connectRealTimeData() {
 
@@ -42,6 +58,25 @@ func connectRealTimeData() {
 	logger.Log.Info("Connected to Kafka topic: ", environment.ProximityDataTopic, " at ", environment.KafkaBroker+":"+environment.KafkaPort)
 }
 
+// connectRejectedData si connette a Kafka per leggere i dati scartati dal filtro degli Edge Hub.
+func connectRejectedData() {
+
+	// Se la connessione è già stabilita, non fare nulla
+	if kafkaRejectedDataReader != nil {
+		return // already connected
+	}
+
+	logger.Log.Debug("Connecting to Kafka topic: ", environment.ProximityRejectedDataTopic, " at ", environment.KafkaBroker+":"+environment.KafkaPort)
+
+	// Configura il lettore Kafka per i dati scartati
+	kafkaRejectedDataReader = kafka.NewReader(kafka.ReaderConfig{
+		Brokers: []string{environment.KafkaBroker + ":" + environment.KafkaPort},
+		Topic:   environment.ProximityRejectedDataTopic,
+		GroupID: environment.KafkaGroupId,
+	})
+	logger.Log.Info("Connected to Kafka topic: ", environment.ProximityRejectedDataTopic, " at ", environment.KafkaBroker+":"+environment.KafkaPort)
+}
+
 // connectProximityConfiguration si connette a Kafka per leggere i messaggi di configurazione.
 func connectProximityConfiguration() {
 
@@ -100,7 +135,7 @@ func connectStatisticsData() {
 }
 
 // PullRealTimeData si occupa di leggere i dati dei sensori in tempo reale.
-func PullRealTimeData(dataChannel chan types.SensorData, pauseSignal *utils.PauseSignal) error {
+func PullRealTimeData(dataQueue *utils.BoundedQueue[types.SensorData], pauseSignal *utils.PauseSignal) error {
 
 	// Connessione a Kafka se non è già stabilita
 	connectRealTimeData()
@@ -155,23 +190,111 @@ func PullRealTimeData(dataChannel chan types.SensorData, pauseSignal *utils.Paus
 				continue
 			}
 
+			// Inserisce il dato in coda: se la coda è piena, la policy configurata decide
+			// se attendere, smettendo di leggere da Kafka, scartare il dato o salvarlo su disco
+			if dataQueue.Push(data) {
+				logger.Log.Debug("Sensor data sent to queue: ", data)
+			} else {
+				logger.Log.Error("Data queue is full, discarding sensor data: ", data)
+			}
+		}
+	}
+}
+
+// CommitSensorDataBatchMessages esegue il commit degli offset dei messaggi Kafka in un batch di dati sensori.
+func CommitSensorDataBatchMessages(messages []kafka.Message) error {
+	// Se il lettore Kafka non è inizializzato, non fare nulla
+	if kafkaRealTimeDataReader == nil {
+		return nil
+	}
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	// Esegue il commit dei messaggi
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(environment.KafkaCommitTimeout)*time.Second)
+	defer cancel()
+
+	err := kafkaRealTimeDataReader.CommitMessages(ctx, messages...)
+	if err != nil {
+		logger.Log.Error("Failed to commit Kafka messages: ", err)
+		return err
+	}
+
+	logger.Log.Debug("Committed Kafka ", len(messages), " messages")
+	return nil
+}
+
+// PullRejectedData si occupa di leggere i dati scartati dal filtro degli Edge Hub.
+func PullRejectedData(rejectedChannel chan types.RejectedSensorData, pauseSignal *utils.PauseSignal) error {
+
+	// Connessione a Kafka se non è già stabilita
+	connectRejectedData()
+	ctx := context.Background()
+	paused := false
+
+	for {
+		select {
+		case p := <-pauseSignal.Chan():
+			paused = p
+			if paused {
+				logger.Log.Info("Pausing rejected data consumption from Kafka.")
+			} else {
+				logger.Log.Info("Resuming rejected data consumption from Kafka.")
+			}
+		default:
+
+			// Se siamo in pausa, aspetta finché non viene tolta la pausa
+			// o finché il contesto non viene cancellato
+			if paused {
+				logger.Log.Info("Paused rejected data consumption. Waiting for resume...")
+
+				select {
+				case p := <-pauseSignal.Chan():
+					paused = p
+					if paused {
+						logger.Log.Info("Rejected data consumption still paused.")
+						continue
+					} else {
+						logger.Log.Info("Resumed rejected data consumption from Kafka.")
+					}
+				case <-ctx.Done():
+					logger.Log.Info("Context canceled while paused. Stopping consumer.")
+					return ctx.Err()
+				}
+			}
+
+			// Legge il messaggio dal topic Kafka
+			m, err := kafkaRejectedDataReader.FetchMessage(ctx)
+			if err != nil {
+				return err
+			}
+			logger.Log.Debug("Received message from Kafka topic: ", m.Topic, " Partition: ", m.Partition, " Offset: ", m.Offset, " Key: ", string(m.Key), " Value: ", string(m.Value))
+
+			// Converte il messaggio in un oggetto RejectedSensorData
+			var data types.RejectedSensorData
+			data, err = types.CreateRejectedSensorDataFromKafka(m)
+			if err != nil {
+				logger.Log.Error("Error unmarshalling Rejected Sensor Data: ", err)
+				continue
+			}
+
 			// Prova a inviare il dato al canale
 			// Se il canale è pieno, ritenta per un numero massimo di volte
 			// con un ritardo tra i tentativi
-			// Se non riesce a inviare il dato, lo scarta e logga un errore
-			// per evitare di bloccare il lettore Kafka
 			sent := false
 			for attempt := 0; attempt < environment.KafkaMaxAttempts && !sent; attempt++ {
 				select {
-				case dataChannel <- data:
+				case rejectedChannel <- data:
 					// Inviato con successo
-					logger.Log.Debug("Sensor data sent to channel: ", data)
+					logger.Log.Debug("Rejected data sent to channel: ", data)
 					sent = true
 				default:
 					// Canale pieno, logghiamo un avviso e attendiamo l'elaborazione
-					logger.Log.Warn("Data channel is full. Attempt(s) ", attempt+1, " of ", environment.KafkaMaxAttempts)
+					logger.Log.Warn("Rejected data channel is full. Attempt(s) ", attempt+1, " of ", environment.KafkaMaxAttempts)
 					if attempt == environment.KafkaMaxAttempts-1 {
-						logger.Log.Error("Max attempts reached, discarding sensor data: ", data)
+						logger.Log.Error("Max attempts reached, discarding rejected data: ", data)
 						break
 					}
 					// Attende prima di ritentare
@@ -182,10 +305,10 @@ func PullRealTimeData(dataChannel chan types.SensorData, pauseSignal *utils.Paus
 	}
 }
 
-// CommitSensorDataBatchMessages esegue il commit degli offset dei messaggi Kafka in un batch di dati sensori.
-func CommitSensorDataBatchMessages(messages []kafka.Message) error {
+// CommitRejectedDataBatchMessages esegue il commit degli offset dei messaggi Kafka in un batch di dati scartati.
+func CommitRejectedDataBatchMessages(messages []kafka.Message) error {
 	// Se il lettore Kafka non è inizializzato, non fare nulla
-	if kafkaRealTimeDataReader == nil {
+	if kafkaRejectedDataReader == nil {
 		return nil
 	}
 
@@ -197,7 +320,322 @@ func CommitSensorDataBatchMessages(messages []kafka.Message) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(environment.KafkaCommitTimeout)*time.Second)
 	defer cancel()
 
-	err := kafkaRealTimeDataReader.CommitMessages(ctx, messages...)
+	err := kafkaRejectedDataReader.CommitMessages(ctx, messages...)
+	if err != nil {
+		logger.Log.Error("Failed to commit Kafka messages: ", err)
+		return err
+	}
+
+	logger.Log.Debug("Committed Kafka ", len(messages), " messages")
+	return nil
+}
+
+// connectCriticalEvents si connette a Kafka per leggere le letture critiche rilevate dagli Edge Hub.
+func connectCriticalEvents() {
+
+	// Se la connessione è già stabilita, non fare nulla
+	if kafkaCriticalEventsReader != nil {
+		return // already connected
+	}
+
+	logger.Log.Debug("Connecting to Kafka topic: ", environment.ProximityCriticalEventsTopic, " at ", environment.KafkaBroker+":"+environment.KafkaPort)
+
+	// Configura il lettore Kafka per le letture critiche
+	kafkaCriticalEventsReader = kafka.NewReader(kafka.ReaderConfig{
+		Brokers: []string{environment.KafkaBroker + ":" + environment.KafkaPort},
+		Topic:   environment.ProximityCriticalEventsTopic,
+		GroupID: environment.KafkaGroupId,
+	})
+	logger.Log.Info("Connected to Kafka topic: ", environment.ProximityCriticalEventsTopic, " at ", environment.KafkaBroker+":"+environment.KafkaPort)
+}
+
+// PullCriticalEvents si occupa di leggere le letture critiche rilevate dagli Edge Hub.
+// Le letture critiche non vengono salvate in batch, quindi il consumer non viene mai messo in pausa:
+// l'invio sul canale è bloccante e il consumer legge il messaggio successivo appena c'è posto.
+func PullCriticalEvents(criticalEventChannel chan types.CriticalEvent) error {
+
+	// Connessione a Kafka se non è già stabilita
+	connectCriticalEvents()
+	ctx := context.Background()
+
+	for {
+		// Legge il messaggio dal topic Kafka
+		m, err := kafkaCriticalEventsReader.FetchMessage(ctx)
+		if err != nil {
+			return err
+		}
+		logger.Log.Debug("Received message from Kafka topic: ", m.Topic, " Partition: ", m.Partition, " Offset: ", m.Offset, " Key: ", string(m.Key), " Value: ", string(m.Value))
+
+		// Converte il messaggio in un oggetto CriticalEvent
+		event, err := types.CreateCriticalEventFromKafka(m)
+		if err != nil {
+			logger.Log.Error("Error unmarshalling Critical Event: ", err)
+			continue
+		}
+
+		criticalEventChannel <- event
+		logger.Log.Debug("Critical event sent to channel: ", event)
+	}
+}
+
+// CommitCriticalEventMessage esegue il commit dell'offset del messaggio Kafka di una lettura critica.
+func CommitCriticalEventMessage(message kafka.Message) error {
+	// Se il lettore Kafka non è inizializzato, non fare nulla
+	if kafkaCriticalEventsReader == nil {
+		return nil
+	}
+
+	// Esegue il commit del messaggio
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(environment.KafkaCommitTimeout)*time.Second)
+	defer cancel()
+
+	err := kafkaCriticalEventsReader.CommitMessages(ctx, message)
+	if err != nil {
+		logger.Log.Error("Failed to commit Kafka message: ", err)
+		return err
+	}
+
+	logger.Log.Debug("Committed Kafka message at offset ", message.Offset)
+	return nil
+}
+
+// connectSensorState si connette a Kafka per leggere le transizioni di stato dei sensori.
+func connectSensorState() {
+
+	// Se la connessione è già stabilita, non fare nulla
+	if kafkaSensorStateReader != nil {
+		return // already connected
+	}
+
+	logger.Log.Debug("Connecting to Kafka topic: ", environment.ProximitySensorStateTopic, " at ", environment.KafkaBroker+":"+environment.KafkaPort)
+
+	// Configura il lettore Kafka per le transizioni di stato dei sensori
+	kafkaSensorStateReader = kafka.NewReader(kafka.ReaderConfig{
+		Brokers: []string{environment.KafkaBroker + ":" + environment.KafkaPort},
+		Topic:   environment.ProximitySensorStateTopic,
+		GroupID: environment.KafkaGroupId,
+	})
+	logger.Log.Info("Connected to Kafka topic: ", environment.ProximitySensorStateTopic, " at ", environment.KafkaBroker+":"+environment.KafkaPort)
+}
+
+// PullSensorStateEvents si occupa di leggere le transizioni di stato dei sensori.
+func PullSensorStateEvents(sensorStateChannel chan types.SensorStateEvent, pauseSignal *utils.PauseSignal) error {
+
+	// Connessione a Kafka se non è già stabilita
+	connectSensorState()
+	ctx := context.Background()
+	paused := false
+
+	for {
+		select {
+		case p := <-pauseSignal.Chan():
+			paused = p
+			if paused {
+				logger.Log.Info("Pausing sensor state consumption from Kafka.")
+			} else {
+				logger.Log.Info("Resuming sensor state consumption from Kafka.")
+			}
+		default:
+
+			// Se siamo in pausa, aspetta finché non viene tolta la pausa
+			// o finché il contesto non viene cancellato
+			if paused {
+				logger.Log.Info("Paused sensor state consumption. Waiting for resume...")
+
+				select {
+				case p := <-pauseSignal.Chan():
+					paused = p
+					if paused {
+						logger.Log.Info("Sensor state consumption still paused.")
+						continue
+					} else {
+						logger.Log.Info("Resumed sensor state consumption from Kafka.")
+					}
+				case <-ctx.Done():
+					logger.Log.Info("Context canceled while paused. Stopping consumer.")
+					return ctx.Err()
+				}
+			}
+
+			// Legge il messaggio dal topic Kafka
+			m, err := kafkaSensorStateReader.FetchMessage(ctx)
+			if err != nil {
+				return err
+			}
+			logger.Log.Debug("Received message from Kafka topic: ", m.Topic, " Partition: ", m.Partition, " Offset: ", m.Offset, " Key: ", string(m.Key), " Value: ", string(m.Value))
+
+			// Converte il messaggio in un oggetto SensorStateEvent
+			var event types.SensorStateEvent
+			event, err = types.CreateSensorStateEventFromKafka(m)
+			if err != nil {
+				logger.Log.Error("Error unmarshalling Sensor State Event: ", err)
+				continue
+			}
+
+			// Prova a inviare l'evento al canale
+			// Se il canale è pieno, ritenta per un numero massimo di volte
+			// con un ritardo tra i tentativi
+			sent := false
+			for attempt := 0; attempt < environment.KafkaMaxAttempts && !sent; attempt++ {
+				select {
+				case sensorStateChannel <- event:
+					// Inviato con successo
+					logger.Log.Debug("Sensor state event sent to channel: ", event)
+					sent = true
+				default:
+					// Canale pieno, logghiamo un avviso e attendiamo l'elaborazione
+					logger.Log.Warn("Sensor state channel is full. Attempt(s) ", attempt+1, " of ", environment.KafkaMaxAttempts)
+					if attempt == environment.KafkaMaxAttempts-1 {
+						logger.Log.Error("Max attempts reached, discarding sensor state event: ", event)
+						break
+					}
+					// Attende prima di ritentare
+					time.Sleep(time.Duration(environment.KafkaAttemptDelay) * time.Millisecond)
+				}
+			}
+		}
+	}
+}
+
+// CommitSensorStateBatchMessages esegue il commit degli offset dei messaggi Kafka in un batch di transizioni di stato.
+func CommitSensorStateBatchMessages(messages []kafka.Message) error {
+	// Se il lettore Kafka non è inizializzato, non fare nulla
+	if kafkaSensorStateReader == nil {
+		return nil
+	}
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	// Esegue il commit dei messaggi
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(environment.KafkaCommitTimeout)*time.Second)
+	defer cancel()
+
+	err := kafkaSensorStateReader.CommitMessages(ctx, messages...)
+	if err != nil {
+		logger.Log.Error("Failed to commit Kafka messages: ", err)
+		return err
+	}
+
+	logger.Log.Debug("Committed Kafka ", len(messages), " messages")
+	return nil
+}
+
+// connectCommandAck si connette a Kafka per leggere le conferme dei comandi inviati ai sensori.
+func connectCommandAck() {
+
+	// Se la connessione è già stabilita, non fare nulla
+	if kafkaCommandAckReader != nil {
+		return // already connected
+	}
+
+	logger.Log.Debug("Connecting to Kafka topic: ", environment.ProximityCommandAckTopic, " at ", environment.KafkaBroker+":"+environment.KafkaPort)
+
+	// Configura il lettore Kafka per le conferme dei comandi
+	kafkaCommandAckReader = kafka.NewReader(kafka.ReaderConfig{
+		Brokers: []string{environment.KafkaBroker + ":" + environment.KafkaPort},
+		Topic:   environment.ProximityCommandAckTopic,
+		GroupID: environment.KafkaGroupId,
+	})
+	logger.Log.Info("Connected to Kafka topic: ", environment.ProximityCommandAckTopic, " at ", environment.KafkaBroker+":"+environment.KafkaPort)
+}
+
+// PullCommandAcks si occupa di leggere le conferme dei comandi inviati ai sensori.
+func PullCommandAcks(commandAckChannel chan types.CommandAck, pauseSignal *utils.PauseSignal) error {
+
+	// Connessione a Kafka se non è già stabilita
+	connectCommandAck()
+	ctx := context.Background()
+	paused := false
+
+	for {
+		select {
+		case p := <-pauseSignal.Chan():
+			paused = p
+			if paused {
+				logger.Log.Info("Pausing command ack consumption from Kafka.")
+			} else {
+				logger.Log.Info("Resuming command ack consumption from Kafka.")
+			}
+		default:
+
+			// Se siamo in pausa, aspetta finché non viene tolta la pausa
+			// o finché il contesto non viene cancellato
+			if paused {
+				logger.Log.Info("Paused command ack consumption. Waiting for resume...")
+
+				select {
+				case p := <-pauseSignal.Chan():
+					paused = p
+					if paused {
+						logger.Log.Info("Command ack consumption still paused.")
+						continue
+					} else {
+						logger.Log.Info("Resumed command ack consumption from Kafka.")
+					}
+				case <-ctx.Done():
+					logger.Log.Info("Context canceled while paused. Stopping consumer.")
+					return ctx.Err()
+				}
+			}
+
+			// Legge il messaggio dal topic Kafka
+			m, err := kafkaCommandAckReader.FetchMessage(ctx)
+			if err != nil {
+				return err
+			}
+			logger.Log.Debug("Received message from Kafka topic: ", m.Topic, " Partition: ", m.Partition, " Offset: ", m.Offset, " Key: ", string(m.Key), " Value: ", string(m.Value))
+
+			// Converte il messaggio in un oggetto CommandAck
+			var ack types.CommandAck
+			ack, err = types.CreateCommandAckFromKafka(m)
+			if err != nil {
+				logger.Log.Error("Error unmarshalling Command Ack: ", err)
+				continue
+			}
+
+			// Prova a inviare la conferma al canale
+			// Se il canale è pieno, ritenta per un numero massimo di volte
+			// con un ritardo tra i tentativi
+			sent := false
+			for attempt := 0; attempt < environment.KafkaMaxAttempts && !sent; attempt++ {
+				select {
+				case commandAckChannel <- ack:
+					// Inviato con successo
+					logger.Log.Debug("Command ack sent to channel: ", ack)
+					sent = true
+				default:
+					// Canale pieno, logghiamo un avviso e attendiamo l'elaborazione
+					logger.Log.Warn("Command ack channel is full. Attempt(s) ", attempt+1, " of ", environment.KafkaMaxAttempts)
+					if attempt == environment.KafkaMaxAttempts-1 {
+						logger.Log.Error("Max attempts reached, discarding command ack: ", ack)
+						break
+					}
+					// Attende prima di ritentare
+					time.Sleep(time.Duration(environment.KafkaAttemptDelay) * time.Millisecond)
+				}
+			}
+		}
+	}
+}
+
+// CommitCommandAckBatchMessages esegue il commit degli offset dei messaggi Kafka in un batch di conferme dei comandi.
+func CommitCommandAckBatchMessages(messages []kafka.Message) error {
+	// Se il lettore Kafka non è inizializzato, non fare nulla
+	if kafkaCommandAckReader == nil {
+		return nil
+	}
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	// Esegue il commit dei messaggi
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(environment.KafkaCommitTimeout)*time.Second)
+	defer cancel()
+
+	err := kafkaCommandAckReader.CommitMessages(ctx, messages...)
 	if err != nil {
 		logger.Log.Error("Failed to commit Kafka messages: ", err)
 		return err
@@ -207,6 +645,51 @@ func CommitSensorDataBatchMessages(messages []kafka.Message) error {
 	return nil
 }
 
+// connectCommandWriter si connette a Kafka per scrivere i comandi destinati ai sensori.
+func connectCommandWriter() {
+
+	// Se la connessione è già stabilita, non fare nulla
+	if commandKafkaWriter != nil {
+		return // already connected
+	}
+
+	// RequireAll: tutte le repliche del topic devono confermare la ricezione del comando
+	commandKafkaWriter = &kafka.Writer{
+		Addr:         kafka.TCP(environment.KafkaBroker + ":" + environment.KafkaPort),
+		Topic:        environment.IntermediateCommandTopic,
+		RequiredAcks: kafka.RequireAll,
+		Balancer:     &kafka.Hash{},
+	}
+	logger.Log.Info("Connected (write) to Kafka topic for commands, topic: ", environment.IntermediateCommandTopic)
+}
+
+// SendSensorCommands invia i comandi destinati ai sensori al topic Kafka dedicato.
+// La chiave è la macrozona, così ogni Proximity Fog Hub riceve i propri comandi nell'ordine di creazione.
+func SendSensorCommands(commands []types.SensorCommand) error {
+	// Assicuriamoci di essere connessi a Kafka
+	connectCommandWriter()
+
+	// Prepara i messaggi da inviare
+	messages := make([]kafka.Message, len(commands))
+	for i, command := range commands {
+		msgBytes, err := json.Marshal(command)
+		if err != nil {
+			return err
+		}
+		messages[i] = kafka.Message{
+			Key:   []byte(command.EdgeMacrozone),
+			Value: msgBytes,
+		}
+	}
+
+	// Imposta un contesto con timeout per evitare blocchi indefiniti
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(environment.KafkaPublishTimeout)*time.Second)
+	defer cancel()
+
+	// Invia i messaggi a Kafka
+	return commandKafkaWriter.WriteMessages(ctx, messages...)
+}
+
 // PullStatisticsData si occupa di leggere i dati statistici aggregati.
 func PullStatisticsData(statsChannel chan types.AggregatedStats, zonePauseSignal, macrozonePauseSignal *utils.PauseSignal) error {
 
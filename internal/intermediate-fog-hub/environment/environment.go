@@ -4,6 +4,7 @@ import (
 	"SensorContinuum/configs/kafka"
 	"SensorContinuum/pkg/logger"
 	"SensorContinuum/pkg/types"
+	"SensorContinuum/pkg/utils"
 	"errors"
 	"os"
 	"strconv"
@@ -35,18 +36,43 @@ var AggregatedStatsTopic string
 // ProximityConfigurationTopic specifica il topic Kafka per i messaggi di configurazione.
 var ProximityConfigurationTopic string
 
+// ProximityRejectedDataTopic specifica il topic Kafka per i dati scartati dal filtro degli Edge Hub.
+var ProximityRejectedDataTopic string
+
+// ProximityCriticalEventsTopic specifica il topic Kafka per le letture critiche rilevate dagli Edge Hub.
+var ProximityCriticalEventsTopic string
+
 // ProximityHeartbeatTopic specifica il topic Kafka per i messaggi di heartbeat.
 var ProximityHeartbeatTopic string
 
-// KafkaMaxAttempts specifica il numero massimo di tentativi di invio di un messaggio di kafka sul canale.
+// ProximitySensorStateTopic specifica il topic Kafka per le transizioni di stato dei sensori.
+var ProximitySensorStateTopic string
+
+// ProximityCommandAckTopic specifica il topic Kafka per le conferme dei comandi inviati ai sensori.
+var ProximityCommandAckTopic string
+
+// IntermediateCommandTopic specifica il topic Kafka su cui l'Intermediate Fog Hub inoltra i comandi destinati ai sensori.
+var IntermediateCommandTopic string
+
+// RealTimeDataQueue è la configurazione della coda tra il consumer Kafka dei dati in tempo reale e il salvataggio in batch.
+// Con la policy di default, se il salvataggio non tiene il passo il consumer smette di leggere da Kafka finché la coda
+// non si libera, quindi nessuna lettura viene persa. La dimensione di default è il triplo di SensorDataBatchSize.
+var RealTimeDataQueue = utils.QueueConfig{Policy: utils.BlockQueuePolicy, SpillDir: "queue-spill"}
+
+// KafkaMaxAttempts specifica il numero massimo di tentativi di inserimento di un messaggio letto da Kafka
+// nel canale di elaborazione. Non si applica ai dati in tempo reale, che passano dalla coda RealTimeDataQueue.
 var KafkaMaxAttempts int = 10
 
-// KafkaAttemptDelay specifica il ritardo tra i tentativi di invio di un messaggio di kafka sul canale, in secondi.
+// KafkaAttemptDelay specifica il ritardo tra i tentativi di inserimento di un messaggio letto da Kafka
+// nel canale di elaborazione, in millisecondi.
 var KafkaAttemptDelay int = 750
 
 // KafkaCommitTimeout specifica il timeout per il commit degli offset Kafka.
 var KafkaCommitTimeout int = 5
 
+// KafkaPublishTimeout specifica il timeout per la pubblicazione dei messaggi su Kafka in secondi.
+var KafkaPublishTimeout int = 5
+
 // Queste impostazioni sono utilizzate per la connessione ai databases PostgreSQL.
 
 /* ------ POSTGRESQL DATABASES ------ */
@@ -132,6 +158,15 @@ var HeartbeatMessageBatchSize int = 50
 // HeartbeatMessageBatchTimeout specifica il timeout per il batch dei messaggi di heartbeat.
 var HeartbeatMessageBatchTimeout int = 5
 
+// CommandDispatchInterval specifica ogni quanti secondi vengono inoltrati i comandi in attesa.
+var CommandDispatchInterval int = 5
+
+// CommandDispatchBatchSize specifica il numero massimo di comandi inoltrati ad ogni esecuzione.
+var CommandDispatchBatchSize int = 100
+
+// CommandExpiration specifica dopo quanto tempo un comando non concluso viene considerato scaduto.
+var CommandExpiration = time.Hour
+
 const (
 	// KafkaGroupId specifica il group ID per i consumer Kafka.
 	// Poiché il fog hub gestisce una singola regione, tutti i servizi usanono lo stesso group ID.
@@ -236,11 +271,36 @@ func SetupEnvironment() error {
 		ProximityConfigurationTopic = kafka.PROXIMITY_FOG_HUB_CONFIGURATION_TOPIC
 	}
 
+	ProximityRejectedDataTopic, exists = os.LookupEnv("KAFKA_PROXIMITY_FOG_HUB_REJECTED_DATA_TOPIC")
+	if !exists {
+		ProximityRejectedDataTopic = kafka.PROXIMITY_FOG_HUB_REJECTED_DATA_TOPIC
+	}
+
+	ProximityCriticalEventsTopic, exists = os.LookupEnv("KAFKA_PROXIMITY_FOG_HUB_CRITICAL_EVENTS_TOPIC")
+	if !exists {
+		ProximityCriticalEventsTopic = kafka.PROXIMITY_FOG_HUB_CRITICAL_EVENTS_TOPIC
+	}
+
 	ProximityHeartbeatTopic, exists = os.LookupEnv("KAFKA_PROXIMITY_FOG_HUB_HEARTBEAT_TOPIC")
 	if !exists {
 		ProximityHeartbeatTopic = kafka.PROXIMITY_FOG_HUB_HEARTBEAT_TOPIC
 	}
 
+	ProximitySensorStateTopic, exists = os.LookupEnv("KAFKA_PROXIMITY_FOG_HUB_SENSOR_STATE_TOPIC")
+	if !exists {
+		ProximitySensorStateTopic = kafka.PROXIMITY_FOG_HUB_SENSOR_STATE_TOPIC
+	}
+
+	ProximityCommandAckTopic, exists = os.LookupEnv("KAFKA_PROXIMITY_FOG_HUB_COMMAND_ACK_TOPIC")
+	if !exists {
+		ProximityCommandAckTopic = kafka.PROXIMITY_FOG_HUB_COMMAND_ACK_TOPIC
+	}
+
+	IntermediateCommandTopic, exists = os.LookupEnv("KAFKA_INTERMEDIATE_FOG_HUB_COMMAND_TOPIC")
+	if !exists {
+		IntermediateCommandTopic = kafka.INTERMEDIATE_FOG_HUB_COMMAND_TOPIC
+	}
+
 	var KafkaMaxAttemptsStr string
 	KafkaMaxAttemptsStr, exists = os.LookupEnv("KAFKA_MAX_ATTEMPTS")
 	if exists {
@@ -271,6 +331,15 @@ func SetupEnvironment() error {
 		}
 	}
 
+	KafkaPublishTimeoutStr, exists := os.LookupEnv("KAFKA_PUBLISH_TIMEOUT")
+	if exists {
+		var err error
+		KafkaPublishTimeout, err = strconv.Atoi(KafkaPublishTimeoutStr)
+		if err != nil || KafkaPublishTimeout <= 0 {
+			return errors.New("invalid value for KAFKA_PUBLISH_TIMEOUT: " + KafkaPublishTimeoutStr + ". Must be a positive integer representing seconds.")
+		}
+	}
+
 	/* ----- POSTGRESQL DATABASES SETTINGS ----- */
 	/* 				  Region DB			  	 	 */
 	/* ----------------------------------------- */
@@ -363,6 +432,13 @@ func SetupEnvironment() error {
 		}
 	}
 
+	/* ----- QUEUE SETTINGS ----- */
+
+	RealTimeDataQueue.Size = SensorDataBatchSize * 3
+	if err := utils.LoadQueueConfigFromEnv("REAL_TIME_DATA", &RealTimeDataQueue); err != nil {
+		return err
+	}
+
 	AggregatedDataBatchSizeStr, exists := os.LookupEnv("AGGREGATED_DATA_BATCH_SIZE")
 	if exists {
 		var err error
@@ -380,6 +456,35 @@ func SetupEnvironment() error {
 		}
 	}
 
+	/* ----- COMMAND SETTINGS ----- */
+
+	CommandDispatchIntervalStr, exists := os.LookupEnv("COMMAND_DISPATCH_INTERVAL")
+	if exists {
+		var err error
+		CommandDispatchInterval, err = strconv.Atoi(CommandDispatchIntervalStr)
+		if err != nil || CommandDispatchInterval <= 0 {
+			return errors.New("invalid value for COMMAND_DISPATCH_INTERVAL: " + CommandDispatchIntervalStr + ". Must be a positive integer representing seconds.")
+		}
+	}
+
+	CommandDispatchBatchSizeStr, exists := os.LookupEnv("COMMAND_DISPATCH_BATCH_SIZE")
+	if exists {
+		var err error
+		CommandDispatchBatchSize, err = strconv.Atoi(CommandDispatchBatchSizeStr)
+		if err != nil || CommandDispatchBatchSize <= 0 {
+			return errors.New("invalid value for COMMAND_DISPATCH_BATCH_SIZE: " + CommandDispatchBatchSizeStr + ". Must be a positive integer.")
+		}
+	}
+
+	CommandExpirationStr, exists := os.LookupEnv("COMMAND_EXPIRATION")
+	if exists {
+		minutes, err := strconv.Atoi(CommandExpirationStr)
+		if err != nil || minutes <= 0 {
+			return errors.New("invalid value for COMMAND_EXPIRATION: " + CommandExpirationStr + ". Must be a positive integer representing minutes.")
+		}
+		CommandExpiration = time.Duration(minutes) * time.Minute
+	}
+
 	/* ----- HEALTH CHECK SERVER SETTINGS ----- */
 
 	HealthzServerStr, exists := os.LookupEnv("HEALTHZ_SERVER")
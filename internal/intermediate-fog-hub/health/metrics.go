@@ -0,0 +1,15 @@
+package health
+
+import (
+	"SensorContinuum/pkg/logger"
+	"SensorContinuum/pkg/utils"
+	"net/http"
+)
+
+// MetricsHandler espone le metriche delle code interne nel formato testuale di Prometheus.
+func MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := utils.WriteQueueMetrics(w, "intermediate_fog_hub"); err != nil {
+		logger.Log.Error("Failed to write response:", err.Error())
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 func StartHealthCheckServer(addr string) error {
 	http.HandleFunc("/healthz", HealthzHandler)
+	http.HandleFunc("/metrics", MetricsHandler)
 	return http.ListenAndServe(addr, nil)
 }
 
@@ -7,6 +7,7 @@ import (
 	"SensorContinuum/pkg/logger"
 	"SensorContinuum/pkg/types"
 	"SensorContinuum/pkg/utils"
+	"context"
 	"os"
 	"time"
 )
@@ -30,7 +31,7 @@ func setupRegionDbConnection() {
 }
 
 // ProcessRealTimeData gestisce i dati in tempo reale ricevuti dai sensori e li salva in batch.
-func ProcessRealTimeData(dataChannel chan types.SensorData, kafkaPauseSignal *utils.PauseSignal) {
+func ProcessRealTimeData(dataChannel <-chan types.SensorData, kafkaPauseSignal *utils.PauseSignal) {
 
 	// Connessione ai databases
 	setupSensorDbConnection()
@@ -79,6 +80,75 @@ func ProcessRealTimeData(dataChannel chan types.SensorData, kafkaPauseSignal *ut
 	os.Exit(1)
 }
 
+// ProcessCriticalEvents salva le letture critiche rilevate dagli Edge Hub appena ricevute, senza attendere un batch,
+// ed esegue il commit del messaggio Kafka solo dopo il salvataggio.
+func ProcessCriticalEvents(criticalEventChannel chan types.CriticalEvent) {
+
+	// Connessione al database dei sensori
+	setupSensorDbConnection()
+
+	for event := range criticalEventChannel {
+		logger.Log.Warn("Critical event received, sensorId: ", event.SensorID, ", value: ", event.Data, ", severity: ", event.Severity)
+		if err := storage.InsertCriticalEvent(event); err != nil {
+			// Il messaggio non viene confermato: verrà letto di nuovo al riavvio
+			logger.Log.Error("Failed to insert critical event: ", err)
+			os.Exit(1)
+		}
+		if err := comunication.CommitCriticalEventMessage(event.KafkaMsg); err != nil {
+			logger.Log.Error("Failed to commit Kafka message for critical event: ", err)
+			os.Exit(1)
+		}
+		logger.Log.Info("Critical event stored, sensorId: ", event.SensorID, ", latency: ", time.Since(time.UnixMilli(event.DetectedAt)).String())
+	}
+
+	logger.Log.Warn("Critical event channel closed, stopping critical event processing")
+	os.Exit(1)
+}
+
+// ProcessRejectedData gestisce i dati scartati dal filtro degli Edge Hub e li salva in batch.
+func ProcessRejectedData(rejectedChannel chan types.RejectedSensorData, kafkaPauseSignal *utils.PauseSignal) {
+
+	// Connessione al database dei sensori
+	setupSensorDbConnection()
+
+	// Batch per i dati scartati
+	batch, err := types.NewRejectedSensorDataBatch(
+		environment.SensorDataBatchSize,
+		time.Duration(environment.SensorDataBatchTimeout)*time.Second,
+		// Funzione di salvataggio dei dati
+		// Viene chiamata quando il batch è pieno o scade il timeout
+		func(b *types.RejectedSensorDataBatch) error {
+			// Manda un segnale per mettere in pausa il consumer Kafka
+			kafkaPauseSignal.Send(true)
+			if err := storage.InsertRejectedDataBatch(b); err != nil {
+				logger.Log.Error("Failed to insert rejected data batch: ", err)
+				os.Exit(1)
+			}
+			// Se tutto è andato a buon fine, esegui il commit
+			// dei messaggi Kafka
+			err := comunication.CommitRejectedDataBatchMessages(b.GetKafkaMessages())
+			if err != nil {
+				logger.Log.Error("Failed to commit Kafka messages for rejected data batch: ", err)
+				os.Exit(1)
+			}
+			// Manda un segnale per riavviare il consumer Kafka
+			kafkaPauseSignal.Send(false)
+			return nil
+		})
+	if err != nil {
+		logger.Log.Error("Failed to create rejected data batch: ", err)
+		os.Exit(1)
+	}
+
+	for data := range rejectedChannel {
+		logger.Log.Info("Rejected sensor data received: ", data.SensorID, " - reason: ", data.Reason)
+		batch.AddRejectedSensorData(data)
+	}
+
+	logger.Log.Warn("Rejected data channel closed, stopping rejected data processing")
+	os.Exit(1)
+}
+
 // ProcessStatisticsData gestisce le statistiche aggregate e le salva.
 func ProcessStatisticsData(statsChannel chan types.AggregatedStats, kafkaZonePauseSignal, kafkaMacrozonePauseSignal *utils.PauseSignal) {
 
@@ -204,6 +274,132 @@ func ProcessProximityFogHubConfiguration(msgChannel chan types.ConfigurationMsg,
 	os.Exit(1)
 }
 
+// ProcessSensorStateEvents gestisce le transizioni di stato dei sensori e le salva in batch
+// nel database dei metadati della regione.
+func ProcessSensorStateEvents(sensorStateChannel chan types.SensorStateEvent, kafkaPauseSignal *utils.PauseSignal) {
+
+	// Connessione ai databases
+	setupRegionDbConnection()
+
+	// Batch per le transizioni di stato
+	batch, err := types.NewSensorStateEventBatch(
+		environment.ConfigurationMessageBatchSize,
+		time.Duration(environment.ConfigurationMessageBatchTimeout)*time.Second,
+		// Funzione di salvataggio delle transizioni
+		// Viene chiamata quando il batch è pieno o scade il timeout
+		func(b *types.SensorStateEventBatch) error {
+			// Manda un segnale per mettere in pausa il consumer Kafka
+			kafkaPauseSignal.Send(true)
+			if err := storage.InsertSensorStateEventsBatch(b); err != nil {
+				logger.Log.Error("Failed to insert sensor state events batch: ", err)
+				os.Exit(1)
+			}
+			// Se tutto è andato a buon fine, esegui il commit
+			// dei messaggi Kafka
+			err := comunication.CommitSensorStateBatchMessages(b.GetKafkaMessages())
+			if err != nil {
+				logger.Log.Error("Failed to commit Kafka messages for sensor state events batch: ", err)
+				os.Exit(1)
+			}
+			// Manda un segnale per riavviare il consumer Kafka
+			kafkaPauseSignal.Send(false)
+			return nil
+		})
+	if err != nil {
+		logger.Log.Error("Failed to create sensor state events batch: ", err)
+		os.Exit(1)
+	}
+
+	for event := range sensorStateChannel {
+		logger.Log.Info("Sensor state event received: ", event.SensorID, " - ", event.From, " -> ", event.To)
+		batch.AddSensorStateEvent(event)
+	}
+
+	logger.Log.Warn("Sensor state channel closed, stopping sensor state processing")
+	os.Exit(1)
+}
+
+// DispatchSensorCommands inoltra periodicamente su Kafka i comandi in attesa salvati nel database dei metadati della regione
+// e segna come scaduti quelli non conclusi entro CommandExpiration.
+func DispatchSensorCommands() {
+
+	// Connessione ai databases
+	setupRegionDbConnection()
+
+	ticker := time.NewTicker(time.Duration(environment.CommandDispatchInterval) * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx := context.Background()
+
+		expired, err := storage.ExpireSensorCommands(ctx, time.Now().UTC().Add(-environment.CommandExpiration))
+		if err != nil {
+			logger.Log.Error("Failed to expire sensor commands: ", err)
+		} else if expired > 0 {
+			logger.Log.Warn("Sensor commands expired: ", expired)
+		}
+
+		// Inoltra i comandi finché ce ne sono in attesa
+		for {
+			dispatched, err := storage.DispatchPendingSensorCommands(ctx, environment.CommandDispatchBatchSize, comunication.SendSensorCommands)
+			if err != nil {
+				logger.Log.Error("Failed to dispatch pending sensor commands: ", err)
+				break
+			}
+			if dispatched > 0 {
+				logger.Log.Info("Sensor commands dispatched: ", dispatched)
+			}
+			if dispatched < environment.CommandDispatchBatchSize {
+				break
+			}
+		}
+	}
+}
+
+// ProcessCommandAcks gestisce le conferme dei comandi inviati ai sensori e aggiorna in batch lo stato dei comandi.
+func ProcessCommandAcks(commandAckChannel chan types.CommandAck, kafkaPauseSignal *utils.PauseSignal) {
+
+	// Connessione ai databases
+	setupRegionDbConnection()
+
+	// Batch per le conferme dei comandi
+	batch, err := types.NewCommandAckBatch(
+		environment.ConfigurationMessageBatchSize,
+		time.Duration(environment.ConfigurationMessageBatchTimeout)*time.Second,
+		// Funzione di salvataggio delle conferme
+		// Viene chiamata quando il batch è pieno o scade il timeout
+		func(b *types.CommandAckBatch) error {
+			// Manda un segnale per mettere in pausa il consumer Kafka
+			kafkaPauseSignal.Send(true)
+			if err := storage.UpdateSensorCommandStatusBatch(b); err != nil {
+				logger.Log.Error("Failed to update sensor command status batch: ", err)
+				os.Exit(1)
+			}
+			// Se tutto è andato a buon fine, esegui il commit
+			// dei messaggi Kafka
+			err := comunication.CommitCommandAckBatchMessages(b.GetKafkaMessages())
+			if err != nil {
+				logger.Log.Error("Failed to commit Kafka messages for command ack batch: ", err)
+				os.Exit(1)
+			}
+			// Manda un segnale per riavviare il consumer Kafka
+			kafkaPauseSignal.Send(false)
+			return nil
+		})
+	if err != nil {
+		logger.Log.Error("Failed to create command ack batch: ", err)
+		os.Exit(1)
+	}
+
+	for ack := range commandAckChannel {
+		logger.Log.Info("Command ack received: ", ack.CommandID, " - ", ack.Status)
+		batch.AddCommandAck(ack)
+	}
+
+	logger.Log.Warn("Command ack channel closed, stopping command ack processing")
+	os.Exit(1)
+}
+
 // ProcessProximityFogHubHeartbeat gestisce i messaggi di heartbeat per il Proximity Fog Hub.
 func ProcessProximityFogHubHeartbeat(heartbeatChannel chan types.HeartbeatMsg, kafkaPauseSignal *utils.PauseSignal) {
 
@@ -255,11 +255,13 @@ func InsertSensorDataBatch(batch *types.SensorDataBatch) error {
 		return err
 	}
 
-	// 4. Copia nella tabella definitiva ignorando i duplicati
+	// 4. Copia nella tabella definitiva: un dato già presente viene sostituito, perché è la revisione
+	// del riepilogo al minuto ricalcolato dall'Edge Hub dopo letture arrivate in ritardo
 	_, err = tx.Exec(ctx, `
 		INSERT INTO sensor_measurements (time, macrozone_name, zone_name, sensor_id, type, value)
-		SELECT time, macrozone_name, zone_name, sensor_id, type, value FROM temp_sensor_measurements
-		ON CONFLICT (time, macrozone_name, zone_name, sensor_id, type) DO NOTHING;
+		SELECT DISTINCT ON (time, macrozone_name, zone_name, sensor_id, type) time, macrozone_name, zone_name, sensor_id, type, value
+		FROM temp_sensor_measurements
+		ON CONFLICT (time, macrozone_name, zone_name, sensor_id, type) DO UPDATE SET value = EXCLUDED.value;
 	`)
 	if err != nil {
 		return err
@@ -269,6 +271,141 @@ func InsertSensorDataBatch(batch *types.SensorDataBatch) error {
 	return nil
 }
 
+// InsertRejectedDataBatch inserisce un batch di dati scartati dal filtro degli Edge Hub nel database gestendo i duplicati
+func InsertRejectedDataBatch(batch *types.RejectedSensorDataBatch) error {
+	logger.Log.Info("Inserting rejected data batch")
+
+	// Se il batch è vuoto, non fare nulla
+	if batch.Count() == 0 {
+		logger.Log.Info("No rejected data to insert, skipping")
+		return nil
+	}
+
+	// Inizio transazione
+	ctx := sensorDB.Ctx
+	conn, err := sensorDB.Db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			err := tx.Rollback(ctx)
+			if err != nil {
+				logger.Log.Error("Unable to rollback transaction: ", err)
+			} else {
+				logger.Log.Debug("Transaction rolled back successfully")
+			}
+		} else {
+			err := tx.Commit(ctx)
+			if err != nil {
+				logger.Log.Error("Unable to commit transaction: ", err)
+			} else {
+				logger.Log.Debug("Transaction committed successfully")
+			}
+		}
+	}()
+
+	// 1. Crea tabella temporanea
+	_, err = tx.Exec(ctx, `
+		CREATE TEMP TABLE temp_rejected_measurements (
+			time TIMESTAMP,
+			macrozone_name TEXT,
+			zone_name TEXT,
+			sensor_id TEXT,
+			type TEXT,
+			value DOUBLE PRECISION,
+			reason TEXT,
+			detector TEXT,
+			lower_bound DOUBLE PRECISION,
+			upper_bound DOUBLE PRECISION,
+			center DOUBLE PRECISION,
+			spread DOUBLE PRECISION,
+			samples INTEGER,
+			rejected_at TIMESTAMP
+		) ON COMMIT DROP;
+	`)
+	if err != nil {
+		return err
+	}
+
+	// 2. Prepara i dati per l'inserimento
+	rows := make([][]interface{}, 0, batch.Count())
+	for _, d := range batch.Items() {
+		rows = append(rows, []interface{}{
+			time.Unix(d.Timestamp, 0).UTC(),
+			d.EdgeMacrozone,
+			d.EdgeZone,
+			d.SensorID,
+			d.Type,
+			d.Data,
+			string(d.Reason),
+			d.Detector,
+			d.LowerBound,
+			d.UpperBound,
+			d.Center,
+			d.Spread,
+			d.Samples,
+			time.Unix(d.RejectedAt, 0).UTC(),
+		})
+	}
+
+	// 3. Inserisci i dati con CopyFrom nella tabella temporanea
+	_, err = tx.CopyFrom(
+		ctx,
+		pgx.Identifier{"temp_rejected_measurements"},
+		[]string{"time", "macrozone_name", "zone_name", "sensor_id", "type", "value", "reason", "detector", "lower_bound", "upper_bound", "center", "spread", "samples", "rejected_at"},
+		pgx.CopyFromRows(rows),
+	)
+	if err != nil {
+		return err
+	}
+
+	// 4. Copia nella tabella definitiva ignorando i duplicati
+	_, err = tx.Exec(ctx, `
+		INSERT INTO rejected_measurements (time, macrozone_name, zone_name, sensor_id, type, value, reason, detector, lower_bound, upper_bound, center, spread, samples, rejected_at)
+		SELECT time, macrozone_name, zone_name, sensor_id, type, value, reason, detector, lower_bound, upper_bound, center, spread, samples, rejected_at FROM temp_rejected_measurements
+		ON CONFLICT (time, macrozone_name, zone_name, sensor_id, type) DO NOTHING;
+	`)
+	if err != nil {
+		return err
+	}
+
+	logger.Log.Info("Inserted rejected data batch successfully: ", len(batch.Items()), " entries")
+	return nil
+}
+
+// InsertCriticalEvent inserisce una lettura critica nel database, ignorandola se è già stata ricevuta.
+// L'istante di memorizzazione (stored_at) permette di misurare la latenza della fast lane rispetto a detected_at,
+// mentre outlier e detector permettono di verificare le letture critiche che il filtro considerava outlier.
+func InsertCriticalEvent(event types.CriticalEvent) error {
+	query := `
+		INSERT INTO critical_events (time, macrozone_name, zone_name, sensor_id, type, value, severity, condition, threshold, detected_at, outlier, detector)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NULLIF($12, ''))
+		ON CONFLICT (time, macrozone_name, zone_name, sensor_id, type) DO NOTHING
+	`
+	_, err := sensorDB.Db.Exec(sensorDB.Ctx, query,
+		time.Unix(event.Timestamp, 0).UTC(),
+		event.EdgeMacrozone,
+		event.EdgeZone,
+		event.SensorID,
+		event.Type,
+		event.Data,
+		string(event.Severity),
+		string(event.Condition),
+		event.Threshold,
+		time.UnixMilli(event.DetectedAt).UTC(),
+		event.Outlier,
+		event.Detector,
+	)
+	return err
+}
+
 // UpdateSensorLastSeenBatch aggiorna il campo last_seen dei sensori in base ai dati ricevuti nel batch
 func UpdateSensorLastSeenBatch(batch *types.SensorDataBatch) error {
 
@@ -834,6 +971,246 @@ func RegisterDevicesFromBatch(batch *types.ConfigurationMsgBatch) error {
 	return nil
 }
 
+// InsertSensorStateEventsBatch salva nel database dei metadati della regione le transizioni di stato dei sensori
+// e aggiorna lo stato corrente di ciascun sensore con la transizione più recente del batch.
+func InsertSensorStateEventsBatch(batch *types.SensorStateEventBatch) error {
+	logger.Log.Info("Inserting sensor state events batch")
+
+	// Se il batch è vuoto, non fare nulla
+	if batch.Count() == 0 {
+		logger.Log.Info("No sensor state events to insert, skipping")
+		return nil
+	}
+
+	// Inizio transazione
+	ctx := regionDB.Ctx
+	conn, err := regionDB.Db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+		} else {
+			_ = tx.Commit(ctx)
+		}
+	}()
+
+	// 1. Crea tabella temporanea
+	_, err = tx.Exec(ctx, `
+		CREATE TEMP TABLE tmp_sensor_status_history (
+			sensor_id TEXT,
+			macrozone_name TEXT,
+			zone_name TEXT,
+			hub_id TEXT,
+			from_status TEXT,
+			to_status TEXT,
+			time TIMESTAMPTZ,
+			last_seen TIMESTAMPTZ
+		) ON COMMIT DROP;
+	`)
+	if err != nil {
+		return err
+	}
+
+	// 2. Prepara i dati per l'inserimento
+	rows := make([][]interface{}, 0, batch.Count())
+	for _, e := range batch.Items() {
+		var lastSeen interface{}
+		if e.LastSeen > 0 {
+			lastSeen = time.Unix(e.LastSeen, 0).UTC()
+		}
+		rows = append(rows, []interface{}{
+			e.SensorID,
+			e.EdgeMacrozone,
+			e.EdgeZone,
+			e.HubID,
+			string(e.From),
+			string(e.To),
+			time.Unix(e.Timestamp, 0).UTC(),
+			lastSeen,
+		})
+	}
+
+	// 3. Inserisci i dati con CopyFrom nella tabella temporanea
+	_, err = tx.CopyFrom(
+		ctx,
+		pgx.Identifier{"tmp_sensor_status_history"},
+		[]string{"sensor_id", "macrozone_name", "zone_name", "hub_id", "from_status", "to_status", "time", "last_seen"},
+		pgx.CopyFromRows(rows),
+	)
+	if err != nil {
+		return err
+	}
+
+	// 4. Copia nella tabella definitiva ignorando i duplicati
+	// e aggiorna lo stato corrente dei sensori solo se la transizione è più recente
+	_, err = tx.Exec(ctx, `
+		INSERT INTO sensor_status_history (sensor_id, macrozone_name, zone_name, hub_id, from_status, to_status, time, last_seen)
+		SELECT sensor_id, macrozone_name, zone_name, hub_id, from_status, to_status, time, last_seen FROM tmp_sensor_status_history
+		ON CONFLICT (sensor_id, macrozone_name, zone_name, time, to_status) DO NOTHING;
+
+		UPDATE sensors s
+		SET status = tmp.to_status, status_since = tmp.time
+		FROM (
+			SELECT DISTINCT ON (macrozone_name, zone_name, sensor_id) macrozone_name, zone_name, sensor_id, to_status, time
+			FROM tmp_sensor_status_history
+			ORDER BY macrozone_name, zone_name, sensor_id, time DESC
+		) tmp
+		WHERE s.macrozone_name = tmp.macrozone_name
+		  AND s.zone_name = tmp.zone_name
+		  AND s.id = tmp.sensor_id
+		  AND (s.status_since IS NULL OR s.status_since <= tmp.time);
+	`)
+	if err != nil {
+		return err
+	}
+
+	logger.Log.Info("Inserted sensor state events batch successfully: ", len(batch.Items()), " entries")
+	return nil
+}
+
+// DispatchPendingSensorCommands preleva al più limit comandi in attesa dal database dei metadati della regione,
+// li passa alla funzione send e, se l'invio ha successo, li segna come dispatched.
+// Le righe vengono bloccate con SKIP LOCKED, così più istanze possono inoltrare i comandi senza duplicati.
+// Restituisce il numero di comandi inoltrati.
+func DispatchPendingSensorCommands(ctx context.Context, limit int, send func([]types.SensorCommand) error) (int, error) {
+
+	tx, err := regionDB.Db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+		}
+	}()
+
+	rows, err := tx.Query(ctx, `
+		SELECT id, macrozone_name, zone_name, sensor_id, type, COALESCE(sampling_interval, 0), created_at
+		FROM sensor_commands
+		WHERE status = $1
+		ORDER BY created_at
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	`, string(types.CommandPending), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	commands := make([]types.SensorCommand, 0)
+	ids := make([]string, 0)
+	for rows.Next() {
+		var c types.SensorCommand
+		var createdAt time.Time
+		if err = rows.Scan(&c.ID, &c.EdgeMacrozone, &c.EdgeZone, &c.SensorID, &c.Type, &c.SamplingInterval, &createdAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		c.Timestamp = createdAt.Unix()
+		commands = append(commands, c)
+		ids = append(ids, c.ID)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(commands) == 0 {
+		err = tx.Commit(ctx)
+		return 0, err
+	}
+
+	// Invia i comandi; in caso di errore la transazione viene annullata e i comandi restano in attesa
+	if err = send(commands); err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE sensor_commands
+		SET status = $1, updated_at = $2
+		WHERE id = ANY($3)
+	`, string(types.CommandDispatched), time.Now().UTC(), ids)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return len(commands), nil
+}
+
+// ExpireSensorCommands segna come expired i comandi non conclusi creati prima di olderThan.
+// Restituisce il numero di comandi scaduti.
+func ExpireSensorCommands(ctx context.Context, olderThan time.Time) (int64, error) {
+	tag, err := regionDB.Db.Exec(ctx, `
+		UPDATE sensor_commands
+		SET status = $1, detail = 'command not completed in time', updated_at = $2
+		WHERE status = ANY($3) AND created_at < $4
+	`, string(types.CommandExpired), time.Now().UTC(), types.PrecedingCommandStatuses(types.CommandExpired), olderThan)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// UpdateSensorCommandStatusBatch aggiorna lo stato dei comandi in base alle conferme ricevute.
+// Lo stato di un comando può solo avanzare: le conferme arrivate fuori ordine o duplicate vengono ignorate.
+func UpdateSensorCommandStatusBatch(batch *types.CommandAckBatch) error {
+	logger.Log.Info("Updating sensor command status batch")
+
+	// Se il batch è vuoto, non fare nulla
+	if batch.Count() == 0 {
+		logger.Log.Info("No command acks to process, skipping")
+		return nil
+	}
+
+	// Inizio transazione
+	ctx := regionDB.Ctx
+	conn, err := regionDB.Db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback(ctx)
+		} else {
+			_ = tx.Commit(ctx)
+		}
+	}()
+
+	for _, ack := range batch.Items() {
+		if ack.Status.Rank() <= 0 {
+			logger.Log.Warn("Unknown status in command ack, skipping: ", ack.CommandID, " - ", ack.Status)
+			continue
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE sensor_commands
+			SET status = $1, detail = NULLIF($2, ''), updated_at = $3
+			WHERE id = $4 AND status = ANY($5)
+		`, string(ack.Status), ack.Detail, time.Unix(ack.Timestamp, 0).UTC(), ack.CommandID, types.PrecedingCommandStatuses(ack.Status))
+		if err != nil {
+			return err
+		}
+	}
+
+	logger.Log.Info("Updated sensor command status batch successfully: ", len(batch.Items()), " entries")
+	return nil
+}
+
 // SelfRegistration registra o aggiorna l'hub regionale
 func SelfRegistration() error {
 
@@ -21,14 +21,33 @@ var statsKafkaWriter *kafka.Writer = nil
 // configurationKafkaWriter per i messaggi di configurazione
 var configurationKafkaWriter *kafka.Writer = nil
 
+// rejectedKafkaWriter per le misurazioni scartate dagli Edge Hub
+var rejectedKafkaWriter *kafka.Writer = nil
+
+// criticalKafkaWriter per le letture critiche rilevate dagli Edge Hub
+var criticalKafkaWriter *kafka.Writer = nil
+
+// criticalBatchTimeout è l'attesa massima prima dell'invio delle letture critiche: il default della libreria (1 secondo)
+// accumula i messaggi in batch, ma per la fast lane ogni lettura deve essere inviata subito.
+const criticalBatchTimeout = 10 * time.Millisecond
+
 // heartbeatKafkaWriter per i messaggi di heartbeat
 var heartbeatKafkaWriter *kafka.Writer = nil
 
+// sensorStateKafkaWriter per le transizioni di stato dei sensori
+var sensorStateKafkaWriter *kafka.Writer = nil
+
+// commandAckKafkaWriter per le conferme dei comandi inviati ai sensori
+var commandAckKafkaWriter *kafka.Writer = nil
+
+// commandKafkaReader è il lettore Kafka per i comandi destinati ai sensori della macrozona
+var commandKafkaReader *kafka.Reader = nil
+
 // connect stabilisce la connessione con Kafka se non è già stabilita
 func connect() {
 
 	// Se tutte le connessioni sono già stabilite, non fare nulla
-	if realtimeKafkaWriter != nil && statsKafkaWriter != nil && configurationKafkaWriter != nil {
+	if realtimeKafkaWriter != nil && statsKafkaWriter != nil && configurationKafkaWriter != nil && rejectedKafkaWriter != nil && criticalKafkaWriter != nil && heartbeatKafkaWriter != nil && sensorStateKafkaWriter != nil && commandAckKafkaWriter != nil {
 		return
 	}
 
@@ -65,6 +84,25 @@ func connect() {
 	}
 	logger.Log.Info("Connected (write) to Kafka topic for configuration data, topic: ", environment.ProximityConfigurationTopic)
 
+	// Connessione per il topic delle misurazioni scartate
+	rejectedKafkaWriter = &kafka.Writer{
+		Addr:         kafka.TCP(environment.KafkaBroker + ":" + environment.KafkaPort),
+		Topic:        environment.ProximityRejectedDataTopic,
+		RequiredAcks: kafka.RequireOne,
+		Balancer:     &kafka.Hash{},
+	}
+	logger.Log.Info("Connected (write) to Kafka topic for rejected data, topic: ", environment.ProximityRejectedDataTopic)
+
+	// Connessione per il topic delle letture critiche
+	criticalKafkaWriter = &kafka.Writer{
+		Addr:         kafka.TCP(environment.KafkaBroker + ":" + environment.KafkaPort),
+		Topic:        environment.ProximityCriticalEventsTopic,
+		RequiredAcks: kafka.RequireAll,
+		Balancer:     &kafka.Hash{},
+		BatchTimeout: criticalBatchTimeout,
+	}
+	logger.Log.Info("Connected (write) to Kafka topic for critical events, topic: ", environment.ProximityCriticalEventsTopic)
+
 	// Connessione per il topic dei messaggi di heartbeat
 	heartbeatKafkaWriter = &kafka.Writer{
 		Addr:         kafka.TCP(environment.KafkaBroker + ":" + environment.KafkaPort),
@@ -73,6 +111,40 @@ func connect() {
 		Balancer:     &kafka.Hash{},
 	}
 	logger.Log.Info("Connected (write) to Kafka topic for heartbeat messages, topic: ", environment.ProximityHeartbeatTopic)
+
+	// Connessione per il topic delle transizioni di stato dei sensori
+	sensorStateKafkaWriter = &kafka.Writer{
+		Addr:         kafka.TCP(environment.KafkaBroker + ":" + environment.KafkaPort),
+		Topic:        environment.ProximitySensorStateTopic,
+		RequiredAcks: kafka.RequireAll,
+		Balancer:     &kafka.Hash{},
+	}
+	logger.Log.Info("Connected (write) to Kafka topic for sensor state events, topic: ", environment.ProximitySensorStateTopic)
+
+	// Connessione per il topic delle conferme dei comandi
+	commandAckKafkaWriter = &kafka.Writer{
+		Addr:         kafka.TCP(environment.KafkaBroker + ":" + environment.KafkaPort),
+		Topic:        environment.ProximityCommandAckTopic,
+		RequiredAcks: kafka.RequireAll,
+		Balancer:     &kafka.Hash{},
+	}
+	logger.Log.Info("Connected (write) to Kafka topic for command acks, topic: ", environment.ProximityCommandAckTopic)
+}
+
+// connectCommand si connette a Kafka per leggere i comandi destinati ai sensori
+func connectCommand() {
+
+	// Se la connessione è già stabilita, non fare nulla
+	if commandKafkaReader != nil {
+		return
+	}
+
+	commandKafkaReader = kafka.NewReader(kafka.ReaderConfig{
+		Brokers: []string{environment.KafkaBroker + ":" + environment.KafkaPort},
+		Topic:   environment.IntermediateCommandTopic,
+		GroupID: environment.KafkaGroupId,
+	})
+	logger.Log.Info("Connected (read) to Kafka topic for commands, topic: ", environment.IntermediateCommandTopic)
 }
 
 // SendRealTimeData invia i dati del sensore al topic Kafka dedicato
@@ -80,16 +152,17 @@ func SendRealTimeData(dataBatch []types.SensorData) error {
 	// Assicuriamoci di essere connessi a Kafka
 	connect()
 
-	// Prepara i messaggi da inviare
+	// Prepara i messaggi da inviare, indicando il formato di serializzazione nell'header
 	messages := make([]kafka.Message, len(dataBatch))
 	for i, data := range dataBatch {
-		msgBytes, err := json.Marshal(data)
+		msgBytes, err := types.MarshalSensorData(data, environment.KafkaDataContentType)
 		if err != nil {
 			return err
 		}
 		messages[i] = kafka.Message{
-			Key:   []byte(environment.EdgeMacrozone),
-			Value: msgBytes,
+			Key:     []byte(environment.EdgeMacrozone),
+			Value:   msgBytes,
+			Headers: []kafka.Header{{Key: types.ContentTypeHeader, Value: []byte(environment.KafkaDataContentType)}},
 		}
 	}
 
@@ -106,9 +179,10 @@ func SendAggregatedData(statsBatch []types.AggregatedStats) error {
 	// Assicuriamoci di essere connessi a Kafka
 	connect()
 
-	// Prepara i messaggi da inviare
+	// Prepara i messaggi da inviare, con la versione corrente dello schema
 	messages := make([]kafka.Message, len(statsBatch))
 	for i, data := range statsBatch {
+		data.SchemaVersion = types.AggregatedStatsSchemaVersion
 		msgBytes, err := json.Marshal(data)
 		if err != nil {
 			return err
@@ -127,6 +201,157 @@ func SendAggregatedData(statsBatch []types.AggregatedStats) error {
 	return statsKafkaWriter.WriteMessages(ctx, messages...)
 }
 
+// SendRejectedData invia una misurazione scartata dal filtro dell'Edge Hub al topic Kafka dedicato
+func SendRejectedData(data types.RejectedSensorData) error {
+	// Assicuriamoci di essere connessi a Kafka
+	connect()
+
+	// Serializza il messaggio in JSON
+	msgBytes, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	// Imposta un contesto con timeout per evitare blocchi indefiniti
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(environment.KafkaPublishTimeout)*time.Second)
+	defer cancel()
+
+	// Invia il messaggio a Kafka
+	return rejectedKafkaWriter.WriteMessages(ctx,
+		kafka.Message{
+			Key:   []byte(environment.EdgeMacrozone),
+			Value: msgBytes,
+		},
+	)
+}
+
+// SendCriticalEvent invia una lettura critica rilevata dall'Edge Hub al topic Kafka dedicato
+func SendCriticalEvent(event types.CriticalEvent) error {
+	// Assicuriamoci di essere connessi a Kafka
+	connect()
+
+	// Serializza il messaggio in JSON
+	msgBytes, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	// Imposta un contesto con timeout per evitare blocchi indefiniti
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(environment.KafkaPublishTimeout)*time.Second)
+	defer cancel()
+
+	// Invia il messaggio a Kafka
+	return criticalKafkaWriter.WriteMessages(ctx,
+		kafka.Message{
+			Key:   []byte(environment.EdgeMacrozone),
+			Value: msgBytes,
+		},
+	)
+}
+
+// SendSensorStateEvent invia una transizione di stato di un sensore al topic Kafka dedicato
+func SendSensorStateEvent(event types.SensorStateEvent) error {
+	// Assicuriamoci di essere connessi a Kafka
+	connect()
+
+	// Serializza il messaggio in JSON
+	msgBytes, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	// Imposta un contesto con timeout per evitare blocchi indefiniti
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(environment.KafkaPublishTimeout)*time.Second)
+	defer cancel()
+
+	// La chiave è l'id del sensore, così le transizioni dello stesso sensore
+	// finiscono nella stessa partizione e vengono consumate nell'ordine di invio
+	return sensorStateKafkaWriter.WriteMessages(ctx,
+		kafka.Message{
+			Key:   []byte(event.SensorID),
+			Value: msgBytes,
+		},
+	)
+}
+
+// SendCommandAck invia la conferma di un comando al topic Kafka dedicato
+func SendCommandAck(ack types.CommandAck) error {
+	// Assicuriamoci di essere connessi a Kafka
+	connect()
+
+	// Serializza il messaggio in JSON
+	msgBytes, err := json.Marshal(ack)
+	if err != nil {
+		return err
+	}
+
+	// Imposta un contesto con timeout per evitare blocchi indefiniti
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(environment.KafkaPublishTimeout)*time.Second)
+	defer cancel()
+
+	// La chiave è l'id del comando, così le conferme dello stesso comando
+	// finiscono nella stessa partizione e vengono consumate nell'ordine di invio
+	return commandAckKafkaWriter.WriteMessages(ctx,
+		kafka.Message{
+			Key:   []byte(ack.CommandID),
+			Value: msgBytes,
+		},
+	)
+}
+
+// PullSensorCommands legge i comandi destinati ai sensori e inoltra sul canale quelli della propria macrozona.
+// I comandi delle altre macrozone vengono confermati subito, senza essere elaborati.
+// Il commit dei comandi inoltrati è a carico di chi li elabora, tramite CommitSensorCommandMessage.
+func PullSensorCommands(commandChannel chan types.SensorCommand) error {
+
+	// Connessione a Kafka se non è già stabilita
+	connectCommand()
+	ctx := context.Background()
+
+	for {
+		// Legge il messaggio dal topic Kafka
+		m, err := commandKafkaReader.FetchMessage(ctx)
+		if err != nil {
+			return err
+		}
+		logger.Log.Debug("Received message from Kafka topic: ", m.Topic, " Partition: ", m.Partition, " Offset: ", m.Offset, " Key: ", string(m.Key))
+
+		// Converte il messaggio in un oggetto SensorCommand
+		command, err := types.CreateSensorCommandFromKafka(m)
+		if err != nil {
+			logger.Log.Error("Error unmarshalling sensor command: ", err)
+			if err := CommitSensorCommandMessage(m); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// I comandi delle altre macrozone non sono di competenza di questo hub
+		if command.EdgeMacrozone != environment.EdgeMacrozone {
+			if err := CommitSensorCommandMessage(m); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// L'invio è bloccante: il comando non deve essere perso
+		commandChannel <- command
+	}
+}
+
+// CommitSensorCommandMessage esegue il commit dell'offset di un comando letto da Kafka
+func CommitSensorCommandMessage(msg kafka.Message) error {
+	// Se il lettore Kafka non è inizializzato, non fare nulla
+	if commandKafkaReader == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(environment.KafkaCommitTimeout)*time.Second)
+	defer cancel()
+
+	return commandKafkaReader.CommitMessages(ctx, msg)
+}
+
 // SendConfigurationMessage invia i messaggi di configurazione al topic Kafka dedicato
 func SendConfigurationMessage(msg types.ConfigurationMsg) error {
 	// Assicuriamoci di essere connessi a Kafka
@@ -159,6 +384,7 @@ func SendOwnRegistrationMessage() {
 
 		// Crea il messaggio di registrazione
 		msg := types.ConfigurationMsg{
+			SchemaVersion: types.ConfigurationMsgSchemaVersion,
 			MsgType:       types.NewProximityMsgType,
 			EdgeMacrozone: environment.EdgeMacrozone,
 			Timestamp:     time.Now().UTC().Unix(),
@@ -217,6 +443,7 @@ func SendOwnHeartbeatMessage() {
 
 		// Crea il messaggio di heartbeat
 		heartbeatMsg := types.HeartbeatMsg{
+			SchemaVersion: types.HeartbeatMsgSchemaVersion,
 			EdgeMacrozone: environment.EdgeMacrozone,
 			HubID:         environment.HubID,
 			Timestamp:     time.Now().UTC().Unix(),
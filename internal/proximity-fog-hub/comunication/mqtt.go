@@ -4,7 +4,10 @@ import (
 	"SensorContinuum/internal/proximity-fog-hub/environment"
 	"SensorContinuum/pkg/logger"
 	"SensorContinuum/pkg/types"
+	"SensorContinuum/pkg/utils"
 	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
@@ -20,12 +23,12 @@ var client MQTT.Client
 var connectAttempts = 0
 
 // sensorDataHandler è la funzione di callback che processa i messaggi in arrivo.
-func makeSensorDataHandler(filteredDataChannel chan types.SensorData) MQTT.MessageHandler {
+func makeSensorDataHandler(filteredDataChannel chan types.SensorMinuteSummary) MQTT.MessageHandler {
 	return func(client MQTT.Client, msg MQTT.Message) {
 		logger.Log.Debug("Received message on topic: ", msg.Topic())
 
-		// convertiamo il messaggio grezzo MQTT nella struttura dati SensorData
-		sensorData, err := types.CreateSensorDataFromMQTT(msg)
+		// convertiamo il messaggio grezzo MQTT nella struttura dati SensorMinuteSummary
+		sensorData, err := types.CreateSensorMinuteSummaryFromMQTT(msg)
 		if err != nil {
 			logger.Log.Error("Error parsing sensor data from MQTT message: ", err.Error())
 			return
@@ -44,6 +47,49 @@ func makeSensorDataHandler(filteredDataChannel chan types.SensorData) MQTT.Messa
 	}
 }
 
+// makeRejectedDataHandler è la funzione di callback che processa i dati scartati dal filtro dell'Edge Hub.
+func makeRejectedDataHandler(rejectedDataChannel chan types.RejectedSensorData) MQTT.MessageHandler {
+	return func(client MQTT.Client, msg MQTT.Message) {
+		logger.Log.Debug("Received message on topic: ", msg.Topic())
+
+		// convertiamo il messaggio grezzo MQTT nella struttura dati RejectedSensorData
+		rejectedData, err := types.CreateRejectedSensorDataFromMQTT(msg)
+		if err != nil {
+			logger.Log.Error("Error parsing rejected data from MQTT message: ", err.Error())
+			return
+		}
+
+		// select non bloccante, il ricevitore MQTT non viene mai bloccato dal processore
+		// Se il canale è pieno, scarta il messaggio per non rallentare la ricezione.
+		select {
+		case rejectedDataChannel <- rejectedData:
+			// Messaggio inviato correttamente
+			logger.Log.Debug("Sent message to rejectedDataChannel")
+		default:
+			logger.Log.Warn("Rejected data channel is full. Discarding message from sensor: ", rejectedData.SensorID)
+		}
+	}
+}
+
+// makeCriticalEventHandler è la funzione di callback che processa le letture critiche rilevate dal filtro dell'Edge Hub.
+func makeCriticalEventHandler(criticalEventChannel chan types.CriticalEvent) MQTT.MessageHandler {
+	return func(client MQTT.Client, msg MQTT.Message) {
+		logger.Log.Debug("Received message on topic: ", msg.Topic())
+
+		// convertiamo il messaggio grezzo MQTT nella struttura dati CriticalEvent
+		event, err := types.CreateCriticalEventFromMQTT(msg)
+		if err != nil {
+			logger.Log.Error("Error parsing critical event from MQTT message: ", err.Error())
+			return
+		}
+
+		// Invio bloccante: un evento critico non viene mai scartato, e se il canale è pieno
+		// il messaggio viene confermato al broker solo quando c'è posto
+		criticalEventChannel <- event
+		logger.Log.Debug("Sent message to criticalEventChannel")
+	}
+}
+
 // configurationMessageHandler è la funzione di callback che processa i messaggi di configurazione in arrivo.
 func makeConfigurationMessageHandler(configurationMessageChannel chan types.ConfigurationMsg) MQTT.MessageHandler {
 	return func(client MQTT.Client, msg MQTT.Message) {
@@ -56,6 +102,19 @@ func makeConfigurationMessageHandler(configurationMessageChannel chan types.Conf
 			return
 		}
 
+		// Gli Edge Hub pubblicano la propria registrazione sul topic con il proprio identificativo
+		// e quelle dei sensori sul topic con l'identificativo del sensore
+		if len(msg.Payload()) > 0 {
+			id := configMsg.SensorID
+			if configMsg.MsgType == types.NewEdgeMsgType {
+				id = configMsg.HubID
+			}
+			if err := utils.CheckTopicIdentity(msg.Topic(), id); err != nil {
+				logger.Log.Error("Discarding configuration message: ", err.Error())
+				return
+			}
+		}
+
 		// select non bloccante, il ricevitore MQTT non viene mai bloccato dal processore
 		// Se il canale è pieno, scarta il messaggio per non rallentare la ricezione.
 		select {
@@ -80,6 +139,16 @@ func makeHeartbeatMessageHandler(heartbeatMessageChannel chan types.HeartbeatMsg
 			return
 		}
 
+		// L'hub può pubblicare solo sul topic con il proprio identificativo (ACL del broker)
+		// e non può inviare heartbeat a nome di un altro hub.
+		// I messaggi vuoti servono solo a rimuovere gli heartbeat conservati dal broker
+		if len(msg.Payload()) > 0 {
+			if err := utils.CheckTopicIdentity(msg.Topic(), heartbeatMsg.HubID); err != nil {
+				logger.Log.Error("Discarding heartbeat message: ", err.Error())
+				return
+			}
+		}
+
 		// select non bloccante, il ricevitore MQTT non viene mai bloccato dal processore
 		// Se il canale è pieno, scarta il messaggio per non rallentare la ricezione.
 		select {
@@ -92,9 +161,57 @@ func makeHeartbeatMessageHandler(heartbeatMessageChannel chan types.HeartbeatMsg
 	}
 }
 
+// makeSensorStateHandler è la funzione di callback che processa le transizioni di stato dei sensori in arrivo.
+func makeSensorStateHandler(sensorStateChannel chan types.SensorStateEvent) MQTT.MessageHandler {
+	return func(client MQTT.Client, msg MQTT.Message) {
+		logger.Log.Debug("Received message on topic: ", msg.Topic())
+
+		// convertiamo il messaggio grezzo MQTT nella struttura dati SensorStateEvent
+		event, err := types.CreateSensorStateEventFromMQTT(msg)
+		if err != nil {
+			logger.Log.Error("Error parsing sensor state event from MQTT message: ", err.Error())
+			return
+		}
+
+		// select non bloccante, il ricevitore MQTT non viene mai bloccato dal processore
+		// Se il canale è pieno, scarta il messaggio per non rallentare la ricezione.
+		select {
+		case sensorStateChannel <- event:
+			// Messaggio inviato correttamente
+			logger.Log.Debug("Sent sensor state event to channel")
+		default:
+			logger.Log.Warn("Sensor state channel is full. Discarding event from sensor: ", event.SensorID)
+		}
+	}
+}
+
+// makeCommandAckHandler è la funzione di callback che processa le conferme dei comandi in arrivo dagli Edge Hub.
+func makeCommandAckHandler(commandAckChannel chan types.CommandAck) MQTT.MessageHandler {
+	return func(client MQTT.Client, msg MQTT.Message) {
+		logger.Log.Debug("Received message on topic: ", msg.Topic())
+
+		// convertiamo il messaggio grezzo MQTT nella struttura dati CommandAck
+		ack, err := types.CreateCommandAckFromMQTT(msg)
+		if err != nil {
+			logger.Log.Error("Error parsing command ack from MQTT message: ", err.Error())
+			return
+		}
+
+		// select non bloccante, il ricevitore MQTT non viene mai bloccato dal processore
+		// Se il canale è pieno, scarta il messaggio per non rallentare la ricezione.
+		select {
+		case commandAckChannel <- ack:
+			// Messaggio inviato correttamente
+			logger.Log.Debug("Sent command ack to channel")
+		default:
+			logger.Log.Warn("Command ack channel is full. Discarding ack for command: ", ack.CommandID)
+		}
+	}
+}
+
 // makeConnectionHandler viene chiamata quando la connessione MQTT è già riuscita e quello che fa ora è
 // sottoscriversi ai topic desiderati.
-func makeConnectionHandler(filteredDataChannel chan types.SensorData, configurationMessageChannel chan types.ConfigurationMsg, heartbeatMessageChannel chan types.HeartbeatMsg) MQTT.OnConnectHandler {
+func makeConnectionHandler(filteredDataChannel chan types.SensorMinuteSummary, rejectedDataChannel chan types.RejectedSensorData, criticalEventChannel chan types.CriticalEvent, configurationMessageChannel chan types.ConfigurationMsg, sensorStateChannel chan types.SensorStateEvent, commandAckChannel chan types.CommandAck, heartbeatMessageChannel chan types.HeartbeatMsg) MQTT.OnConnectHandler {
 	return func(client MQTT.Client) {
 
 		var topic string
@@ -114,6 +231,34 @@ func makeConnectionHandler(filteredDataChannel chan types.SensorData, configurat
 			}
 		}
 
+		if rejectedDataChannel != nil && (environment.ServiceMode == types.ProximityHubLocalCacheService || environment.ServiceMode == types.ProximityHubService) {
+			topic = environment.RejectedDataTopic + "/#"
+			logger.Log.Debug("Subscribing to topic: ", topic)
+
+			// Sottoscrivi al topic per ricevere i dati scartati dagli Edge Hub
+			// QoS 1, cioè "at least once", il messaggio viene consegnato almeno una volta, possono esserci duplicati
+			token = client.Subscribe(topic, 1, makeRejectedDataHandler(rejectedDataChannel))
+			logger.Log.Info("Subscribed to topic: ", topic)
+			if token.WaitTimeout(time.Duration(environment.MqttMaxSubscriptionTimeout)*time.Second) && token.Error() != nil {
+				logger.Log.Error("Failed to subscribe to topic:", topic, "error:", token.Error())
+				os.Exit(1) // Esci se non riesci a sottoscrivere
+			}
+		}
+
+		if criticalEventChannel != nil && (environment.ServiceMode == types.ProximityHubLocalCacheService || environment.ServiceMode == types.ProximityHubService) {
+			topic = environment.CriticalDataTopic + "/#"
+			logger.Log.Debug("Subscribing to topic: ", topic)
+
+			// Sottoscrivi al topic per ricevere le letture critiche dagli Edge Hub
+			// QoS 1, cioè "at least once", il messaggio viene consegnato almeno una volta, possono esserci duplicati
+			token = client.Subscribe(topic, 1, makeCriticalEventHandler(criticalEventChannel))
+			logger.Log.Info("Subscribed to topic: ", topic)
+			if token.WaitTimeout(time.Duration(environment.MqttMaxSubscriptionTimeout)*time.Second) && token.Error() != nil {
+				logger.Log.Error("Failed to subscribe to topic:", topic, "error:", token.Error())
+				os.Exit(1) // Esci se non riesci a sottoscrivere
+			}
+		}
+
 		if configurationMessageChannel != nil && (environment.ServiceMode == types.ProximityHubConfigurationService || environment.ServiceMode == types.ProximityHubService) {
 			topic = environment.HubConfigurationTopic + "/#"
 			logger.Log.Debug("Subscribing to topic: ", topic)
@@ -128,6 +273,34 @@ func makeConnectionHandler(filteredDataChannel chan types.SensorData, configurat
 			}
 		}
 
+		if sensorStateChannel != nil && (environment.ServiceMode == types.ProximityHubConfigurationService || environment.ServiceMode == types.ProximityHubService) {
+			topic = environment.SensorStateTopic + "/#"
+			logger.Log.Debug("Subscribing to topic: ", topic)
+
+			// Sottoscrivi al topic per ricevere le transizioni di stato dei sensori
+			// QoS 1, cioè "at least once", il messaggio viene consegnato almeno una volta, possono esserci duplicati
+			token = client.Subscribe(topic, 1, makeSensorStateHandler(sensorStateChannel))
+			logger.Log.Info("Subscribed to topic: ", topic)
+			if token.WaitTimeout(time.Duration(environment.MqttMaxSubscriptionTimeout)*time.Second) && token.Error() != nil {
+				logger.Log.Error("Failed to subscribe to topic:", topic, "error:", token.Error())
+				os.Exit(1) // Esci se non riesci a sottoscrivere
+			}
+		}
+
+		if commandAckChannel != nil && (environment.ServiceMode == types.ProximityHubConfigurationService || environment.ServiceMode == types.ProximityHubService) {
+			topic = environment.CommandAckTopic + "/#"
+			logger.Log.Debug("Subscribing to topic: ", topic)
+
+			// Sottoscrivi al topic per ricevere le conferme dei comandi
+			// QoS 1, cioè "at least once", il messaggio viene consegnato almeno una volta, possono esserci duplicati
+			token = client.Subscribe(topic, 1, makeCommandAckHandler(commandAckChannel))
+			logger.Log.Info("Subscribed to topic: ", topic)
+			if token.WaitTimeout(time.Duration(environment.MqttMaxSubscriptionTimeout)*time.Second) && token.Error() != nil {
+				logger.Log.Error("Failed to subscribe to topic:", topic, "error:", token.Error())
+				os.Exit(1) // Esci se non riesci a sottoscrivere
+			}
+		}
+
 		if heartbeatMessageChannel != nil && (environment.ServiceMode == types.ProximityHubHeartbeatService || environment.ServiceMode == types.ProximityHubService) {
 			topic = environment.HeartbeatTopic + "/#"
 			logger.Log.Debug("Subscribing to topic: ", topic)
@@ -153,7 +326,7 @@ func makeConnectionHandler(filteredDataChannel chan types.SensorData, configurat
 
 // connectAndManage gestisce la connessione al broker MQTT e la riconnessione in caso di perdita della connessione.
 // Se la connessione è già attiva, non fa nulla.
-func connectAndManage(filteredDataChannel chan types.SensorData, configurationMessageChannel chan types.ConfigurationMsg, heartbeatMessageChannel chan types.HeartbeatMsg) {
+func connectAndManage(filteredDataChannel chan types.SensorMinuteSummary, rejectedDataChannel chan types.RejectedSensorData, criticalEventChannel chan types.CriticalEvent, configurationMessageChannel chan types.ConfigurationMsg, sensorStateChannel chan types.SensorStateEvent, commandAckChannel chan types.CommandAck, heartbeatMessageChannel chan types.HeartbeatMsg) {
 	if client != nil && client.IsConnected() {
 		return
 	}
@@ -168,6 +341,14 @@ func connectAndManage(filteredDataChannel chan types.SensorData, configurationMe
 	opts.SetClientID(mqttId)
 	opts.SetProtocolVersion(5)
 
+	// --- Impostazioni di Sicurezza ---
+
+	// TLS con autenticazione reciproca e credenziali dell'hub, se configurati
+	if err := environment.MqttSecurity.Apply(opts, environment.HubID); err != nil {
+		logger.Log.Error("Error configuring MQTT security: ", err.Error())
+		os.Exit(1)
+	}
+
 	// --- Impostazioni di Resilienza ---
 
 	// la libreria paho gestisce automaticamente la riconnessione in background,
@@ -182,7 +363,7 @@ func connectAndManage(filteredDataChannel chan types.SensorData, configurationMe
 	// e permette di sottoscrivere ai topic desiderati.
 	// In questo caso, sottoscrive al topic dei dati, di configurazione del sensore
 	// e di heartbeat.
-	opts.SetOnConnectHandler(makeConnectionHandler(filteredDataChannel, configurationMessageChannel, heartbeatMessageChannel))
+	opts.SetOnConnectHandler(makeConnectionHandler(filteredDataChannel, rejectedDataChannel, criticalEventChannel, configurationMessageChannel, sensorStateChannel, commandAckChannel, heartbeatMessageChannel))
 	opts.SetConnectionLostHandler(func(c MQTT.Client, err error) {
 		logger.Log.Warn("Hub lost connection to MQTT broker: ", err.Error())
 	})
@@ -213,7 +394,7 @@ func connectAndManage(filteredDataChannel chan types.SensorData, configurationMe
 	}
 }
 
-func SetupMQTTConnection(filteredDataChannel chan types.SensorData, configurationMessageChannel chan types.ConfigurationMsg, heartbeatMessageChannel chan types.HeartbeatMsg) {
+func SetupMQTTConnection(filteredDataChannel chan types.SensorMinuteSummary, rejectedDataChannel chan types.RejectedSensorData, criticalEventChannel chan types.CriticalEvent, configurationMessageChannel chan types.ConfigurationMsg, sensorStateChannel chan types.SensorStateEvent, commandAckChannel chan types.CommandAck, heartbeatMessageChannel chan types.HeartbeatMsg) {
 
 	// Assicura che la connessione non sia già stata inizializzata.
 	if client != nil && client.IsConnected() {
@@ -222,7 +403,7 @@ func SetupMQTTConnection(filteredDataChannel chan types.SensorData, configuratio
 	}
 
 	// Inizializza la connessione MQTT
-	connectAndManage(filteredDataChannel, configurationMessageChannel, heartbeatMessageChannel)
+	connectAndManage(filteredDataChannel, rejectedDataChannel, criticalEventChannel, configurationMessageChannel, sensorStateChannel, commandAckChannel, heartbeatMessageChannel)
 
 	// Non procedere se la connessione non è attiva.
 	if !client.IsConnected() {
@@ -231,6 +412,39 @@ func SetupMQTTConnection(filteredDataChannel chan types.SensorData, configuratio
 	}
 }
 
+// PublishSensorCommand pubblica un comando sul topic HubCommandTopic/<zona>/<id sensore>/<id comando>.
+// Il messaggio viene conservato dal broker finché l'Edge Hub della zona non lo consegna al sensore,
+// così i comandi non vengono persi se l'Edge Hub è temporaneamente disconnesso.
+func PublishSensorCommand(command types.SensorCommand) error {
+
+	// Non procedere se la connessione non è attiva.
+	if !client.IsConnected() {
+		return errors.New("MQTT client not connected")
+	}
+
+	payload, err := json.Marshal(command)
+	if err != nil {
+		return err
+	}
+
+	topic := environment.HubCommandTopic + "/" + command.EdgeZone + "/" + command.SensorID + "/" + command.ID
+
+	// QoS 2, cioè "exactly once", il messaggio viene consegnato una sola volta, senza duplicati
+	// Retained true, il messaggio viene conservato dal broker
+	for i := 0; i < environment.MqttMessagePublishAttempts; i++ {
+		token := client.Publish(topic, 2, true, payload)
+		if !token.WaitTimeout(time.Duration(environment.MqttMessagePublishTimeout) * time.Second) {
+			logger.Log.Warn("Timeout publishing sensor command. Retry ", i+1)
+		} else if err = token.Error(); err != nil {
+			logger.Log.Error("Error publishing sensor command: ", err.Error(), ". Retry ", i+1)
+		} else {
+			logger.Log.Debug("Sensor command published successfully on topic: ", topic)
+			return nil
+		}
+	}
+	return errors.New("failed to publish sensor command on topic " + topic)
+}
+
 // CleanRetentionConfigurationMessage Rimuove il messaggio di configurazione dal canale se è già stato elaborato.
 // Questo è utile per evitare di elaborare più volte lo stesso messaggio.
 func CleanRetentionConfigurationMessage(msg types.ConfigurationMsg) {
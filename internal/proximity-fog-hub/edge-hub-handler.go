@@ -2,24 +2,30 @@ package proximity_fog_hub
 
 import (
 	"SensorContinuum/internal/proximity-fog-hub/comunication"
+	"SensorContinuum/internal/proximity-fog-hub/environment"
 	"SensorContinuum/internal/proximity-fog-hub/storage"
 	"SensorContinuum/pkg/logger"
 	"SensorContinuum/pkg/types"
 	"context"
+	"os"
+	"time"
 )
 
 // ProcessEdgeHubData riceve i dati che arrivano dal Edge Hub tramite MQTT nel canale
 // I dati vengono messi nel canale dalla funzione makeSensorDataHandler e, una volta ricevuti,
 // li salva nella cache locale.
-func ProcessEdgeHubData(dataChannel chan types.SensorData) {
+func ProcessEdgeHubData(dataChannel chan types.SensorMinuteSummary) {
 	// si mette in attesa di ricevere i dati
 	for data := range dataChannel {
-		logger.Log.Info("Filtered data received, sensorId: ", data.SensorID, ", value: ", data.Data)
+		logger.Log.Info("Filtered data received, sensorId: ", data.SensorID, ", mean: ", data.Mean, ", count: ", data.Count)
+		if data.Revision > 0 {
+			logger.Log.Info("Summary revision ", data.Revision, " received for sensorId: ", data.SensorID, ", timestamp: ", data.Timestamp)
+		}
 
 		// Salva il dato nella cache locale (TimescaleDB)
 		// Usiamo un contesto separato per l'operazione sul DB per non bloccare tutto.
 		ctx := context.Background()
-		if err := storage.InsertSensorData(ctx, data); err != nil {
+		if err := storage.InsertSensorMinuteSummary(ctx, data); err != nil {
 			// Se il salvataggio fallisce, logghiamo l'errore ma NON CI FERMIAMO.
 			// La resilienza impone che l'invio in tempo reale a Kafka abbia la priorità.
 			logger.Log.Error("Failure to save data to local cache, sensorId: ", data.SensorID, ", Error: ", err)
@@ -29,6 +35,40 @@ func ProcessEdgeHubData(dataChannel chan types.SensorData) {
 	}
 }
 
+// ProcessEdgeHubRejectedData riceve i dati scartati dal filtro dell'Edge Hub tramite MQTT nel canale
+// e li inoltra all'Intermediate Fog Hub, che li memorizza per l'analisi delle decisioni del filtro.
+func ProcessEdgeHubRejectedData(rejectedDataChannel chan types.RejectedSensorData) {
+	for data := range rejectedDataChannel {
+		logger.Log.Info("Rejected data received, sensorId: ", data.SensorID, ", value: ", data.Data, ", reason: ", data.Reason)
+		if err := comunication.SendRejectedData(data); err != nil {
+			logger.Log.Error("Failure to send rejected data to Region Hub, sensorId: ", data.SensorID, ", Error: ", err)
+			continue
+		}
+		logger.Log.Debug("Rejected data sent to Region Hub successfully, sensorId: ", data.SensorID)
+	}
+}
+
+// ProcessEdgeHubCriticalEvents riceve le letture critiche rilevate dal filtro dell'Edge Hub tramite MQTT nel canale
+// e le inoltra subito all'Intermediate Fog Hub, senza passare dalla cache locale e dall'aggregazione.
+// Una lettura critica non viene mai scartata: se l'invio fallisce viene ritentato con un'attesa crescente
+// e, nel frattempo, le letture successive restano nel canale.
+func ProcessEdgeHubCriticalEvents(criticalEventChannel chan types.CriticalEvent) {
+	for event := range criticalEventChannel {
+		logger.Log.Warn("Critical event received, sensorId: ", event.SensorID, ", value: ", event.Data, ", severity: ", event.Severity)
+		delay := environment.CriticalEventRetryMinDelay
+		for attempt := 1; ; attempt++ {
+			err := comunication.SendCriticalEvent(event)
+			if err == nil {
+				break
+			}
+			logger.Log.Error("Failure to send critical event to Region Hub, sensorId: ", event.SensorID, ", attempt: ", attempt, ", retrying in ", delay.String(), ", Error: ", err)
+			time.Sleep(delay)
+			delay = min(2*delay, environment.CriticalEventRetryMaxDelay)
+		}
+		logger.Log.Debug("Critical event sent to Region Hub successfully, sensorId: ", event.SensorID)
+	}
+}
+
 // ProcessEdgeHubConfiguration riceve i messaggi di configurazione che arrivano dal Edge Hub tramite MQTT nel canale
 func ProcessEdgeHubConfiguration(configChannel chan types.ConfigurationMsg) {
 	for configMsg := range configChannel {
@@ -48,6 +88,61 @@ func ProcessEdgeHubConfiguration(configChannel chan types.ConfigurationMsg) {
 	}
 }
 
+// ProcessEdgeHubSensorState riceve le transizioni di stato dei sensori che arrivano dal Edge Hub tramite MQTT nel canale
+// e le inoltra all'Intermediate Fog Hub, che ne mantiene la storia nel database dei metadati della regione.
+func ProcessEdgeHubSensorState(sensorStateChannel chan types.SensorStateEvent) {
+	for event := range sensorStateChannel {
+		if event.Timestamp <= 0 {
+			logger.Log.Warn("Received empty sensor state event, skipping...")
+			continue
+		}
+		logger.Log.Info("Sensor state event received, sensorId: ", event.SensorID, ", from: ", event.From, ", to: ", event.To)
+		// Invia la transizione di stato al Region Hub
+		if err := comunication.SendSensorStateEvent(event); err != nil {
+			logger.Log.Error("Failure to send sensor state event to Region Hub, sensorId: ", event.SensorID, ", Error: ", err)
+			continue
+		}
+		logger.Log.Debug("Sensor state event sent to Region Hub successfully, sensorId: ", event.SensorID)
+	}
+}
+
+// ProcessIntermediateFogHubCommands riceve i comandi destinati ai sensori della macrozona letti da Kafka
+// e li pubblica sul broker MQTT, da cui vengono prelevati dall'Edge Hub della zona.
+// L'offset Kafka viene confermato solo dopo la pubblicazione, così nessun comando viene perso.
+func ProcessIntermediateFogHubCommands(commandChannel chan types.SensorCommand) {
+	for command := range commandChannel {
+		logger.Log.Info("Sensor command received, commandId: ", command.ID, ", sensorId: ", command.SensorID, ", type: ", command.Type)
+		// Pubblica il comando verso l'Edge Hub
+		if err := comunication.PublishSensorCommand(command); err != nil {
+			logger.Log.Error("Failure to publish sensor command to Edge Hub, commandId: ", command.ID, ", Error: ", err)
+			os.Exit(1)
+		}
+		if err := comunication.CommitSensorCommandMessage(command.KafkaMsg); err != nil {
+			logger.Log.Error("Failure to commit sensor command, commandId: ", command.ID, ", Error: ", err)
+			os.Exit(1)
+		}
+		logger.Log.Debug("Sensor command published to Edge Hub successfully, commandId: ", command.ID)
+	}
+}
+
+// ProcessEdgeHubCommandAcks riceve le conferme dei comandi che arrivano dal Edge Hub tramite MQTT nel canale
+// e le inoltra all'Intermediate Fog Hub, che aggiorna lo stato dei comandi nel database dei metadati della regione.
+func ProcessEdgeHubCommandAcks(commandAckChannel chan types.CommandAck) {
+	for ack := range commandAckChannel {
+		if ack.CommandID == "" {
+			logger.Log.Warn("Received empty command ack, skipping...")
+			continue
+		}
+		logger.Log.Info("Command ack received, commandId: ", ack.CommandID, ", status: ", ack.Status)
+		// Invia la conferma al Region Hub
+		if err := comunication.SendCommandAck(ack); err != nil {
+			logger.Log.Error("Failure to send command ack to Region Hub, commandId: ", ack.CommandID, ", Error: ", err)
+			continue
+		}
+		logger.Log.Debug("Command ack sent to Region Hub successfully, commandId: ", ack.CommandID)
+	}
+}
+
 // ProcessEdgeHubHeartbeat riceve i messaggi di heartbeat che arrivano dal Edge Hub tramite MQTT nel canale
 func ProcessEdgeHubHeartbeat(heartbeatChannel chan types.HeartbeatMsg) {
 	for heartbeatMsg := range heartbeatChannel {
@@ -6,6 +6,7 @@ import (
 	"SensorContinuum/configs/timeouts"
 	"SensorContinuum/pkg/logger"
 	"SensorContinuum/pkg/types"
+	"SensorContinuum/pkg/utils"
 	"errors"
 	"os"
 	"strconv"
@@ -35,15 +36,34 @@ var MqttBroker string
 // MqttPort specifica la porta del broker MQTT.
 var MqttPort string
 
+// MqttSecurity contiene le impostazioni TLS e le credenziali della connessione al broker MQTT.
+// Con un certificato client, il suo CN è l'identità dell'hub e deve coincidere con HubID.
+var MqttSecurity utils.MQTTSecurity
+
 // FilteredDataTopic è il topic MQTT su cui il Proximity Fog Hub riceve i dati filtrati dall'Edge Hub.
 var FilteredDataTopic string
 
+// RejectedDataTopic è il topic MQTT su cui il Proximity Fog Hub riceve i dati scartati dal filtro dell'Edge Hub.
+var RejectedDataTopic string
+
+// CriticalDataTopic è il topic MQTT su cui il Proximity Fog Hub riceve le letture critiche rilevate dal filtro dell'Edge Hub.
+var CriticalDataTopic string
+
 // HubConfigurationTopic è il topic MQTT su cui il Proximity Fog Hub riceve i messaggi di configurazione.
 var HubConfigurationTopic string
 
 // HeartbeatTopic è il topic MQTT su cui il Proximity Fog Hub riceve i messaggi di heartbeat.
 var HeartbeatTopic string
 
+// SensorStateTopic è il topic MQTT su cui il Proximity Fog Hub riceve le transizioni di stato dei sensori dagli Edge Hub.
+var SensorStateTopic string
+
+// HubCommandTopic è il topic MQTT su cui il Proximity Fog Hub pubblica i comandi destinati ai sensori della macrozona.
+var HubCommandTopic string
+
+// CommandAckTopic è il topic MQTT su cui il Proximity Fog Hub riceve le conferme dei comandi dagli Edge Hub.
+var CommandAckTopic string
+
 // Queste impostazioni controllano il comportamento della riconnessione al broker MQTT.
 
 // MqttMaxReconnectionInterval specifica l'intervallo massimo tra i tentativi di riconnessione in secondi.
@@ -85,12 +105,38 @@ var ProximityConfigurationTopic string
 // ProximityAggregatedStatsTopic è il topic Kafka su cui il Proximity Fog Hub invia le statistiche aggregate all'Intermediate Fog Hub.
 var ProximityAggregatedStatsTopic string
 
+// ProximityRejectedDataTopic è il topic Kafka su cui il Proximity Fog Hub invia i dati scartati dagli Edge Hub all'Intermediate Fog Hub.
+var ProximityRejectedDataTopic string
+
+// ProximityCriticalEventsTopic è il topic Kafka su cui il Proximity Fog Hub invia le letture critiche all'Intermediate Fog Hub.
+var ProximityCriticalEventsTopic string
+
 // ProximityHeartbeatTopic è il topic Kafka su cui il Proximity Fog Hub invia i messaggi di heartbeat all'Intermediate Fog Hub.
 var ProximityHeartbeatTopic string
 
+// ProximitySensorStateTopic è il topic Kafka su cui il Proximity Fog Hub invia le transizioni di stato dei sensori all'Intermediate Fog Hub.
+var ProximitySensorStateTopic string
+
+// ProximityCommandAckTopic è il topic Kafka su cui il Proximity Fog Hub invia le conferme dei comandi all'Intermediate Fog Hub.
+var ProximityCommandAckTopic string
+
+// IntermediateCommandTopic è il topic Kafka da cui il Proximity Fog Hub riceve i comandi destinati ai sensori.
+var IntermediateCommandTopic string
+
+// KafkaGroupId specifica il group ID per i consumer Kafka.
+// Ogni macrozona ha il proprio group ID, così ogni Proximity Fog Hub riceve tutti i comandi
+// e le istanze della stessa macrozona si dividono il carico.
+var KafkaGroupId string
+
+// KafkaCommitTimeout specifica il timeout per il commit degli offset Kafka in secondi.
+var KafkaCommitTimeout int = 5
+
 // KafkaPublishTimeout specifica il timeout per la pubblicazione dei messaggi su Kafka in secondi.
 var KafkaPublishTimeout int = 5
 
+// KafkaDataContentType specifica il formato di serializzazione (JSON o CBOR) delle letture inviate all'Intermediate Fog Hub.
+var KafkaDataContentType = types.JSONContentType
+
 // Queste impostazioni sono utilizzate per la connessione al database PostgreSQL locale.
 // Il database viene utilizzato per la memorizzazione temporanea dei dati e delle statistiche.
 
@@ -141,6 +187,11 @@ const (
 	// messaggi che sono stati appena inviati.
 	SentMessageMaxAge = 12 * time.Hour
 
+	// CriticalEventRetryMinDelay e CriticalEventRetryMaxDelay delimitano l'attesa tra i tentativi di inoltro
+	// di una lettura critica: l'attesa raddoppia ad ogni errore, fino al massimo, finché l'invio non riesce.
+	CriticalEventRetryMinDelay = time.Second
+	CriticalEventRetryMaxDelay = 30 * time.Second
+
 	// HeartbeatInterval specifica l'intervallo di tempo tra i messaggi di heartbeat inviati all'Intermediate Fog Hub.
 	HeartbeatInterval = timeouts.HeartbeatInterval
 )
@@ -195,6 +246,17 @@ func SetupEnvironment() error {
 		}
 	}
 
+	/* ----- MQTT SECURITY SETTINGS ----- */
+
+	MqttSecurity = utils.MQTTSecurity{
+		CAFile:   os.Getenv("MQTT_CA_FILE"),
+		CertFile: os.Getenv("MQTT_CERT_FILE"),
+		KeyFile:  os.Getenv("MQTT_KEY_FILE"),
+		Username: os.Getenv("MQTT_USERNAME"),
+		Password: os.Getenv("MQTT_PASSWORD"),
+		Token:    os.Getenv("MQTT_TOKEN"),
+	}
+
 	/* ----- ENVIRONMENT SETTINGS ----- */
 
 	EdgeMacrozone, exists = os.LookupEnv("EDGE_MACROZONE")
@@ -203,10 +265,19 @@ func SetupEnvironment() error {
 	}
 
 	HubID, exists = os.LookupEnv("HUB_ID")
+	hubIDConfigured := exists
 	if !exists {
 		HubID = uuid.New().String()
 	}
 
+	// Con un certificato client l'identità dell'hub è il CN del certificato:
+	// viene utilizzata come HubID se HUB_ID non è impostata, altrimenti deve coincidere con HubID
+	var err error
+	HubID, err = MqttSecurity.ResolveIdentity(HubID, hubIDConfigured)
+	if err != nil {
+		return errors.New("invalid value for HUB_ID: " + err.Error())
+	}
+
 	/* ----- MQTT BROKER SETTINGS ----- */
 
 	MqttProtocol, exists = os.LookupEnv("MQTT_BROKER_PROTOCOL")
@@ -224,9 +295,18 @@ func SetupEnvironment() error {
 		MqttPort = mosquitto.PORT
 	}
 
+	if err := MqttSecurity.Validate(MqttProtocol); err != nil {
+		return errors.New("invalid MQTT security settings: " + err.Error())
+	}
+
 	FilteredDataTopic = "$share/proximity-fog-hub_" + EdgeMacrozone + "/filtered-data/" + EdgeMacrozone
+	RejectedDataTopic = "$share/proximity-fog-hub_" + EdgeMacrozone + "/rejected-data/" + EdgeMacrozone
+	CriticalDataTopic = "$share/proximity-fog-hub_" + EdgeMacrozone + "/critical-data/" + EdgeMacrozone
 	HubConfigurationTopic = "configuration/hub/" + EdgeMacrozone
 	HeartbeatTopic = "heartbeat/" + EdgeMacrozone
+	SensorStateTopic = "$share/proximity-fog-hub_" + EdgeMacrozone + "/sensor-state/" + EdgeMacrozone
+	HubCommandTopic = "command/hub/" + EdgeMacrozone
+	CommandAckTopic = "$share/proximity-fog-hub_" + EdgeMacrozone + "/command-ack/hub/" + EdgeMacrozone
 
 	var MqttMaxReconnectionIntervalStr string
 	MqttMaxReconnectionIntervalStr, exists = os.LookupEnv("MQTT_MAX_RECONNECTION_INTERVAL")
@@ -325,11 +405,38 @@ func SetupEnvironment() error {
 		ProximityAggregatedStatsTopic = kafka.PROXIMITY_FOG_HUB_AGGREGATED_STATS_TOPIC
 	}
 
+	ProximityRejectedDataTopic, exists = os.LookupEnv("KAFKA_PROXIMITY_FOG_HUB_REJECTED_DATA_TOPIC")
+	if !exists {
+		ProximityRejectedDataTopic = kafka.PROXIMITY_FOG_HUB_REJECTED_DATA_TOPIC
+	}
+
+	ProximityCriticalEventsTopic, exists = os.LookupEnv("KAFKA_PROXIMITY_FOG_HUB_CRITICAL_EVENTS_TOPIC")
+	if !exists {
+		ProximityCriticalEventsTopic = kafka.PROXIMITY_FOG_HUB_CRITICAL_EVENTS_TOPIC
+	}
+
 	ProximityHeartbeatTopic, exists = os.LookupEnv("KAFKA_PROXIMITY_FOG_HUB_HEARTBEAT_TOPIC")
 	if !exists {
 		ProximityHeartbeatTopic = kafka.PROXIMITY_FOG_HUB_HEARTBEAT_TOPIC
 	}
 
+	ProximitySensorStateTopic, exists = os.LookupEnv("KAFKA_PROXIMITY_FOG_HUB_SENSOR_STATE_TOPIC")
+	if !exists {
+		ProximitySensorStateTopic = kafka.PROXIMITY_FOG_HUB_SENSOR_STATE_TOPIC
+	}
+
+	ProximityCommandAckTopic, exists = os.LookupEnv("KAFKA_PROXIMITY_FOG_HUB_COMMAND_ACK_TOPIC")
+	if !exists {
+		ProximityCommandAckTopic = kafka.PROXIMITY_FOG_HUB_COMMAND_ACK_TOPIC
+	}
+
+	IntermediateCommandTopic, exists = os.LookupEnv("KAFKA_INTERMEDIATE_FOG_HUB_COMMAND_TOPIC")
+	if !exists {
+		IntermediateCommandTopic = kafka.INTERMEDIATE_FOG_HUB_COMMAND_TOPIC
+	}
+
+	KafkaGroupId = "proximity-fog-hub_" + EdgeMacrozone
+
 	KafkaPublishTimeoutStr, exists := os.LookupEnv("KAFKA_PUBLISH_TIMEOUT")
 	if exists {
 		var err error
@@ -339,6 +446,24 @@ func SetupEnvironment() error {
 		}
 	}
 
+	KafkaDataContentTypeStr, exists := os.LookupEnv("KAFKA_DATA_CONTENT_TYPE")
+	if exists {
+		var err error
+		KafkaDataContentType, err = types.ParseContentType(KafkaDataContentTypeStr)
+		if err != nil {
+			return errors.New("invalid value for KAFKA_DATA_CONTENT_TYPE: " + KafkaDataContentTypeStr + ". Must be 'application/json' or 'application/cbor'")
+		}
+	}
+
+	KafkaCommitTimeoutStr, exists := os.LookupEnv("KAFKA_COMMIT_TIMEOUT")
+	if exists {
+		var err error
+		KafkaCommitTimeout, err = strconv.Atoi(KafkaCommitTimeoutStr)
+		if err != nil || KafkaCommitTimeout <= 0 {
+			return errors.New("invalid value for KAFKA_COMMIT_TIMEOUT: " + KafkaCommitTimeoutStr + ". Must be a positive integer")
+		}
+	}
+
 	/* ----- POSTGRESQL DATABASE SETTINGS ----- */
 
 	PostgresUser, exists = os.LookupEnv("POSTGRES_USER")
@@ -96,15 +96,31 @@ func ReleaseDispatcherLock(ctx context.Context) error {
 /*			   		  DATI GREZZI 						*/
 /* ---------------------------------------------------- */
 
-// InsertSensorData inserisce un nuovo dato nella tabella della cache locale
-func InsertSensorData(ctx context.Context, d types.SensorData) error {
+// InsertSensorMinuteSummary inserisce il riepilogo al minuto di un sensore nella tabella della cache locale.
+// La media viene salvata come valore della misurazione, le altre statistiche servono all'aggregazione per zona.
+// Se il riepilogo è una revisione più recente di quello presente, dovuta a letture arrivate in ritardo all'Edge Hub,
+// le statistiche vengono aggiornate e il riepilogo torna 'pending', in modo che la revisione venga inoltrata.
+func InsertSensorMinuteSummary(ctx context.Context, d types.SensorMinuteSummary) error {
 	query := `
-        INSERT INTO sensor_measurements_cache (time, macrozone_name, zone_name, sensor_id, type, value, status)
-        VALUES ($1, $2, $3, $4, $5, $6, 'pending')
-        ON CONFLICT (time, macrozone_name, zone_name, sensor_id, type) DO NOTHING
+        INSERT INTO sensor_measurements_cache (time, macrozone_name, zone_name, sensor_id, type, value,
+                                               min_value, max_value, sample_count, std_dev, first_value, last_value, rejected_count, revision, status)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, 'pending')
+        ON CONFLICT (time, macrozone_name, zone_name, sensor_id, type) DO UPDATE SET
+            value = EXCLUDED.value,
+            min_value = EXCLUDED.min_value,
+            max_value = EXCLUDED.max_value,
+            sample_count = EXCLUDED.sample_count,
+            std_dev = EXCLUDED.std_dev,
+            first_value = EXCLUDED.first_value,
+            last_value = EXCLUDED.last_value,
+            rejected_count = EXCLUDED.rejected_count,
+            revision = EXCLUDED.revision,
+            status = 'pending'
+        WHERE sensor_measurements_cache.revision < EXCLUDED.revision
     `
 	t := time.Unix(d.Timestamp, 0).UTC()
-	_, err := DBPool.Exec(ctx, query, t, d.EdgeMacrozone, d.EdgeZone, d.SensorID, d.Type, d.Data)
+	_, err := DBPool.Exec(ctx, query, t, d.EdgeMacrozone, d.EdgeZone, d.SensorID, d.Type, d.Mean,
+		d.Min, d.Max, d.Count, d.StdDev, d.First, d.Last, d.Rejected, d.Revision)
 	if err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
@@ -154,6 +170,7 @@ func GetPendingSensorData(ctx context.Context, limit int) ([]types.SensorData, e
 
 // UpdateSensorData aggiorna lo stato di un messaggio nella tabella outbox.
 // Solitamente viene chiamato dopo che il messaggio è stato inviato con successo a Kafka.
+// Lo stato viene aggiornato solo se il valore non è cambiato: una revisione arrivata durante l'invio resta 'pending'.
 func UpdateSensorData(ctx context.Context, data []types.SensorData, newStatus string) error {
 	tx, err := DBPool.Begin(ctx)
 	if err != nil {
@@ -176,10 +193,11 @@ func UpdateSensorData(ctx context.Context, data []types.SensorData, newStatus st
 		  	AND zone_name = $4
 			AND sensor_id = $5
 			AND type = $6
+			AND value = $7
 	`
 	for _, d := range data {
 		t := time.Unix(d.Timestamp, 0).UTC()
-		_, err := tx.Exec(ctx, query, newStatus, t, d.EdgeMacrozone, d.EdgeZone, d.SensorID, d.Type)
+		_, err := tx.Exec(ctx, query, newStatus, t, d.EdgeMacrozone, d.EdgeZone, d.SensorID, d.Type, d.Data)
 		if err != nil {
 			return fmt.Errorf("failed to update outbox message status for %s_%s: %w", d.SensorID, t.Format(time.RFC3339), err)
 		}
@@ -360,17 +378,19 @@ func ReleaseAggregationLock(ctx context.Context) error {
 
 // GetZoneAggregatedData calcola le statistiche aggregate (min, max, avg, sum, count)
 // per ogni tipo di sensore e per ogni zona, nell'intervallo di tempo specificato.
+// Le statistiche sono calcolate a partire dai riepiloghi al minuto dei sensori:
+// la media è pesata per il numero di campioni, quindi coincide con quella delle letture originali.
 // Restituisce una slice di AggregatedStats, una per ogni combinazione di tipo e zona.
 func GetZoneAggregatedData(ctx context.Context, start time.Time, end time.Time) ([]types.AggregatedStats, error) {
 	query := `
         SELECT 
             type,
             zone_name,
-            MIN(value) as min_val,
-            MAX(value) as max_val,
-            AVG(value) as avg_val,
-            SUM(value) as avg_sum_val,
-        	COUNT(value) as avg_count_val
+            MIN(min_value) as min_val,
+            MAX(max_value) as max_val,
+            SUM(value * sample_count) / SUM(sample_count) as avg_val,
+            SUM(value * sample_count) as avg_sum_val,
+        	SUM(sample_count) as avg_count_val
         FROM sensor_measurements_cache
         WHERE time >= $1 AND time < $2 -- Usa i parametri di inizio e fine
         GROUP BY type, zone_name
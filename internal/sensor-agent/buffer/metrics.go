@@ -0,0 +1,34 @@
+package buffer
+
+import "sync/atomic"
+
+// Contatori delle letture passate dal WAL dall'avvio del Sensor Agent.
+var (
+	// buffered conta le letture salvate nel WAL perché il sensore era disconnesso o l'invio è fallito.
+	buffered atomic.Int64
+	// replayed conta le letture del WAL inviate dopo la riconnessione.
+	replayed atomic.Int64
+	// evicted conta le letture eliminate dal WAL prima dell'invio perché il WAL era pieno.
+	evicted atomic.Int64
+)
+
+// Metrics contiene i contatori delle letture passate dal WAL e il numero di letture in attesa.
+type Metrics struct {
+	Buffered int64
+	Replayed int64
+	Evicted  int64
+	Pending  int
+}
+
+// GetMetrics restituisce i contatori del WAL. Pending è valorizzato solo se wal non è nil.
+func GetMetrics(wal *WAL) Metrics {
+	metrics := Metrics{
+		Buffered: buffered.Load(),
+		Replayed: replayed.Load(),
+		Evicted:  evicted.Load(),
+	}
+	if wal != nil {
+		metrics.Pending = wal.Len()
+	}
+	return metrics
+}
@@ -0,0 +1,322 @@
+package buffer
+
+import (
+	"SensorContinuum/pkg/types"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// segmentPrefix e segmentSuffix compongono il nome dei file dei segmenti: segment-<sequenza>.wal
+const segmentPrefix = "segment-"
+const segmentSuffix = ".wal"
+
+// progressFile contiene il segmento in rilettura e il numero di letture già confermate,
+// in modo che dopo un riavvio non vengano inviate di nuovo.
+const progressFile = "replay.progress"
+
+// segment è un file del WAL, contenente una lettura JSON per riga.
+type segment struct {
+	seq   uint64
+	count int
+}
+
+// WAL è una coda limitata su disco delle letture non inviate, divisa in file di segmento.
+// Le letture vengono aggiunte in coda all'ultimo segmento; quando il numero totale di letture
+// supera maxReadings viene eliminato il segmento più vecchio.
+// Le letture vengono rilette un segmento alla volta, dal più vecchio, e il segmento
+// viene eliminato quando tutte le sue letture sono state confermate.
+type WAL struct {
+	mu          sync.Mutex
+	dir         string
+	maxReadings int
+	segmentSize int
+
+	segments []segment
+	total    int
+
+	// active è il file dell'ultimo segmento, aperto in scrittura. nil se il prossimo Append deve creare un nuovo segmento.
+	active *os.File
+
+	// replaySeq e replayed indicano il segmento in rilettura e quante delle sue letture sono state confermate.
+	replaySeq uint64
+	replayed  int
+}
+
+// Open apre il WAL nella directory indicata, creandola se non esiste.
+// I segmenti presenti (es. dopo un riavvio) vengono mantenuti e riletti;
+// le nuove letture vengono sempre scritte in un nuovo segmento.
+func Open(dir string, maxReadings, segmentSize int) (*WAL, error) {
+	if maxReadings <= 0 || segmentSize <= 0 {
+		return nil, errors.New("maxReadings and segmentSize must be greater than zero")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	w := &WAL{dir: dir, maxReadings: maxReadings, segmentSize: segmentSize}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		var seq uint64
+		if _, err := fmt.Sscanf(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix), "%d", &seq); err != nil {
+			continue
+		}
+		readings, err := w.readSegment(seq)
+		if err != nil {
+			return nil, err
+		}
+		w.segments = append(w.segments, segment{seq: seq, count: len(readings)})
+		w.total += len(readings)
+	}
+	sort.Slice(w.segments, func(i, j int) bool { return w.segments[i].seq < w.segments[j].seq })
+
+	// Riprende la rilettura del segmento più vecchio dall'ultima lettura confermata
+	if seq, replayed, ok := w.readProgress(); ok && len(w.segments) > 0 && w.segments[0].seq == seq {
+		w.replaySeq = seq
+		w.replayed = min(replayed, w.segments[0].count)
+	}
+
+	w.evict()
+	return w, nil
+}
+
+// Append aggiunge una lettura al WAL, eliminando il segmento più vecchio se il WAL è pieno.
+func (w *WAL) Append(data types.SensorData) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	if w.active == nil || w.segments[len(w.segments)-1].count >= w.segmentSize {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := w.active.Write(append(payload, '\n')); err != nil {
+		return err
+	}
+	if err := w.active.Sync(); err != nil {
+		return err
+	}
+
+	w.segments[len(w.segments)-1].count++
+	w.total++
+	buffered.Add(1)
+
+	w.evict()
+	return nil
+}
+
+// Len restituisce il numero di letture nel WAL non ancora confermate.
+func (w *WAL) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.total - w.replayedLocked()
+}
+
+// Next restituisce le letture non ancora confermate del segmento più vecchio, ordinate per timestamp.
+// Se il segmento più vecchio è quello in scrittura, viene chiuso e le nuove letture vanno in un nuovo segmento.
+// Restituisce false se il WAL è vuoto.
+func (w *WAL) Next() ([]types.SensorData, bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for len(w.segments) > 0 {
+		oldest := w.segments[0]
+		if w.active != nil && len(w.segments) == 1 {
+			if err := w.active.Close(); err != nil {
+				return nil, false, err
+			}
+			w.active = nil
+		}
+
+		readings, err := w.readSegment(oldest.seq)
+		if err != nil {
+			return nil, false, err
+		}
+		sort.SliceStable(readings, func(i, j int) bool { return readings[i].Timestamp < readings[j].Timestamp })
+
+		if w.replaySeq != oldest.seq {
+			w.replaySeq = oldest.seq
+			w.replayed = 0
+		}
+
+		// Un segmento senza letture da inviare (es. vuoto dopo un errore di scrittura) viene eliminato
+		if w.replayed >= len(readings) {
+			if err := w.removeOldest(); err != nil {
+				return nil, false, err
+			}
+			continue
+		}
+		return readings[w.replayed:], true, nil
+	}
+	return nil, false, nil
+}
+
+// Ack conferma l'invio della prossima lettura del segmento restituito da Next.
+// Quando tutte le letture del segmento sono confermate, il segmento viene eliminato.
+// Se nel frattempo il segmento è stato eliminato perché il WAL era pieno, la conferma viene ignorata.
+func (w *WAL) Ack() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.segments) == 0 || w.segments[0].seq != w.replaySeq {
+		return nil
+	}
+
+	w.replayed++
+	replayed.Add(1)
+
+	if w.replayed >= w.segments[0].count {
+		return w.removeOldest()
+	}
+	return w.writeProgress()
+}
+
+// Close chiude il segmento in scrittura.
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.active == nil {
+		return nil
+	}
+	err := w.active.Close()
+	w.active = nil
+	return err
+}
+
+// rotate chiude il segmento in scrittura e ne crea uno nuovo.
+func (w *WAL) rotate() error {
+	if w.active != nil {
+		if err := w.active.Close(); err != nil {
+			return err
+		}
+		w.active = nil
+	}
+
+	var seq uint64 = 1
+	if len(w.segments) > 0 {
+		seq = w.segments[len(w.segments)-1].seq + 1
+	}
+
+	file, err := os.OpenFile(w.segmentPath(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	w.active = file
+	w.segments = append(w.segments, segment{seq: seq})
+	return nil
+}
+
+// evict elimina i segmenti più vecchi finché il numero di letture non supera maxReadings.
+// Il segmento in scrittura non viene mai eliminato.
+func (w *WAL) evict() {
+	for w.total > w.maxReadings && len(w.segments) > 1 {
+		lost := w.segments[0].count - w.replayedLocked()
+		if err := w.removeOldest(); err != nil {
+			return
+		}
+		evicted.Add(int64(lost))
+	}
+}
+
+// removeOldest elimina il segmento più vecchio.
+func (w *WAL) removeOldest() error {
+	oldest := w.segments[0]
+	if w.active != nil && len(w.segments) == 1 {
+		if err := w.active.Close(); err != nil {
+			return err
+		}
+		w.active = nil
+	}
+	if err := os.Remove(w.segmentPath(oldest.seq)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	w.segments = w.segments[1:]
+	w.total -= oldest.count
+	if w.replaySeq == oldest.seq {
+		w.replayed = 0
+		if err := os.Remove(filepath.Join(w.dir, progressFile)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeProgress salva il segmento in rilettura e le letture confermate.
+// Il file viene sostituito con una rename, così un arresto durante la scrittura non lo lascia incompleto.
+func (w *WAL) writeProgress() error {
+	path := filepath.Join(w.dir, progressFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(fmt.Sprintf("%d %d\n", w.replaySeq, w.replayed)), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readProgress legge il segmento in rilettura e le letture confermate salvate da writeProgress.
+// Restituisce false se il file non esiste o non è valido.
+func (w *WAL) readProgress() (uint64, int, bool) {
+	content, err := os.ReadFile(filepath.Join(w.dir, progressFile))
+	if err != nil {
+		return 0, 0, false
+	}
+	var seq uint64
+	var replayed int
+	if _, err := fmt.Sscanf(string(content), "%d %d", &seq, &replayed); err != nil || replayed < 0 {
+		return 0, 0, false
+	}
+	return seq, replayed, true
+}
+
+// replayedLocked restituisce le letture già confermate del segmento più vecchio.
+func (w *WAL) replayedLocked() int {
+	if len(w.segments) > 0 && w.segments[0].seq == w.replaySeq {
+		return w.replayed
+	}
+	return 0
+}
+
+// readSegment legge le letture di un segmento.
+// Una riga non valida (es. scritta solo in parte prima di un arresto) viene ignorata.
+func (w *WAL) readSegment(seq uint64) ([]types.SensorData, error) {
+	file, err := os.Open(w.segmentPath(seq))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	readings := make([]types.SensorData, 0, w.segmentSize)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var data types.SensorData
+		if err := json.Unmarshal(scanner.Bytes(), &data); err != nil {
+			continue
+		}
+		readings = append(readings, data)
+	}
+	return readings, scanner.Err()
+}
+
+func (w *WAL) segmentPath(seq uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%s%020d%s", segmentPrefix, seq, segmentSuffix))
+}
@@ -0,0 +1,81 @@
+package buffer
+
+import (
+	"SensorContinuum/pkg/types"
+	"testing"
+)
+
+func appendReadings(t *testing.T, wal *WAL, from, to int) {
+	t.Helper()
+	for i := from; i < to; i++ {
+		if err := wal.Append(types.SensorData{SensorID: "sensor-1", Timestamp: int64(i), Data: float64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWALReplayResumesAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	wal, err := Open(dir, 100, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendReadings(t, wal, 0, 8)
+
+	// Conferma le prime tre letture del primo segmento
+	readings, ok, err := wal.Next()
+	if err != nil || !ok || len(readings) != 5 {
+		t.Fatalf("Next = %d readings, %v, %v; want 5 readings", len(readings), ok, err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := wal.Ack(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := wal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Dopo il riavvio vengono rilette solo le letture non confermate
+	wal, err = Open(dir, 100, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := wal.Len(); got != 5 {
+		t.Fatalf("Len after restart = %d, want 5", got)
+	}
+	readings, ok, err = wal.Next()
+	if err != nil || !ok {
+		t.Fatalf("Next after restart: %v, %v", ok, err)
+	}
+	if len(readings) != 2 || readings[0].Timestamp != 3 {
+		t.Fatalf("Next after restart = %+v, want readings 3 and 4", readings)
+	}
+
+	// Confermato il primo segmento, si passa al secondo
+	for range readings {
+		if err := wal.Ack(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	readings, ok, err = wal.Next()
+	if err != nil || !ok || len(readings) != 3 || readings[0].Timestamp != 5 {
+		t.Fatalf("Next on second segment = %+v, %v, %v; want readings 5 to 7", readings, ok, err)
+	}
+}
+
+func TestWALEvictsOldestSegment(t *testing.T) {
+	wal, err := Open(t.TempDir(), 10, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendReadings(t, wal, 0, 12)
+
+	if got := wal.Len(); got > 10 {
+		t.Fatalf("Len = %d, want at most 10", got)
+	}
+	readings, ok, err := wal.Next()
+	if err != nil || !ok || readings[0].Timestamp != 5 {
+		t.Fatalf("Next = %+v, %v, %v; want the oldest segment to be evicted", readings, ok, err)
+	}
+}
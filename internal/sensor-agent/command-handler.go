@@ -0,0 +1,76 @@
+package sensor_agent
+
+import (
+	"SensorContinuum/internal/sensor-agent/comunication"
+	"SensorContinuum/internal/sensor-agent/simulation"
+	"SensorContinuum/pkg/logger"
+	"SensorContinuum/pkg/types"
+	"time"
+)
+
+// recentCommandsSize è il numero di comandi recenti ricordati per scartare i duplicati.
+const recentCommandsSize = 100
+
+// ProcessSensorCommands esegue i comandi ricevuti dall'Edge Hub e ne invia la conferma.
+// I comandi già eseguiti di recente vengono scartati, così un comando ricevuto più volte
+// (es. dopo una riconnessione) viene eseguito una sola volta.
+func ProcessSensorCommands(commandChannel chan types.SensorCommand) {
+
+	recent := make(map[string]struct{}, recentCommandsSize)
+	order := make([]string, 0, recentCommandsSize)
+
+	for command := range commandChannel {
+
+		if _, seen := recent[command.ID]; seen {
+			logger.Log.Debug("Command already executed, skipping: ", command.ID)
+			comunication.CleanRetentionCommand(command)
+			continue
+		}
+		if len(order) == recentCommandsSize {
+			delete(recent, order[0])
+			order = order[1:]
+		}
+		recent[command.ID] = struct{}{}
+		order = append(order, command.ID)
+
+		logger.Log.Info("Executing command ", command.ID, ": ", command.Type)
+
+		var ack types.CommandAck
+		if err := executeCommand(command); err != nil {
+			logger.Log.Warn("Command ", command.ID, " failed: ", err)
+			ack = types.NewCommandAck(command, types.CommandFailed, err.Error())
+		} else {
+			ack = types.NewCommandAck(command, types.CommandExecuted, "")
+		}
+
+		if err := comunication.PublishCommandAck(ack); err != nil {
+			logger.Log.Error("Error publishing ack for command ", command.ID, ": ", err)
+		}
+		comunication.CleanRetentionCommand(command)
+	}
+}
+
+// executeCommand applica il comando alla simulazione del sensore.
+func executeCommand(command types.SensorCommand) error {
+	if err := command.Validate(); err != nil {
+		return err
+	}
+
+	switch command.Type {
+	case types.SetSamplingIntervalCommand:
+		simulation.SetSamplingInterval(time.Duration(command.SamplingInterval) * time.Millisecond)
+		logger.Log.Info("Sampling interval set to ", simulation.SamplingInterval().String())
+		// Mantiene allineata la configurazione riportata
+		reportConfiguration("")
+	case types.PauseCommand:
+		simulation.Pause()
+		logger.Log.Info("Simulation paused")
+	case types.ResumeCommand:
+		simulation.Resume()
+		logger.Log.Info("Simulation resumed")
+	case types.RebootCommand:
+		simulation.Reboot()
+		logger.Log.Info("Simulation reboot requested")
+	}
+	return nil
+}
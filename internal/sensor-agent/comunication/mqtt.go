@@ -1,14 +1,18 @@
 package comunication
 
 import (
+	"SensorContinuum/internal/sensor-agent/buffer"
 	"SensorContinuum/internal/sensor-agent/environment"
 	"SensorContinuum/pkg/logger"
 	"SensorContinuum/pkg/types"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	MQTT "github.com/eclipse/paho.mqtt.golang"
@@ -19,6 +23,124 @@ var client MQTT.Client
 // Contatori per i tentativi di connessione
 var connectAttempts = 0
 
+// offlineBuffer è il WAL su disco in cui vengono salvate le letture non inviate.
+// Se è nil, le letture non inviate vengono scartate.
+// È letto anche dall'endpoint /metrics, quindi viene impostato e letto in modo atomico.
+var offlineBuffer atomic.Pointer[buffer.WAL]
+
+// lastPublish contiene l'esito dell'ultimo tentativo di invio di una lettura, riportato negli heartbeat.
+var lastPublish struct {
+	sync.Mutex
+	timestamp int64
+	err       string
+}
+
+// commandChannel è il canale su cui vengono inoltrati i comandi ricevuti dall'Edge Hub.
+// Se è nil, il sensore non si sottoscrive al topic dei comandi.
+var commandChannel chan types.SensorCommand
+
+// desiredConfigurationChannel è il canale su cui viene inoltrata la configurazione desiderata del sensore.
+// Se è nil, il sensore non si sottoscrive al topic della configurazione desiderata.
+var desiredConfigurationChannel chan types.SensorDesiredConfiguration
+
+// makeCommandHandler è la funzione di callback che processa i comandi in arrivo dall'Edge Hub.
+func makeCommandHandler(commandChannel chan types.SensorCommand) MQTT.MessageHandler {
+	return func(client MQTT.Client, msg MQTT.Message) {
+		logger.Log.Debug("Received message on topic: ", msg.Topic())
+
+		command, err := types.CreateSensorCommandFromMQTT(msg)
+		if err != nil {
+			logger.Log.Error("Error parsing command from MQTT message: ", err.Error())
+			return
+		}
+
+		// I messaggi vuoti servono solo a rimuovere i comandi conservati dal broker
+		if command.ID == "" {
+			return
+		}
+
+		// select non bloccante, il ricevitore MQTT non viene mai bloccato dal processore
+		// Se il canale è pieno, scarta il messaggio: il comando resta conservato dal broker
+		// e verrà ricevuto di nuovo alla prossima riconnessione.
+		select {
+		case commandChannel <- command:
+			logger.Log.Debug("Sent command to channel")
+		default:
+			logger.Log.Warn("Command channel is full. Discarding command: ", command.ID)
+		}
+	}
+}
+
+// subscribeCommands sottoscrive il sensore al topic dei comandi e, con più canali, ai topic dei comandi di ogni canale.
+// I comandi ricevuti su qualsiasi canale si applicano all'intero Sensor Agent.
+func subscribeCommands(c MQTT.Client) {
+	if commandChannel == nil {
+		return
+	}
+
+	// QoS 2, cioè "exactly once", il messaggio viene consegnato una sola volta, senza duplicati
+	topics := map[string]byte{environment.CommandTopic + "/#": 2}
+	for _, channel := range environment.SensorChannels {
+		topics[environment.SensorCommandTopic+"/"+channel.SensorID+"/#"] = 2
+	}
+
+	for topic, qos := range topics {
+		logger.Log.Debug("Subscribing to topic: ", topic)
+		token := c.Subscribe(topic, qos, makeCommandHandler(commandChannel))
+		if token.WaitTimeout(time.Duration(environment.MaxSubscriptionTimeout)*time.Second) && token.Error() != nil {
+			logger.Log.Error("Failed to subscribe to topic:", topic, "error:", token.Error())
+			os.Exit(1) // Esci se non riesci a sottoscrivere
+		}
+		logger.Log.Info("Subscribed to topic: ", topic)
+	}
+}
+
+// makeDesiredConfigurationHandler è la funzione di callback che processa la configurazione desiderata del sensore.
+func makeDesiredConfigurationHandler(desiredConfigurationChannel chan types.SensorDesiredConfiguration) MQTT.MessageHandler {
+	return func(client MQTT.Client, msg MQTT.Message) {
+		logger.Log.Debug("Received message on topic: ", msg.Topic())
+
+		desired, ok, err := types.CreateSensorDesiredConfigurationFromMQTT(msg)
+		if err != nil {
+			logger.Log.Error("Error parsing desired configuration from MQTT message: ", err.Error())
+			return
+		}
+
+		// I messaggi vuoti servono solo a rimuovere la configurazione conservata dal broker
+		if !ok {
+			return
+		}
+
+		// select non bloccante, il ricevitore MQTT non viene mai bloccato dal processore
+		// Se il canale è pieno, scarta il messaggio: la configurazione resta conservata dal broker
+		// e verrà ricevuta di nuovo alla prossima riconnessione.
+		select {
+		case desiredConfigurationChannel <- desired:
+			logger.Log.Debug("Sent desired configuration to channel")
+		default:
+			logger.Log.Warn("Desired configuration channel is full. Discarding configuration version: ", desired.Version)
+		}
+	}
+}
+
+// subscribeDesiredConfiguration sottoscrive il sensore al topic della configurazione desiderata.
+func subscribeDesiredConfiguration(c MQTT.Client) {
+	if desiredConfigurationChannel == nil {
+		return
+	}
+
+	topic := environment.DesiredConfigurationTopic
+	logger.Log.Debug("Subscribing to topic: ", topic)
+
+	// QoS 1, cioè "at least once": applicare due volte la stessa configurazione non ha effetti
+	token := c.Subscribe(topic, 1, makeDesiredConfigurationHandler(desiredConfigurationChannel))
+	if token.WaitTimeout(time.Duration(environment.MaxSubscriptionTimeout)*time.Second) && token.Error() != nil {
+		logger.Log.Error("Failed to subscribe to topic:", topic, "error:", token.Error())
+		os.Exit(1) // Esci se non riesci a sottoscrivere
+	}
+	logger.Log.Info("Subscribed to topic: ", topic)
+}
+
 // connectAndManage gestisce la connessione una sola volta.
 func connectAndManage() {
 	// Se il client è già definito e connesso, non fare nulla.
@@ -35,6 +157,14 @@ func connectAndManage() {
 	opts.AddBroker(brokerURL)
 	opts.SetClientID(mqttId)
 
+	// --- Impostazioni di Sicurezza ---
+
+	// TLS con autenticazione reciproca e credenziali del sensore, se configurati
+	if err := environment.MqttSecurity.Apply(opts, environment.SensorId); err != nil {
+		logger.Log.Error("Error configuring MQTT security: ", err.Error())
+		os.Exit(1)
+	}
+
 	// --- Impostazioni di Resilienza ---
 
 	// la libreria paho gestisce automaticamente la riconnessione in background,
@@ -47,6 +177,9 @@ func connectAndManage() {
 	opts.SetOnConnectHandler(func(c MQTT.Client) {
 		logger.Log.Info("Sensor connected to MQTT broker.")
 		connectAttempts = 0 // resetta i tentativi dopo una connessione riuscita
+		// Ad ogni (ri)connessione rinnova la sottoscrizione ai comandi e alla configurazione desiderata
+		subscribeCommands(c)
+		subscribeDesiredConfiguration(c)
 	})
 	opts.SetConnectionLostHandler(func(c MQTT.Client, err error) {
 		logger.Log.Warn("Sensor lost connection to MQTT broker: ", err.Error())
@@ -82,55 +215,194 @@ func connectAndManage() {
 	}
 }
 
-// PublishData pubblica i dati del sensore al broker MQTT
-func PublishData(sensorChannel chan types.SensorData) {
+// PublishData pubblica i dati del sensore al broker MQTT.
+// Se il sensore è disconnesso o l'invio fallisce, la lettura viene salvata nel WAL su disco
+// e inviata dopo la riconnessione da replayBufferedData.
+func PublishData(sensorChannel <-chan types.SensorData) {
 
 	// Assicura che la connessione sia gestita
 	if client == nil {
 		connectAndManage()
 	}
 
+	if environment.OfflineBuffer {
+		wal, err := buffer.Open(environment.OfflineBufferDir, environment.OfflineBufferMaxReadings, environment.OfflineBufferSegmentSize)
+		if err != nil {
+			logger.Log.Error("Error opening offline buffer, readings will be discarded while disconnected: ", err.Error())
+		} else {
+			logger.Log.Info("Offline buffer opened in ", environment.OfflineBufferDir, " with ", wal.Len(), " pending reading(s)")
+			offlineBuffer.Store(wal)
+			go replayBufferedData(wal)
+		}
+	}
+
 	for sensorData := range sensorChannel {
 
 		// Non procedere se la connessione non è attiva.
 		if !client.IsConnected() {
-			logger.Log.Warn("MQTT client not connected. Skipping data publishing.")
 			// L'opzione AutoReconnect della libreria sta già lavorando per riconnettersi.
 			// Quindi non è necessario riconnettersi manualmente qui.
 			// Il sensore continuerà a tentare di riconnettersi in background.
+			logger.Log.Warn("MQTT client not connected. Buffering reading.")
+			recordPublish(errors.New("MQTT client not connected"))
+			bufferReading(sensorData)
+			continue
+		}
+
+		err := publishReading(sensorData)
+		recordPublish(err)
+		if err != nil {
+			logger.Log.Warn("Error publishing reading: ", err.Error(), ". Buffering reading.")
+			bufferReading(sensorData)
+		}
+	}
+}
+
+// recordPublish registra l'esito dell'ultimo tentativo di invio di una lettura.
+func recordPublish(err error) {
+	lastPublish.Lock()
+	defer lastPublish.Unlock()
+	lastPublish.timestamp = time.Now().UTC().Unix()
+	lastPublish.err = ""
+	if err != nil {
+		lastPublish.err = err.Error()
+	}
+}
+
+// GetLastPublish restituisce il timestamp e l'errore, vuoto se riuscito, dell'ultimo tentativo di invio di una lettura.
+// Il timestamp è zero se il sensore non ha ancora inviato letture.
+func GetLastPublish() (int64, string) {
+	lastPublish.Lock()
+	defer lastPublish.Unlock()
+	return lastPublish.timestamp, lastPublish.err
+}
+
+// publishReading pubblica una lettura sul topic DataTopic/<id sensore>, con l'identificativo del canale della lettura.
+// La lettura viene serializzata nel formato DataContentType, riconosciuto dall'Edge Hub dal payload.
+// Se la firma è abilitata, la lettura viene firmata al momento dell'invio, anche quando proviene dal WAL.
+func publishReading(sensorData types.SensorData) error {
+
+	if err := signReading(&sensorData); err != nil {
+		return err
+	}
+
+	payload, err := types.MarshalSensorData(sensorData, environment.DataContentType)
+	if err != nil {
+		return err
+	}
+
+	// QoS (Quality of Service) in MQTT:
+	// 0: At most once - Nessuna conferma, il messaggio può andare perso.
+	// 1: At least once - Il messaggio viene consegnato almeno una volta, può essere duplicato.
+	// 2: Exactly once - Il messaggio viene consegnato una sola volta, senza duplicati.
+	//
+	// Noi usiamo QoS 0 per minimizzare il traffico di rete e la latenza,
+	// accettando la possibilità di perdere qualche messaggio in caso di problemi di rete.
+	topic := environment.DataTopic + "/" + sensorData.SensorID
+	token := client.Publish(topic, 0, false, payload)
+
+	// Usiamo WaitTimeout per non bloccare il sensore all'infinito,
+	// cioè se la rete è lenta il sensore comunque non si blocca
+	if !token.WaitTimeout(time.Duration(environment.MessagePublishTimeout) * time.Second) {
+		return errors.New("timeout publishing message on topic " + topic)
+	}
+	if err := token.Error(); err != nil {
+		return err
+	}
+	logger.Log.Debug("Message published successfully on topic: ", topic)
+	return nil
+}
+
+// bufferReading salva una lettura non inviata nel WAL su disco.
+// Se il WAL non è abilitato, la lettura viene scartata.
+func bufferReading(sensorData types.SensorData) {
+	wal := offlineBuffer.Load()
+	if wal == nil {
+		return
+	}
+	if err := wal.Append(sensorData); err != nil {
+		logger.Log.Error("Error buffering reading: ", err.Error())
+	}
+}
+
+// replayBufferedData invia le letture salvate nel WAL quando il sensore è connesso,
+// in ordine di timestamp e al massimo OfflineBufferReplayRate letture al secondo.
+// Una lettura viene rimossa dal WAL solo dopo essere stata inviata.
+func replayBufferedData(wal *buffer.WAL) {
+
+	ticker := time.NewTicker(time.Second / time.Duration(environment.OfflineBufferReplayRate))
+	defer ticker.Stop()
+
+	for {
+		if !client.IsConnected() {
 			time.Sleep(time.Duration(environment.MaxReconnectionInterval) * time.Second)
 			continue
 		}
 
-		payload, err := json.Marshal(sensorData)
+		readings, ok, err := wal.Next()
 		if err != nil {
-			logger.Log.Warn("Error during JSON serialization: ", err.Error(), ". Skipping data publishing.")
+			logger.Log.Error("Error reading offline buffer: ", err.Error())
+			time.Sleep(time.Duration(environment.MaxReconnectionInterval) * time.Second)
+			continue
+		}
+		if !ok {
+			time.Sleep(time.Second)
 			continue
 		}
 
-		// QoS (Quality of Service) in MQTT:
-		// 0: At most once - Nessuna conferma, il messaggio può andare perso.
-		// 1: At least once - Il messaggio viene consegnato almeno una volta, può essere duplicato.
-		// 2: Exactly once - Il messaggio viene consegnato una sola volta, senza duplicati.
-		//
-		// Noi usiamo QoS 0 per minimizzare il traffico di rete e la latenza,
-		// accettando la possibilità di perdere qualche messaggio in caso di problemi di rete.
-		topic := environment.DataTopic + "/" + environment.SensorId
-		token := client.Publish(topic, 0, false, payload)
-
-		// Usiamo WaitTimeout per non bloccare il sensore all'infinito,
-		// cioè se la rete è lenta il sensore comunque non si blocca
-		// anche se il timeout scade il programma comunque prosegue
+		logger.Log.Info("Replaying ", len(readings), " buffered reading(s)")
+		for _, sensorData := range readings {
+			<-ticker.C
+			if err := publishReading(sensorData); err != nil {
+				logger.Log.Warn("Error replaying buffered reading: ", err.Error())
+				break
+			}
+			if err := wal.Ack(); err != nil {
+				logger.Log.Error("Error removing replayed reading from offline buffer: ", err.Error())
+				break
+			}
+		}
+	}
+}
+
+// PublishFaultLabels pubblica sul topic FaultLabelTopic le etichette delle letture alterate dal simulatore,
+// così le decisioni del filtro dell'Edge Hub possono essere confrontate con i guasti effettivamente iniettati.
+func PublishFaultLabels(labelChannel chan types.FaultLabel) {
+
+	// Assicura che la connessione sia gestita
+	if client == nil {
+		connectAndManage()
+	}
+
+	for label := range labelChannel {
+
+		// Non procedere se la connessione non è attiva.
+		if !client.IsConnected() {
+			logger.Log.Warn("MQTT client not connected. Skipping fault label publishing.")
+			continue
+		}
+
+		payload, err := json.Marshal(label)
+		if err != nil {
+			logger.Log.Warn("Error during JSON serialization: ", err.Error(), ". Skipping fault label publishing.")
+			continue
+		}
+
+		// QoS 1, cioè "at least once": le etichette servono a valutare il filtro e non devono andare perse
+		token := client.Publish(environment.FaultLabelTopic, 1, false, payload)
 		if !token.WaitTimeout(time.Duration(environment.MessagePublishTimeout) * time.Second) {
-			logger.Log.Warn("Timeout publishing message (", environment.MessagePublishTimeout, " seconds) to MQTT broker.")
+			logger.Log.Warn("Timeout publishing fault label (", environment.MessagePublishTimeout, " seconds) to MQTT broker.")
 		} else if err := token.Error(); err != nil {
-			logger.Log.Error("Error publishing message: ", err.Error())
-		} else {
-			logger.Log.Debug("Message published successfully on topic: ", topic)
+			logger.Log.Error("Error publishing fault label: ", err.Error())
 		}
 	}
 }
 
+// GetBufferMetrics restituisce i contatori del WAL su disco.
+func GetBufferMetrics() buffer.Metrics {
+	return buffer.GetMetrics(offlineBuffer.Load())
+}
+
 // SendRegistrationMessage invia un messaggio di registrazione al broker MQTT
 // per registrare il sensore con le sue informazioni di configurazione.
 func SendRegistrationMessage() {
@@ -153,7 +425,8 @@ func SendRegistrationMessage() {
 			continue
 		}
 
-		payload, err := json.Marshal(types.ConfigurationMsg{
+		configMsg := types.ConfigurationMsg{
+			SchemaVersion:   types.ConfigurationMsgSchemaVersion,
 			EdgeMacrozone:   environment.EdgeMacrozone,
 			MsgType:         types.NewSensorMsgType,
 			Timestamp:       time.Now().UTC().Unix(),
@@ -161,9 +434,22 @@ func SendRegistrationMessage() {
 			EdgeZone:        environment.EdgeZone,
 			SensorID:        environment.SensorId,
 			SensorLocation:  string(environment.SensorLocation),
-			SensorType:      string(environment.SensorType),
+			SensorType:      string(environment.SensorChannels[0].Type),
 			SensorReference: string(environment.SimulationSensorReference),
-		})
+			PublicKey:       signingPublicKey(),
+		}
+
+		// Con più canali, tutti i canali vengono registrati con un unico messaggio
+		if len(environment.SensorChannels) > 1 {
+			for _, channel := range environment.SensorChannels {
+				configMsg.Channels = append(configMsg.Channels, types.SensorChannel{
+					SensorID:   channel.SensorID,
+					SensorType: string(channel.Type),
+				})
+			}
+		}
+
+		payload, err := json.Marshal(configMsg)
 		if err != nil {
 			logger.Log.Error("Error during JSON serialization: ", err.Error())
 			os.Exit(1)
@@ -192,6 +478,131 @@ func SendRegistrationMessage() {
 	}
 }
 
+// SubscribeCommands abilita la ricezione dei comandi dall'Edge Hub, inoltrandoli sul canale.
+func SubscribeCommands(channel chan types.SensorCommand) {
+
+	commandChannel = channel
+
+	// Assicura che la connessione sia gestita
+	if client == nil {
+		connectAndManage()
+		return
+	}
+
+	if client.IsConnected() {
+		subscribeCommands(client)
+	}
+}
+
+// PublishCommandAck invia all'Edge Hub la conferma di un comando sul topic CommandAckTopic.
+func PublishCommandAck(ack types.CommandAck) error {
+
+	// Non procedere se la connessione non è attiva.
+	if client == nil || !client.IsConnected() {
+		return errors.New("MQTT client not connected")
+	}
+
+	payload, err := json.Marshal(ack)
+	if err != nil {
+		return err
+	}
+
+	// QoS 1, cioè "at least once", il messaggio viene consegnato almeno una volta, può essere duplicato
+	token := client.Publish(environment.CommandAckTopic, 1, false, payload)
+	if !token.WaitTimeout(time.Duration(environment.MessagePublishTimeout) * time.Second) {
+		return errors.New("timeout publishing command ack on topic " + environment.CommandAckTopic)
+	}
+	return token.Error()
+}
+
+// CleanRetentionCommand rimuove dal broker un comando già elaborato,
+// così non viene ricevuto di nuovo alla prossima riconnessione.
+func CleanRetentionCommand(command types.SensorCommand) {
+
+	// Non procedere se la connessione non è attiva.
+	if client == nil || !client.IsConnected() {
+		logger.Log.Warn("MQTT client not connected. Skipping command cleaning.")
+		return
+	}
+
+	// Per pulire un comando, pubblichiamo un messaggio vuoto
+	// sullo stesso topic con retained=true.
+	topic := environment.SensorCommandTopic + "/" + command.SensorID + "/" + command.ID
+	token := client.Publish(topic, 2, true, "")
+
+	if !token.WaitTimeout(time.Duration(environment.MessagePublishTimeout) * time.Second) {
+		logger.Log.Error("Timeout cleaning message: ", topic)
+		return
+	}
+	if err := token.Error(); err != nil {
+		logger.Log.Error("Error cleaning message: ", err.Error())
+		return
+	}
+	logger.Log.Debug("Message cleaned successfully: ", topic)
+}
+
+// SubscribeDesiredConfiguration abilita la ricezione della configurazione desiderata del sensore, inoltrandola sul canale.
+// Il broker conserva l'ultima configurazione desiderata, che viene quindi ricevuta anche ad ogni (ri)connessione.
+func SubscribeDesiredConfiguration(channel chan types.SensorDesiredConfiguration) {
+
+	desiredConfigurationChannel = channel
+
+	// Assicura che la connessione sia gestita
+	if client == nil {
+		connectAndManage()
+		return
+	}
+
+	if client.IsConnected() {
+		subscribeDesiredConfiguration(client)
+	}
+}
+
+// PublishReportedConfiguration pubblica la configurazione applicata dal sensore sul topic ReportedConfigurationTopic.
+func PublishReportedConfiguration(reported types.SensorReportedConfiguration) error {
+
+	// Non procedere se la connessione non è attiva.
+	if client == nil || !client.IsConnected() {
+		return errors.New("MQTT client not connected")
+	}
+
+	payload, err := json.Marshal(reported)
+	if err != nil {
+		return err
+	}
+
+	// QoS 1, cioè "at least once", il messaggio viene consegnato almeno una volta, può essere duplicato
+	//
+	// Retained: true
+	//  Il broker conserva l'ultima configurazione applicata e la invia ai nuovi iscritti.
+	token := client.Publish(environment.ReportedConfigurationTopic, 1, true, payload)
+	if !token.WaitTimeout(time.Duration(environment.MessagePublishTimeout) * time.Second) {
+		return errors.New("timeout publishing reported configuration on topic " + environment.ReportedConfigurationTopic)
+	}
+	return token.Error()
+}
+
+// PublishHeartbeat pubblica un messaggio di heartbeat del sensore sul topic HeartbeatTopic.
+func PublishHeartbeat(heartbeat types.HeartbeatMsg) error {
+
+	// Non procedere se la connessione non è attiva.
+	if client == nil || !client.IsConnected() {
+		return errors.New("MQTT client not connected")
+	}
+
+	payload, err := json.Marshal(heartbeat)
+	if err != nil {
+		return err
+	}
+
+	// QoS 1, cioè "at least once", il messaggio viene consegnato almeno una volta, può essere duplicato
+	token := client.Publish(environment.HeartbeatTopic, 1, false, payload)
+	if !token.WaitTimeout(time.Duration(environment.MessagePublishTimeout) * time.Second) {
+		return errors.New("timeout publishing heartbeat on topic " + environment.HeartbeatTopic)
+	}
+	return token.Error()
+}
+
 // IsConnected verifica se il client MQTT è connesso al broker.
 func IsConnected() bool {
 
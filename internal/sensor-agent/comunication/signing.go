@@ -0,0 +1,92 @@
+package comunication
+
+import (
+	"SensorContinuum/internal/sensor-agent/environment"
+	"SensorContinuum/pkg/logger"
+	"SensorContinuum/pkg/types"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"os"
+)
+
+// signingKey è la chiave privata con cui vengono firmate le letture.
+// Se è nil, le letture vengono inviate senza firma.
+var signingKey ed25519.PrivateKey
+
+// SetupSigning carica la chiave privata di firma da SigningKeyFile, generandone una nuova se il file non esiste.
+// La chiave pubblica viene inviata all'Edge Hub nel messaggio di registrazione, quindi va chiamata prima della registrazione.
+func SetupSigning() error {
+	key, err := loadSigningKey(environment.SigningKeyFile)
+	if errors.Is(err, os.ErrNotExist) {
+		logger.Log.Info("Signing key not found, generating a new one in ", environment.SigningKeyFile)
+		key, err = createSigningKey(environment.SigningKeyFile)
+	}
+	if err != nil {
+		return err
+	}
+	signingKey = key
+	logger.Log.Info("Readings will be signed with public key: ", signingPublicKey())
+	return nil
+}
+
+// loadSigningKey legge una chiave privata Ed25519 da un file PEM in formato PKCS #8.
+func loadSigningKey(path string) (ed25519.PrivateKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("invalid signing key file " + path + ": no PEM private key found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.New("invalid signing key file " + path + ": " + err.Error())
+	}
+	ed25519Key, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("invalid signing key file " + path + ": not an Ed25519 key")
+	}
+	return ed25519Key, nil
+}
+
+// createSigningKey genera una nuova chiave privata Ed25519 e la salva in un file PEM leggibile solo dal proprietario.
+func createSigningKey(path string) (ed25519.PrivateKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// signingPublicKey restituisce la chiave pubblica di firma in base64, vuota se le letture non vengono firmate.
+func signingPublicKey() string {
+	if signingKey == nil {
+		return ""
+	}
+	return types.EncodePublicKey(signingKey.Public().(ed25519.PublicKey))
+}
+
+// signReading firma la lettura, se la firma è abilitata, con un nonce casuale.
+func signReading(sensorData *types.SensorData) error {
+	if signingKey == nil {
+		return nil
+	}
+	var nonce [8]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return err
+	}
+	sensorData.Sign(signingKey, binary.BigEndian.Uint64(nonce[:]))
+	return nil
+}
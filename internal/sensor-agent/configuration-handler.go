@@ -0,0 +1,75 @@
+package sensor_agent
+
+import (
+	"SensorContinuum/internal/sensor-agent/comunication"
+	"SensorContinuum/internal/sensor-agent/simulation"
+	"SensorContinuum/pkg/logger"
+	"SensorContinuum/pkg/types"
+	"sync/atomic"
+	"time"
+)
+
+// desiredVersion è la versione dell'ultima configurazione desiderata ricevuta.
+var desiredVersion atomic.Int64
+
+// ProcessDesiredConfigurations applica la configurazione desiderata ricevuta dal broker
+// e pubblica la configurazione risultante sul topic reported, come un device twin.
+// Una configurazione non valida non viene applicata e l'errore viene riportato nel campo error.
+func ProcessDesiredConfigurations(desiredConfigurationChannel chan types.SensorDesiredConfiguration) {
+
+	for desired := range desiredConfigurationChannel {
+
+		// Scarta le configurazioni più vecchie di quella già ricevuta
+		if desired.Version < desiredVersion.Load() {
+			logger.Log.Debug("Desired configuration version ", desired.Version, " is older than ", desiredVersion.Load(), ", skipping")
+			continue
+		}
+		desiredVersion.Store(desired.Version)
+
+		logger.Log.Info("Applying desired configuration version ", desired.Version)
+
+		detail := ""
+		if err := applySettings(desired.SensorSettings); err != nil {
+			logger.Log.Warn("Desired configuration version ", desired.Version, " rejected: ", err)
+			detail = err.Error()
+		}
+
+		reportConfiguration(detail)
+	}
+}
+
+// applySettings applica alla simulazione i parametri valorizzati.
+func applySettings(settings types.SensorSettings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+
+	if settings.SamplingInterval != nil {
+		simulation.SetSamplingInterval(time.Duration(*settings.SamplingInterval) * time.Millisecond)
+		logger.Log.Info("Sampling interval set to ", simulation.SamplingInterval().String())
+	}
+	if settings.MissingProbability != nil {
+		simulation.SetMissingProbability(*settings.MissingProbability)
+		logger.Log.Info("Missing probability set to ", simulation.MissingProbability())
+	}
+	if settings.OutlierProbability != nil {
+		simulation.SetOutlierProbability(*settings.OutlierProbability)
+		logger.Log.Info("Outlier probability set to ", simulation.OutlierProbability())
+	}
+	return nil
+}
+
+// reportConfiguration pubblica la configurazione corrente della simulazione sul topic reported.
+func reportConfiguration(detail string) {
+	reported := types.SensorReportedConfiguration{
+		SamplingInterval:   simulation.SamplingInterval().Milliseconds(),
+		MissingProbability: simulation.MissingProbability(),
+		OutlierProbability: simulation.OutlierProbability(),
+		Version:            desiredVersion.Load(),
+		Error:              detail,
+		Timestamp:          time.Now().UTC().Unix(),
+	}
+	if err := comunication.PublishReportedConfiguration(reported); err != nil {
+		logger.Log.Error("Error publishing reported configuration: ", err)
+	}
+}
@@ -0,0 +1,54 @@
+package driver
+
+import (
+	"SensorContinuum/internal/sensor-agent/environment"
+	"SensorContinuum/internal/sensor-agent/simulation"
+	"SensorContinuum/pkg/types"
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"time"
+)
+
+// CommandSensor esegue un comando ad ogni campionamento e ne legge le letture dallo standard output,
+// una o più righe secondo il protocollo testuale descritto in parseLine.
+// Il comando viene interrotto se non termina entro l'intervallo di campionamento.
+type CommandSensor struct {
+	Command string
+}
+
+func (s *CommandSensor) Name() string {
+	return string(environment.CommandDriver) + " (" + s.Command + ")"
+}
+
+func (s *CommandSensor) Run(dataChannel chan types.SensorData) error {
+	return poll(dataChannel, s.read)
+}
+
+// read esegue il comando e ne interpreta l'output.
+func (s *CommandSensor) read() ([]types.SensorData, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), simulation.SamplingInterval())
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", s.Command)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, errors.New("command failed: " + err.Error() + ": " + stderr.String())
+	}
+
+	now := time.Now()
+	var sensorDataList []types.SensorData
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		lineData, err := parseLine(scanner.Text(), now)
+		if err != nil {
+			return nil, err
+		}
+		sensorDataList = append(sensorDataList, lineData...)
+	}
+	return sensorDataList, nil
+}
@@ -0,0 +1,41 @@
+package driver
+
+import (
+	"SensorContinuum/internal/sensor-agent/environment"
+	"testing"
+)
+
+func TestCommandSensorRead(t *testing.T) {
+	setChannels(t, environment.Temperature, environment.Humidity)
+
+	tests := []struct {
+		name    string
+		command string
+		want    []float64
+		wantErr bool
+	}{
+		{name: "single line", command: "echo 21.5,40.2", want: []float64{21.5, 40.2}},
+		{name: "multiple lines", command: "printf '# header\\ntemperature=21.5\\nhumidity=40.2\\n'", want: []float64{21.5, 40.2}},
+		{name: "no output", command: "true", want: nil},
+		{name: "invalid output", command: "echo hello", wantErr: true},
+		{name: "failing command", command: "echo broken >&2; exit 3", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sensor := &CommandSensor{Command: tt.command}
+			got, err := sensor.read()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("read error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("read = %+v, want %v", got, tt.want)
+			}
+			for i, data := range got {
+				if data.Data != tt.want[i] {
+					t.Errorf("reading %d = %v, want %v", i, data.Data, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package driver
+
+import (
+	"SensorContinuum/internal/sensor-agent/environment"
+	"SensorContinuum/internal/sensor-agent/simulation"
+	"SensorContinuum/pkg/logger"
+	"SensorContinuum/pkg/types"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseLine interpreta una riga del protocollo testuale dei driver fisici.
+// La riga contiene i valori dei canali separati da virgola, nell'ordine di SensorChannels (es. "21.5,40.2"),
+// oppure associati al tipo del canale (es. "temperature=21.5,humidity=40.2").
+// Le righe vuote e quelle che iniziano con '#' vengono ignorate.
+func parseLine(line string, timestamp time.Time) ([]types.SensorData, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, nil
+	}
+
+	fields := strings.Split(line, ",")
+	if len(fields) > len(environment.SensorChannels) {
+		return nil, errors.New("too many values in line: " + line)
+	}
+
+	sensorDataList := make([]types.SensorData, 0, len(fields))
+	for i, field := range fields {
+		channel := environment.SensorChannels[i]
+
+		valueStr := strings.TrimSpace(field)
+		if typeStr, value, found := strings.Cut(valueStr, "="); found {
+			var known bool
+			channel, known = findChannel(environment.Type(strings.TrimSpace(typeStr)))
+			if !known {
+				return nil, errors.New("unknown channel type in line: " + line)
+			}
+			valueStr = strings.TrimSpace(value)
+		}
+
+		value, err := strconv.ParseFloat(valueStr, 64)
+		if err != nil {
+			return nil, errors.New("invalid value in line: " + line)
+		}
+		sensorDataList = append(sensorDataList, newSensorData(channel, value, timestamp))
+	}
+	return sensorDataList, nil
+}
+
+// findChannel restituisce il canale del tipo indicato.
+func findChannel(channelType environment.Type) (environment.Channel, bool) {
+	for _, channel := range environment.SensorChannels {
+		if channel.Type == channelType {
+			return channel, true
+		}
+	}
+	return environment.Channel{}, false
+}
+
+// newSensorData crea la lettura di un canale, applicando il fattore SensorDriverScale al valore letto.
+func newSensorData(channel environment.Channel, value float64, timestamp time.Time) types.SensorData {
+	return types.SensorData{
+		EdgeMacrozone: environment.EdgeMacrozone,
+		EdgeZone:      environment.EdgeZone,
+		SensorID:      channel.SensorID,
+		Timestamp:     timestamp.UTC().Unix(),
+		Type:          string(channel.Type),
+		Data:          value * environment.SensorDriverScale,
+	}
+}
+
+// send invia le letture su dataChannel senza bloccare il driver: se il canale è pieno, la lettura viene scartata.
+func send(dataChannel chan types.SensorData, sensorDataList []types.SensorData) {
+	for _, sensorData := range sensorDataList {
+		logger.Log.Info("Sensor reading (", sensorData.Type, "): ", sensorData.Data)
+		select {
+		case dataChannel <- sensorData:
+		default:
+			logger.Log.Error("Channel is full, skipping sending value: ", sensorData.Data)
+		}
+	}
+}
+
+// poll esegue read ad ogni intervallo di campionamento e ne invia le letture su dataChannel.
+// Gli errori di lettura vengono registrati senza interrompere il campionamento.
+// Mentre il sensore è in pausa (comando pause) non vengono eseguite letture.
+func poll(dataChannel chan types.SensorData, read func() ([]types.SensorData, error)) error {
+	for {
+		if !simulation.IsPaused() {
+			sensorDataList, err := read()
+			if err != nil {
+				logger.Log.Error("Error reading sensor: ", err)
+			} else {
+				send(dataChannel, sensorDataList)
+			}
+		}
+		time.Sleep(simulation.SamplingInterval())
+	}
+}
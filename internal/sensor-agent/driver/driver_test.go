@@ -0,0 +1,96 @@
+package driver
+
+import (
+	"SensorContinuum/internal/sensor-agent/environment"
+	"SensorContinuum/pkg/types"
+	"testing"
+	"time"
+)
+
+// setChannels configura i canali del Sensor Agent per la durata del test.
+func setChannels(t *testing.T, channels ...environment.Type) {
+	t.Helper()
+	previous := environment.SensorChannels
+	environment.SensorChannels = nil
+	for _, channelType := range channels {
+		environment.SensorChannels = append(environment.SensorChannels, environment.Channel{Type: channelType, SensorID: "sensor-1-" + string(channelType)})
+	}
+	t.Cleanup(func() { environment.SensorChannels = previous })
+}
+
+// receive attende una lettura sul canale, fallendo il test dopo il timeout.
+func receive(t *testing.T, dataChannel chan types.SensorData, timeout time.Duration) types.SensorData {
+	t.Helper()
+	select {
+	case data := <-dataChannel:
+		return data
+	case <-time.After(timeout):
+		t.Fatal("no reading received")
+		return types.SensorData{}
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	setChannels(t, environment.Temperature, environment.Humidity)
+	timestamp := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		line    string
+		want    map[string]float64
+		wantErr bool
+	}{
+		{name: "empty line", line: "   ", want: map[string]float64{}},
+		{name: "comment", line: "# boot", want: map[string]float64{}},
+		{name: "single value", line: "21.5", want: map[string]float64{"temperature": 21.5}},
+		{name: "positional values", line: "21.5,40.2", want: map[string]float64{"temperature": 21.5, "humidity": 40.2}},
+		{name: "spaces and carriage return", line: " 21.5 , 40.2 \r", want: map[string]float64{"temperature": 21.5, "humidity": 40.2}},
+		{name: "named values", line: "humidity=40.2,temperature=21.5", want: map[string]float64{"temperature": 21.5, "humidity": 40.2}},
+		{name: "negative value", line: "temperature=-3", want: map[string]float64{"temperature": -3}},
+		{name: "too many values", line: "1,2,3", wantErr: true},
+		{name: "invalid number", line: "21.5,abc", wantErr: true},
+		{name: "unknown channel", line: "pressure=1013", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLine(tt.line, timestamp)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseLine(%q) error = %v, wantErr %v", tt.line, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseLine(%q) = %d readings, want %d", tt.line, len(got), len(tt.want))
+			}
+			for _, data := range got {
+				want, ok := tt.want[data.Type]
+				if !ok || data.Data != want {
+					t.Errorf("parseLine(%q): %s = %v, want %v", tt.line, data.Type, data.Data, want)
+				}
+				if data.SensorID != "sensor-1-"+data.Type {
+					t.Errorf("parseLine(%q): sensor ID %q for channel %s", tt.line, data.SensorID, data.Type)
+				}
+				if data.Timestamp != timestamp.Unix() {
+					t.Errorf("parseLine(%q): timestamp %d, want %d", tt.line, data.Timestamp, timestamp.Unix())
+				}
+			}
+		})
+	}
+}
+
+func TestParseLineAppliesScale(t *testing.T) {
+	setChannels(t, environment.Temperature)
+	previous := environment.SensorDriverScale
+	environment.SensorDriverScale = 0.001
+	t.Cleanup(func() { environment.SensorDriverScale = previous })
+
+	got, err := parseLine("21500", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Data != 21.5 {
+		t.Fatalf("parseLine with scale = %+v, want 21.5", got)
+	}
+}
@@ -0,0 +1,87 @@
+package driver
+
+import (
+	"SensorContinuum/internal/sensor-agent/environment"
+	"SensorContinuum/internal/sensor-agent/simulation"
+	"SensorContinuum/pkg/logger"
+	"SensorContinuum/pkg/types"
+	"bufio"
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// SerialSensor legge le letture da una linea seriale (UART), una riga per campionamento,
+// secondo il protocollo testuale descritto in parseLine. Il campionamento è dettato dal dispositivo.
+// Se la linea si interrompe (es. il dispositivo viene scollegato), viene riaperta dopo MaxReconnectionInterval secondi.
+type SerialSensor struct {
+	Path     string
+	BaudRate int
+}
+
+func (s *SerialSensor) Name() string {
+	return string(environment.SerialDriver) + " (" + s.Path + ")"
+}
+
+func (s *SerialSensor) Run(dataChannel chan types.SensorData) error {
+	for {
+		if err := s.read(dataChannel); err != nil {
+			logger.Log.Error("Error reading serial line ", s.Path, ": ", err)
+		}
+		logger.Log.Info("Reopening serial line ", s.Path, " in ", environment.MaxReconnectionInterval, " seconds...")
+		time.Sleep(time.Duration(environment.MaxReconnectionInterval) * time.Second)
+	}
+}
+
+// read apre la linea seriale e ne legge le righe finché non si interrompe.
+func (s *SerialSensor) read(dataChannel chan types.SensorData) error {
+	if err := s.configure(); err != nil {
+		return err
+	}
+
+	file, err := os.Open(s.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	logger.Log.Info("Serial line opened: ", s.Path)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// Mentre il sensore è in pausa le righe vengono lette e scartate, per non accumularle
+		if simulation.IsPaused() {
+			continue
+		}
+
+		sensorDataList, err := parseLine(scanner.Text(), time.Now())
+		if err != nil {
+			logger.Log.Warn("Discarding serial line: ", err)
+			continue
+		}
+		send(dataChannel, sensorDataList)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("serial line closed")
+}
+
+// configure imposta la velocità e la modalità raw della linea seriale con stty.
+// I file che non sono terminali (es. una FIFO) vengono letti senza configurazione.
+func (s *SerialSensor) configure() error {
+	info, err := os.Stat(s.Path)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeCharDevice == 0 {
+		return nil
+	}
+
+	output, err := exec.Command("stty", "-F", s.Path, strconv.Itoa(s.BaudRate), "raw", "-echo").CombinedOutput()
+	if err != nil {
+		return errors.New("failed to configure serial line: " + err.Error() + ": " + string(output))
+	}
+	return nil
+}
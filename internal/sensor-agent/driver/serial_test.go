@@ -0,0 +1,104 @@
+//go:build linux
+
+package driver
+
+import (
+	"SensorContinuum/internal/sensor-agent/environment"
+	"SensorContinuum/pkg/types"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// openPty apre una coppia di pseudo-terminali e restituisce il lato master e il percorso del lato slave,
+// che il driver seriale apre come se fosse una linea UART.
+func openPty(t *testing.T) (*os.File, string) {
+	t.Helper()
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skip("pseudo-terminals not available: ", err)
+	}
+
+	var unlock int32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); errno != 0 {
+		_ = master.Close()
+		t.Fatal("unlockpt: ", errno)
+	}
+	var number uint32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&number))); errno != 0 {
+		_ = master.Close()
+		t.Fatal("ptsname: ", errno)
+	}
+	return master, "/dev/pts/" + strconv.Itoa(int(number))
+}
+
+func TestSerialSensorReadsPty(t *testing.T) {
+	setChannels(t, environment.Temperature, environment.Humidity)
+	master, slavePath := openPty(t)
+	defer master.Close()
+
+	sensor := &SerialSensor{Path: slavePath, BaudRate: 9600}
+	dataChannel := make(chan types.SensorData, 10)
+	done := make(chan error, 1)
+	go func() { done <- sensor.read(dataChannel) }()
+
+	// La riga viene scritta finché il driver non ha aperto e configurato la linea
+	deadline := time.Now().Add(5 * time.Second)
+	var first types.SensorData
+	for received := false; !received; {
+		if time.Now().After(deadline) {
+			t.Fatal("no reading received from the serial line")
+		}
+		if _, err := master.Write([]byte("21.5,40.2\n")); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case first = <-dataChannel:
+			received = true
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+	if first.Type != "temperature" || first.Data != 21.5 {
+		t.Fatalf("first reading = %+v, want temperature 21.5", first)
+	}
+	if second := receive(t, dataChannel, 2*time.Second); second.Type != "humidity" || second.Data != 40.2 {
+		t.Fatalf("second reading = %+v, want humidity 40.2", second)
+	}
+
+	// Le righe non valide vengono scartate senza interrompere la lettura
+	if _, err := master.Write([]byte("garbage\ntemperature=19\n")); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		data := receive(t, dataChannel, 2*time.Second)
+		// Scarta le eventuali righe duplicate scritte prima dell'apertura della linea
+		if data.Data == 21.5 || data.Data == 40.2 {
+			continue
+		}
+		if data.Type != "temperature" || data.Data != 19 {
+			t.Fatalf("reading after invalid line = %+v, want temperature 19", data)
+		}
+		break
+	}
+
+	// Chiudendo il lato master la linea si interrompe e read restituisce un errore
+	_ = master.Close()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("read returned without error after the line was closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("read did not return after the line was closed")
+	}
+}
+
+func TestSerialSensorMissingDevice(t *testing.T) {
+	sensor := &SerialSensor{Path: "/dev/does-not-exist", BaudRate: 9600}
+	if err := sensor.read(make(chan types.SensorData, 1)); err == nil {
+		t.Fatal("read succeeded on a missing device")
+	}
+}
@@ -0,0 +1,55 @@
+package driver
+
+import (
+	"SensorContinuum/internal/sensor-agent/environment"
+	"SensorContinuum/pkg/types"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SysfsSensor legge ad ogni campionamento un file per canale, come quelli esposti da Linux
+// in /sys/class/hwmon (es. temp1_input), contenente un solo valore numerico.
+type SysfsSensor struct {
+	Paths []string
+}
+
+// NewSysfsSensor crea un SysfsSensor con i file indicati, separati da virgola: uno per ogni canale, nell'ordine di SensorChannels.
+func NewSysfsSensor(paths string) (*SysfsSensor, error) {
+	s := &SysfsSensor{}
+	for _, path := range strings.Split(paths, ",") {
+		s.Paths = append(s.Paths, strings.TrimSpace(path))
+	}
+	if len(s.Paths) != len(environment.SensorChannels) {
+		return nil, errors.New("the sysfs driver requires one path for each channel, got " + strconv.Itoa(len(s.Paths)) + " paths for " + strconv.Itoa(len(environment.SensorChannels)) + " channels")
+	}
+	return s, nil
+}
+
+func (s *SysfsSensor) Name() string {
+	return string(environment.SysfsDriver) + " (" + strings.Join(s.Paths, ", ") + ")"
+}
+
+func (s *SysfsSensor) Run(dataChannel chan types.SensorData) error {
+	return poll(dataChannel, s.read)
+}
+
+// read legge il valore corrente di ogni canale.
+func (s *SysfsSensor) read() ([]types.SensorData, error) {
+	now := time.Now()
+	sensorDataList := make([]types.SensorData, 0, len(s.Paths))
+	for i, path := range s.Paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(string(content)), 64)
+		if err != nil {
+			return nil, errors.New("invalid value in " + path + ": " + err.Error())
+		}
+		sensorDataList = append(sensorDataList, newSensorData(environment.SensorChannels[i], value, now))
+	}
+	return sensorDataList, nil
+}
@@ -0,0 +1,74 @@
+package driver
+
+import (
+	"SensorContinuum/internal/sensor-agent/environment"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeSysfsFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSysfsSensorRead(t *testing.T) {
+	setChannels(t, environment.Temperature, environment.Humidity)
+	dir := t.TempDir()
+	temperaturePath := filepath.Join(dir, "temp1_input")
+	humidityPath := filepath.Join(dir, "humidity1_input")
+	writeSysfsFile(t, temperaturePath, "21.5\n")
+	writeSysfsFile(t, humidityPath, "40.2\n")
+
+	sensor, err := NewSysfsSensor(temperaturePath + ", " + humidityPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := sensor.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Type != "temperature" || got[0].Data != 21.5 || got[1].Type != "humidity" || got[1].Data != 40.2 {
+		t.Fatalf("read = %+v, want temperature 21.5 and humidity 40.2", got)
+	}
+
+	// Ogni lettura rilegge il valore corrente del file
+	writeSysfsFile(t, temperaturePath, "22\n")
+	got, err = sensor.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0].Data != 22 {
+		t.Fatalf("read after update = %v, want 22", got[0].Data)
+	}
+}
+
+func TestSysfsSensorErrors(t *testing.T) {
+	setChannels(t, environment.Temperature)
+	dir := t.TempDir()
+
+	if _, err := NewSysfsSensor(filepath.Join(dir, "a") + "," + filepath.Join(dir, "b")); err == nil {
+		t.Error("NewSysfsSensor accepted more paths than channels")
+	}
+
+	missing, err := NewSysfsSensor(filepath.Join(dir, "missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := missing.read(); err == nil {
+		t.Error("read succeeded on a missing file")
+	}
+
+	invalidPath := filepath.Join(dir, "invalid")
+	writeSysfsFile(t, invalidPath, "not a number\n")
+	invalid, err := NewSysfsSensor(invalidPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := invalid.read(); err == nil {
+		t.Error("read succeeded on an invalid value")
+	}
+}
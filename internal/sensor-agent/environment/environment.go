@@ -2,10 +2,15 @@ package environment
 
 import (
 	"SensorContinuum/configs/mosquitto"
+	"SensorContinuum/configs/simulation"
+	"SensorContinuum/configs/timeouts"
 	"SensorContinuum/pkg/logger"
+	"SensorContinuum/pkg/types"
+	"SensorContinuum/pkg/utils"
 	"errors"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/google/uuid"
 )
@@ -74,6 +79,93 @@ var SimulationTimestampFormat string
 // Ad esempio, se oggi è 2024-06-15 e SimulationOffsetDay è 2, la data di simulazione sarà 2024-06-13.
 var SimulationOffsetDay int = 2
 
+type DataSource string
+
+const (
+	DownloadDataSource DataSource = "download"
+	LocalDataSource    DataSource = "local"
+	EmbeddedDataSource DataSource = "embedded"
+)
+
+// SimulationDataSource identifica da dove il simulatore legge il file CSV:
+// "download" dall'archivio di sensor.community, "local" da una directory locale,
+// "embedded" da un dataset di esempio incluso nel binario.
+var SimulationDataSource DataSource = DownloadDataSource
+
+// SimulationDataDir è la directory da cui leggere i file CSV con la sorgente "local".
+var SimulationDataDir string = "csv"
+
+type Mode string
+
+const (
+	RandomMode Mode = "random"
+	ReplayMode Mode = "replay"
+)
+
+// SimulationMode identifica come vengono generate le letture:
+// "random" genera valori casuali a partire dalla distribuzione oraria del CSV,
+// "replay" invia le righe del CSV nell'ordine originale, rispettando gli intervalli tra i timestamp.
+var SimulationMode Mode = RandomMode
+
+// SimulationReplaySpeed è il fattore di accelerazione del tempo in modalità replay.
+// Ad esempio, con 60 un'ora di dati viene inviata in un minuto.
+var SimulationReplaySpeed float64 = 1
+
+// SimulationSeed è il seed del generatore casuale della simulazione, valido solo se SimulationSeeded è true.
+// Con lo stesso seed e la stessa sorgente dati la simulazione genera la stessa sequenza di rumore, dati mancanti e outlier.
+var SimulationSeed int64
+var SimulationSeeded bool = false
+
+// SimulationFaults contiene la probabilità di innesco, ad ogni lettura, dei guasti da iniettare nella simulazione
+// e i loro parametri. Si configura con SIMULATION_FAULTS nel formato "<guasto>:<probabilità>[:<parametro>=<valore>...],...",
+// ad esempio "stuck:0.01:length=20,duplicate:0.05". I parametri non specificati assumono i valori di configs/simulation.
+var SimulationFaults []types.FaultConfig
+
+// SimulationFaultLabels abilita la pubblicazione delle etichette delle letture alterate sul topic FaultLabelTopic.
+var SimulationFaultLabels bool = false
+
+type Driver string
+
+const (
+	SimulationDriver Driver = "simulation"
+	SerialDriver     Driver = "serial"
+	SysfsDriver      Driver = "sysfs"
+	CommandDriver    Driver = "command"
+)
+
+// SensorDriver identifica da dove il Sensor Agent legge le letture: "simulation" le genera con il simulatore,
+// "serial" le legge da una linea seriale (UART), "sysfs" da file come quelli di /sys/class/hwmon,
+// "command" dall'output di un comando eseguito ad ogni campionamento.
+var SensorDriver Driver = SimulationDriver
+
+// SensorDriverPath è il dispositivo della linea seriale con il driver "serial",
+// oppure l'elenco dei file da leggere, uno per canale e separati da virgola, con il driver "sysfs".
+var SensorDriverPath string
+
+// SensorDriverBaudRate è la velocità della linea seriale con il driver "serial".
+var SensorDriverBaudRate int = 9600
+
+// SensorDriverCommand è il comando, eseguito con "sh -c", da cui il driver "command" legge le letture.
+var SensorDriverCommand string
+
+// SensorDriverScale è il fattore per cui vengono moltiplicati i valori letti dai driver fisici,
+// ad esempio 0.001 per le temperature di hwmon, espresse in millesimi di grado.
+var SensorDriverScale float64 = 1
+
+// Channel è un canale di misura del Sensor Agent: ogni canale pubblica le letture di un tipo,
+// lette dalla propria colonna del CSV, con un proprio identificativo.
+type Channel struct {
+	Type        Type
+	ValueColumn string
+	SensorID    string
+}
+
+// SensorChannels contiene i canali di misura del Sensor Agent.
+// Si configura con SENSOR_CHANNELS nel formato "<tipo>[:<colonna>],...", ad esempio "temperature,humidity:hum".
+// Di default contiene un solo canale, di tipo SensorType e colonna SimulationValueColumn, con identificativo SensorId.
+// Con più canali, l'identificativo di ogni canale è "<SensorId>-<tipo>".
+var SensorChannels []Channel
+
 type IdGenerator string
 
 const (
@@ -89,13 +181,58 @@ var SensorId string
 var MqttBrokerProtocol string
 var MqttBrokerAddress string
 var MqttBrokerPort string
+
+// MqttSecurity contiene le impostazioni TLS e le credenziali della connessione al broker MQTT.
+// Con un certificato client, il suo CN è l'identità del sensore e deve coincidere con SensorId.
+var MqttSecurity utils.MQTTSecurity
+
 var DataTopic string
 var ConfigurationTopic string
+var SensorCommandTopic string
+var CommandTopic string
+var CommandAckTopic string
+var DesiredConfigurationTopic string
+var ReportedConfigurationTopic string
+var FaultLabelTopic string
+var HeartbeatTopic string
+
+// DataContentType è il formato di serializzazione (JSON o CBOR) delle letture pubblicate sul topic DataTopic.
+var DataContentType = types.JSONContentType
 
 var MaxReconnectionInterval int = 10 // in seconds
 var MaxReconnectionTimeout int = 10  // in seconds
 var MaxReconnectionAttempts int = 10
-var MessagePublishTimeout int = 5 // in seconds
+var MessagePublishTimeout int = 5  // in seconds
+var MaxSubscriptionTimeout int = 5 // in seconds
+
+// Heartbeat abilita l'invio periodico di un messaggio di heartbeat all'Edge Hub, ogni HeartbeatInterval secondi,
+// così il sensore viene considerato in funzione anche con un intervallo di campionamento lungo o con dati mancanti.
+var Heartbeat bool = true
+var HeartbeatInterval int = int(timeouts.SensorHeartbeatInterval.Seconds())
+
+// SensorVersion è la versione del firmware del sensore fisico o del simulatore, riportata negli heartbeat.
+var SensorVersion string = simulation.VERSION
+
+// OfflineBuffer abilita il salvataggio su disco delle letture non inviate, per inviarle dopo la riconnessione.
+var OfflineBuffer bool = true
+var OfflineBufferDir string = "buffer"
+var OfflineBufferMaxReadings int = 10000
+var OfflineBufferSegmentSize int = 500
+var OfflineBufferReplayRate int = 10 // letture al secondo
+
+// MaxOfflineBufferReplayRate è il massimo di OfflineBufferReplayRate: l'intervallo tra due invii non può essere inferiore a 1 ms.
+const MaxOfflineBufferReplayRate int = 1000
+
+// Signing abilita la firma Ed25519 delle letture, verificata dall'Edge Hub con la chiave pubblica inviata nella registrazione.
+var Signing bool = false
+
+// SigningKeyFile specifica il file PEM (PKCS #8) con la chiave privata di firma del sensore.
+// Se il file non esiste, viene generata una nuova chiave e salvata nel file.
+var SigningKeyFile string = "signing.key"
+
+// PublishQueue è la configurazione della coda tra il sensore e la pubblicazione MQTT delle letture.
+// Con la policy di default, se la pubblicazione non tiene il passo le nuove letture vengono scartate.
+var PublishQueue = utils.QueueConfig{Policy: utils.DropNewestQueuePolicy, Size: 100, SpillDir: "queue-spill"}
 
 var HealthzServer bool = false
 var HealthzServerPort string = ":"
@@ -213,6 +350,211 @@ func SetupEnvironment() error {
 		}
 	}
 
+	SimulationDataSourceStr, exists := os.LookupEnv("SIMULATION_DATA_SOURCE")
+	if exists {
+		switch SimulationDataSourceStr {
+		case string(DownloadDataSource):
+			SimulationDataSource = DownloadDataSource
+		case string(LocalDataSource):
+			SimulationDataSource = LocalDataSource
+		case string(EmbeddedDataSource):
+			SimulationDataSource = EmbeddedDataSource
+		default:
+			return errors.New("invalid value for SIMULATION_DATA_SOURCE: " + SimulationDataSourceStr + ". Must be 'download', 'local' or 'embedded'")
+		}
+	}
+
+	SimulationDataDirStr, exists := os.LookupEnv("SIMULATION_DATA_DIR")
+	if exists && SimulationDataDirStr != "" {
+		SimulationDataDir = SimulationDataDirStr
+	}
+
+	SimulationModeStr, exists := os.LookupEnv("SIMULATION_MODE")
+	if exists {
+		switch SimulationModeStr {
+		case string(RandomMode):
+			SimulationMode = RandomMode
+		case string(ReplayMode):
+			SimulationMode = ReplayMode
+		default:
+			return errors.New("invalid value for SIMULATION_MODE: " + SimulationModeStr + ". Must be 'random' or 'replay'")
+		}
+	}
+
+	SimulationReplaySpeedStr, exists := os.LookupEnv("SIMULATION_REPLAY_SPEED")
+	if exists {
+		var err error
+		SimulationReplaySpeed, err = strconv.ParseFloat(SimulationReplaySpeedStr, 64)
+		if err != nil || SimulationReplaySpeed <= 0 {
+			return errors.New("invalid value for SIMULATION_REPLAY_SPEED: " + SimulationReplaySpeedStr + ". Must be a positive number")
+		}
+	}
+
+	SimulationSeedStr, exists := os.LookupEnv("SIMULATION_SEED")
+	if exists {
+		var err error
+		SimulationSeed, err = strconv.ParseInt(SimulationSeedStr, 10, 64)
+		if err != nil {
+			return errors.New("invalid value for SIMULATION_SEED: " + SimulationSeedStr + ". Must be an integer")
+		}
+		SimulationSeeded = true
+	}
+
+	SimulationFaultsStr, exists := os.LookupEnv("SIMULATION_FAULTS")
+	if exists && SimulationFaultsStr != "" {
+		SimulationFaults = nil
+		for _, entry := range strings.Split(SimulationFaultsStr, ",") {
+			parts := strings.Split(strings.TrimSpace(entry), ":")
+			if len(parts) < 2 {
+				return errors.New("invalid value for SIMULATION_FAULTS: " + entry + ". Must be in the format '<fault>:<probability>[:<param>=<value>...]'")
+			}
+			name, probabilityStr := parts[0], parts[1]
+			fault := types.FaultType(name)
+			known := false
+			for _, f := range types.InjectableFaults {
+				if f == fault {
+					known = true
+					break
+				}
+			}
+			if !known {
+				return errors.New("invalid value for SIMULATION_FAULTS: unknown fault " + name)
+			}
+			probability, err := strconv.ParseFloat(probabilityStr, 64)
+			if err != nil || probability < 0 || probability > 1 {
+				return errors.New("invalid value for SIMULATION_FAULTS: " + entry + ". Probability must be between 0 and 1")
+			}
+
+			// Parametri di default del guasto
+			faultConfig := types.FaultConfig{Type: fault, Probability: probability, Length: 1}
+			switch fault {
+			case types.StuckFault:
+				faultConfig.Length = simulation.STUCK_LENGTH
+			case types.DriftFault:
+				faultConfig.Length = simulation.DRIFT_LENGTH
+				faultConfig.Step = simulation.DRIFT_STEP
+			case types.BurstFault:
+				faultConfig.Length = simulation.BURST_LENGTH
+				faultConfig.Multiplier = simulation.OUTLIER_MULTIPLIER
+			case types.ClockSkewFault:
+				faultConfig.Length = simulation.CLOCK_SKEW_LENGTH
+				faultConfig.Skew = simulation.CLOCK_SKEW
+			case types.OutOfOrderFault:
+				faultConfig.Delay = simulation.OUT_OF_ORDER_DELAY
+			case types.FlatLineFault:
+				faultConfig.Length = simulation.FLAT_LINE_LENGTH
+			}
+
+			// Parametri specificati per il Sensor Agent
+			for _, param := range parts[2:] {
+				key, valueStr, found := strings.Cut(param, "=")
+				if !found {
+					return errors.New("invalid value for SIMULATION_FAULTS: " + entry + ". Parameters must be in the format '<param>=<value>'")
+				}
+				value, err := strconv.ParseFloat(valueStr, 64)
+				isInteger := err == nil && value == float64(int64(value))
+				valid := false
+				switch {
+				case key == "length" && fault != types.OutOfOrderFault && fault != types.DuplicateFault:
+					valid = isInteger && value >= 1
+					faultConfig.Length = int(value)
+				case key == "step" && fault == types.DriftFault:
+					valid = err == nil && value > 0
+					faultConfig.Step = value
+				case key == "multiplier" && fault == types.BurstFault:
+					valid = err == nil && value > 0
+					faultConfig.Multiplier = value
+				case key == "skew" && fault == types.ClockSkewFault:
+					valid = isInteger && value != 0
+					faultConfig.Skew = int64(value)
+				case key == "delay" && fault == types.OutOfOrderFault:
+					valid = isInteger && value >= 1
+					faultConfig.Delay = int(value)
+				default:
+					return errors.New("invalid value for SIMULATION_FAULTS: unknown parameter " + key + " for fault " + name)
+				}
+				if !valid {
+					return errors.New("invalid value for SIMULATION_FAULTS: " + entry + ". Invalid value for parameter " + key)
+				}
+			}
+			SimulationFaults = append(SimulationFaults, faultConfig)
+		}
+	}
+
+	SimulationFaultLabelsStr, exists := os.LookupEnv("SIMULATION_FAULT_LABELS")
+	if exists {
+		switch SimulationFaultLabelsStr {
+		case "true":
+			SimulationFaultLabels = true
+		case "false":
+			SimulationFaultLabels = false
+		default:
+			return errors.New("invalid value for SIMULATION_FAULT_LABELS: " + SimulationFaultLabelsStr + ". Must be 'true' or 'false'")
+		}
+	}
+
+	/* ----- SENSOR DRIVER SETTINGS ----- */
+
+	SensorDriverStr, exists := os.LookupEnv("SENSOR_DRIVER")
+	if exists {
+		switch SensorDriverStr {
+		case string(SimulationDriver):
+			SensorDriver = SimulationDriver
+		case string(SerialDriver):
+			SensorDriver = SerialDriver
+		case string(SysfsDriver):
+			SensorDriver = SysfsDriver
+		case string(CommandDriver):
+			SensorDriver = CommandDriver
+		default:
+			return errors.New("invalid value for SENSOR_DRIVER: " + SensorDriverStr + ". Must be 'simulation', 'serial', 'sysfs' or 'command'")
+		}
+	}
+
+	SensorDriverPath, exists = os.LookupEnv("SENSOR_DRIVER_PATH")
+	if !exists {
+		switch SensorDriver {
+		case SerialDriver:
+			SensorDriverPath = "/dev/ttyUSB0"
+		case SysfsDriver:
+			return errors.New("environment variable SENSOR_DRIVER_PATH not set, required by the sysfs driver")
+		}
+	}
+
+	SensorDriverBaudRateStr, exists := os.LookupEnv("SENSOR_DRIVER_BAUD_RATE")
+	if exists {
+		var err error
+		SensorDriverBaudRate, err = strconv.Atoi(SensorDriverBaudRateStr)
+		if err != nil || SensorDriverBaudRate <= 0 {
+			return errors.New("invalid value for SENSOR_DRIVER_BAUD_RATE: " + SensorDriverBaudRateStr + ". Must be a positive integer")
+		}
+	}
+
+	SensorDriverCommand, exists = os.LookupEnv("SENSOR_DRIVER_COMMAND")
+	if (!exists || SensorDriverCommand == "") && SensorDriver == CommandDriver {
+		return errors.New("environment variable SENSOR_DRIVER_COMMAND not set, required by the command driver")
+	}
+
+	SensorDriverScaleStr, exists := os.LookupEnv("SENSOR_DRIVER_SCALE")
+	if exists {
+		var err error
+		SensorDriverScale, err = strconv.ParseFloat(SensorDriverScaleStr, 64)
+		if err != nil || SensorDriverScale == 0 {
+			return errors.New("invalid value for SENSOR_DRIVER_SCALE: " + SensorDriverScaleStr + ". Must be a non-zero number")
+		}
+	}
+
+	/* ----- MQTT SECURITY SETTINGS ----- */
+
+	MqttSecurity = utils.MQTTSecurity{
+		CAFile:   os.Getenv("MQTT_CA_FILE"),
+		CertFile: os.Getenv("MQTT_CERT_FILE"),
+		KeyFile:  os.Getenv("MQTT_KEY_FILE"),
+		Username: os.Getenv("MQTT_USERNAME"),
+		Password: os.Getenv("MQTT_PASSWORD"),
+		Token:    os.Getenv("MQTT_TOKEN"),
+	}
+
 	/* ----- ENVIRONMENT SETTINGS ----- */
 
 	EdgeMacrozone, exists = os.LookupEnv("EDGE_MACROZONE")
@@ -241,6 +583,7 @@ func SetupEnvironment() error {
 	}
 
 	SensorId, exists = os.LookupEnv("SENSOR_ID")
+	sensorIdConfigured := exists
 	if !exists {
 		switch SensorIdGenerator {
 		case UUID:
@@ -264,6 +607,47 @@ func SetupEnvironment() error {
 		}
 	}
 
+	// Con un certificato client l'identità del sensore è il CN del certificato:
+	// viene utilizzata come SensorId se SENSOR_ID non è impostata, altrimenti deve coincidere con SensorId
+	var err error
+	SensorId, err = MqttSecurity.ResolveIdentity(SensorId, sensorIdConfigured)
+	if err != nil {
+		return errors.New("invalid value for SENSOR_ID: " + err.Error())
+	}
+
+	SensorChannels = []Channel{{Type: SensorType, ValueColumn: SimulationValueColumn, SensorID: SensorId}}
+	SensorChannelsStr, exists := os.LookupEnv("SENSOR_CHANNELS")
+	if exists && SensorChannelsStr != "" {
+		SensorChannels = nil
+		for _, entry := range strings.Split(SensorChannelsStr, ",") {
+			typeStr, column, found := strings.Cut(strings.TrimSpace(entry), ":")
+			channelType := Type(typeStr)
+			switch channelType {
+			case Temperature, Humidity, Pressure:
+			default:
+				return errors.New("invalid value for SENSOR_CHANNELS: " + entry + ". Type must be 'temperature', 'humidity', or 'pressure'")
+			}
+			if !found || column == "" {
+				column = typeStr
+			}
+			for _, channel := range SensorChannels {
+				if channel.Type == channelType {
+					return errors.New("invalid value for SENSOR_CHANNELS: duplicate type " + typeStr)
+				}
+			}
+			SensorChannels = append(SensorChannels, Channel{Type: channelType, ValueColumn: column})
+		}
+
+		// Con un solo canale l'identificativo resta quello del sensore
+		for i := range SensorChannels {
+			if len(SensorChannels) == 1 {
+				SensorChannels[i].SensorID = SensorId
+			} else {
+				SensorChannels[i].SensorID = SensorId + "-" + string(SensorChannels[i].Type)
+			}
+		}
+	}
+
 	/* ----- MQTT BROKER SETTINGS ----- */
 
 	MqttBrokerProtocol, exists = os.LookupEnv("MQTT_BROKER_PROTOCOL")
@@ -281,8 +665,28 @@ func SetupEnvironment() error {
 		MqttBrokerPort = mosquitto.PORT
 	}
 
+	if err := MqttSecurity.Validate(MqttBrokerProtocol); err != nil {
+		return errors.New("invalid MQTT security settings: " + err.Error())
+	}
+
 	DataTopic = "sensor-data/" + EdgeMacrozone + "/" + EdgeZone
 	ConfigurationTopic = "configuration/sensor/" + EdgeMacrozone + "/" + EdgeZone
+	SensorCommandTopic = "command/sensor/" + EdgeMacrozone + "/" + EdgeZone
+	CommandTopic = SensorCommandTopic + "/" + SensorId
+	CommandAckTopic = "command-ack/sensor/" + EdgeMacrozone + "/" + EdgeZone + "/" + SensorId
+	DesiredConfigurationTopic = ConfigurationTopic + "/" + SensorId + "/desired"
+	ReportedConfigurationTopic = ConfigurationTopic + "/" + SensorId + "/reported"
+	FaultLabelTopic = "fault-label/" + EdgeMacrozone + "/" + EdgeZone + "/" + SensorId
+	HeartbeatTopic = "heartbeat/sensor/" + EdgeMacrozone + "/" + EdgeZone + "/" + SensorId
+
+	DataContentTypeStr, exists := os.LookupEnv("DATA_CONTENT_TYPE")
+	if exists {
+		var err error
+		DataContentType, err = types.ParseContentType(DataContentTypeStr)
+		if err != nil {
+			return errors.New("invalid value for DATA_CONTENT_TYPE: " + DataContentTypeStr + ". Must be 'application/json' or 'application/cbor'")
+		}
+	}
 
 	var MaxReconnectionIntervalStr string
 	MaxReconnectionIntervalStr, exists = os.LookupEnv("MAX_RECONNECTION_INTERVAL")
@@ -324,6 +728,118 @@ func SetupEnvironment() error {
 		}
 	}
 
+	var MaxSubscriptionTimeoutStr string
+	MaxSubscriptionTimeoutStr, exists = os.LookupEnv("MAX_SUBSCRIPTION_TIMEOUT")
+	if exists {
+		var err error
+		MaxSubscriptionTimeout, err = strconv.Atoi(MaxSubscriptionTimeoutStr)
+		if err != nil || MaxSubscriptionTimeout <= 0 {
+			return errors.New("invalid value for MAX_SUBSCRIPTION_TIMEOUT: " + MaxSubscriptionTimeoutStr + ". Must be a positive integer")
+		}
+	}
+
+	/* ----- HEARTBEAT SETTINGS ----- */
+
+	HeartbeatStr, exists := os.LookupEnv("HEARTBEAT")
+	if exists {
+		switch HeartbeatStr {
+		case "true":
+			Heartbeat = true
+		case "false":
+			Heartbeat = false
+		default:
+			return errors.New("invalid value for HEARTBEAT: " + HeartbeatStr + ". Must be 'true' or 'false'")
+		}
+	}
+
+	HeartbeatIntervalStr, exists := os.LookupEnv("HEARTBEAT_INTERVAL")
+	if exists {
+		var err error
+		HeartbeatInterval, err = strconv.Atoi(HeartbeatIntervalStr)
+		if err != nil || HeartbeatInterval <= 0 {
+			return errors.New("invalid value for HEARTBEAT_INTERVAL: " + HeartbeatIntervalStr + ". Must be a positive integer")
+		}
+	}
+
+	SensorVersionStr, exists := os.LookupEnv("SENSOR_VERSION")
+	if exists && SensorVersionStr != "" {
+		SensorVersion = SensorVersionStr
+	}
+
+	/* ----- OFFLINE BUFFER SETTINGS ----- */
+
+	OfflineBufferStr, exists := os.LookupEnv("OFFLINE_BUFFER")
+	if exists {
+		switch OfflineBufferStr {
+		case "true":
+			OfflineBuffer = true
+		case "false":
+			OfflineBuffer = false
+		default:
+			return errors.New("invalid value for OFFLINE_BUFFER: " + OfflineBufferStr + ". Must be 'true' or 'false'")
+		}
+	}
+
+	OfflineBufferDirStr, exists := os.LookupEnv("OFFLINE_BUFFER_DIR")
+	if exists && OfflineBufferDirStr != "" {
+		OfflineBufferDir = OfflineBufferDirStr
+	}
+
+	var OfflineBufferMaxReadingsStr string
+	OfflineBufferMaxReadingsStr, exists = os.LookupEnv("OFFLINE_BUFFER_MAX_READINGS")
+	if exists {
+		var err error
+		OfflineBufferMaxReadings, err = strconv.Atoi(OfflineBufferMaxReadingsStr)
+		if err != nil || OfflineBufferMaxReadings <= 0 {
+			return errors.New("invalid value for OFFLINE_BUFFER_MAX_READINGS: " + OfflineBufferMaxReadingsStr + ". Must be a positive integer")
+		}
+	}
+
+	var OfflineBufferSegmentSizeStr string
+	OfflineBufferSegmentSizeStr, exists = os.LookupEnv("OFFLINE_BUFFER_SEGMENT_SIZE")
+	if exists {
+		var err error
+		OfflineBufferSegmentSize, err = strconv.Atoi(OfflineBufferSegmentSizeStr)
+		if err != nil || OfflineBufferSegmentSize <= 0 {
+			return errors.New("invalid value for OFFLINE_BUFFER_SEGMENT_SIZE: " + OfflineBufferSegmentSizeStr + ". Must be a positive integer")
+		}
+	}
+
+	var OfflineBufferReplayRateStr string
+	OfflineBufferReplayRateStr, exists = os.LookupEnv("OFFLINE_BUFFER_REPLAY_RATE")
+	if exists {
+		var err error
+		OfflineBufferReplayRate, err = strconv.Atoi(OfflineBufferReplayRateStr)
+		if err != nil || OfflineBufferReplayRate <= 0 || OfflineBufferReplayRate > MaxOfflineBufferReplayRate {
+			return errors.New("invalid value for OFFLINE_BUFFER_REPLAY_RATE: " + OfflineBufferReplayRateStr + ". Must be an integer between 1 and " + strconv.Itoa(MaxOfflineBufferReplayRate) + " representing readings per second")
+		}
+	}
+
+	/* ----- SIGNING SETTINGS ----- */
+
+	SigningStr, exists := os.LookupEnv("SIGNING")
+	if exists {
+		switch SigningStr {
+		case "true":
+			Signing = true
+		case "false":
+			Signing = false
+		default:
+			return errors.New("invalid value for SIGNING: " + SigningStr + ". Must be 'true' or 'false'")
+		}
+	}
+
+	SigningKeyFileStr, exists := os.LookupEnv("SIGNING_KEY_FILE")
+	if exists && SigningKeyFileStr != "" {
+		SigningKeyFile = SigningKeyFileStr
+	}
+
+	/* ----- QUEUE SETTINGS ----- */
+
+	if err := utils.LoadQueueConfigFromEnv("PUBLISH", &PublishQueue); err != nil {
+		return err
+	}
+
 	/* ----- HEALTH CHECK SERVER SETTINGS ----- */
 
 	HealthzServerStr, exists := os.LookupEnv("HEALTHZ_SERVER")
@@ -3,6 +3,7 @@ package health
 import (
 	"SensorContinuum/configs/timeouts"
 	"SensorContinuum/internal/sensor-agent/comunication"
+	"SensorContinuum/internal/sensor-agent/simulation"
 	"time"
 )
 
@@ -13,7 +14,12 @@ func UpdateLastValueTimestamp() {
 	lastValueTimestamp = time.Now()
 }
 
-// IsHealthy verifica se l'ultimo valore ricevuto è entro il timeout di salute
+// IsHealthy verifica se l'ultimo valore ricevuto è entro il timeout di salute.
+// Se la simulazione è in pausa, il sensore è considerato sano finché è connesso.
 func isHealthy() bool {
-	return time.Since(lastValueTimestamp) < timeouts.IsAliveSensorTimeout && comunication.IsConnected()
+	if simulation.IsPaused() {
+		return comunication.IsConnected()
+	}
+	timeout := max(timeouts.IsAliveSensorTimeout, 2*simulation.SamplingInterval())
+	return time.Since(lastValueTimestamp) < timeout && comunication.IsConnected()
 }
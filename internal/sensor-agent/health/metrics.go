@@ -0,0 +1,28 @@
+package health
+
+import (
+	"SensorContinuum/internal/sensor-agent/comunication"
+	"SensorContinuum/pkg/logger"
+	"SensorContinuum/pkg/utils"
+	"fmt"
+	"net/http"
+)
+
+// MetricsHandler espone i contatori del WAL su disco e le metriche delle code interne nel formato testuale di Prometheus.
+func MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	metrics := comunication.GetBufferMetrics()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, err := fmt.Fprintf(w,
+		"# TYPE sensor_agent_buffered_readings_total counter\nsensor_agent_buffered_readings_total %d\n"+
+			"# TYPE sensor_agent_replayed_readings_total counter\nsensor_agent_replayed_readings_total %d\n"+
+			"# TYPE sensor_agent_evicted_readings_total counter\nsensor_agent_evicted_readings_total %d\n"+
+			"# TYPE sensor_agent_pending_readings gauge\nsensor_agent_pending_readings %d\n",
+		metrics.Buffered, metrics.Replayed, metrics.Evicted, metrics.Pending)
+	if err == nil {
+		err = utils.WriteQueueMetrics(w, "sensor_agent")
+	}
+	if err != nil {
+		logger.Log.Error("Failed to write response:", err.Error())
+	}
+}
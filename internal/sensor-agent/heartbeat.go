@@ -0,0 +1,59 @@
+package sensor_agent
+
+import (
+	"SensorContinuum/internal/sensor-agent/comunication"
+	"SensorContinuum/internal/sensor-agent/environment"
+	"SensorContinuum/internal/sensor-agent/simulation"
+	"SensorContinuum/pkg/logger"
+	"SensorContinuum/pkg/types"
+	"time"
+)
+
+// startTime è l'istante di avvio del Sensor Agent, utilizzato per calcolare l'uptime.
+var startTime = time.Now()
+
+// SendHeartbeats invia un messaggio di heartbeat all'Edge Hub ogni HeartbeatInterval secondi,
+// con l'uptime, le letture in attesa nel buffer offline, l'esito dell'ultimo invio e la versione del sensore.
+// Se il sensore è disconnesso, l'heartbeat viene saltato.
+func SendHeartbeats() {
+
+	ticker := time.NewTicker(time.Duration(environment.HeartbeatInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		if err := comunication.PublishHeartbeat(newHeartbeat()); err != nil {
+			logger.Log.Warn("Error publishing heartbeat: ", err)
+		} else {
+			logger.Log.Debug("Heartbeat published successfully")
+		}
+		<-ticker.C
+	}
+}
+
+// newHeartbeat crea il messaggio di heartbeat con lo stato corrente del sensore.
+func newHeartbeat() types.HeartbeatMsg {
+	lastPublish, lastPublishError := comunication.GetLastPublish()
+
+	heartbeat := types.HeartbeatMsg{
+		SchemaVersion:    types.HeartbeatMsgSchemaVersion,
+		Timestamp:        time.Now().UTC().Unix(),
+		EdgeMacrozone:    environment.EdgeMacrozone,
+		EdgeZone:         environment.EdgeZone,
+		SensorID:         environment.SensorId,
+		Uptime:           int64(time.Since(startTime).Seconds()),
+		SamplingInterval: simulation.SamplingInterval().Milliseconds(),
+		BufferDepth:      comunication.GetBufferMetrics().Pending,
+		LastPublish:      lastPublish,
+		LastPublishError: lastPublishError,
+		Driver:           string(environment.SensorDriver),
+		Version:          environment.SensorVersion,
+	}
+
+	// Con più canali, l'heartbeat vale per tutti i canali registrati
+	if len(environment.SensorChannels) > 1 {
+		for _, channel := range environment.SensorChannels {
+			heartbeat.Channels = append(heartbeat.Channels, channel.SensorID)
+		}
+	}
+	return heartbeat
+}
@@ -0,0 +1,46 @@
+package sensor_agent
+
+import (
+	"SensorContinuum/internal/sensor-agent/driver"
+	"SensorContinuum/internal/sensor-agent/environment"
+	"SensorContinuum/internal/sensor-agent/simulation"
+	"SensorContinuum/pkg/types"
+)
+
+// Sensor è la sorgente delle letture del Sensor Agent: il simulatore oppure un driver per un sensore fisico.
+type Sensor interface {
+	// Name restituisce il nome del sensore, utilizzato nei log.
+	Name() string
+	// Run legge le letture del sensore, per ogni canale, e le invia su dataChannel.
+	// Non termina finché il sensore è utilizzabile; restituisce un errore se non lo è più.
+	Run(dataChannel chan types.SensorData) error
+}
+
+// NewSensor crea il sensore indicato da SensorDriver.
+// labelChannel riceve le etichette dei guasti iniettati ed è utilizzato solo dal simulatore.
+func NewSensor(labelChannel chan types.FaultLabel) (Sensor, error) {
+	switch environment.SensorDriver {
+	case environment.SerialDriver:
+		return &driver.SerialSensor{Path: environment.SensorDriverPath, BaudRate: environment.SensorDriverBaudRate}, nil
+	case environment.SysfsDriver:
+		return driver.NewSysfsSensor(environment.SensorDriverPath)
+	case environment.CommandDriver:
+		return &driver.CommandSensor{Command: environment.SensorDriverCommand}, nil
+	default:
+		return &SimulatedSensor{LabelChannel: labelChannel}, nil
+	}
+}
+
+// SimulatedSensor genera le letture con il simulatore, a partire dal file CSV della sorgente dati.
+type SimulatedSensor struct {
+	LabelChannel chan types.FaultLabel
+}
+
+func (s *SimulatedSensor) Name() string {
+	return string(environment.SimulationDriver)
+}
+
+func (s *SimulatedSensor) Run(dataChannel chan types.SensorData) error {
+	simulation.SimulateForever(dataChannel, s.LabelChannel)
+	return nil
+}
@@ -0,0 +1,24 @@
+package simulation
+
+import (
+	"SensorContinuum/internal/sensor-agent/environment"
+	"time"
+)
+
+// channelState contiene lo stato della simulazione di un canale del sensore: le letture della colonna del CSV,
+// la distribuzione oraria, la posizione in modalità replay e il guasto attivo.
+type channelState struct {
+	config      environment.Channel
+	readings    []sensorReading
+	statsByHour map[int]distribution
+	replayIndex int
+	injector    faultInjector
+}
+
+// channels contiene i canali della simulazione corrente, nell'ordine di SensorChannels.
+var channels []*channelState
+
+// std restituisce la deviazione standard delle letture del canale nell'ora corrente.
+func (c *channelState) std() float64 {
+	return c.statsByHour[time.Now().UTC().Hour()].Std
+}
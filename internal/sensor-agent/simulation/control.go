@@ -0,0 +1,80 @@
+package simulation
+
+import (
+	"SensorContinuum/configs/simulation"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// samplingInterval è l'intervallo tra due letture del sensore, in millisecondi.
+// Può essere modificato a runtime tramite il comando set_sampling_interval o la configurazione desiderata.
+var samplingInterval atomic.Int64
+
+// missingProbability e outlierProbability sono le probabilità di generare un dato mancante o un outlier,
+// salvate come bit di un float64 per poterle modificare a runtime tramite la configurazione desiderata.
+var missingProbability atomic.Uint64
+var outlierProbability atomic.Uint64
+
+// paused indica se la simulazione è sospesa tramite il comando pause.
+var paused atomic.Bool
+
+// rebootRequested indica che è stato richiesto il riavvio della simulazione tramite il comando reboot.
+var rebootRequested atomic.Bool
+
+func init() {
+	samplingInterval.Store(simulation.TIMEOUT)
+	missingProbability.Store(math.Float64bits(simulation.MISSING_PROBABILITY))
+	outlierProbability.Store(math.Float64bits(simulation.OUTLIER_PROBABILITY))
+}
+
+// SamplingInterval restituisce l'intervallo corrente tra due letture del sensore.
+func SamplingInterval() time.Duration {
+	return time.Duration(samplingInterval.Load()) * time.Millisecond
+}
+
+// SetSamplingInterval modifica l'intervallo tra due letture del sensore.
+func SetSamplingInterval(interval time.Duration) {
+	samplingInterval.Store(interval.Milliseconds())
+}
+
+// MissingProbability restituisce la probabilità corrente di generare un dato mancante.
+func MissingProbability() float64 {
+	return math.Float64frombits(missingProbability.Load())
+}
+
+// SetMissingProbability modifica la probabilità di generare un dato mancante.
+func SetMissingProbability(probability float64) {
+	missingProbability.Store(math.Float64bits(probability))
+}
+
+// OutlierProbability restituisce la probabilità corrente di generare un outlier.
+func OutlierProbability() float64 {
+	return math.Float64frombits(outlierProbability.Load())
+}
+
+// SetOutlierProbability modifica la probabilità di generare un outlier.
+func SetOutlierProbability(probability float64) {
+	outlierProbability.Store(math.Float64bits(probability))
+}
+
+// Pause sospende l'invio delle letture, senza interrompere la simulazione.
+func Pause() {
+	paused.Store(true)
+}
+
+// Resume riprende l'invio delle letture dopo una pausa.
+func Resume() {
+	paused.Store(false)
+}
+
+// IsPaused indica se l'invio delle letture è sospeso.
+func IsPaused() bool {
+	return paused.Load()
+}
+
+// Reboot richiede il riavvio della simulazione: alla prossima lettura la simulazione termina
+// e SimulateForever la riavvia, scaricando di nuovo i dati e ricostruendo la distribuzione.
+func Reboot() {
+	rebootRequested.Store(true)
+}
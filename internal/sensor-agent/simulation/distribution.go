@@ -6,16 +6,10 @@ import (
 	"SensorContinuum/pkg/logger"
 	"SensorContinuum/pkg/types"
 	"math"
-	"math/rand"
 	"os"
 	"time"
 )
 
-var (
-	readings    []sensorReading
-	statsByHour map[int]distribution
-)
-
 type distribution struct {
 	Mean float64
 	Std  float64
@@ -27,38 +21,61 @@ type sensorReading struct {
 	Value     float64
 }
 
-// setupDistribution carica il file e prepara la distribuzione
-func setupDistribution(filePath string) error {
-	var err error
+// setupDistribution carica il contenuto CSV della sorgente e prepara la distribuzione di ogni canale
+func setupDistribution(source DataSource) error {
+	content, err := source.Open()
+	if err != nil {
+		return err
+	}
+	defer content.Close()
 
-	readings, err = parseCSV(filePath)
+	columns := make([]string, 0, len(environment.SensorChannels))
+	for _, channel := range environment.SensorChannels {
+		columns = append(columns, channel.ValueColumn)
+	}
+
+	readingsByColumn, err := parseCSV(content, columns)
 	if err != nil {
 		return err
 	}
 
-	computeStatsByHour()
+	// Lo stato dei canali viene ricreato: in modalità replay le righe vengono inviate dall'inizio del file
+	// e nessun guasto resta attivo dopo il riavvio della simulazione
+	channels = make([]*channelState, 0, len(environment.SensorChannels))
+	for _, channel := range environment.SensorChannels {
+		readings := readingsByColumn[channel.ValueColumn]
+		channels = append(channels, &channelState{
+			config:      channel,
+			readings:    readings,
+			statsByHour: computeStatsByHour(readings),
+		})
+	}
 
 	return nil
 }
 
-// generateSensorData genera letture randomiche basate sulla distribuzione
-func generateSensorData() types.SensorData {
+// generateSensorData genera letture randomiche del canale basate sulla distribuzione
+func generateSensorData(channel *channelState) generatedData {
 	now := time.Now().UTC()
-	reading := generateRandomReading(now)
-	return types.SensorData{
-		EdgeMacrozone: environment.EdgeMacrozone,
-		EdgeZone:      environment.EdgeZone,
-		SensorID:      environment.SensorId,
-		Timestamp:     reading.Timestamp.UTC().Unix(),
-		Type:          string(environment.SensorType),
-		Data:          reading.Value,
+	reading, fault, original := generateRandomReading(channel, now)
+	return generatedData{
+		data: types.SensorData{
+			EdgeMacrozone: environment.EdgeMacrozone,
+			EdgeZone:      environment.EdgeZone,
+			SensorID:      channel.config.SensorID,
+			Timestamp:     reading.Timestamp.UTC().Unix(),
+			Type:          string(channel.config.Type),
+			Data:          reading.Value,
+		},
+		fault:         fault,
+		originalValue: original,
 	}
 }
 
 // computeStatsByHour calcola la media e la deviazione standard per le letture di una specifica ora
 // Filtra le letture per l'ora richiesta, calcola la media e la deviazione standard, utili per generare valori randomici realistici.
-func computeStatsByHour() {
-	statsByHour = make(map[int]distribution)
+func computeStatsByHour(readings []sensorReading) map[int]distribution {
+	statsByHour := make(map[int]distribution)
 	for hour := 0; hour < 24; hour++ {
 		var vals []float64
 		for _, r := range readings {
@@ -83,36 +100,41 @@ func computeStatsByHour() {
 		std = math.Sqrt(std)
 		statsByHour[hour] = distribution{mean, std}
 	}
+	return statsByHour
 }
 
-// generateRandomReading genera una lettura randomica basata sulla distribuzione
-func generateRandomReading(datetime time.Time) sensorReading {
-	stats := statsByHour[datetime.Hour()]
-	logger.Log.Debug("Generating random reading for hour: ", datetime.Hour(), " with mean: ", stats.Mean, " and std: ", stats.Std)
+// generateRandomReading genera una lettura randomica basata sulla distribuzione.
+// Restituisce anche il guasto iniettato (dato mancante o outlier) e il valore che la lettura avrebbe avuto senza guasto.
+func generateRandomReading(channel *channelState, datetime time.Time) (sensorReading, types.FaultType, float64) {
+	stats := channel.statsByHour[datetime.Hour()]
+	logger.Log.Debug("Generating random ", channel.config.Type, " reading for hour: ", datetime.Hour(), " with mean: ", stats.Mean, " and std: ", stats.Std)
 
 	if stats.Mean == 0 {
 		// Nessun dato per questa ora, ritorna un valore nullo
-		logger.Log.Warn("No data available for hour: ", datetime.Hour(), " - removing CSV and restarting simulation")
-		err := removeCSV()
+		logger.Log.Warn("No ", channel.config.Type, " data available for hour: ", datetime.Hour(), " - discarding CSV and restarting simulation")
+		err := source.Discard()
 		if err != nil {
-			logger.Log.Error("Error removing CSV: ", err)
+			logger.Log.Error("Error discarding CSV: ", err)
 		}
 		os.Exit(1)
 	}
 
-	if rand.Float64() < simulation.MISSING_PROBABILITY {
+	if rng.Float64() < MissingProbability() {
 		logger.Log.Info("Generating missing value")
-		return sensorReading{}
+		return sensorReading{}, types.MissingFault, 0
 	}
 
 	// Genera un valore casuale basato sulla distribuzione normale
-	tmp := rand.NormFloat64() * stats.Std
+	tmp := rng.NormFloat64() * stats.Std
+	original := tmp + stats.Mean
+	var fault types.FaultType
 
 	// Aggiunge un outlier con una probabilità definita
-	if rand.Float64() < simulation.OUTLIER_PROBABILITY {
+	if rng.Float64() < OutlierProbability() {
 		logger.Log.Info("Generating outlier")
 		tmp *= simulation.OUTLIER_MULTIPLIER // Moltiplica per il moltiplicatore per generare un outlier
 		tmp += simulation.OUTLIER_ADDITION   // Aggiunge un valore per aumentare il centro dell'outlier
+		fault = types.OutlierFault
 	}
 
 	// Aggiunge la media per centrare il valore
@@ -121,5 +143,5 @@ func generateRandomReading(datetime time.Time) sensorReading {
 	return sensorReading{
 		Timestamp: datetime,
 		Value:     tmp,
-	}
+	}, fault, original
 }
@@ -6,7 +6,6 @@ import (
 	"SensorContinuum/pkg/logger"
 	"fmt"
 	"io"
-	"math/rand"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -71,7 +70,7 @@ func downloadRandomCSV() (string, error) {
 		return "", fmt.Errorf("no CSV file found on page")
 	}
 
-	selected := matches[rand.Intn(len(matches))][1]
+	selected := matches[rng.Intn(len(matches))][1]
 	csvURL := fmt.Sprintf("https://archive.sensor.community/%s/%s", date, selected)
 	filePath := filepath.Join(simulation.CSV_DIR, date+".csv")
 
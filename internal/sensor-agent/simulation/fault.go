@@ -0,0 +1,125 @@
+package simulation
+
+import (
+	"SensorContinuum/configs/simulation"
+	"SensorContinuum/internal/sensor-agent/environment"
+	"SensorContinuum/pkg/logger"
+	"SensorContinuum/pkg/types"
+	"time"
+)
+
+// generatedData contiene una lettura generata, l'eventuale guasto iniettato dal generatore
+// (dato mancante o outlier) e il valore che la lettura avrebbe avuto senza guasto.
+type generatedData struct {
+	data          types.SensorData
+	fault         types.FaultType
+	originalValue float64
+}
+
+// faultInjector inietta nelle letture generate i guasti configurati in SimulationFaults.
+// Un solo guasto alla volta può essere attivo: finché resta attivo, non se ne innescano altri.
+type faultInjector struct {
+	active    types.FaultType
+	remaining int
+	// config contiene i parametri del guasto attivo
+	config types.FaultConfig
+
+	// drift è lo scostamento accumulato dal guasto drift
+	drift float64
+	// stuckValue è il valore su cui resta bloccato il guasto stuck
+	stuckValue float64
+
+	// lastValue è l'ultimo valore generato senza guasti
+	lastValue float64
+	hasLast   bool
+}
+
+// start innesca, con la probabilità configurata, il primo guasto estratto tra quelli di SimulationFaults.
+func (f *faultInjector) start(current float64) {
+	for _, fault := range environment.SimulationFaults {
+		if rng.Float64() < fault.Probability {
+			logger.Log.Info("Starting fault: ", fault.Type)
+			f.active = fault.Type
+			f.config = fault
+			f.remaining = max(fault.Length, 1)
+			f.drift = 0
+			f.stuckValue = current
+			if f.hasLast {
+				f.stuckValue = f.lastValue
+			}
+			return
+		}
+	}
+}
+
+// inject applica alla lettura generata il guasto attivo, innescandone uno nuovo se nessuno è attivo.
+// Restituisce le letture da inviare (nessuna per un dato mancante, due per un duplicato)
+// e le etichette dei guasti, con il timestamp e il valore originali.
+// std è la deviazione standard delle letture, utilizzata per dimensionare deriva e outlier.
+func (f *faultInjector) inject(generated generatedData, std float64) ([]types.SensorData, []types.FaultLabel) {
+	data := generated.data
+
+	if generated.fault == types.MissingFault {
+		data.Timestamp = time.Now().UTC().Unix()
+		return nil, []types.FaultLabel{newFaultLabel(types.MissingFault, data, data.Timestamp, generated.originalValue)}
+	}
+
+	var labels []types.FaultLabel
+	if generated.fault == types.OutlierFault {
+		labels = append(labels, newFaultLabel(types.OutlierFault, data, data.Timestamp, generated.originalValue))
+	}
+
+	if f.remaining == 0 {
+		f.active = ""
+		f.start(generated.originalValue)
+	}
+
+	f.lastValue = generated.originalValue
+	f.hasLast = true
+
+	if f.active == "" {
+		return []types.SensorData{data}, labels
+	}
+
+	originalTimestamp, originalValue := data.Timestamp, data.Data
+	sensorDataList := []types.SensorData{data}
+
+	switch f.active {
+	case types.StuckFault:
+		sensorDataList[0].Data = f.stuckValue
+		labels = nil // il valore generato, anche se outlier, viene sostituito
+	case types.DriftFault:
+		f.drift += f.config.Step * std
+		sensorDataList[0].Data += f.drift
+	case types.BurstFault:
+		sensorDataList[0].Data += rng.NormFloat64()*std*f.config.Multiplier + simulation.OUTLIER_ADDITION
+	case types.ClockSkewFault:
+		sensorDataList[0].Timestamp += f.config.Skew
+	case types.OutOfOrderFault:
+		delay := int64(float64(f.config.Delay) * SamplingInterval().Seconds())
+		sensorDataList[0].Timestamp -= max(delay, 1)
+	case types.DuplicateFault:
+		sensorDataList = append(sensorDataList, sensorDataList[0])
+	case types.FlatLineFault:
+		sensorDataList[0].Data = 0
+		labels = nil // il valore generato, anche se outlier, viene sostituito
+	}
+
+	labels = append(labels, newFaultLabel(f.active, sensorDataList[0], originalTimestamp, originalValue))
+	f.remaining--
+	return sensorDataList, labels
+}
+
+// newFaultLabel crea l'etichetta di una lettura alterata da un guasto.
+func newFaultLabel(fault types.FaultType, data types.SensorData, originalTimestamp int64, originalValue float64) types.FaultLabel {
+	return types.FaultLabel{
+		EdgeMacrozone:     data.EdgeMacrozone,
+		EdgeZone:          data.EdgeZone,
+		SensorID:          data.SensorID,
+		Fault:             fault,
+		Timestamp:         data.Timestamp,
+		Value:             data.Data,
+		OriginalTimestamp: originalTimestamp,
+		OriginalValue:     originalValue,
+	}
+}
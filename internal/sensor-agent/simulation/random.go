@@ -0,0 +1,17 @@
+package simulation
+
+import (
+	"math/rand"
+	"time"
+)
+
+// rng è il generatore casuale della simulazione, utilizzato per il rumore, i dati mancanti,
+// gli outlier e la scelta del file CSV. Non è sicuro per l'uso concorrente:
+// viene utilizzato solo dalla goroutine della simulazione.
+var rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// SetSeed reinizializza il generatore casuale della simulazione con il seed indicato,
+// così la stessa sorgente dati produce la stessa sequenza di letture.
+func SetSeed(seed int64) {
+	rng = rand.New(rand.NewSource(seed))
+}
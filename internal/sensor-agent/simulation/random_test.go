@@ -0,0 +1,61 @@
+package simulation
+
+import (
+	"SensorContinuum/pkg/types"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type randomReading struct {
+	value    float64
+	fault    types.FaultType
+	original float64
+}
+
+// randomSequence genera n letture casuali del canale a partire dal seed indicato.
+func randomSequence(channel *channelState, seed int64, n int) []randomReading {
+	SetSeed(seed)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sequence := make([]randomReading, 0, n)
+	for i := 0; i < n; i++ {
+		reading, fault, original := generateRandomReading(channel, start.Add(time.Duration(i)*5*time.Minute))
+		sequence = append(sequence, randomReading{value: reading.Value, fault: fault, original: original})
+	}
+	return sequence
+}
+
+func TestGenerateRandomReadingSeed(t *testing.T) {
+	channel := setupSample(t)
+	SetMissingProbability(0.1)
+	SetOutlierProbability(0.1)
+
+	first := randomSequence(channel, 42, 288)
+	if second := randomSequence(channel, 42, 288); !reflect.DeepEqual(first, second) {
+		t.Fatal("the same seed generated different sequences")
+	}
+	if other := randomSequence(channel, 43, 288); reflect.DeepEqual(first, other) {
+		t.Fatal("different seeds generated the same sequence")
+	}
+
+	// Con queste probabilità la sequenza contiene sia dati mancanti che outlier
+	faults := make(map[types.FaultType]int)
+	for _, reading := range first {
+		faults[reading.fault]++
+	}
+	if faults[types.MissingFault] == 0 || faults[types.OutlierFault] == 0 {
+		t.Errorf("faults in 288 readings = %v, want missing values and outliers", faults)
+	}
+}
+
+func TestGenerateRandomReadingWithoutFaults(t *testing.T) {
+	channel := setupSample(t)
+	SetMissingProbability(0)
+	SetOutlierProbability(0)
+
+	for _, reading := range randomSequence(channel, 42, 288) {
+		if reading.fault != "" || reading.value != reading.original {
+			t.Fatalf("reading without faults = %+v", reading)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package simulation
+
+import (
+	"SensorContinuum/configs/simulation"
+	"SensorContinuum/internal/sensor-agent/environment"
+	"SensorContinuum/pkg/logger"
+	"SensorContinuum/pkg/types"
+	"time"
+)
+
+// nextReplayData restituisce la prossima riga del CSV per il canale, con il timestamp corrente,
+// e l'attesa prima della riga successiva: l'intervallo tra i timestamp originali diviso SimulationReplaySpeed.
+// Dati mancanti e outlier vengono iniettati con le stesse probabilità della modalità random.
+// Restituisce false quando tutte le righe sono state inviate.
+func nextReplayData(channel *channelState) (generatedData, time.Duration, bool) {
+	if channel.replayIndex >= len(channel.readings) {
+		return generatedData{}, 0, false
+	}
+
+	reading := channel.readings[channel.replayIndex]
+	channel.replayIndex++
+
+	// Attesa prima della riga successiva; l'ultima riga usa l'intervallo di campionamento
+	wait := SamplingInterval()
+	if channel.replayIndex < len(channel.readings) {
+		gap := channel.readings[channel.replayIndex].Timestamp.Sub(reading.Timestamp)
+		wait = time.Duration(float64(max(gap, 0)) / environment.SimulationReplaySpeed)
+	}
+
+	sensorData := types.SensorData{
+		EdgeMacrozone: environment.EdgeMacrozone,
+		EdgeZone:      environment.EdgeZone,
+		SensorID:      channel.config.SensorID,
+		Type:          string(channel.config.Type),
+		Data:          reading.Value,
+	}
+
+	if rng.Float64() < MissingProbability() {
+		logger.Log.Info("Generating missing value")
+		return generatedData{data: sensorData, fault: types.MissingFault, originalValue: reading.Value}, wait, true
+	}
+
+	// Aggiunge un outlier con una probabilità definita, in base alla deviazione standard dell'ora
+	var fault types.FaultType
+	if rng.Float64() < OutlierProbability() {
+		logger.Log.Info("Generating outlier")
+		stats := channel.statsByHour[reading.Timestamp.Hour()]
+		sensorData.Data += rng.NormFloat64()*stats.Std*simulation.OUTLIER_MULTIPLIER + simulation.OUTLIER_ADDITION
+		fault = types.OutlierFault
+	}
+
+	sensorData.Timestamp = time.Now().UTC().Unix()
+	return generatedData{data: sensorData, fault: fault, originalValue: reading.Value}, wait, true
+}
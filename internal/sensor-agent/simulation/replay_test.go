@@ -0,0 +1,87 @@
+package simulation
+
+import (
+	"SensorContinuum/internal/sensor-agent/environment"
+	"SensorContinuum/pkg/types"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type replayReading struct {
+	value    float64
+	fault    types.FaultType
+	original float64
+	wait     time.Duration
+}
+
+// replaySequence riproduce tutte le righe del canale dall'inizio, a partire dal seed indicato.
+func replaySequence(t *testing.T, channel *channelState, seed int64) []replayReading {
+	t.Helper()
+	SetSeed(seed)
+	channel.replayIndex = 0
+	var sequence []replayReading
+	for {
+		generated, wait, ok := nextReplayData(channel)
+		if !ok {
+			return sequence
+		}
+		if generated.data.SensorID != "sensor-1" || generated.data.Type != string(environment.Temperature) {
+			t.Fatalf("replayed reading = %+v", generated.data)
+		}
+		sequence = append(sequence, replayReading{value: generated.data.Data, fault: generated.fault, original: generated.originalValue, wait: wait})
+	}
+}
+
+func TestNextReplayData(t *testing.T) {
+	channel := setupSample(t)
+	SetMissingProbability(0)
+	SetOutlierProbability(0)
+	environment.SimulationReplaySpeed = 60
+
+	sequence := replaySequence(t, channel, 42)
+	if len(sequence) != len(channel.readings) {
+		t.Fatalf("replayed %d readings, want %d", len(sequence), len(channel.readings))
+	}
+
+	// Le righe vengono inviate nell'ordine del CSV e l'intervallo di 5 minuti è accelerato 60 volte
+	for i, reading := range sequence {
+		if reading.value != channel.readings[i].Value || reading.fault != "" {
+			t.Fatalf("reading %d = %+v, want value %v", i, reading, channel.readings[i].Value)
+		}
+		want := 5 * time.Second
+		if i == len(sequence)-1 {
+			want = SamplingInterval()
+		}
+		if reading.wait != want {
+			t.Fatalf("wait after reading %d = %v, want %v", i, reading.wait, want)
+		}
+	}
+
+	if _, _, ok := nextReplayData(channel); ok {
+		t.Fatal("nextReplayData returned a reading after the end of the CSV")
+	}
+}
+
+func TestNextReplayDataSeed(t *testing.T) {
+	channel := setupSample(t)
+	SetMissingProbability(0.1)
+	SetOutlierProbability(0.1)
+
+	first := replaySequence(t, channel, 42)
+	if second := replaySequence(t, channel, 42); !reflect.DeepEqual(first, second) {
+		t.Fatal("the same seed replayed different sequences")
+	}
+
+	// I guasti iniettati non alterano l'ordine delle righe
+	faults := make(map[types.FaultType]int)
+	for i, reading := range first {
+		faults[reading.fault]++
+		if reading.original != channel.readings[i].Value {
+			t.Fatalf("original value of reading %d = %v, want %v", i, reading.original, channel.readings[i].Value)
+		}
+	}
+	if faults[types.MissingFault] == 0 || faults[types.OutlierFault] == 0 {
+		t.Errorf("faults in %d readings = %v, want missing values and outliers", len(first), faults)
+	}
+}
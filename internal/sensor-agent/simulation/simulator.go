@@ -1,7 +1,7 @@
 package simulation
 
 import (
-	"SensorContinuum/configs/simulation"
+	"SensorContinuum/internal/sensor-agent/environment"
 	"SensorContinuum/pkg/types"
 	"os"
 	"time"
@@ -11,30 +11,41 @@ import (
 
 const infiniteValue = -1234
 
+// source è la sorgente dati da cui viene letto il file CSV della simulazione corrente.
+var source DataSource
+
 func setupSimulator() error {
 
-	// Scarica un file CSV random della data attuale meno 2 giorni
-	filePath, err := downloadRandomCSV()
-	if err != nil {
-		logger.Log.Error("Error downloading random CSV: ", err)
-		return err
-	} else {
-		logger.Log.Info("CSV file downloaded successfully: ", filePath)
-	}
+	// Inizializza la sorgente dati: di default scarica un file CSV random della data attuale meno 2 giorni
+	source = NewDataSource()
+	logger.Log.Info("Using data source: ", source.Name())
 
-	// Inizializza la distribuzione con il file CSV scaricato
-	err = setupDistribution(filePath)
+	// Inizializza la distribuzione con il file CSV della sorgente
+	err := setupDistribution(source)
 	if err != nil {
 		logger.Log.Error("Error setting up distribution: ", err)
 		return err
 	} else {
-		logger.Log.Info("Distribution setup successfully with file: ", filePath)
+		for _, channel := range channels {
+			logger.Log.Info("Distribution setup successfully for channel ", channel.config.Type, " with ", len(channel.readings), " readings from data source: ", source.Name())
+		}
 	}
 
 	return nil
 }
 
-func Simulate(nValue int, dataChannel chan types.SensorData) error {
+// nextSensorData restituisce la prossima lettura del canale e l'attesa prima della successiva, in base a SimulationMode.
+// Restituisce false se non ci sono altre letture (solo in modalità replay).
+func nextSensorData(channel *channelState) (generatedData, time.Duration, bool) {
+	if environment.SimulationMode == environment.ReplayMode {
+		return nextReplayData(channel)
+	}
+	return generateSensorData(channel), SamplingInterval(), true
+}
+
+// Simulate genera nValue letture (o infinite, con infiniteValue) e le invia su dataChannel.
+// Se labelChannel non è nil, vi invia le etichette delle letture alterate dai guasti iniettati.
+func Simulate(nValue int, dataChannel chan types.SensorData, labelChannel chan types.FaultLabel) error {
 
 	err := setupSimulator()
 	if err != nil {
@@ -50,15 +61,52 @@ func Simulate(nValue int, dataChannel chan types.SensorData) error {
 
 	for nValue == infiniteValue || nValue > 0 {
 
-		sensorData := generateSensorData()
+		// Se è stato richiesto il riavvio, termina la simulazione corrente
+		if rebootRequested.CompareAndSwap(true, false) {
+			logger.Log.Info("Reboot requested, restarting simulation...")
+			return nil
+		}
 
-		logger.Log.Info("Sensor reading: ", sensorData.Data)
+		// Se la simulazione è in pausa, non genera letture
+		if IsPaused() {
+			time.Sleep(SamplingInterval())
+			continue
+		}
 
-		if dataChannel != nil && sensorData.Timestamp > 0 {
-			select {
-			case dataChannel <- sensorData:
-			default:
-				logger.Log.Error("Channel is full, skipping sending value: ", sensorData.Data)
+		// Genera una lettura per ogni canale; l'attesa prima della successiva è quella del primo canale
+		wait := SamplingInterval()
+		for i, channel := range channels {
+			generated, channelWait, ok := nextSensorData(channel)
+			if !ok {
+				logger.Log.Info("All CSV rows replayed, restarting simulation...")
+				return nil
+			}
+			if i == 0 {
+				wait = channelWait
+			}
+
+			sensorDataList, labels := channel.injector.inject(generated, channel.std())
+
+			for _, sensorData := range sensorDataList {
+				logger.Log.Info("Sensor reading (", sensorData.Type, "): ", sensorData.Data)
+
+				if dataChannel != nil && sensorData.Timestamp > 0 {
+					select {
+					case dataChannel <- sensorData:
+					default:
+						logger.Log.Error("Channel is full, skipping sending value: ", sensorData.Data)
+					}
+				}
+			}
+
+			if labelChannel != nil {
+				for _, label := range labels {
+					select {
+					case labelChannel <- label:
+					default:
+						logger.Log.Error("Label channel is full, skipping fault label: ", label.Fault)
+					}
+				}
 			}
 		}
 
@@ -66,7 +114,7 @@ func Simulate(nValue int, dataChannel chan types.SensorData) error {
 			nValue--
 		}
 
-		time.Sleep(simulation.TIMEOUT * time.Millisecond)
+		time.Sleep(wait)
 
 	}
 
@@ -74,10 +122,14 @@ func Simulate(nValue int, dataChannel chan types.SensorData) error {
 	return nil
 }
 
-func SimulateForever(dataChannel chan types.SensorData) {
+func SimulateForever(dataChannel chan types.SensorData, labelChannel chan types.FaultLabel) {
 	logger.Log.Info("Starting sensor simulator loop...")
+	if environment.SimulationSeeded {
+		logger.Log.Info("Using simulation seed: ", environment.SimulationSeed)
+		SetSeed(environment.SimulationSeed)
+	}
 	for {
-		if err := Simulate(infiniteValue, dataChannel); err != nil {
+		if err := Simulate(infiniteValue, dataChannel, labelChannel); err != nil {
 			logger.Log.Error("Error during simulation: ", err)
 			os.Exit(1)
 		}
@@ -0,0 +1,107 @@
+package simulation
+
+import (
+	"SensorContinuum/internal/sensor-agent/environment"
+	"SensorContinuum/pkg/logger"
+	"embed"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// sampleFS contiene il dataset di esempio, con 24 ore di letture di temperatura, umidità e pressione.
+// Usa il separatore e il formato del timestamp di default.
+//
+//go:embed sample/sample.csv
+var sampleFS embed.FS
+
+// DataSource fornisce il contenuto CSV da cui il simulatore ricava le letture.
+type DataSource interface {
+	// Name restituisce il nome della sorgente, utilizzato nei log.
+	Name() string
+	// Open restituisce il contenuto CSV da leggere.
+	Open() (io.ReadCloser, error)
+	// Discard segnala che i dati restituiti da Open non sono utilizzabili (es. mancano le letture di un'ora),
+	// così la sorgente può fornire dati diversi al riavvio.
+	Discard() error
+}
+
+// NewDataSource crea la sorgente dati indicata da SimulationDataSource.
+func NewDataSource() DataSource {
+	switch environment.SimulationDataSource {
+	case environment.LocalDataSource:
+		return &LocalDataSource{Dir: environment.SimulationDataDir}
+	case environment.EmbeddedDataSource:
+		return &EmbeddedDataSource{}
+	default:
+		return &DownloadDataSource{}
+	}
+}
+
+// DownloadDataSource scarica un file CSV casuale dall'archivio di sensor.community
+// e lo conserva nella cartella CSV_DIR fino al giorno successivo.
+type DownloadDataSource struct{}
+
+func (s *DownloadDataSource) Name() string {
+	return string(environment.DownloadDataSource)
+}
+
+func (s *DownloadDataSource) Open() (io.ReadCloser, error) {
+	filePath, err := downloadRandomCSV()
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(filePath)
+}
+
+func (s *DownloadDataSource) Discard() error {
+	return removeCSV()
+}
+
+// LocalDataSource legge un file CSV, scelto a caso, da una directory locale.
+// Non richiede l'accesso alla rete e i file non vengono mai rimossi.
+type LocalDataSource struct {
+	Dir string
+}
+
+func (s *LocalDataSource) Name() string {
+	return string(environment.LocalDataSource)
+}
+
+func (s *LocalDataSource) Open() (io.ReadCloser, error) {
+	files, err := filepath.Glob(filepath.Join(s.Dir, "*.csv"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no CSV file found in %s", s.Dir)
+	}
+
+	// Ordina i file per rendere la scelta riproducibile a parità di seed
+	sort.Strings(files)
+	selected := files[rng.Intn(len(files))]
+	logger.Log.Info("Using local CSV file: ", selected)
+	return os.Open(selected)
+}
+
+func (s *LocalDataSource) Discard() error {
+	logger.Log.Warn("Local CSV files in ", s.Dir, " are not removed")
+	return nil
+}
+
+// EmbeddedDataSource legge il dataset di esempio incluso nel binario.
+type EmbeddedDataSource struct{}
+
+func (s *EmbeddedDataSource) Name() string {
+	return string(environment.EmbeddedDataSource)
+}
+
+func (s *EmbeddedDataSource) Open() (io.ReadCloser, error) {
+	return sampleFS.Open("sample/sample.csv")
+}
+
+func (s *EmbeddedDataSource) Discard() error {
+	return nil
+}
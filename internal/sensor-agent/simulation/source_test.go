@@ -0,0 +1,116 @@
+package simulation
+
+import (
+	"SensorContinuum/internal/sensor-agent/environment"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setupSample configura il simulatore con un canale di temperatura sul dataset di esempio,
+// ripristinando la configurazione al termine del test.
+func setupSample(t *testing.T) *channelState {
+	t.Helper()
+	separator, format, column := environment.SimulationSeparator, environment.SimulationTimestampFormat, environment.SimulationTimestampColumn
+	previousChannels, previousSpeed := environment.SensorChannels, environment.SimulationReplaySpeed
+	missing, outlier := MissingProbability(), OutlierProbability()
+	t.Cleanup(func() {
+		environment.SimulationSeparator, environment.SimulationTimestampFormat, environment.SimulationTimestampColumn = separator, format, column
+		environment.SensorChannels, environment.SimulationReplaySpeed = previousChannels, previousSpeed
+		SetMissingProbability(missing)
+		SetOutlierProbability(outlier)
+		channels = nil
+	})
+
+	environment.SimulationSeparator = ';'
+	environment.SimulationTimestampFormat = "2006-01-02T15:04:05"
+	environment.SimulationTimestampColumn = "timestamp"
+	environment.SensorChannels = []environment.Channel{{Type: environment.Temperature, ValueColumn: "temperature", SensorID: "sensor-1"}}
+
+	if err := setupDistribution(&EmbeddedDataSource{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(channels) != 1 {
+		t.Fatalf("setupDistribution created %d channels, want 1", len(channels))
+	}
+	return channels[0]
+}
+
+// readSource restituisce il contenuto CSV fornito dalla sorgente.
+func readSource(t *testing.T, source DataSource) string {
+	t.Helper()
+	content, err := source.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer content.Close()
+	data, err := io.ReadAll(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestEmbeddedDataSource(t *testing.T) {
+	channel := setupSample(t)
+
+	// Il dataset di esempio copre 24 ore con una lettura ogni 5 minuti
+	if len(channel.readings) != 288 {
+		t.Fatalf("embedded sample has %d readings, want 288", len(channel.readings))
+	}
+	if channel.readings[0].Value != 18.48 || channel.readings[1].Value != 18.68 {
+		t.Errorf("first readings = %v, %v; want 18.48, 18.68", channel.readings[0].Value, channel.readings[1].Value)
+	}
+	for hour := 0; hour < 24; hour++ {
+		if channel.statsByHour[hour].Mean == 0 {
+			t.Errorf("embedded sample has no readings for hour %d", hour)
+		}
+	}
+}
+
+func TestLocalDataSource(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.csv", "b.csv", "c.csv", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	source := &LocalDataSource{Dir: dir}
+
+	// A parità di seed viene scelto sempre lo stesso file, e mai un file diverso da un CSV
+	chosen := make(map[string]bool)
+	for seed := int64(0); seed < 20; seed++ {
+		SetSeed(seed)
+		first := readSource(t, source)
+		SetSeed(seed)
+		if second := readSource(t, source); second != first {
+			t.Fatalf("seed %d chose %q and then %q", seed, first, second)
+		}
+		if !strings.HasSuffix(first, ".csv") {
+			t.Fatalf("seed %d chose %q, want a CSV file", seed, first)
+		}
+		chosen[first] = true
+	}
+	if len(chosen) < 2 {
+		t.Errorf("20 seeds chose only %v", chosen)
+	}
+
+	if err := source.Discard(); err != nil {
+		t.Errorf("Discard = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.csv")); err != nil {
+		t.Errorf("Discard removed the local files: %v", err)
+	}
+}
+
+func TestLocalDataSourceEmpty(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&LocalDataSource{Dir: dir}).Open(); err == nil {
+		t.Fatal("Open on a directory without CSV files succeeded")
+	}
+}
@@ -3,26 +3,24 @@ package simulation
 import (
 	"SensorContinuum/internal/sensor-agent/environment"
 	"encoding/csv"
-	"os"
+	"io"
 	"strconv"
 	"time"
 )
 
-func parseCSV(filePath string) ([]sensorReading, error) {
-	f, err := os.Open(filePath)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-
-	r := csv.NewReader(f)
+// parseCSV legge dal contenuto CSV le letture delle colonne indicate, mantenendo l'ordine originale delle righe.
+// Le righe senza un valore numerico in una colonna vengono scartate solo per quella colonna.
+func parseCSV(content io.Reader, columns []string) (map[string][]sensorReading, error) {
+	r := csv.NewReader(content)
 	r.Comma = environment.SimulationSeparator
 	records, err := r.ReadAll()
 	if err != nil {
 		return nil, err
 	}
+
+	res := make(map[string][]sensorReading, len(columns))
 	if len(records) < 2 {
-		return nil, nil // nessun dato
+		return res, nil // nessun dato
 	}
 
 	// Mappa nome colonna -> indice
@@ -32,17 +30,17 @@ func parseCSV(filePath string) ([]sensorReading, error) {
 		colIndex[name] = i
 	}
 
-	var res []sensorReading
 	for _, rec := range records[1:] {
 		timestamp, _ := time.Parse(environment.SimulationTimestampFormat, rec[colIndex[environment.SimulationTimestampColumn]])
 
-		value := 0.0
-		if idx, ok := colIndex[environment.SimulationValueColumn]; ok {
-			if value, err = strconv.ParseFloat(rec[idx], 64); err == nil {
-				res = append(res, sensorReading{
-					Timestamp: timestamp,
-					Value:     value,
-				})
+		for _, column := range columns {
+			if idx, ok := colIndex[column]; ok {
+				if value, err := strconv.ParseFloat(rec[idx], 64); err == nil {
+					res[column] = append(res[column], sensorReading{
+						Timestamp: timestamp,
+						Value:     value,
+					})
+				}
 			}
 		}
 	}
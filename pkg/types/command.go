@@ -0,0 +1,214 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/segmentio/kafka-go"
+)
+
+// CommandType identifica il tipo di comando inviato dal cloud verso un sensore.
+type CommandType string
+
+const (
+	// SetSamplingIntervalCommand modifica l'intervallo di campionamento del sensore.
+	SetSamplingIntervalCommand CommandType = "set_sampling_interval"
+	// PauseCommand sospende l'invio delle letture.
+	PauseCommand CommandType = "pause"
+	// ResumeCommand riprende l'invio delle letture dopo una pausa.
+	ResumeCommand CommandType = "resume"
+	// RebootCommand riavvia la simulazione del sensore.
+	RebootCommand CommandType = "reboot"
+)
+
+// CommandStatus identifica lo stato di un comando lungo il percorso verso il sensore.
+// Il percorso è: pending → dispatched → delivered → executed/failed.
+// Un comando non concluso entro il tempo massimo diventa expired.
+type CommandStatus string
+
+const (
+	// CommandPending indica un comando salvato nel database dei metadati della regione e non ancora inoltrato.
+	CommandPending CommandStatus = "pending"
+	// CommandDispatched indica un comando inoltrato dall'Intermediate Fog Hub su Kafka.
+	CommandDispatched CommandStatus = "dispatched"
+	// CommandDelivered indica un comando consegnato dall'Edge Hub al broker dei sensori.
+	CommandDelivered CommandStatus = "delivered"
+	// CommandExecuted indica un comando eseguito dal sensore.
+	CommandExecuted CommandStatus = "executed"
+	// CommandFailed indica un comando rifiutato dal sensore o dall'Edge Hub.
+	CommandFailed CommandStatus = "failed"
+	// CommandExpired indica un comando non concluso entro il tempo massimo.
+	CommandExpired CommandStatus = "expired"
+)
+
+// Rank restituisce la posizione dello stato nel percorso del comando.
+// Lo stato di un comando può solo avanzare verso stati con rank maggiore.
+func (s CommandStatus) Rank() int {
+	switch s {
+	case CommandPending:
+		return 0
+	case CommandDispatched:
+		return 1
+	case CommandDelivered:
+		return 2
+	case CommandExecuted, CommandFailed, CommandExpired:
+		return 3
+	default:
+		return -1
+	}
+}
+
+// PrecedingCommandStatuses restituisce gli stati da cui un comando può passare allo stato s.
+func PrecedingCommandStatuses(s CommandStatus) []CommandStatus {
+	statuses := make([]CommandStatus, 0)
+	for _, prev := range []CommandStatus{CommandPending, CommandDispatched, CommandDelivered} {
+		if prev.Rank() < s.Rank() {
+			statuses = append(statuses, prev)
+		}
+	}
+	return statuses
+}
+
+// SensorCommand contiene un comando per un sensore, creato tramite API e inoltrato
+// dal database dei metadati della regione fino al Sensor Agent.
+type SensorCommand struct {
+	ID               string      `json:"id"`
+	EdgeMacrozone    string      `json:"macrozone"`
+	EdgeZone         string      `json:"zone"`
+	SensorID         string      `json:"sensor_id"`
+	Type             CommandType `json:"type"`
+	SamplingInterval int64       `json:"sampling_interval,omitempty"` // in millisecondi, solo per set_sampling_interval
+	Timestamp        int64       `json:"timestamp"`
+
+	KafkaMsg kafka.Message `json:"-"`
+	MQTTMsg  MQTT.Message  `json:"-"`
+}
+
+// Validate controlla che il comando sia di un tipo noto e che abbia i parametri richiesti.
+func (c SensorCommand) Validate() error {
+	switch c.Type {
+	case SetSamplingIntervalCommand:
+		if c.SamplingInterval <= 0 {
+			return errors.New("sampling_interval must be greater than zero")
+		}
+	case PauseCommand, ResumeCommand, RebootCommand:
+	default:
+		return errors.New("unknown command type: " + string(c.Type))
+	}
+	return nil
+}
+
+func CreateSensorCommandFromKafka(msg kafka.Message) (SensorCommand, error) {
+	var command SensorCommand
+	err := json.Unmarshal(msg.Value, &command)
+	command.KafkaMsg = msg
+	return command, err
+}
+
+// CreateSensorCommandFromMQTT converte un messaggio MQTT in un comando.
+// I messaggi vuoti, usati per rimuovere i comandi conservati dal broker, restituiscono un comando senza ID.
+func CreateSensorCommandFromMQTT(msg MQTT.Message) (SensorCommand, error) {
+	var command SensorCommand
+
+	if msg == nil || len(msg.Payload()) == 0 {
+		return SensorCommand{}, nil
+	}
+
+	err := json.Unmarshal(msg.Payload(), &command)
+	command.MQTTMsg = msg
+	return command, err
+}
+
+// CommandAck contiene la conferma di un passaggio di stato di un comando,
+// inviata dall'Edge Hub o dal Sensor Agent e inoltrata fino al database dei metadati della regione.
+type CommandAck struct {
+	CommandID     string        `json:"command_id"`
+	EdgeMacrozone string        `json:"macrozone"`
+	EdgeZone      string        `json:"zone"`
+	SensorID      string        `json:"sensor_id"`
+	HubID         string        `json:"hub_id,omitempty"`
+	Status        CommandStatus `json:"status"`
+	Detail        string        `json:"detail,omitempty"`
+	Timestamp     int64         `json:"timestamp"`
+
+	KafkaMsg kafka.Message `json:"-"`
+	MQTTMsg  MQTT.Message  `json:"-"`
+}
+
+// NewCommandAck crea la conferma di un comando con lo stato indicato.
+func NewCommandAck(command SensorCommand, status CommandStatus, detail string) CommandAck {
+	return CommandAck{
+		CommandID:     command.ID,
+		EdgeMacrozone: command.EdgeMacrozone,
+		EdgeZone:      command.EdgeZone,
+		SensorID:      command.SensorID,
+		Status:        status,
+		Detail:        detail,
+		Timestamp:     time.Now().UTC().Unix(),
+	}
+}
+
+func CreateCommandAckFromMQTT(msg MQTT.Message) (CommandAck, error) {
+	var ack CommandAck
+	err := json.Unmarshal(msg.Payload(), &ack)
+	ack.MQTTMsg = msg
+	return ack, err
+}
+
+func CreateCommandAckFromKafka(msg kafka.Message) (CommandAck, error) {
+	var ack CommandAck
+	err := json.Unmarshal(msg.Value, &ack)
+	ack.KafkaMsg = msg
+	return ack, err
+}
+
+type CommandAckBatch struct {
+	engine *BatchEngine[CommandAck]
+}
+
+func NewCommandAckBatch(maxCount int, timeout time.Duration, save func(*CommandAckBatch) error) (*CommandAckBatch, error) {
+	cab := &CommandAckBatch{}
+	var err error
+	cab.engine, err = NewBatchEngine(maxCount, timeout, func(engine *BatchEngine[CommandAck]) error {
+		return save(cab)
+	})
+	return cab, err
+}
+
+func (cab *CommandAckBatch) AddCommandAck(ack CommandAck) {
+	cab.engine.Add(ack)
+}
+
+func (cab *CommandAckBatch) Count() int {
+	return cab.engine.Count()
+}
+
+func (cab *CommandAckBatch) Items() []CommandAck {
+	return cab.engine.Items()
+}
+
+func (cab *CommandAckBatch) GetKafkaMessages() []kafka.Message {
+	messages := make([]kafka.Message, 0, cab.Count())
+	for _, a := range cab.Items() {
+		if a.KafkaMsg.Value != nil {
+			messages = append(messages, a.KafkaMsg)
+		}
+	}
+	return messages
+}
+
+// SensorCommandInfo contiene un comando e il suo stato corrente, come restituito dalle API.
+type SensorCommandInfo struct {
+	ID               string        `json:"id"`
+	MacrozoneName    string        `json:"macrozone_name"`
+	ZoneName         string        `json:"zone_name"`
+	SensorID         string        `json:"sensor_id"`
+	Type             CommandType   `json:"type"`
+	SamplingInterval int64         `json:"sampling_interval,omitempty"`
+	Status           CommandStatus `json:"status"`
+	Detail           string        `json:"detail,omitempty"`
+	CreatedAt        time.Time     `json:"created_at"`
+	UpdatedAt        time.Time     `json:"updated_at"`
+}
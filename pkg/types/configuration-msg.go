@@ -18,6 +18,9 @@ const (
 )
 
 type ConfigurationMsg struct {
+	// SchemaVersion è la versione dello schema del messaggio, vedi ConfigurationMsgSchemaVersion
+	SchemaVersion int `json:"schema_version,omitempty"`
+
 	MsgType         MsgType `json:"msg_type,omitempty"`
 	Service         Service `json:"service,omitempty"`
 	Timestamp       int64   `json:"timestamp,omitempty"`
@@ -29,17 +32,58 @@ type ConfigurationMsg struct {
 	SensorType      string  `json:"sensor_type,omitempty"`
 	SensorReference string  `json:"sensor_reference,omitempty"`
 
+	// Channels contiene i canali di misura di un Sensor Agent con più canali,
+	// ognuno registrato come un sensore distinto
+	Channels []SensorChannel `json:"channels,omitempty"`
+
+	// PublicKey è la chiave pubblica Ed25519, in base64, con cui il Sensor Agent firma le letture.
+	// Con più canali, tutti i canali usano la stessa chiave
+	PublicKey string `json:"public_key,omitempty"`
+
 	KafkaMsg kafka.Message `json:"-"`
 	MQTTMsg  mqtt.Message  `json:"-"`
 }
 
+// SensorChannel è un canale di misura di un Sensor Agent, con il proprio identificativo e tipo.
+type SensorChannel struct {
+	SensorID   string `json:"sensor_id"`
+	SensorType string `json:"sensor_type"`
+}
+
+// ChannelMessages restituisce un messaggio di configurazione per ogni canale del messaggio,
+// con l'identificativo e il tipo del canale. Se il messaggio non ha canali, restituisce il messaggio stesso.
+func (msg ConfigurationMsg) ChannelMessages() []ConfigurationMsg {
+	if len(msg.Channels) == 0 {
+		return []ConfigurationMsg{msg}
+	}
+
+	messages := make([]ConfigurationMsg, 0, len(msg.Channels))
+	for _, channel := range msg.Channels {
+		channelMsg := msg
+		channelMsg.SensorID = channel.SensorID
+		channelMsg.SensorType = channel.SensorType
+		channelMsg.Channels = nil
+		messages = append(messages, channelMsg)
+	}
+	return messages
+}
+
+// CreateConfigurationMsgFromKafka crea un messaggio di configurazione da un messaggio Kafka,
+// convertendolo alla versione corrente dello schema e validandolo.
 func CreateConfigurationMsgFromKafka(msg kafka.Message) (ConfigurationMsg, error) {
 	var confMsg ConfigurationMsg
 	err := json.Unmarshal(msg.Value, &confMsg)
 	confMsg.KafkaMsg = msg
-	return confMsg, err
+	if err != nil {
+		return confMsg, err
+	}
+	confMsg.Upgrade()
+	return confMsg, confMsg.Validate()
 }
 
+// CreateConfigurationMsgFromMqtt crea un messaggio di configurazione da un messaggio MQTT,
+// convertendolo alla versione corrente dello schema e validandolo.
+// I messaggi vuoti, usati per rimuovere i messaggi conservati dal broker, restituiscono un messaggio vuoto.
 func CreateConfigurationMsgFromMqtt(msg mqtt.Message) (ConfigurationMsg, error) {
 	var edgeConfMsg ConfigurationMsg
 
@@ -49,7 +93,11 @@ func CreateConfigurationMsgFromMqtt(msg mqtt.Message) (ConfigurationMsg, error)
 
 	err := json.Unmarshal(msg.Payload(), &edgeConfMsg)
 	edgeConfMsg.MQTTMsg = msg
-	return edgeConfMsg, err
+	if err != nil {
+		return edgeConfMsg, err
+	}
+	edgeConfMsg.Upgrade()
+	return edgeConfMsg, edgeConfMsg.Validate()
 }
 
 type ConfigurationMsgBatch struct {
@@ -0,0 +1,79 @@
+package types
+
+import (
+	"encoding/json"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/segmentio/kafka-go"
+)
+
+// EventSeverity indica la gravità di una lettura critica.
+type EventSeverity string
+
+const (
+	// CriticalSeverity indica una lettura oltre una soglia di attenzione (es. temperatura anomala).
+	CriticalSeverity EventSeverity = "critical"
+	// EmergencySeverity indica una lettura oltre una soglia di emergenza, che richiede un intervento immediato.
+	EmergencySeverity EventSeverity = "emergency"
+)
+
+// Rank restituisce l'ordine di gravità: un valore maggiore indica un evento più grave.
+func (s EventSeverity) Rank() int {
+	switch s {
+	case CriticalSeverity:
+		return 1
+	case EmergencySeverity:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// ThresholdCondition indica se una soglia critica viene superata verso l'alto o verso il basso.
+type ThresholdCondition string
+
+const (
+	// AboveThreshold indica una lettura maggiore della soglia.
+	AboveThreshold ThresholdCondition = "above"
+	// BelowThreshold indica una lettura minore della soglia.
+	BelowThreshold ThresholdCondition = "below"
+)
+
+// CriticalEvent contiene una lettura che ha superato una soglia critica del profilo del sensore.
+// Viene rilevata dal filtro dell'Edge Hub e inoltrata subito, senza attendere l'aggregazione,
+// fino all'Intermediate Fog Hub che la memorizza nella tabella critical_events.
+type CriticalEvent struct {
+	EdgeMacrozone string  `json:"macrozone"`
+	EdgeZone      string  `json:"zone"`
+	SensorID      string  `json:"sensor_id"`
+	Timestamp     int64   `json:"timestamp"`
+	Type          string  `json:"type"`
+	Data          float64 `json:"data"`
+
+	Severity  EventSeverity      `json:"severity"`
+	Condition ThresholdCondition `json:"condition"`
+	Threshold float64            `json:"threshold"`
+	// DetectedAt è l'istante di rilevamento all'Edge Hub in millisecondi, per misurare la latenza della fast lane.
+	DetectedAt int64 `json:"detected_at"`
+	// Outlier è l'esito del rilevamento degli outlier sulla storia del sensore, registrato per verificare i falsi allarmi:
+	// una lettura critica viene inoltrata anche se è un outlier. È nil se il rilevamento non è stato eseguito.
+	Outlier  *bool  `json:"outlier,omitempty"`
+	Detector string `json:"detector,omitempty"`
+
+	KafkaMsg kafka.Message `json:"-"`
+	MQTTMsg  MQTT.Message  `json:"-"`
+}
+
+func CreateCriticalEventFromMQTT(msg MQTT.Message) (CriticalEvent, error) {
+	var event CriticalEvent
+	err := json.Unmarshal(msg.Payload(), &event)
+	event.MQTTMsg = msg
+	return event, err
+}
+
+func CreateCriticalEventFromKafka(msg kafka.Message) (CriticalEvent, error) {
+	var event CriticalEvent
+	err := json.Unmarshal(msg.Value, &event)
+	event.KafkaMsg = msg
+	return event, err
+}
@@ -0,0 +1,59 @@
+package types
+
+// FaultType identifica un guasto iniettato dal simulatore del Sensor Agent.
+type FaultType string
+
+const (
+	// MissingFault indica una lettura non inviata.
+	MissingFault FaultType = "missing"
+	// OutlierFault indica un singolo outlier.
+	OutlierFault FaultType = "outlier"
+	// StuckFault indica una sequenza di letture bloccate sull'ultimo valore valido.
+	StuckFault FaultType = "stuck"
+	// DriftFault indica una sequenza di letture con uno scostamento che cresce lentamente.
+	DriftFault FaultType = "drift"
+	// BurstFault indica una sequenza di outlier consecutivi.
+	BurstFault FaultType = "burst"
+	// ClockSkewFault indica una sequenza di letture con il timestamp spostato in avanti.
+	ClockSkewFault FaultType = "clock_skew"
+	// OutOfOrderFault indica una lettura con un timestamp precedente a quello delle letture già inviate.
+	OutOfOrderFault FaultType = "out_of_order"
+	// DuplicateFault indica una lettura inviata due volte.
+	DuplicateFault FaultType = "duplicate"
+	// FlatLineFault indica una sequenza di letture a zero.
+	FlatLineFault FaultType = "flat_line"
+)
+
+// InjectableFaults sono i guasti configurabili per ogni Sensor Agent, nell'ordine in cui ne viene valutato l'innesco.
+// I dati mancanti e gli outlier singoli sono configurati separatamente, tramite le rispettive probabilità.
+var InjectableFaults = []FaultType{StuckFault, DriftFault, BurstFault, ClockSkewFault, OutOfOrderFault, DuplicateFault, FlatLineFault}
+
+// FaultConfig contiene la probabilità che un guasto si inneschi ad ogni lettura e i parametri che ne definiscono durata e intensità.
+// I parametri non pertinenti al tipo di guasto sono ignorati.
+type FaultConfig struct {
+	Type        FaultType
+	Probability float64
+	// Length è il numero di letture per cui il guasto resta attivo (stuck, drift, burst, clock_skew, flat_line).
+	Length int
+	// Step è l'incremento dello scostamento ad ogni lettura, in deviazioni standard (drift).
+	Step float64
+	// Multiplier è il moltiplicatore della deviazione standard degli outlier (burst).
+	Multiplier float64
+	// Skew è lo spostamento del timestamp, in secondi (clock_skew).
+	Skew int64
+	// Delay è il ritardo del timestamp, in intervalli di campionamento (out_of_order).
+	Delay int
+}
+
+// FaultLabel etichetta una lettura alterata dal simulatore, per confrontarla con le decisioni del filtro dell'Edge Hub.
+// Timestamp e Value sono quelli della lettura inviata; per i dati mancanti Timestamp è l'istante in cui la lettura sarebbe stata generata.
+type FaultLabel struct {
+	EdgeMacrozone     string    `json:"macrozone"`
+	EdgeZone          string    `json:"zone"`
+	SensorID          string    `json:"sensor_id"`
+	Fault             FaultType `json:"fault"`
+	Timestamp         int64     `json:"timestamp"`
+	Value             float64   `json:"value"`
+	OriginalTimestamp int64     `json:"original_timestamp"`
+	OriginalValue     float64   `json:"original_value"`
+}
@@ -9,23 +9,65 @@ import (
 )
 
 type HeartbeatMsg struct {
+	// SchemaVersion è la versione dello schema del messaggio, vedi HeartbeatMsgSchemaVersion
+	SchemaVersion int `json:"schema_version,omitempty"`
+
 	Timestamp     int64  `json:"timestamp,omitempty"`
 	EdgeMacrozone string `json:"macrozone,omitempty"`
 	EdgeZone      string `json:"zone,omitempty"`
 	HubID         string `json:"hub_id,omitempty"`
 
+	// Campi valorizzati solo negli heartbeat dei Sensor Agent
+
+	SensorID string `json:"sensor_id,omitempty"`
+	// Channels contiene gli identificativi dei canali di un Sensor Agent con più canali
+	Channels []string `json:"channels,omitempty"`
+	// Uptime è il tempo trascorso dall'avvio del Sensor Agent, in secondi
+	Uptime int64 `json:"uptime,omitempty"`
+	// SamplingInterval è l'intervallo di campionamento corrente, in millisecondi
+	SamplingInterval int64 `json:"sampling_interval,omitempty"`
+	// BufferDepth è il numero di letture in attesa di invio nel buffer offline
+	BufferDepth int `json:"buffer_depth,omitempty"`
+	// LastPublish è il timestamp dell'ultimo tentativo di invio di una lettura
+	// e LastPublishError l'errore restituito, vuoto se l'invio è riuscito
+	LastPublish      int64  `json:"last_publish,omitempty"`
+	LastPublishError string `json:"last_publish_error,omitempty"`
+	// Driver e Version identificano la sorgente delle letture e la versione del firmware o del simulatore
+	Driver  string `json:"driver,omitempty"`
+	Version string `json:"version,omitempty"`
+
 	KafkaMsg kafka.Message `json:"-"`
 	MQTTMsg  mqtt.Message  `json:"-"`
 }
 
-// CreateHeartbeatMsgFromKafka crea un messaggio di heartbeat da un messaggio Kafka
+// SensorIDs restituisce gli identificativi dei sensori a cui si riferisce l'heartbeat di un Sensor Agent:
+// i canali, se presenti, altrimenti il sensore stesso.
+func (msg HeartbeatMsg) SensorIDs() []string {
+	if len(msg.Channels) > 0 {
+		return msg.Channels
+	}
+	if msg.SensorID == "" {
+		return nil
+	}
+	return []string{msg.SensorID}
+}
+
+// CreateHeartbeatMsgFromKafka crea un messaggio di heartbeat da un messaggio Kafka,
+// convertendolo alla versione corrente dello schema e validandolo
 func CreateHeartbeatMsgFromKafka(msg kafka.Message) (HeartbeatMsg, error) {
 	var heartbeatMsg HeartbeatMsg
 	err := json.Unmarshal(msg.Value, &heartbeatMsg)
 	heartbeatMsg.KafkaMsg = msg
-	return heartbeatMsg, err
+	if err != nil {
+		return heartbeatMsg, err
+	}
+	heartbeatMsg.Upgrade()
+	return heartbeatMsg, heartbeatMsg.Validate()
 }
 
+// CreateHeartbeatMsgFromMqtt crea un messaggio di heartbeat da un messaggio MQTT,
+// convertendolo alla versione corrente dello schema e validandolo.
+// I messaggi vuoti, usati per rimuovere i messaggi conservati dal broker, restituiscono un heartbeat vuoto.
 func CreateHeartbeatMsgFromMqtt(msg mqtt.Message) (HeartbeatMsg, error) {
 	var heartbeatMsg HeartbeatMsg
 
@@ -35,7 +77,11 @@ func CreateHeartbeatMsgFromMqtt(msg mqtt.Message) (HeartbeatMsg, error) {
 
 	err := json.Unmarshal(msg.Payload(), &heartbeatMsg)
 	heartbeatMsg.MQTTMsg = msg
-	return heartbeatMsg, err
+	if err != nil {
+		return heartbeatMsg, err
+	}
+	heartbeatMsg.Upgrade()
+	return heartbeatMsg, heartbeatMsg.Validate()
 }
 
 type HeartbeatMsgBatch struct {
@@ -70,4 +70,7 @@ type Sensor struct {
 	Reference        string    `json:"reference"`
 	RegistrationTime time.Time `json:"registration_time,omitempty"`
 	LastSeen         time.Time `json:"last_seen,omitempty"`
+
+	// PublicKey è la chiave pubblica, in base64, con cui vengono verificate le firme delle letture del sensore
+	PublicKey string `json:"public_key,omitempty"`
 }
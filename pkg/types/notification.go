@@ -0,0 +1,24 @@
+package types
+
+// NotificationType identifica l'evento che ha generato una notifica sullo stato di un sensore.
+type NotificationType string
+
+const (
+	// UnhealthySensorNotification indica un sensore che non invia dati da troppo tempo.
+	UnhealthySensorNotification NotificationType = "unhealthy"
+	// RemovedSensorNotification indica un sensore rimosso dalla cache dell'Edge Hub.
+	RemovedSensorNotification NotificationType = "removed"
+	// RecoveredSensorNotification indica un sensore segnalato come unhealthy che ha ripreso a inviare dati.
+	RecoveredSensorNotification NotificationType = "recovered"
+)
+
+// SensorNotification contiene le informazioni di una notifica sullo stato di un sensore,
+// inviata ai manutentori dall'Edge Hub.
+type SensorNotification struct {
+	Type          NotificationType `json:"type"`
+	EdgeMacrozone string           `json:"macrozone"`
+	EdgeZone      string           `json:"zone"`
+	HubID         string           `json:"hub_id"`
+	SensorID      string           `json:"sensor_id"`
+	Timestamp     int64            `json:"timestamp"`
+}
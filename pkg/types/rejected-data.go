@@ -0,0 +1,92 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/segmentio/kafka-go"
+)
+
+// RejectionReason identifica il motivo per cui una misurazione è stata scartata dal filtro dell'Edge Hub.
+type RejectionReason string
+
+const (
+	// PhysicalBoundsRejection indica un valore esterno ai limiti fisici del profilo del sensore.
+	PhysicalBoundsRejection RejectionReason = "physical_bounds"
+	// OutlierRejection indica un valore considerato outlier dal detector statistico.
+	OutlierRejection RejectionReason = "outlier"
+)
+
+// RejectedSensorData contiene una misurazione scartata dal filtro dell'Edge Hub
+// insieme ai limiti e alle statistiche che ne hanno causato lo scarto.
+// Permette di verificare a posteriori le decisioni del filtro (es. falsi positivi).
+type RejectedSensorData struct {
+	EdgeMacrozone string  `json:"macrozone"`
+	EdgeZone      string  `json:"zone"`
+	SensorID      string  `json:"sensor_id"`
+	Timestamp     int64   `json:"timestamp"`
+	Type          string  `json:"type"`
+	Data          float64 `json:"data"`
+
+	Reason     RejectionReason `json:"reason"`
+	Detector   string          `json:"detector,omitempty"`
+	LowerBound *float64        `json:"lower_bound,omitempty"`
+	UpperBound *float64        `json:"upper_bound,omitempty"`
+	Center     *float64        `json:"center,omitempty"`
+	Spread     *float64        `json:"spread,omitempty"`
+	Samples    int             `json:"samples"`
+	RejectedAt int64           `json:"rejected_at"`
+
+	KafkaMsg kafka.Message `json:"-"`
+	MQTTMsg  MQTT.Message  `json:"-"`
+}
+
+func CreateRejectedSensorDataFromMQTT(msg MQTT.Message) (RejectedSensorData, error) {
+	var data RejectedSensorData
+	err := json.Unmarshal(msg.Payload(), &data)
+	data.MQTTMsg = msg
+	return data, err
+}
+
+func CreateRejectedSensorDataFromKafka(msg kafka.Message) (RejectedSensorData, error) {
+	var data RejectedSensorData
+	err := json.Unmarshal(msg.Value, &data)
+	data.KafkaMsg = msg
+	return data, err
+}
+
+type RejectedSensorDataBatch struct {
+	engine *BatchEngine[RejectedSensorData]
+}
+
+func NewRejectedSensorDataBatch(maxCount int, timeout time.Duration, save func(*RejectedSensorDataBatch) error) (*RejectedSensorDataBatch, error) {
+	rdb := &RejectedSensorDataBatch{}
+	var err error
+	rdb.engine, err = NewBatchEngine(maxCount, timeout, func(engine *BatchEngine[RejectedSensorData]) error {
+		return save(rdb)
+	})
+	return rdb, err
+}
+
+func (rdb *RejectedSensorDataBatch) AddRejectedSensorData(data RejectedSensorData) {
+	rdb.engine.Add(data)
+}
+
+func (rdb *RejectedSensorDataBatch) Count() int {
+	return rdb.engine.Count()
+}
+
+func (rdb *RejectedSensorDataBatch) Items() []RejectedSensorData {
+	return rdb.engine.Items()
+}
+
+func (rdb *RejectedSensorDataBatch) GetKafkaMessages() []kafka.Message {
+	messages := make([]kafka.Message, 0, rdb.Count())
+	for _, d := range rdb.Items() {
+		if d.KafkaMsg.Value != nil {
+			messages = append(messages, d.KafkaMsg)
+		}
+	}
+	return messages
+}
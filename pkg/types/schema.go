@@ -0,0 +1,249 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+)
+
+// Versioni degli schemi dei messaggi scambiati tra i servizi, inviate nel campo schema_version.
+// I messaggi senza versione, inviati dai servizi precedenti al versionamento, hanno versione LegacySchemaVersion.
+//
+// Durante un aggiornamento progressivo servizi con versioni diverse restano attivi contemporaneamente, quindi:
+//   - i messaggi di una versione precedente vengono convertiti nella versione corrente dalle funzioni di Upgrade;
+//   - i messaggi di una versione successiva vengono accettati e letti con i soli campi noti,
+//     perciò uno schema può evolvere solo aggiungendo campi opzionali.
+const (
+	LegacySchemaVersion = 1
+
+	// SensorDataSchemaVersion è la versione corrente dello schema delle letture:
+	// la versione 2 aggiunge la firma delle letture
+	SensorDataSchemaVersion = 2
+	// AggregatedStatsSchemaVersion è la versione corrente dello schema delle statistiche aggregate
+	AggregatedStatsSchemaVersion = 1
+	// HeartbeatMsgSchemaVersion è la versione corrente dello schema degli heartbeat:
+	// la versione 2 aggiunge i campi degli heartbeat dei Sensor Agent
+	HeartbeatMsgSchemaVersion = 2
+	// ConfigurationMsgSchemaVersion è la versione corrente dello schema dei messaggi di configurazione:
+	// la versione 2 aggiunge i canali dei Sensor Agent con più canali, la versione 3 la chiave pubblica di firma
+	ConfigurationMsgSchemaVersion = 3
+)
+
+// MaxTimestampSkew è lo scostamento massimo nel futuro ammesso per il timestamp di un messaggio,
+// per tollerare orologi non sincronizzati. Un timestamp oltre questo limite è tipicamente in millisecondi anziché in secondi.
+const MaxTimestampSkew = 10 * time.Minute
+
+// SensorTypes sono i tipi di sensore ammessi nelle letture, nelle statistiche e nelle registrazioni.
+var SensorTypes = []string{"temperature", "humidity", "pressure"}
+
+// upgradeSchema porta un messaggio dalla versione version alla versione current,
+// applicando in ordine le funzioni di upgrades indicizzate per versione di partenza.
+// Restituisce la versione corrente, che il messaggio assume anche se ricevuto con una versione successiva.
+func upgradeSchema[T any](msg *T, version int, current int, upgrades map[int]func(*T)) int {
+	if version <= 0 {
+		version = LegacySchemaVersion
+	}
+	for ; version < current; version++ {
+		if upgrade, ok := upgrades[version]; ok {
+			upgrade(msg)
+		}
+	}
+	return current
+}
+
+// validateTimestamp controlla che il timestamp, in secondi, sia valorizzato e non troppo nel futuro.
+func validateTimestamp(timestamp int64) error {
+	if timestamp <= 0 {
+		return errors.New("missing timestamp")
+	}
+	if limit := time.Now().Add(MaxTimestampSkew).Unix(); timestamp > limit {
+		return fmt.Errorf("timestamp %d is in the future", timestamp)
+	}
+	return nil
+}
+
+// validateSensorType controlla che il tipo di sensore sia tra quelli ammessi.
+func validateSensorType(sensorType string) error {
+	if sensorType == "" {
+		return errors.New("missing type")
+	}
+	if !slices.Contains(SensorTypes, sensorType) {
+		return errors.New("unknown sensor type: " + sensorType)
+	}
+	return nil
+}
+
+// validateNumbers controlla che i valori numerici siano finiti.
+func validateNumbers(values ...float64) error {
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return errors.New("value is not a finite number")
+		}
+	}
+	return nil
+}
+
+/* ----- SensorData ----- */
+
+// sensorDataUpgrades contiene le conversioni delle letture dalle versioni precedenti, indicizzate per versione di partenza.
+// La versione 2 aggiunge solo la firma, opzionale: le letture della versione 1 non sono firmate e non richiedono conversioni.
+var sensorDataUpgrades = map[int]func(*SensorData){}
+
+// Upgrade converte la lettura alla versione corrente dello schema.
+func (data *SensorData) Upgrade() {
+	data.SchemaVersion = upgradeSchema(data, data.SchemaVersion, SensorDataSchemaVersion, sensorDataUpgrades)
+}
+
+// Validate controlla che la lettura abbia i campi obbligatori, un timestamp plausibile, un tipo noto e un valore finito.
+func (data SensorData) Validate() error {
+	if data.EdgeMacrozone == "" || data.EdgeZone == "" {
+		return errors.New("invalid sensor data: missing macrozone or zone")
+	}
+	if data.SensorID == "" {
+		return errors.New("invalid sensor data: missing sensor_id")
+	}
+	if err := validateTimestamp(data.Timestamp); err != nil {
+		return fmt.Errorf("invalid sensor data from %s: %w", data.SensorID, err)
+	}
+	if err := validateSensorType(data.Type); err != nil {
+		return fmt.Errorf("invalid sensor data from %s: %w", data.SensorID, err)
+	}
+	if err := validateNumbers(data.Data); err != nil {
+		return fmt.Errorf("invalid sensor data from %s: %w", data.SensorID, err)
+	}
+	return nil
+}
+
+/* ----- AggregatedStats ----- */
+
+// aggregatedStatsUpgrades contiene le conversioni delle statistiche dalle versioni precedenti, indicizzate per versione di partenza.
+var aggregatedStatsUpgrades = map[int]func(*AggregatedStats){}
+
+// Upgrade converte le statistiche alla versione corrente dello schema.
+func (stats *AggregatedStats) Upgrade() {
+	stats.SchemaVersion = upgradeSchema(stats, stats.SchemaVersion, AggregatedStatsSchemaVersion, aggregatedStatsUpgrades)
+}
+
+// Validate controlla che le statistiche abbiano un timestamp plausibile, un tipo noto e valori coerenti.
+func (stats AggregatedStats) Validate() error {
+	if err := validateTimestamp(stats.Timestamp); err != nil {
+		return fmt.Errorf("invalid aggregated stats: %w", err)
+	}
+	if err := validateSensorType(stats.Type); err != nil {
+		return fmt.Errorf("invalid aggregated stats: %w", err)
+	}
+	if err := validateNumbers(stats.Min, stats.Max, stats.Avg, stats.Sum, stats.WeightedAvg, stats.WeightedSum, stats.WeightedCount); err != nil {
+		return fmt.Errorf("invalid aggregated stats: %w", err)
+	}
+	if stats.Min > stats.Max {
+		return errors.New("invalid aggregated stats: min is greater than max")
+	}
+	if stats.Count < 0 || stats.WeightedCount < 0 {
+		return errors.New("invalid aggregated stats: negative count")
+	}
+	return nil
+}
+
+/* ----- HeartbeatMsg ----- */
+
+// heartbeatMsgUpgrades contiene le conversioni degli heartbeat dalle versioni precedenti, indicizzate per versione di partenza.
+// La versione 2 aggiunge solo campi opzionali, valorizzati dai Sensor Agent: gli heartbeat della versione 1,
+// inviati solo dagli hub, non richiedono conversioni.
+var heartbeatMsgUpgrades = map[int]func(*HeartbeatMsg){}
+
+// Upgrade converte l'heartbeat alla versione corrente dello schema.
+func (msg *HeartbeatMsg) Upgrade() {
+	msg.SchemaVersion = upgradeSchema(msg, msg.SchemaVersion, HeartbeatMsgSchemaVersion, heartbeatMsgUpgrades)
+}
+
+// Validate controlla che l'heartbeat abbia un timestamp plausibile e identifichi l'hub o il sensore che lo ha inviato.
+func (msg HeartbeatMsg) Validate() error {
+	if msg.HubID == "" && msg.SensorID == "" {
+		return errors.New("invalid heartbeat: missing hub_id and sensor_id")
+	}
+	if err := validateTimestamp(msg.Timestamp); err != nil {
+		return fmt.Errorf("invalid heartbeat from %s%s: %w", msg.HubID, msg.SensorID, err)
+	}
+	if msg.Uptime < 0 || msg.SamplingInterval < 0 || msg.BufferDepth < 0 {
+		return fmt.Errorf("invalid heartbeat from %s%s: negative value", msg.HubID, msg.SensorID)
+	}
+	return nil
+}
+
+/* ----- ConfigurationMsg ----- */
+
+// configurationMsgUpgrades contiene le conversioni dei messaggi di configurazione dalle versioni precedenti,
+// indicizzate per versione di partenza. La versione 3 aggiunge solo la chiave pubblica, opzionale.
+var configurationMsgUpgrades = map[int]func(*ConfigurationMsg){
+	LegacySchemaVersion: upgradeLegacyConfigurationMsg,
+}
+
+// upgradeLegacyConfigurationMsg converte un messaggio di configurazione della versione 1 nella versione 2:
+//   - i messaggi dei servizi precedenti al versionamento possono non indicare il servizio che li ha inviati,
+//     che viene ricavato dal tipo di messaggio per non registrare hub e sensori senza servizio;
+//   - i messaggi della versione 1 registrano un sensore con un solo canale, che viene riportato in Channels
+//     come nei messaggi dei Sensor Agent con più canali.
+func upgradeLegacyConfigurationMsg(msg *ConfigurationMsg) {
+	if msg.Service == "" {
+		switch msg.MsgType {
+		case NewProximityMsgType:
+			msg.Service = ProximityHubService
+		case NewEdgeMsgType:
+			msg.Service = EdgeHubService
+		case NewSensorMsgType:
+			msg.Service = SensorAgentService
+		}
+	}
+	if msg.MsgType == NewSensorMsgType && len(msg.Channels) == 0 && msg.SensorID != "" {
+		msg.Channels = []SensorChannel{{SensorID: msg.SensorID, SensorType: msg.SensorType}}
+	}
+}
+
+// Upgrade converte il messaggio di configurazione alla versione corrente dello schema.
+func (msg *ConfigurationMsg) Upgrade() {
+	msg.SchemaVersion = upgradeSchema(msg, msg.SchemaVersion, ConfigurationMsgSchemaVersion, configurationMsgUpgrades)
+}
+
+// Validate controlla che il messaggio di configurazione abbia un tipo noto, un timestamp plausibile
+// e i campi obbligatori per il proprio tipo.
+func (msg ConfigurationMsg) Validate() error {
+	if err := validateTimestamp(msg.Timestamp); err != nil {
+		return fmt.Errorf("invalid configuration message: %w", err)
+	}
+	if msg.EdgeMacrozone == "" {
+		return errors.New("invalid configuration message: missing macrozone")
+	}
+
+	switch msg.MsgType {
+	case NewProximityMsgType:
+		if msg.HubID == "" {
+			return errors.New("invalid configuration message: missing hub_id")
+		}
+	case NewEdgeMsgType:
+		if msg.HubID == "" || msg.EdgeZone == "" {
+			return errors.New("invalid configuration message: missing hub_id or zone")
+		}
+	case NewSensorMsgType:
+		if msg.SensorID == "" || msg.EdgeZone == "" {
+			return errors.New("invalid configuration message: missing sensor_id or zone")
+		}
+		for _, channelMsg := range msg.ChannelMessages() {
+			if channelMsg.SensorID == "" {
+				return fmt.Errorf("invalid configuration message from %s: channel without sensor_id", msg.SensorID)
+			}
+			if err := validateSensorType(channelMsg.SensorType); err != nil {
+				return fmt.Errorf("invalid configuration message from %s: %w", msg.SensorID, err)
+			}
+		}
+		if msg.PublicKey != "" {
+			if _, err := ParsePublicKey(msg.PublicKey); err != nil {
+				return fmt.Errorf("invalid configuration message from %s: %w", msg.SensorID, err)
+			}
+		}
+	default:
+		return errors.New("invalid configuration message: unknown msg_type " + string(msg.MsgType))
+	}
+	return nil
+}
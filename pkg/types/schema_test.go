@@ -0,0 +1,188 @@
+package types
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestUpgradeSchemaAppliesUpgradesInOrder(t *testing.T) {
+	var applied []int
+	upgrades := map[int]func(*[]int){
+		1: func(msg *[]int) { *msg = append(*msg, 1) },
+		3: func(msg *[]int) { *msg = append(*msg, 3) },
+		4: func(msg *[]int) { *msg = append(*msg, 4) },
+	}
+
+	tests := []struct {
+		version int
+		want    []int
+	}{
+		{version: 0, want: []int{1, 3, 4}},
+		{version: LegacySchemaVersion, want: []int{1, 3, 4}},
+		{version: 3, want: []int{3, 4}},
+		{version: 5, want: nil},
+		{version: 9, want: nil},
+	}
+	for _, tt := range tests {
+		applied = nil
+		if got := upgradeSchema(&applied, tt.version, 5, upgrades); got != 5 {
+			t.Errorf("upgradeSchema from %d = version %d, want 5", tt.version, got)
+		}
+		if fmt.Sprint(applied) != fmt.Sprint(tt.want) {
+			t.Errorf("upgradeSchema from %d applied %v, want %v", tt.version, applied, tt.want)
+		}
+	}
+}
+
+func configurationKafkaMsg(payload string) kafka.Message {
+	return kafka.Message{Value: []byte(payload)}
+}
+
+func TestConfigurationMsgLegacyUpgrade(t *testing.T) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	tests := []struct {
+		name         string
+		payload      string
+		wantService  Service
+		wantChannels []SensorChannel
+	}{
+		{
+			name:         "legacy sensor",
+			payload:      `{"msg_type":"new_sensor","timestamp":` + timestamp + `,"macrozone":"build-0001","zone":"floor-001","sensor_id":"sensor-1","sensor_type":"temperature"}`,
+			wantService:  SensorAgentService,
+			wantChannels: []SensorChannel{{SensorID: "sensor-1", SensorType: "temperature"}},
+		},
+		{
+			name:         "legacy sensor with service",
+			payload:      `{"msg_type":"new_sensor","service":"custom_agent","timestamp":` + timestamp + `,"macrozone":"build-0001","zone":"floor-001","sensor_id":"sensor-1","sensor_type":"humidity"}`,
+			wantService:  "custom_agent",
+			wantChannels: []SensorChannel{{SensorID: "sensor-1", SensorType: "humidity"}},
+		},
+		{
+			name:        "legacy edge hub",
+			payload:     `{"msg_type":"new_edge","timestamp":` + timestamp + `,"macrozone":"build-0001","zone":"floor-001","hub_id":"edge-1"}`,
+			wantService: EdgeHubService,
+		},
+		{
+			name:        "legacy proximity hub",
+			payload:     `{"schema_version":1,"msg_type":"new_proximity","timestamp":` + timestamp + `,"macrozone":"build-0001","hub_id":"proximity-1"}`,
+			wantService: ProximityHubService,
+		},
+		{
+			// I messaggi della versione corrente non vengono convertiti
+			name:        "current sensor",
+			payload:     `{"schema_version":` + strconv.Itoa(ConfigurationMsgSchemaVersion) + `,"msg_type":"new_sensor","timestamp":` + timestamp + `,"macrozone":"build-0001","zone":"floor-001","sensor_id":"sensor-1","sensor_type":"temperature"}`,
+			wantService: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := CreateConfigurationMsgFromKafka(configurationKafkaMsg(tt.payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg.SchemaVersion != ConfigurationMsgSchemaVersion {
+				t.Errorf("schema version = %d, want %d", msg.SchemaVersion, ConfigurationMsgSchemaVersion)
+			}
+			if msg.Service != tt.wantService {
+				t.Errorf("service = %q, want %q", msg.Service, tt.wantService)
+			}
+			if fmt.Sprint(msg.Channels) != fmt.Sprint(tt.wantChannels) {
+				t.Errorf("channels = %v, want %v", msg.Channels, tt.wantChannels)
+			}
+			// La conversione non cambia i sensori registrati
+			if channelMsgs := msg.ChannelMessages(); msg.MsgType == NewSensorMsgType && (len(channelMsgs) != 1 || channelMsgs[0].SensorID != "sensor-1") {
+				t.Errorf("channel messages = %+v, want only sensor-1", channelMsgs)
+			}
+		})
+	}
+}
+
+func TestConfigurationMsgFutureVersion(t *testing.T) {
+	payload := `{"schema_version":7,"msg_type":"new_sensor","service":"sensor_agent","timestamp":` + strconv.FormatInt(time.Now().Unix(), 10) +
+		`,"macrozone":"build-0001","zone":"floor-001","sensor_id":"agent-1","sensor_type":"temperature","firmware":{"version":"2.0"},` +
+		`"channels":[{"sensor_id":"agent-1-temperature","sensor_type":"temperature","unit":"C"},{"sensor_id":"agent-1-humidity","sensor_type":"humidity"}]}`
+
+	msg, err := CreateConfigurationMsgFromKafka(configurationKafkaMsg(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.SchemaVersion != ConfigurationMsgSchemaVersion {
+		t.Errorf("schema version = %d, want %d", msg.SchemaVersion, ConfigurationMsgSchemaVersion)
+	}
+	if len(msg.Channels) != 2 || msg.Channels[1].SensorID != "agent-1-humidity" {
+		t.Errorf("channels = %v, want the two channels of the message", msg.Channels)
+	}
+}
+
+func TestSensorDataVersions(t *testing.T) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	tests := []struct {
+		name    string
+		payload string
+		wantErr bool
+	}{
+		{name: "legacy", payload: `{"macrozone":"build-0001","zone":"floor-001","sensor_id":"sensor-1","timestamp":` + timestamp + `,"type":"temperature","data":21.5}`},
+		{name: "version 1", payload: `{"schema_version":1,"macrozone":"build-0001","zone":"floor-001","sensor_id":"sensor-1","timestamp":` + timestamp + `,"type":"temperature","data":21.5}`},
+		{name: "future version", payload: `{"schema_version":9,"macrozone":"build-0001","zone":"floor-001","sensor_id":"sensor-1","timestamp":` + timestamp + `,"type":"temperature","data":21.5,"unit":"C","quality":{"score":0.9}}`},
+		{name: "timestamp in milliseconds", payload: `{"macrozone":"build-0001","zone":"floor-001","sensor_id":"sensor-1","timestamp":` + timestamp + `000,"type":"temperature","data":21.5}`, wantErr: true},
+		{name: "unknown type", payload: `{"macrozone":"build-0001","zone":"floor-001","sensor_id":"sensor-1","timestamp":` + timestamp + `,"type":"co2","data":400}`, wantErr: true},
+		{name: "missing zone", payload: `{"macrozone":"build-0001","sensor_id":"sensor-1","timestamp":` + timestamp + `,"type":"temperature","data":21.5}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := CreateSensorDataFromKafka(kafka.Message{Value: []byte(tt.payload)})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateSensorDataFromKafka error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if data.SchemaVersion != SensorDataSchemaVersion || data.SensorID != "sensor-1" || data.Data != 21.5 {
+				t.Fatalf("CreateSensorDataFromKafka = %+v", data)
+			}
+		})
+	}
+}
+
+func TestHeartbeatAndStatsVersions(t *testing.T) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	for _, payload := range []string{
+		`{"timestamp":` + timestamp + `,"macrozone":"build-0001","hub_id":"edge-1"}`,
+		`{"schema_version":5,"timestamp":` + timestamp + `,"macrozone":"build-0001","hub_id":"edge-1","load":0.5}`,
+	} {
+		msg, err := CreateHeartbeatMsgFromKafka(kafka.Message{Value: []byte(payload)})
+		if err != nil {
+			t.Fatalf("CreateHeartbeatMsgFromKafka(%s): %v", payload, err)
+		}
+		if msg.SchemaVersion != HeartbeatMsgSchemaVersion || msg.HubID != "edge-1" {
+			t.Errorf("CreateHeartbeatMsgFromKafka(%s) = %+v", payload, msg)
+		}
+	}
+
+	for _, payload := range []string{
+		`{"timestamp":` + timestamp + `,"type":"temperature","min":18,"max":24,"avg":21,"sum":210,"count":10}`,
+		`{"schema_version":4,"timestamp":` + timestamp + `,"type":"temperature","min":18,"max":24,"avg":21,"median":21.2}`,
+	} {
+		stats, err := CreateAggregatedStatsFromKafka(kafka.Message{Value: []byte(payload)})
+		if err != nil {
+			t.Fatalf("CreateAggregatedStatsFromKafka(%s): %v", payload, err)
+		}
+		if stats.SchemaVersion != AggregatedStatsSchemaVersion || stats.Avg != 21 {
+			t.Errorf("CreateAggregatedStatsFromKafka(%s) = %+v", payload, stats)
+		}
+	}
+
+	if _, err := CreateAggregatedStatsFromKafka(kafka.Message{Value: []byte(`{"timestamp":` + timestamp + `,"type":"temperature","min":30,"max":20}`)}); err == nil {
+		t.Error("CreateAggregatedStatsFromKafka accepted min greater than max")
+	}
+}
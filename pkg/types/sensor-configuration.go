@@ -0,0 +1,67 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+// SensorSettings contiene i parametri di simulazione di un sensore modificabili a runtime.
+// I campi non valorizzati non vengono modificati.
+type SensorSettings struct {
+	SamplingInterval   *int64   `json:"sampling_interval,omitempty"` // in millisecondi
+	MissingProbability *float64 `json:"missing_probability,omitempty"`
+	OutlierProbability *float64 `json:"outlier_probability,omitempty"`
+}
+
+// Validate controlla che i parametri valorizzati siano ammessi.
+func (s SensorSettings) Validate() error {
+	if s.SamplingInterval != nil && *s.SamplingInterval <= 0 {
+		return errors.New("sampling_interval must be greater than zero")
+	}
+	if s.MissingProbability != nil && (*s.MissingProbability < 0 || *s.MissingProbability > 1) {
+		return errors.New("missing_probability must be between 0 and 1")
+	}
+	if s.OutlierProbability != nil && (*s.OutlierProbability < 0 || *s.OutlierProbability > 1) {
+		return errors.New("outlier_probability must be between 0 and 1")
+	}
+	return nil
+}
+
+// SensorDesiredConfiguration contiene la configurazione desiderata di un sensore,
+// pubblicata come messaggio conservato dal broker sul topic <SensorConfigurationTopic>/<id>/desired.
+type SensorDesiredConfiguration struct {
+	SensorSettings
+	Version   int64 `json:"version"`
+	Timestamp int64 `json:"timestamp"`
+
+	MQTTMsg MQTT.Message `json:"-"`
+}
+
+// CreateSensorDesiredConfigurationFromMQTT converte un messaggio MQTT nella configurazione desiderata.
+// I messaggi vuoti, usati per rimuovere la configurazione conservata dal broker, restituiscono false.
+func CreateSensorDesiredConfigurationFromMQTT(msg MQTT.Message) (SensorDesiredConfiguration, bool, error) {
+	var desired SensorDesiredConfiguration
+
+	if msg == nil || len(msg.Payload()) == 0 {
+		return SensorDesiredConfiguration{}, false, nil
+	}
+
+	err := json.Unmarshal(msg.Payload(), &desired)
+	desired.MQTTMsg = msg
+	return desired, err == nil, err
+}
+
+// SensorReportedConfiguration contiene la configurazione applicata da un sensore,
+// pubblicata come messaggio conservato dal broker sul topic <SensorConfigurationTopic>/<id>/reported.
+// Version è la versione dell'ultima configurazione desiderata ricevuta,
+// Error è valorizzato se questa non è stata applicata.
+type SensorReportedConfiguration struct {
+	SamplingInterval   int64   `json:"sampling_interval"` // in millisecondi
+	MissingProbability float64 `json:"missing_probability"`
+	OutlierProbability float64 `json:"outlier_probability"`
+	Version            int64   `json:"version"`
+	Error              string  `json:"error,omitempty"`
+	Timestamp          int64   `json:"timestamp"`
+}
@@ -0,0 +1,433 @@
+package types
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+)
+
+// ContentType identifica il formato di serializzazione delle letture dei sensori.
+type ContentType string
+
+const (
+	// JSONContentType serializza le letture in JSON, con i nomi dei campi.
+	JSONContentType ContentType = "application/json"
+	// CBORContentType serializza le letture in CBOR (RFC 8949), con chiavi intere al posto dei nomi dei campi.
+	CBORContentType ContentType = "application/cbor"
+)
+
+// ContentTypeHeader è l'header Kafka che indica il formato di serializzazione del messaggio.
+const ContentTypeHeader = "content-type"
+
+// Chiavi intere dei campi di SensorData nella codifica CBOR.
+const (
+	cborMacrozoneKey     = 1
+	cborZoneKey          = 2
+	cborSensorIDKey      = 3
+	cborTimestampKey     = 4
+	cborTypeKey          = 5
+	cborDataKey          = 6
+	cborSchemaVersionKey = 7
+	cborSignedAtKey      = 8
+	cborNonceKey         = 9
+	cborSignatureKey     = 10
+)
+
+// Tipi principali (major type) di CBOR utilizzati dalla codifica.
+const (
+	cborUnsigned = 0
+	cborNegative = 1
+	cborBytes    = 2
+	cborText     = 3
+	cborArray    = 4
+	cborMap      = 5
+	cborTag      = 6
+	cborSimple   = 7
+)
+
+// ParseContentType verifica che il formato di serializzazione sia supportato.
+func ParseContentType(value string) (ContentType, error) {
+	switch ContentType(value) {
+	case JSONContentType, CBORContentType:
+		return ContentType(value), nil
+	default:
+		return "", errors.New("unsupported content type: " + value)
+	}
+}
+
+// DetectContentType riconosce il formato di serializzazione di una lettura dal primo byte del payload:
+// un oggetto JSON inizia con '{', una mappa CBOR con un byte di tipo principale 5.
+// Viene utilizzato con MQTT, che nella versione 3.1.1 non permette di inviare il formato come proprietà del messaggio.
+func DetectContentType(payload []byte) ContentType {
+	for _, b := range payload {
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		if b>>5 == cborMap {
+			return CBORContentType
+		}
+		return JSONContentType
+	}
+	return JSONContentType
+}
+
+// MarshalSensorData serializza una lettura nel formato indicato, con la versione corrente dello schema.
+func MarshalSensorData(data SensorData, contentType ContentType) ([]byte, error) {
+	data.SchemaVersion = SensorDataSchemaVersion
+	switch contentType {
+	case CBORContentType:
+		return marshalSensorDataCBOR(data), nil
+	case JSONContentType, "":
+		return json.Marshal(data)
+	default:
+		return nil, errors.New("unsupported content type: " + string(contentType))
+	}
+}
+
+// UnmarshalSensorData deserializza una lettura nel formato indicato.
+func UnmarshalSensorData(payload []byte, contentType ContentType) (SensorData, error) {
+	var data SensorData
+	switch contentType {
+	case CBORContentType:
+		err := unmarshalSensorDataCBOR(payload, &data)
+		return data, err
+	case JSONContentType, "":
+		err := json.Unmarshal(payload, &data)
+		return data, err
+	default:
+		return data, errors.New("unsupported content type: " + string(contentType))
+	}
+}
+
+// marshalSensorDataCBOR codifica una lettura come mappa CBOR di 7 elementi con chiavi intere,
+// 10 se la lettura è firmata. Il valore viene codificato a 32 bit quando la conversione non perde precisione.
+func marshalSensorDataCBOR(data SensorData) []byte {
+	items := uint64(7)
+	if data.Signed() {
+		items = 10
+	}
+	b := make([]byte, 0, 40+len(data.EdgeMacrozone)+len(data.EdgeZone)+len(data.SensorID)+len(data.Type)+len(data.Signature))
+	b = appendCBORHead(b, cborMap, items)
+	b = appendCBORHead(b, cborUnsigned, cborMacrozoneKey)
+	b = appendCBORText(b, data.EdgeMacrozone)
+	b = appendCBORHead(b, cborUnsigned, cborZoneKey)
+	b = appendCBORText(b, data.EdgeZone)
+	b = appendCBORHead(b, cborUnsigned, cborSensorIDKey)
+	b = appendCBORText(b, data.SensorID)
+	b = appendCBORHead(b, cborUnsigned, cborTimestampKey)
+	b = appendCBORInt(b, data.Timestamp)
+	b = appendCBORHead(b, cborUnsigned, cborTypeKey)
+	b = appendCBORText(b, data.Type)
+	b = appendCBORHead(b, cborUnsigned, cborDataKey)
+	b = appendCBORFloat(b, data.Data)
+	b = appendCBORHead(b, cborUnsigned, cborSchemaVersionKey)
+	b = appendCBORInt(b, int64(data.SchemaVersion))
+	if data.Signed() {
+		b = appendCBORHead(b, cborUnsigned, cborSignedAtKey)
+		b = appendCBORInt(b, data.SignedAt)
+		b = appendCBORHead(b, cborUnsigned, cborNonceKey)
+		b = appendCBORHead(b, cborUnsigned, data.Nonce)
+		b = appendCBORHead(b, cborUnsigned, cborSignatureKey)
+		b = append(appendCBORHead(b, cborBytes, uint64(len(data.Signature))), data.Signature...)
+	}
+	return b
+}
+
+// appendCBORHead aggiunge l'intestazione di un elemento CBOR: tipo principale e argomento nella forma più corta.
+func appendCBORHead(b []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(b, major<<5|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, major<<5|24, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, major<<5|25), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, major<<5|26), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, major<<5|27), n)
+	}
+}
+
+func appendCBORInt(b []byte, v int64) []byte {
+	if v >= 0 {
+		return appendCBORHead(b, cborUnsigned, uint64(v))
+	}
+	return appendCBORHead(b, cborNegative, uint64(-1-v))
+}
+
+func appendCBORText(b []byte, s string) []byte {
+	return append(appendCBORHead(b, cborText, uint64(len(s))), s...)
+}
+
+func appendCBORFloat(b []byte, f float64) []byte {
+	if f32 := float32(f); float64(f32) == f || math.IsNaN(f) {
+		return binary.BigEndian.AppendUint32(append(b, cborSimple<<5|26), math.Float32bits(f32))
+	}
+	return binary.BigEndian.AppendUint64(append(b, cborSimple<<5|27), math.Float64bits(f))
+}
+
+// cborReader legge gli elementi di un payload CBOR. Le lunghezze indefinite non sono supportate.
+type cborReader struct {
+	b   []byte
+	pos int
+}
+
+var errCBORTruncated = errors.New("invalid CBOR payload: truncated")
+
+// next restituisce i prossimi n byte del payload.
+func (r *cborReader) next(n uint64) ([]byte, error) {
+	if n > uint64(len(r.b)-r.pos) {
+		return nil, errCBORTruncated
+	}
+	b := r.b[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+// head legge l'intestazione di un elemento: tipo principale, informazione aggiuntiva e argomento.
+func (r *cborReader) head() (byte, byte, uint64, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, info := b[0]>>5, b[0]&0x1f
+
+	var arg uint64
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info <= 27:
+		// 24, 25, 26 e 27 indicano un argomento di 1, 2, 4 e 8 byte
+		size := uint64(1) << (info - 24)
+		b, err := r.next(size)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		for _, c := range b {
+			arg = arg<<8 | uint64(c)
+		}
+	default:
+		return 0, 0, 0, errors.New("invalid CBOR payload: indefinite length items are not supported")
+	}
+	return major, info, arg, nil
+}
+
+func (r *cborReader) readInt() (int64, error) {
+	major, _, arg, err := r.head()
+	if err != nil {
+		return 0, err
+	}
+	if arg > math.MaxInt64 {
+		return 0, errors.New("invalid CBOR payload: integer overflow")
+	}
+	switch major {
+	case cborUnsigned:
+		return int64(arg), nil
+	case cborNegative:
+		return -1 - int64(arg), nil
+	default:
+		return 0, errors.New("invalid CBOR payload: expected an integer")
+	}
+}
+
+func (r *cborReader) readUint() (uint64, error) {
+	major, _, arg, err := r.head()
+	if err != nil {
+		return 0, err
+	}
+	if major != cborUnsigned {
+		return 0, errors.New("invalid CBOR payload: expected an unsigned integer")
+	}
+	return arg, nil
+}
+
+func (r *cborReader) readBytes() ([]byte, error) {
+	major, _, arg, err := r.head()
+	if err != nil {
+		return nil, err
+	}
+	if major != cborBytes {
+		return nil, errors.New("invalid CBOR payload: expected a byte string")
+	}
+	b, err := r.next(arg)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), b...), nil
+}
+
+func (r *cborReader) readText() (string, error) {
+	major, _, arg, err := r.head()
+	if err != nil {
+		return "", err
+	}
+	if major != cborText {
+		return "", errors.New("invalid CBOR payload: expected a text string")
+	}
+	b, err := r.next(arg)
+	return string(b), err
+}
+
+// readFloat legge un numero, a virgola mobile (16, 32 o 64 bit) o intero.
+func (r *cborReader) readFloat() (float64, error) {
+	major, info, arg, err := r.head()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case major == cborUnsigned:
+		return float64(arg), nil
+	case major == cborNegative:
+		return -1 - float64(arg), nil
+	case major == cborSimple && info == 25:
+		return halfToFloat64(uint16(arg)), nil
+	case major == cborSimple && info == 26:
+		return float64(math.Float32frombits(uint32(arg))), nil
+	case major == cborSimple && info == 27:
+		return math.Float64frombits(arg), nil
+	default:
+		return 0, errors.New("invalid CBOR payload: expected a number")
+	}
+}
+
+// skip salta un elemento, compresi gli elementi annidati.
+func (r *cborReader) skip() error {
+	major, _, arg, err := r.head()
+	if err != nil {
+		return err
+	}
+	switch major {
+	case cborBytes, cborText:
+		_, err = r.next(arg)
+		return err
+	case cborArray, cborMap, cborTag:
+		items := arg
+		if major == cborMap {
+			items = 2 * arg
+		} else if major == cborTag {
+			items = 1
+		}
+		for i := uint64(0); i < items; i++ {
+			if err := r.skip(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// unmarshalSensorDataCBOR decodifica una lettura da una mappa CBOR.
+// Le chiavi possono essere intere, come in marshalSensorDataCBOR, o testuali, con i nomi dei campi JSON;
+// le chiavi sconosciute vengono ignorate.
+func unmarshalSensorDataCBOR(payload []byte, data *SensorData) error {
+	r := &cborReader{b: payload}
+	major, _, n, err := r.head()
+	if err != nil {
+		return err
+	}
+	if major != cborMap {
+		return errors.New("invalid CBOR payload: expected a map")
+	}
+
+	for i := uint64(0); i < n; i++ {
+		var key int64
+		if r.pos < len(r.b) && r.b[r.pos]>>5 == cborText {
+			name, err := r.readText()
+			if err != nil {
+				return err
+			}
+			key = cborKeyByName(name)
+		} else if key, err = r.readInt(); err != nil {
+			return err
+		}
+
+		switch key {
+		case cborMacrozoneKey:
+			data.EdgeMacrozone, err = r.readText()
+		case cborZoneKey:
+			data.EdgeZone, err = r.readText()
+		case cborSensorIDKey:
+			data.SensorID, err = r.readText()
+		case cborTimestampKey:
+			data.Timestamp, err = r.readInt()
+		case cborTypeKey:
+			data.Type, err = r.readText()
+		case cborDataKey:
+			data.Data, err = r.readFloat()
+		case cborSchemaVersionKey:
+			var version int64
+			version, err = r.readInt()
+			data.SchemaVersion = int(version)
+		case cborSignedAtKey:
+			data.SignedAt, err = r.readInt()
+		case cborNonceKey:
+			data.Nonce, err = r.readUint()
+		case cborSignatureKey:
+			data.Signature, err = r.readBytes()
+		default:
+			err = r.skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if r.pos != len(r.b) {
+		return errors.New("invalid CBOR payload: unexpected data after the map")
+	}
+	return nil
+}
+
+// cborKeyByName restituisce la chiave intera corrispondente al nome JSON di un campo, zero se sconosciuto.
+func cborKeyByName(name string) int64 {
+	switch name {
+	case "macrozone":
+		return cborMacrozoneKey
+	case "zone":
+		return cborZoneKey
+	case "sensor_id":
+		return cborSensorIDKey
+	case "timestamp":
+		return cborTimestampKey
+	case "type":
+		return cborTypeKey
+	case "data":
+		return cborDataKey
+	case "schema_version":
+		return cborSchemaVersionKey
+	case "signed_at":
+		return cborSignedAtKey
+	case "nonce":
+		return cborNonceKey
+	case "signature":
+		return cborSignatureKey
+	default:
+		return 0
+	}
+}
+
+// halfToFloat64 converte un numero a virgola mobile a 16 bit (IEEE 754 half precision).
+func halfToFloat64(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var v float64
+	switch exp {
+	case 0:
+		v = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			v = math.Inf(1)
+		} else {
+			v = math.NaN()
+		}
+	default:
+		v = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -v
+	}
+	return v
+}
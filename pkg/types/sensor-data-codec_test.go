@@ -0,0 +1,282 @@
+package types
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"math"
+	"testing"
+)
+
+func sampleSensorData() SensorData {
+	return SensorData{
+		EdgeMacrozone: "build-0001",
+		EdgeZone:      "floor-001",
+		SensorID:      "sensor-agent-01-temperature",
+		Timestamp:     1735732800,
+		Type:          "temperature",
+		Data:          21.5,
+	}
+}
+
+func signedSensorData(t testing.TB) (SensorData, ed25519.PublicKey) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := sampleSensorData()
+	data.Sign(privateKey, math.MaxUint64-1)
+	return data, publicKey
+}
+
+func TestSensorDataCodecRoundTrip(t *testing.T) {
+	signed, publicKey := signedSensorData(t)
+
+	negative := sampleSensorData()
+	negative.Timestamp = -1
+	negative.Data = -40.125
+
+	precise := sampleSensorData()
+	precise.Data = 21.123456789
+
+	large := sampleSensorData()
+	large.Timestamp = math.MaxInt64
+	large.Data = 1e300
+	large.SensorID = string(bytes.Repeat([]byte("s"), 300))
+
+	tests := []struct {
+		name string
+		data SensorData
+	}{
+		{name: "float32 value", data: sampleSensorData()},
+		{name: "float64 value", data: precise},
+		{name: "negative values", data: negative},
+		{name: "large values", data: large},
+		{name: "empty fields", data: SensorData{}},
+		{name: "signed", data: signed},
+	}
+
+	for _, contentType := range []ContentType{JSONContentType, CBORContentType} {
+		for _, tt := range tests {
+			t.Run(string(contentType)+"/"+tt.name, func(t *testing.T) {
+				payload, err := MarshalSensorData(tt.data, contentType)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := DetectContentType(payload); got != contentType {
+					t.Errorf("DetectContentType = %s, want %s", got, contentType)
+				}
+
+				got, err := UnmarshalSensorData(payload, contentType)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := tt.data
+				want.SchemaVersion = SensorDataSchemaVersion
+				if got.SchemaVersion != want.SchemaVersion || got.EdgeMacrozone != want.EdgeMacrozone || got.EdgeZone != want.EdgeZone ||
+					got.SensorID != want.SensorID || got.Timestamp != want.Timestamp || got.Type != want.Type || got.Data != want.Data ||
+					got.SignedAt != want.SignedAt || got.Nonce != want.Nonce || !bytes.Equal(got.Signature, want.Signature) {
+					t.Fatalf("round trip = %+v, want %+v", got, want)
+				}
+				if want.Signed() {
+					if err := got.VerifySignature(publicKey); err != nil {
+						t.Fatalf("signature not valid after round trip: %v", err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestSensorDataCBORSmallerThanJSON(t *testing.T) {
+	data := sampleSensorData()
+	jsonPayload, err := MarshalSensorData(data, JSONContentType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cborPayload, err := MarshalSensorData(data, CBORContentType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cborPayload) >= len(jsonPayload) {
+		t.Fatalf("CBOR payload is %d bytes, JSON payload is %d bytes", len(cborPayload), len(jsonPayload))
+	}
+}
+
+func TestUnmarshalSensorDataCBORAlternativeEncodings(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		want    SensorData
+	}{
+		{
+			// {"sensor_id": "s1", "data": 21.5}
+			name:    "text keys",
+			payload: []byte{0xa2, 0x69, 's', 'e', 'n', 's', 'o', 'r', '_', 'i', 'd', 0x62, 's', '1', 0x64, 'd', 'a', 't', 'a', 0xfa, 0x41, 0xac, 0x00, 0x00},
+			want:    SensorData{SensorID: "s1", Data: 21.5},
+		},
+		{
+			// {6: 1.5 in half precision}
+			name:    "half precision value",
+			payload: []byte{0xa1, 0x06, 0xf9, 0x3e, 0x00},
+			want:    SensorData{Data: 1.5},
+		},
+		{
+			// {6: -22, 4: 1000}
+			name:    "integer value",
+			payload: []byte{0xa2, 0x06, 0x35, 0x04, 0x19, 0x03, 0xe8},
+			want:    SensorData{Data: -22, Timestamp: 1000},
+		},
+		{
+			// {3: "s1", 99: [1, {"a": h'00'}], "unknown": 1}
+			name:    "unknown keys",
+			payload: []byte{0xa3, 0x03, 0x62, 's', '1', 0x18, 0x63, 0x82, 0x01, 0xa1, 0x61, 'a', 0x41, 0x00, 0x67, 'u', 'n', 'k', 'n', 'o', 'w', 'n', 0x01},
+			want:    SensorData{SensorID: "s1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := UnmarshalSensorData(tt.payload, CBORContentType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.SensorID != tt.want.SensorID || got.Data != tt.want.Data || got.Timestamp != tt.want.Timestamp {
+				t.Fatalf("UnmarshalSensorData = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalSensorDataMalformed(t *testing.T) {
+	tests := []struct {
+		name        string
+		payload     []byte
+		contentType ContentType
+	}{
+		{name: "empty CBOR", payload: nil, contentType: CBORContentType},
+		{name: "CBOR array", payload: []byte{0x81, 0x01}, contentType: CBORContentType},
+		{name: "indefinite length map", payload: []byte{0xbf, 0x03, 0x61, 's', 0xff}, contentType: CBORContentType},
+		{name: "wrong field type", payload: []byte{0xa1, 0x03, 0x01}, contentType: CBORContentType},
+		{name: "non numeric value", payload: []byte{0xa1, 0x06, 0x61, '1'}, contentType: CBORContentType},
+		{name: "integer overflow", payload: []byte{0xa1, 0x04, 0x1b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, contentType: CBORContentType},
+		{name: "negative nonce", payload: []byte{0xa1, 0x09, 0x20}, contentType: CBORContentType},
+		{name: "text signature", payload: []byte{0xa1, 0x0a, 0x61, 'x'}, contentType: CBORContentType},
+		{name: "oversized length", payload: []byte{0xa1, 0x03, 0x7b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, contentType: CBORContentType},
+		{name: "trailing data", payload: []byte{0xa0, 0x00}, contentType: CBORContentType},
+		{name: "empty JSON", payload: nil, contentType: JSONContentType},
+		{name: "JSON syntax error", payload: []byte(`{"sensor_id": "s1",`), contentType: JSONContentType},
+		{name: "JSON wrong field type", payload: []byte(`{"data": "21.5"}`), contentType: JSONContentType},
+		{name: "unsupported content type", payload: []byte(`{}`), contentType: "text/plain"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := UnmarshalSensorData(tt.payload, tt.contentType); err == nil {
+				t.Fatalf("UnmarshalSensorData(%x) succeeded", tt.payload)
+			}
+		})
+	}
+}
+
+func TestUnmarshalSensorDataTruncated(t *testing.T) {
+	signed, _ := signedSensorData(t)
+	for _, contentType := range []ContentType{JSONContentType, CBORContentType} {
+		payload, err := MarshalSensorData(signed, contentType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Ogni prefisso proprio del payload deve essere rifiutato, senza panic
+		for n := 0; n < len(payload); n++ {
+			if _, err := UnmarshalSensorData(payload[:n], contentType); err == nil {
+				t.Fatalf("%s payload truncated to %d of %d bytes was accepted", contentType, n, len(payload))
+			}
+		}
+	}
+}
+
+func TestContentType(t *testing.T) {
+	for _, value := range []string{"application/json", "application/cbor"} {
+		if _, err := ParseContentType(value); err != nil {
+			t.Errorf("ParseContentType(%q): %v", value, err)
+		}
+	}
+	if _, err := ParseContentType("application/xml"); err == nil {
+		t.Error("ParseContentType accepted an unsupported content type")
+	}
+	if _, err := MarshalSensorData(sampleSensorData(), "application/xml"); err == nil {
+		t.Error("MarshalSensorData accepted an unsupported content type")
+	}
+
+	tests := []struct {
+		payload []byte
+		want    ContentType
+	}{
+		{payload: []byte(`{"data": 1}`), want: JSONContentType},
+		{payload: []byte(" \n{}"), want: JSONContentType},
+		{payload: nil, want: JSONContentType},
+		{payload: []byte{0xa0}, want: CBORContentType},
+		{payload: []byte{0xb8, 0x20}, want: CBORContentType},
+	}
+	for _, tt := range tests {
+		if got := DetectContentType(tt.payload); got != tt.want {
+			t.Errorf("DetectContentType(%x) = %s, want %s", tt.payload, got, tt.want)
+		}
+	}
+}
+
+func TestHalfToFloat64(t *testing.T) {
+	tests := []struct {
+		half uint16
+		want float64
+	}{
+		{half: 0x0000, want: 0},
+		{half: 0x3c00, want: 1},
+		{half: 0xc000, want: -2},
+		{half: 0x7bff, want: 65504},
+		{half: 0x0001, want: 5.960464477539063e-08},
+		{half: 0x7c00, want: math.Inf(1)},
+		{half: 0xfc00, want: math.Inf(-1)},
+	}
+	for _, tt := range tests {
+		if got := halfToFloat64(tt.half); got != tt.want {
+			t.Errorf("halfToFloat64(%#04x) = %v, want %v", tt.half, got, tt.want)
+		}
+	}
+	if got := halfToFloat64(0x7e00); !math.IsNaN(got) {
+		t.Errorf("halfToFloat64(0x7e00) = %v, want NaN", got)
+	}
+}
+
+func benchmarkMarshal(b *testing.B, contentType ContentType) {
+	data, _ := signedSensorData(b)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := MarshalSensorData(data, contentType); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkUnmarshal(b *testing.B, contentType ContentType) {
+	data, _ := signedSensorData(b)
+	payload, err := MarshalSensorData(data, contentType)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := UnmarshalSensorData(payload, contentType); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncodeJSON(b *testing.B) { benchmarkMarshal(b, JSONContentType) }
+
+func BenchmarkEncodeCBOR(b *testing.B) { benchmarkMarshal(b, CBORContentType) }
+
+func BenchmarkDecodeJSON(b *testing.B) { benchmarkUnmarshal(b, JSONContentType) }
+
+func BenchmarkDecodeCBOR(b *testing.B) { benchmarkUnmarshal(b, CBORContentType) }
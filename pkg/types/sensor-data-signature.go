@@ -0,0 +1,75 @@
+package types
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+)
+
+// signingContext precede i campi firmati, in modo che la firma di una lettura
+// non possa essere riutilizzata per un altro tipo di messaggio firmato con la stessa chiave.
+const signingContext = "SensorContinuum/sensor-data/v1"
+
+// SigningPayload restituisce i byte firmati di una lettura: i campi della lettura, l'istante della firma e il nonce.
+// La codifica non dipende dal formato di serializzazione (JSON o CBOR), quindi la firma resta valida in entrambi;
+// la versione dello schema non è firmata, perché viene aggiornata da chi riceve la lettura.
+func (data SensorData) SigningPayload() []byte {
+	b := make([]byte, 0, len(signingContext)+48+len(data.EdgeMacrozone)+len(data.EdgeZone)+len(data.SensorID)+len(data.Type))
+	b = append(b, signingContext...)
+	for _, s := range []string{data.EdgeMacrozone, data.EdgeZone, data.SensorID, data.Type} {
+		b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+		b = append(b, s...)
+	}
+	b = binary.BigEndian.AppendUint64(b, uint64(data.Timestamp))
+	b = binary.BigEndian.AppendUint64(b, math.Float64bits(data.Data))
+	b = binary.BigEndian.AppendUint64(b, uint64(data.SignedAt))
+	b = binary.BigEndian.AppendUint64(b, data.Nonce)
+	return b
+}
+
+// Sign firma la lettura con la chiave privata del sensore, impostando l'istante della firma e il nonce.
+// Il nonce deve essere casuale: insieme all'istante della firma permette a chi riceve di rifiutare le letture ripetute.
+func (data *SensorData) Sign(key ed25519.PrivateKey, nonce uint64) {
+	data.SignedAt = time.Now().UTC().Unix()
+	data.Nonce = nonce
+	data.Signature = ed25519.Sign(key, data.SigningPayload())
+}
+
+// Signed indica se la lettura contiene una firma.
+func (data SensorData) Signed() bool {
+	return len(data.Signature) > 0
+}
+
+// VerifySignature verifica la firma della lettura con la chiave pubblica del sensore.
+func (data SensorData) VerifySignature(key ed25519.PublicKey) error {
+	if !data.Signed() {
+		return errors.New("missing signature")
+	}
+	if len(data.Signature) != ed25519.SignatureSize {
+		return errors.New("invalid signature length")
+	}
+	if !ed25519.Verify(key, data.SigningPayload(), data.Signature) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// EncodePublicKey codifica una chiave pubblica Ed25519 in base64, come inviata nei messaggi di registrazione.
+func EncodePublicKey(key ed25519.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// ParsePublicKey decodifica una chiave pubblica Ed25519 codificata con EncodePublicKey.
+func ParsePublicKey(value string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New("invalid public key: " + err.Error())
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid public key: wrong length")
+	}
+	return key, nil
+}
@@ -9,6 +9,9 @@ import (
 )
 
 type SensorData struct {
+	// SchemaVersion è la versione dello schema del messaggio, vedi SensorDataSchemaVersion
+	SchemaVersion int `json:"schema_version,omitempty"`
+
 	EdgeMacrozone string  `json:"macrozone"`
 	EdgeZone      string  `json:"zone"`
 	SensorID      string  `json:"sensor_id"`
@@ -16,22 +19,46 @@ type SensorData struct {
 	Type          string  `json:"type"`
 	Data          float64 `json:"data"`
 
+	// SignedAt, Nonce e Signature contengono la firma Ed25519 della lettura, vedi SensorData.Sign.
+	// SignedAt è l'istante della firma, in secondi: le letture inviate dal buffer offline vengono firmate al momento dell'invio.
+	SignedAt  int64  `json:"signed_at,omitempty"`
+	Nonce     uint64 `json:"nonce,omitempty"`
+	Signature []byte `json:"signature,omitempty"`
+
 	KafkaMsg kafka.Message `json:"-"`
 	MQTTMsg  MQTT.Message  `json:"-"`
 }
 
+// CreateSensorDataFromMQTT deserializza una lettura da un messaggio MQTT, in JSON o CBOR.
+// Il formato viene riconosciuto dal payload, perché MQTT 3.1.1 non permette di inviarlo come proprietà del messaggio.
+// La lettura viene convertita alla versione corrente dello schema e validata.
 func CreateSensorDataFromMQTT(msg MQTT.Message) (SensorData, error) {
-	var data SensorData
-	err := json.Unmarshal(msg.Payload(), &data)
+	data, err := UnmarshalSensorData(msg.Payload(), DetectContentType(msg.Payload()))
 	data.MQTTMsg = msg
-	return data, err
+	if err != nil {
+		return data, err
+	}
+	data.Upgrade()
+	return data, data.Validate()
 }
 
+// CreateSensorDataFromKafka deserializza una lettura da un messaggio Kafka, nel formato indicato dall'header ContentTypeHeader.
+// Senza header il formato viene riconosciuto dal payload. La lettura viene convertita alla versione corrente dello schema e validata.
 func CreateSensorDataFromKafka(msg kafka.Message) (SensorData, error) {
-	var data SensorData
-	err := json.Unmarshal(msg.Value, &data)
+	contentType := DetectContentType(msg.Value)
+	for _, header := range msg.Headers {
+		if header.Key == ContentTypeHeader {
+			contentType = ContentType(header.Value)
+			break
+		}
+	}
+	data, err := UnmarshalSensorData(msg.Value, contentType)
 	data.KafkaMsg = msg
-	return data, err
+	if err != nil {
+		return data, err
+	}
+	data.Upgrade()
+	return data, data.Validate()
 }
 
 type SensorDataBatch struct {
@@ -72,6 +99,9 @@ func (sdb *SensorDataBatch) GetKafkaMessages() []kafka.Message {
 // AggregatedStats contiene i dati statistici calcolati ogni tot minuti dal Proximity-Fog-Hub
 // e inviati tramite kafka all' intermediate-fog-hub per essere memorizzati nel database centrale
 type AggregatedStats struct {
+	// SchemaVersion è la versione dello schema del messaggio, vedi AggregatedStatsSchemaVersion
+	SchemaVersion int `json:"schema_version,omitempty"`
+
 	ID            string  `json:"id,omitempty"`
 	Timestamp     int64   `json:"timestamp"`
 	Region        string  `json:"region,omitempty"`
@@ -90,12 +120,17 @@ type AggregatedStats struct {
 	KafkaMsg kafka.Message `json:"-"`
 }
 
-// CreateAggregatedStatsFromKafka deserializza un messaggio Kafka in AggregatedStats
+// CreateAggregatedStatsFromKafka deserializza un messaggio Kafka in AggregatedStats,
+// convertendolo alla versione corrente dello schema e validandolo
 func CreateAggregatedStatsFromKafka(msg kafka.Message) (AggregatedStats, error) {
 	var stats AggregatedStats
 	err := json.Unmarshal(msg.Value, &stats)
 	stats.KafkaMsg = msg
-	return stats, err
+	if err != nil {
+		return stats, err
+	}
+	stats.Upgrade()
+	return stats, stats.Validate()
 }
 
 type AggregatedStatsBatch struct {
@@ -0,0 +1,92 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/segmentio/kafka-go"
+)
+
+// SensorState identifica lo stato di un sensore nel suo ciclo di vita sull'Edge Hub.
+// Il ciclo di vita è: registered → active → silent → unhealthy → decommissioned.
+// Un sensore che riprende a inviare dati torna active da qualsiasi stato.
+type SensorState string
+
+const (
+	// SensorRegistered indica un sensore registrato che non ha ancora inviato dati.
+	SensorRegistered SensorState = "registered"
+	// SensorActive indica un sensore che invia dati regolarmente.
+	SensorActive SensorState = "active"
+	// SensorSilent indica un sensore che non invia dati da più di SilentSensorTimeout.
+	SensorSilent SensorState = "silent"
+	// SensorUnhealthy indica un sensore che non invia dati da più di UnhealthySensorTimeout.
+	SensorUnhealthy SensorState = "unhealthy"
+	// SensorDecommissioned indica un sensore rimosso dalla cache dell'Edge Hub per inattività prolungata.
+	SensorDecommissioned SensorState = "decommissioned"
+)
+
+// SensorStateEvent contiene una transizione di stato di un sensore, rilevata dall'Edge Hub
+// e inoltrata fino al database dei metadati della regione per mantenere la storia degli stati.
+type SensorStateEvent struct {
+	EdgeMacrozone string      `json:"macrozone"`
+	EdgeZone      string      `json:"zone"`
+	SensorID      string      `json:"sensor_id"`
+	HubID         string      `json:"hub_id"`
+	From          SensorState `json:"from,omitempty"`
+	To            SensorState `json:"to"`
+	Timestamp     int64       `json:"timestamp"`
+	LastSeen      int64       `json:"last_seen,omitempty"`
+
+	KafkaMsg kafka.Message `json:"-"`
+	MQTTMsg  MQTT.Message  `json:"-"`
+}
+
+func CreateSensorStateEventFromMQTT(msg MQTT.Message) (SensorStateEvent, error) {
+	var event SensorStateEvent
+	err := json.Unmarshal(msg.Payload(), &event)
+	event.MQTTMsg = msg
+	return event, err
+}
+
+func CreateSensorStateEventFromKafka(msg kafka.Message) (SensorStateEvent, error) {
+	var event SensorStateEvent
+	err := json.Unmarshal(msg.Value, &event)
+	event.KafkaMsg = msg
+	return event, err
+}
+
+type SensorStateEventBatch struct {
+	engine *BatchEngine[SensorStateEvent]
+}
+
+func NewSensorStateEventBatch(maxCount int, timeout time.Duration, save func(*SensorStateEventBatch) error) (*SensorStateEventBatch, error) {
+	seb := &SensorStateEventBatch{}
+	var err error
+	seb.engine, err = NewBatchEngine(maxCount, timeout, func(engine *BatchEngine[SensorStateEvent]) error {
+		return save(seb)
+	})
+	return seb, err
+}
+
+func (seb *SensorStateEventBatch) AddSensorStateEvent(event SensorStateEvent) {
+	seb.engine.Add(event)
+}
+
+func (seb *SensorStateEventBatch) Count() int {
+	return seb.engine.Count()
+}
+
+func (seb *SensorStateEventBatch) Items() []SensorStateEvent {
+	return seb.engine.Items()
+}
+
+func (seb *SensorStateEventBatch) GetKafkaMessages() []kafka.Message {
+	messages := make([]kafka.Message, 0, seb.Count())
+	for _, e := range seb.Items() {
+		if e.KafkaMsg.Value != nil {
+			messages = append(messages, e.KafkaMsg)
+		}
+	}
+	return messages
+}
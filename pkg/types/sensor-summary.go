@@ -0,0 +1,64 @@
+package types
+
+import (
+	"encoding/json"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/segmentio/kafka-go"
+)
+
+// SensorMinuteSummary contiene le statistiche delle letture valide di un sensore in un minuto,
+// calcolate dall'Edge Hub e inviate al Proximity Hub.
+// I campi comuni con SensorData (compresa la media nel campo "data") mantengono gli stessi nomi JSON,
+// in modo che il messaggio resti leggibile anche come SensorData.
+type SensorMinuteSummary struct {
+	EdgeMacrozone string  `json:"macrozone"`
+	EdgeZone      string  `json:"zone"`
+	SensorID      string  `json:"sensor_id"`
+	Timestamp     int64   `json:"timestamp"`
+	Type          string  `json:"type"`
+	Mean          float64 `json:"data"`
+	Min           float64 `json:"min"`
+	Max           float64 `json:"max"`
+	Count         int     `json:"count"`
+	StdDev        float64 `json:"std_dev"`
+	First         float64 `json:"first"`
+	Last          float64 `json:"last"`
+	Rejected      int     `json:"rejected"`
+	// Revision è 0 per il primo invio del riepilogo e viene incrementato ad ogni ricalcolo
+	// dovuto a letture arrivate in ritardo. Un riepilogo con Revision maggiore sostituisce i precedenti.
+	Revision int `json:"revision,omitempty"`
+
+	KafkaMsg kafka.Message `json:"-"`
+	MQTTMsg  MQTT.Message  `json:"-"`
+}
+
+// normalize completa un riepilogo inviato da un Edge Hub che trasmette solo la media,
+// trattandolo come un minuto con un solo campione.
+func (s *SensorMinuteSummary) normalize() {
+	if s.Count > 0 {
+		return
+	}
+	s.Count = 1
+	s.Min = s.Mean
+	s.Max = s.Mean
+	s.First = s.Mean
+	s.Last = s.Mean
+	s.StdDev = 0
+}
+
+func CreateSensorMinuteSummaryFromMQTT(msg MQTT.Message) (SensorMinuteSummary, error) {
+	var summary SensorMinuteSummary
+	err := json.Unmarshal(msg.Payload(), &summary)
+	summary.normalize()
+	summary.MQTTMsg = msg
+	return summary, err
+}
+
+func CreateSensorMinuteSummaryFromKafka(msg kafka.Message) (SensorMinuteSummary, error) {
+	var summary SensorMinuteSummary
+	err := json.Unmarshal(msg.Value, &summary)
+	summary.normalize()
+	summary.KafkaMsg = msg
+	return summary, err
+}
@@ -0,0 +1,421 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// QueuePolicy specifica cosa fa una BoundedQueue quando un elemento viene inserito con la coda piena.
+type QueuePolicy string
+
+const (
+	// BlockQueuePolicy attende che si liberi un posto, rallentando chi inserisce: nessun elemento viene perso.
+	BlockQueuePolicy QueuePolicy = "block"
+	// DropOldestQueuePolicy scarta l'elemento più vecchio in coda per fare posto a quello nuovo.
+	DropOldestQueuePolicy QueuePolicy = "drop-oldest"
+	// DropNewestQueuePolicy scarta l'elemento nuovo, lasciando invariata la coda.
+	DropNewestQueuePolicy QueuePolicy = "drop-newest"
+	// SpillQueuePolicy salva su disco gli elementi che non entrano in coda, e li reinserisce appena si libera un posto.
+	// Gli elementi salvati e non ancora consegnati vengono riletti al riavvio, quindi possono essere consegnati più di una volta.
+	SpillQueuePolicy QueuePolicy = "spill"
+)
+
+// ParseQueuePolicy converte una stringa in una QueuePolicy.
+func ParseQueuePolicy(value string) (QueuePolicy, error) {
+	switch QueuePolicy(value) {
+	case BlockQueuePolicy, DropOldestQueuePolicy, DropNewestQueuePolicy, SpillQueuePolicy:
+		return QueuePolicy(value), nil
+	default:
+		return "", errors.New("invalid queue policy: " + value + ". Valid values are 'block', 'drop-oldest', 'drop-newest' or 'spill'.")
+	}
+}
+
+// DefaultQueueSpillMaxBytes è la dimensione massima di default del file degli elementi in eccesso.
+const DefaultQueueSpillMaxBytes int64 = 64 << 20
+
+// QueueConfig contiene la configurazione di una BoundedQueue.
+type QueueConfig struct {
+	Policy QueuePolicy
+	Size   int
+	// SpillDir è la cartella in cui viene salvato il file degli elementi in eccesso, usata solo con SpillQueuePolicy.
+	SpillDir string
+	// SpillMaxBytes è la dimensione massima del file degli elementi in eccesso: gli elementi che la supererebbero
+	// vengono scartati. Se è 0 viene usato DefaultQueueSpillMaxBytes.
+	SpillMaxBytes int64
+}
+
+// LoadQueueConfigFromEnv aggiorna la configurazione di una coda con le variabili d'ambiente
+// <prefix>_QUEUE_POLICY, <prefix>_QUEUE_SIZE, <prefix>_QUEUE_SPILL_DIR e <prefix>_QUEUE_SPILL_MAX_BYTES, se impostate.
+func LoadQueueConfigFromEnv(prefix string, config *QueueConfig) error {
+	if policyStr, exists := os.LookupEnv(prefix + "_QUEUE_POLICY"); exists {
+		policy, err := ParseQueuePolicy(policyStr)
+		if err != nil {
+			return errors.New("invalid value for " + prefix + "_QUEUE_POLICY: " + err.Error())
+		}
+		config.Policy = policy
+	}
+
+	if sizeStr, exists := os.LookupEnv(prefix + "_QUEUE_SIZE"); exists {
+		size, err := strconv.Atoi(sizeStr)
+		if err != nil || size <= 0 {
+			return errors.New("invalid value for " + prefix + "_QUEUE_SIZE: " + sizeStr + ". Must be a positive integer.")
+		}
+		config.Size = size
+	}
+
+	if spillDir, exists := os.LookupEnv(prefix + "_QUEUE_SPILL_DIR"); exists {
+		if spillDir == "" {
+			return errors.New("invalid value for " + prefix + "_QUEUE_SPILL_DIR: must not be empty")
+		}
+		config.SpillDir = spillDir
+	}
+
+	if maxBytesStr, exists := os.LookupEnv(prefix + "_QUEUE_SPILL_MAX_BYTES"); exists {
+		maxBytes, err := strconv.ParseInt(maxBytesStr, 10, 64)
+		if err != nil || maxBytes <= 0 {
+			return errors.New("invalid value for " + prefix + "_QUEUE_SPILL_MAX_BYTES: " + maxBytesStr + ". Must be a positive integer.")
+		}
+		config.SpillMaxBytes = maxBytes
+	}
+	return nil
+}
+
+// queueCounters contiene i contatori di una coda dalla sua creazione.
+type queueCounters struct {
+	// enqueued conta gli elementi inseriti in coda, compresi quelli salvati su disco.
+	enqueued atomic.Uint64
+	// dropped conta gli elementi scartati, per la policy o perché non è stato possibile salvarli su disco,
+	// ad esempio perché il file degli elementi in eccesso ha raggiunto la dimensione massima.
+	dropped atomic.Uint64
+	// blocked conta gli inserimenti che hanno dovuto attendere un posto libero.
+	blocked atomic.Uint64
+	// spilled conta gli elementi salvati su disco.
+	spilled atomic.Uint64
+}
+
+// BoundedQueue è una coda limitata tra chi riceve gli elementi e chi li elabora,
+// con una policy che stabilisce cosa fare quando la coda è piena.
+// Gli elementi vengono letti dal canale restituito da C.
+type BoundedQueue[T any] struct {
+	name     string
+	policy   QueuePolicy
+	ch       chan T
+	counters queueCounters
+
+	// Stato del file degli elementi in eccesso, usato solo con SpillQueuePolicy.
+	// backlog è il numero di elementi salvati su disco e non ancora inseriti nel canale:
+	// finché è maggiore di zero anche i nuovi elementi vengono salvati su disco, per mantenere l'ordine.
+	// Il file viene svuotato solo quando backlog torna a zero, quindi spillSize comprende anche gli elementi già reinseriti:
+	// spillMaxBytes ne limita la crescita finché la coda non riesce a smaltire tutti gli elementi salvati.
+	spillMu       sync.Mutex
+	spillCond     *sync.Cond
+	spillFile     *os.File
+	spillSize     int64
+	spillMaxBytes int64
+	backlog       int
+}
+
+// queues contiene le code create, per esporne le metriche.
+var queues = struct {
+	sync.Mutex
+	list []queueMetricsSource
+}{}
+
+// queueMetricsSource è implementata da tutte le BoundedQueue, indipendentemente dal tipo degli elementi.
+type queueMetricsSource interface {
+	Metrics() QueueMetrics
+}
+
+// NewBoundedQueue crea una coda limitata con la configurazione indicata. Il nome identifica la coda nelle metriche
+// e, con SpillQueuePolicy, nel nome del file su disco: se il file esiste già, gli elementi salvati vengono reinseriti in coda.
+func NewBoundedQueue[T any](name string, config QueueConfig) (*BoundedQueue[T], error) {
+	if config.Size <= 0 {
+		return nil, errors.New("queue size must be greater than 0")
+	}
+	if _, err := ParseQueuePolicy(string(config.Policy)); err != nil {
+		return nil, err
+	}
+
+	q := &BoundedQueue[T]{
+		name:   name,
+		policy: config.Policy,
+		ch:     make(chan T, config.Size),
+	}
+
+	if q.policy == SpillQueuePolicy {
+		q.spillMaxBytes = config.SpillMaxBytes
+		if q.spillMaxBytes <= 0 {
+			q.spillMaxBytes = DefaultQueueSpillMaxBytes
+		}
+		if err := q.openSpillFile(config.SpillDir); err != nil {
+			return nil, fmt.Errorf("cannot open spill file of queue %s: %w", name, err)
+		}
+		go q.drainSpillFile()
+	}
+
+	queues.Lock()
+	queues.list = append(queues.list, q)
+	queues.Unlock()
+	return q, nil
+}
+
+// C restituisce il canale da cui leggere gli elementi in coda.
+func (q *BoundedQueue[T]) C() <-chan T {
+	return q.ch
+}
+
+// Push inserisce un elemento in coda secondo la policy. Restituisce false se l'elemento è stato scartato.
+func (q *BoundedQueue[T]) Push(item T) bool {
+	switch q.policy {
+	case BlockQueuePolicy:
+		select {
+		case q.ch <- item:
+		default:
+			q.counters.blocked.Add(1)
+			q.ch <- item
+		}
+
+	case DropOldestQueuePolicy:
+		for sent := false; !sent; {
+			select {
+			case q.ch <- item:
+				sent = true
+			default:
+				// Scarta l'elemento più vecchio; se nel frattempo è stato letto, ritenta l'inserimento
+				select {
+				case <-q.ch:
+					q.counters.dropped.Add(1)
+				default:
+				}
+			}
+		}
+
+	case DropNewestQueuePolicy:
+		select {
+		case q.ch <- item:
+		default:
+			q.counters.dropped.Add(1)
+			return false
+		}
+
+	case SpillQueuePolicy:
+		if !q.pushOrSpill(item) {
+			q.counters.dropped.Add(1)
+			return false
+		}
+	}
+
+	q.counters.enqueued.Add(1)
+	return true
+}
+
+// openSpillFile apre il file degli elementi in eccesso, contando quelli salvati prima di un riavvio.
+func (q *BoundedQueue[T]) openSpillFile(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filepath.Join(dir, q.name+".spill"), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	// Gli elementi sono salvati come JSON, uno per riga
+	reader := bufio.NewReader(file)
+	var size int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			q.backlog++
+			size += int64(len(line))
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	// Una riga incompleta, scritta durante un arresto improvviso, viene rimossa
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return err
+	}
+
+	q.spillFile = file
+	q.spillSize = size
+	q.spillCond = sync.NewCond(&q.spillMu)
+	return nil
+}
+
+// pushOrSpill inserisce l'elemento nel canale se non ci sono elementi su disco e c'è posto, altrimenti lo salva su disco.
+func (q *BoundedQueue[T]) pushOrSpill(item T) bool {
+	q.spillMu.Lock()
+	defer q.spillMu.Unlock()
+
+	if q.backlog == 0 {
+		select {
+		case q.ch <- item:
+			return true
+		default:
+		}
+	}
+
+	line, err := json.Marshal(item)
+	if err != nil {
+		return false
+	}
+	size, err := q.spillFile.Seek(0, io.SeekEnd)
+	if err != nil {
+		return false
+	}
+	// Il file ha raggiunto la dimensione massima: l'elemento viene scartato
+	if size+int64(len(line))+1 > q.spillMaxBytes {
+		return false
+	}
+	if _, err := q.spillFile.Write(append(line, '\n')); err != nil {
+		// Una scrittura parziale lascerebbe una riga incompleta, che verrebbe letta insieme a quella successiva:
+		// il file viene riportato alla dimensione precedente
+		_ = q.spillFile.Truncate(size)
+		return false
+	}
+	q.spillSize = size + int64(len(line)) + 1
+	q.backlog++
+	q.counters.spilled.Add(1)
+	q.spillCond.Signal()
+	return true
+}
+
+// drainSpillFile reinserisce nel canale gli elementi salvati su disco, nell'ordine in cui sono stati salvati.
+// Quando tutti gli elementi sono stati reinseriti, il file viene svuotato.
+func (q *BoundedQueue[T]) drainSpillFile() {
+	reader, err := os.Open(q.spillFile.Name())
+	if err != nil {
+		return
+	}
+	defer reader.Close()
+	buffered := bufio.NewReader(reader)
+
+	for {
+		q.spillMu.Lock()
+		for q.backlog == 0 {
+			q.spillCond.Wait()
+		}
+		// Ogni elemento contato in backlog è una riga completa non ancora letta
+		line, err := buffered.ReadBytes('\n')
+		q.spillMu.Unlock()
+
+		var item T
+		decoded := err == nil && json.Unmarshal(bytes.TrimSpace(line), &item) == nil
+		if decoded {
+			q.ch <- item
+		} else {
+			q.counters.dropped.Add(1)
+		}
+
+		q.spillMu.Lock()
+		q.backlog--
+		if q.backlog == 0 {
+			// Tutti gli elementi sono stati reinseriti: il file può essere svuotato e riletto dall'inizio
+			if err := q.spillFile.Truncate(0); err == nil {
+				q.spillSize = 0
+				if _, err := reader.Seek(0, io.SeekStart); err == nil {
+					buffered.Reset(reader)
+				}
+			}
+		}
+		q.spillMu.Unlock()
+	}
+}
+
+// QueueMetrics contiene lo stato e i contatori di una coda.
+type QueueMetrics struct {
+	Name     string
+	Policy   QueuePolicy
+	Capacity int
+	// Depth è il numero di elementi in coda, Backlog il numero di elementi salvati su disco in attesa.
+	Depth   int
+	Backlog int
+	// SpillBytes è la dimensione del file degli elementi in eccesso, SpillMaxBytes il suo limite.
+	SpillBytes    int64
+	SpillMaxBytes int64
+	Enqueued      uint64
+	Dropped       uint64
+	Blocked       uint64
+	Spilled       uint64
+}
+
+// Metrics restituisce lo stato e i contatori della coda.
+func (q *BoundedQueue[T]) Metrics() QueueMetrics {
+	metrics := QueueMetrics{
+		Name:     q.name,
+		Policy:   q.policy,
+		Capacity: cap(q.ch),
+		Depth:    len(q.ch),
+		Enqueued: q.counters.enqueued.Load(),
+		Dropped:  q.counters.dropped.Load(),
+		Blocked:  q.counters.blocked.Load(),
+		Spilled:  q.counters.spilled.Load(),
+	}
+	if q.policy == SpillQueuePolicy {
+		q.spillMu.Lock()
+		metrics.Backlog = q.backlog
+		metrics.SpillBytes = q.spillSize
+		metrics.SpillMaxBytes = q.spillMaxBytes
+		q.spillMu.Unlock()
+	}
+	return metrics
+}
+
+// GetQueueMetrics restituisce le metriche di tutte le code create, ordinate per nome.
+func GetQueueMetrics() []QueueMetrics {
+	queues.Lock()
+	list := append([]queueMetricsSource(nil), queues.list...)
+	queues.Unlock()
+
+	metrics := make([]QueueMetrics, 0, len(list))
+	for _, q := range list {
+		metrics = append(metrics, q.Metrics())
+	}
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].Name < metrics[j].Name })
+	return metrics
+}
+
+// WriteQueueMetrics scrive le metriche di tutte le code nel formato testuale di Prometheus,
+// con il prefisso indicato e l'etichetta queue con il nome della coda.
+func WriteQueueMetrics(w io.Writer, prefix string) error {
+	metrics := GetQueueMetrics()
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	var b bytes.Buffer
+	write := func(name, kind string, value func(QueueMetrics) uint64) {
+		fmt.Fprintf(&b, "# TYPE %s_queue_%s %s\n", prefix, name, kind)
+		for _, m := range metrics {
+			fmt.Fprintf(&b, "%s_queue_%s{queue=%q,policy=%q} %d\n", prefix, name, m.Name, m.Policy, value(m))
+		}
+	}
+	write("capacity", "gauge", func(m QueueMetrics) uint64 { return uint64(m.Capacity) })
+	write("depth", "gauge", func(m QueueMetrics) uint64 { return uint64(m.Depth) })
+	write("spill_backlog", "gauge", func(m QueueMetrics) uint64 { return uint64(m.Backlog) })
+	write("spill_bytes", "gauge", func(m QueueMetrics) uint64 { return uint64(m.SpillBytes) })
+	write("spill_max_bytes", "gauge", func(m QueueMetrics) uint64 { return uint64(m.SpillMaxBytes) })
+	write("enqueued_total", "counter", func(m QueueMetrics) uint64 { return m.Enqueued })
+	write("dropped_total", "counter", func(m QueueMetrics) uint64 { return m.Dropped })
+	write("blocked_total", "counter", func(m QueueMetrics) uint64 { return m.Blocked })
+	write("spilled_total", "counter", func(m QueueMetrics) uint64 { return m.Spilled })
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// TestBoundedQueueSpillPartialWrite limita la dimensione massima dei file del processo (RLIMIT_FSIZE)
+// per provocare la scrittura parziale di un elemento sul file degli elementi in eccesso.
+func TestBoundedQueueSpillPartialWrite(t *testing.T) {
+	dir := t.TempDir()
+	spillFile := filepath.Join(dir, "test-partial.spill")
+	q, err := NewBoundedQueue[string]("test-partial", QueueConfig{Policy: SpillQueuePolicy, Size: 1, SpillDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Il primo elemento occupa la coda, il secondo viene salvato su disco
+	q.Push("first")
+	q.Push("second")
+	info, err := os.Stat(spillFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := info.Size()
+
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_FSIZE, &limit); err != nil {
+		t.Fatal(err)
+	}
+	reduced := limit
+	reduced.Cur = uint64(size) + 4
+	if err := syscall.Setrlimit(syscall.RLIMIT_FSIZE, &reduced); err != nil {
+		t.Skip("cannot set RLIMIT_FSIZE: ", err)
+	}
+	pushed := q.Push(strings.Repeat("x", 64))
+	if err := syscall.Setrlimit(syscall.RLIMIT_FSIZE, &limit); err != nil {
+		t.Fatal(err)
+	}
+
+	if pushed {
+		t.Fatal("Push succeeded with a partial write")
+	}
+	if info, err := os.Stat(spillFile); err != nil || info.Size() != size {
+		t.Fatalf("spill file size after the failed write = %v, %v; want %d", info.Size(), err, size)
+	}
+
+	// Gli elementi successivi vengono salvati e consegnati integri
+	q.Push("third")
+	if got := receiveItems(t, q, 3); got[0] != "first" || got[1] != "second" || got[2] != "third" {
+		t.Fatalf("items = %q, want [first second third]", got)
+	}
+	if metrics := q.Metrics(); metrics.Dropped != 1 {
+		t.Fatalf("dropped = %d, want 1", metrics.Dropped)
+	}
+}
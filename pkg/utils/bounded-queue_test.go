@@ -0,0 +1,297 @@
+package utils
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// receiveItems legge n elementi dalla coda, fallendo il test se non arrivano entro il timeout.
+func receiveItems[T any](t *testing.T, q *BoundedQueue[T], n int) []T {
+	t.Helper()
+	items := make([]T, 0, n)
+	for len(items) < n {
+		select {
+		case item := <-q.C():
+			items = append(items, item)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("received %d items, want %d", len(items), n)
+		}
+	}
+	return items
+}
+
+// expectEmpty verifica che la coda non consegni altri elementi.
+func expectEmpty[T any](t *testing.T, q *BoundedQueue[T]) {
+	t.Helper()
+	select {
+	case item := <-q.C():
+		t.Fatalf("unexpected item %v", item)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func equalItems(got, want []int) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBoundedQueueBlock(t *testing.T) {
+	q, err := NewBoundedQueue[int]("test-block", QueueConfig{Policy: BlockQueuePolicy, Size: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Push(1)
+	q.Push(2)
+
+	// Con la coda piena l'inserimento attende che si liberi un posto
+	pushed := make(chan bool)
+	go func() { pushed <- q.Push(3) }()
+	select {
+	case <-pushed:
+		t.Fatal("Push returned with a full queue")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if got := receiveItems(t, q, 1); got[0] != 1 {
+		t.Fatalf("first item = %d, want 1", got[0])
+	}
+	select {
+	case ok := <-pushed:
+		if !ok {
+			t.Fatal("Push returned false")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Push still blocked after an item was read")
+	}
+	if got := receiveItems(t, q, 2); !equalItems(got, []int{2, 3}) {
+		t.Fatalf("items = %v, want [2 3]", got)
+	}
+
+	metrics := q.Metrics()
+	if metrics.Enqueued != 3 || metrics.Blocked != 1 || metrics.Dropped != 0 {
+		t.Fatalf("metrics = %+v, want 3 enqueued, 1 blocked, 0 dropped", metrics)
+	}
+}
+
+func TestBoundedQueueDropOldest(t *testing.T) {
+	q, err := NewBoundedQueue[int]("test-drop-oldest", QueueConfig{Policy: DropOldestQueuePolicy, Size: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 5; i++ {
+		if !q.Push(i) {
+			t.Fatalf("Push(%d) returned false", i)
+		}
+	}
+
+	if got := receiveItems(t, q, 2); !equalItems(got, []int{4, 5}) {
+		t.Fatalf("items = %v, want the two newest [4 5]", got)
+	}
+	expectEmpty(t, q)
+	if metrics := q.Metrics(); metrics.Enqueued != 5 || metrics.Dropped != 3 {
+		t.Fatalf("metrics = %+v, want 5 enqueued, 3 dropped", metrics)
+	}
+}
+
+func TestBoundedQueueDropNewest(t *testing.T) {
+	q, err := NewBoundedQueue[int]("test-drop-newest", QueueConfig{Policy: DropNewestQueuePolicy, Size: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 5; i++ {
+		if got, want := q.Push(i), i <= 2; got != want {
+			t.Fatalf("Push(%d) = %v, want %v", i, got, want)
+		}
+	}
+
+	if got := receiveItems(t, q, 2); !equalItems(got, []int{1, 2}) {
+		t.Fatalf("items = %v, want the two oldest [1 2]", got)
+	}
+	expectEmpty(t, q)
+	if metrics := q.Metrics(); metrics.Enqueued != 2 || metrics.Dropped != 3 {
+		t.Fatalf("metrics = %+v, want 2 enqueued, 3 dropped", metrics)
+	}
+}
+
+func TestBoundedQueueSpill(t *testing.T) {
+	dir := t.TempDir()
+	q, err := NewBoundedQueue[int]("test-spill", QueueConfig{Policy: SpillQueuePolicy, Size: 2, SpillDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 10; i++ {
+		if !q.Push(i) {
+			t.Fatalf("Push(%d) returned false", i)
+		}
+	}
+	if metrics := q.Metrics(); metrics.Spilled != 8 || metrics.Dropped != 0 {
+		t.Fatalf("metrics = %+v, want 8 spilled, 0 dropped", metrics)
+	}
+
+	// Gli elementi salvati su disco vengono consegnati dopo quelli in coda, nell'ordine di inserimento
+	want := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	if got := receiveItems(t, q, 10); !equalItems(got, want) {
+		t.Fatalf("items = %v, want %v", got, want)
+	}
+	expectEmpty(t, q)
+
+	// Consegnati tutti gli elementi, il file viene svuotato
+	if info, err := os.Stat(filepath.Join(dir, "test-spill.spill")); err != nil || info.Size() != 0 {
+		t.Fatalf("spill file after draining: %v, %v; want an empty file", info, err)
+	}
+	if metrics := q.Metrics(); metrics.Backlog != 0 {
+		t.Fatalf("backlog after draining = %d, want 0", metrics.Backlog)
+	}
+
+	// Dopo lo svuotamento il file viene riutilizzato dall'inizio
+	for i := 11; i <= 14; i++ {
+		q.Push(i)
+	}
+	if got := receiveItems(t, q, 4); !equalItems(got, []int{11, 12, 13, 14}) {
+		t.Fatalf("items after reuse = %v, want [11 12 13 14]", got)
+	}
+}
+
+func TestBoundedQueueSpillReplayAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	spillFile := filepath.Join(dir, "test-restart.spill")
+
+	// Simula gli elementi salvati prima di un arresto improvviso, con l'ultima riga scritta a metà
+	if err := os.WriteFile(spillFile, []byte("1\n2\n3\n{\"trunc"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := NewBoundedQueue[int]("test-restart", QueueConfig{Policy: SpillQueuePolicy, Size: 1, SpillDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics := q.Metrics(); metrics.Backlog != 3 {
+		t.Fatalf("backlog after restart = %d, want 3", metrics.Backlog)
+	}
+
+	// I nuovi elementi vengono consegnati dopo quelli salvati prima del riavvio
+	q.Push(4)
+	if got := receiveItems(t, q, 4); !equalItems(got, []int{1, 2, 3, 4}) {
+		t.Fatalf("items = %v, want [1 2 3 4]", got)
+	}
+	expectEmpty(t, q)
+	if metrics := q.Metrics(); metrics.Dropped != 0 {
+		t.Fatalf("dropped = %d, want 0: the incomplete line must be discarded on open", metrics.Dropped)
+	}
+}
+
+func TestBoundedQueueSpillMaxBytes(t *testing.T) {
+	dir := t.TempDir()
+	// Ogni elemento occupa due byte sul file ("2\n"): il file ne contiene al più tre
+	q, err := NewBoundedQueue[int]("test-spill-max", QueueConfig{Policy: SpillQueuePolicy, Size: 1, SpillDir: dir, SpillMaxBytes: 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 4; i++ {
+		if !q.Push(i) {
+			t.Fatalf("Push(%d) returned false", i)
+		}
+	}
+
+	// Il file ha raggiunto la dimensione massima: il nuovo elemento viene scartato
+	if q.Push(5) {
+		t.Fatal("Push succeeded with a full spill file")
+	}
+	if metrics := q.Metrics(); metrics.Spilled != 3 || metrics.Dropped != 1 || metrics.SpillBytes != 6 || metrics.SpillMaxBytes != 6 {
+		t.Fatalf("metrics = %+v, want 3 spilled, 1 dropped, 6 of 6 bytes", metrics)
+	}
+	if got := receiveItems(t, q, 4); !equalItems(got, []int{1, 2, 3, 4}) {
+		t.Fatalf("items = %v, want [1 2 3 4]", got)
+	}
+
+	// Svuotato il file, i nuovi elementi vengono di nuovo salvati su disco
+	for deadline := time.Now().Add(2 * time.Second); q.Metrics().SpillBytes != 0; {
+		if time.Now().After(deadline) {
+			t.Fatalf("spill file not emptied after draining: %+v", q.Metrics())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for i := 6; i <= 9; i++ {
+		if !q.Push(i) {
+			t.Fatalf("Push(%d) after draining returned false", i)
+		}
+	}
+	if got := receiveItems(t, q, 4); !equalItems(got, []int{6, 7, 8, 9}) {
+		t.Fatalf("items after draining = %v, want [6 7 8 9]", got)
+	}
+}
+
+func TestNewBoundedQueueInvalidConfig(t *testing.T) {
+	if _, err := NewBoundedQueue[int]("test-invalid", QueueConfig{Policy: BlockQueuePolicy}); err == nil {
+		t.Error("NewBoundedQueue accepted a zero size")
+	}
+	if _, err := NewBoundedQueue[int]("test-invalid", QueueConfig{Policy: "fifo", Size: 1}); err == nil {
+		t.Error("NewBoundedQueue accepted an unknown policy")
+	}
+}
+
+func TestLoadQueueConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    QueueConfig
+		wantErr bool
+	}{
+		{name: "defaults", env: nil, want: QueueConfig{Policy: BlockQueuePolicy, Size: 10, SpillDir: "spill"}},
+		{name: "all set", env: map[string]string{"TEST_QUEUE_POLICY": "spill", "TEST_QUEUE_SIZE": "5", "TEST_QUEUE_SPILL_DIR": "/tmp/q", "TEST_QUEUE_SPILL_MAX_BYTES": "1024"}, want: QueueConfig{Policy: SpillQueuePolicy, Size: 5, SpillDir: "/tmp/q", SpillMaxBytes: 1024}},
+		{name: "invalid policy", env: map[string]string{"TEST_QUEUE_POLICY": "lifo"}, wantErr: true},
+		{name: "invalid size", env: map[string]string{"TEST_QUEUE_SIZE": "0"}, wantErr: true},
+		{name: "empty spill dir", env: map[string]string{"TEST_QUEUE_SPILL_DIR": ""}, wantErr: true},
+		{name: "invalid spill max bytes", env: map[string]string{"TEST_QUEUE_SPILL_MAX_BYTES": "-1"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			config := QueueConfig{Policy: BlockQueuePolicy, Size: 10, SpillDir: "spill"}
+			err := LoadQueueConfigFromEnv("TEST", &config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadQueueConfigFromEnv error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && config != tt.want {
+				t.Fatalf("config = %+v, want %+v", config, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteQueueMetrics(t *testing.T) {
+	q, err := NewBoundedQueue[int]("test-metrics", QueueConfig{Policy: DropNewestQueuePolicy, Size: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Push(1)
+	q.Push(2)
+
+	var b bytes.Buffer
+	if err := WriteQueueMetrics(&b, "test"); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`test_queue_capacity{queue="test-metrics",policy="drop-newest"} 1`,
+		`test_queue_depth{queue="test-metrics",policy="drop-newest"} 1`,
+		`test_queue_dropped_total{queue="test-metrics",policy="drop-newest"} 1`,
+		"# TYPE test_queue_enqueued_total counter",
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("metrics do not contain %q:\n%s", line, b.String())
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+// TLSProtocols sono i protocolli MQTT con cui la libreria paho stabilisce una connessione TLS.
+var TLSProtocols = []string{"ssl", "tls", "mqtts", "wss"}
+
+// MQTTSecurity contiene le impostazioni di sicurezza della connessione a un broker MQTT:
+// TLS con autenticazione reciproca e credenziali del client.
+type MQTTSecurity struct {
+	// CAFile è il certificato dell'autorità che ha firmato il certificato del broker.
+	// Se non è impostato, vengono utilizzate le autorità del sistema.
+	CAFile string
+	// CertFile e KeyFile sono il certificato e la chiave privata del client, per l'autenticazione reciproca.
+	// Il CN del certificato è l'identità del dispositivo.
+	CertFile string
+	KeyFile  string
+
+	// Username e Password sono le credenziali del client. Token viene inviato come password,
+	// in alternativa a Password; se Username non è impostato, viene utilizzata l'identità del dispositivo.
+	Username string
+	Password string
+	Token    string
+}
+
+// TLSEnabled indica se è configurata almeno un'impostazione TLS.
+func (s MQTTSecurity) TLSEnabled() bool {
+	return s.CAFile != "" || s.CertFile != "" || s.KeyFile != ""
+}
+
+// Validate controlla che le impostazioni siano coerenti tra loro e con il protocollo del broker.
+func (s MQTTSecurity) Validate(protocol string) error {
+	if (s.CertFile == "") != (s.KeyFile == "") {
+		return errors.New("MQTT client certificate and key must be set together")
+	}
+	if s.Password != "" && s.Token != "" {
+		return errors.New("MQTT password and token cannot be set together")
+	}
+	if s.TLSEnabled() && !slices.Contains(TLSProtocols, protocol) {
+		return errors.New("MQTT TLS settings require one of the protocols " + strings.Join(TLSProtocols, ", ") + ", got: " + protocol)
+	}
+	return nil
+}
+
+// Identity restituisce il CN del certificato del client, vuoto se il certificato non è impostato.
+func (s MQTTSecurity) Identity() (string, error) {
+	if s.CertFile == "" {
+		return "", nil
+	}
+	pair, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+	if err != nil {
+		return "", errors.New("invalid MQTT client certificate: " + err.Error())
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return "", errors.New("invalid MQTT client certificate: " + err.Error())
+	}
+	if cert.Subject.CommonName == "" {
+		return "", errors.New("invalid MQTT client certificate: missing common name")
+	}
+	return cert.Subject.CommonName, nil
+}
+
+// ResolveIdentity verifica che l'identificativo del dispositivo corrisponda al CN del certificato del client.
+// Se l'identificativo non è stato impostato (configured è false), viene utilizzato il CN.
+func (s MQTTSecurity) ResolveIdentity(id string, configured bool) (string, error) {
+	identity, err := s.Identity()
+	if err != nil || identity == "" {
+		return id, err
+	}
+	if !configured {
+		return identity, nil
+	}
+	if id != identity {
+		return "", errors.New("identifier " + id + " does not match the MQTT client certificate common name " + identity)
+	}
+	return id, nil
+}
+
+// TLSConfig crea la configurazione TLS del client con le autorità e il certificato indicati.
+func (s MQTTSecurity) TLSConfig() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if s.CAFile != "" {
+		ca, err := os.ReadFile(s.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, errors.New("invalid MQTT CA file: no PEM certificates found in " + s.CAFile)
+		}
+	}
+
+	if s.CertFile != "" {
+		pair, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{pair}
+	}
+	return cfg, nil
+}
+
+// Apply imposta sulle opzioni del client la configurazione TLS e le credenziali.
+// identity è l'identificativo del dispositivo, utilizzato come username se Username non è impostato.
+func (s MQTTSecurity) Apply(opts *MQTT.ClientOptions, identity string) error {
+	if s.TLSEnabled() {
+		cfg, err := s.TLSConfig()
+		if err != nil {
+			return err
+		}
+		opts.SetTLSConfig(cfg)
+	}
+
+	password := s.Password
+	if s.Token != "" {
+		password = s.Token
+	}
+	if s.Username != "" {
+		opts.SetUsername(s.Username)
+	} else if password != "" {
+		opts.SetUsername(identity)
+	}
+	if password != "" {
+		opts.SetPassword(password)
+	}
+	return nil
+}
+
+// CheckTopicIdentity verifica che l'identificativo nel payload di un messaggio corrisponda all'ultimo livello del topic.
+// Con le ACL del broker, che permettono a ogni dispositivo di pubblicare solo sui topic con la propria identità,
+// impedisce a un dispositivo di inviare messaggi a nome di un altro.
+func CheckTopicIdentity(topic string, id string) error {
+	if topic[strings.LastIndex(topic, "/")+1:] != id {
+		return errors.New("identifier " + id + " does not match topic " + topic)
+	}
+	return nil
+}
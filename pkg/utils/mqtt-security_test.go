@@ -0,0 +1,475 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+// testCA è un'autorità di certificazione generata per i test.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	dir  string
+	file string
+}
+
+func newTestCA(t *testing.T, dir, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := &testCA{cert: cert, key: key, dir: dir, file: filepath.Join(dir, name+".crt")}
+	writePEM(t, ca.file, "CERTIFICATE", der)
+	return ca
+}
+
+// issue firma un certificato con il CN indicato e restituisce i percorsi del certificato e della chiave.
+func (ca *testCA) issue(t *testing.T, name string, server bool) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if server {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		template.DNSNames = []string{"localhost"}
+		template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(ca.dir, name+".crt")
+	keyFile := filepath.Join(ca.dir, name+".key")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMQTTSecurityValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		security MQTTSecurity
+		protocol string
+		wantErr  bool
+	}{
+		{name: "no security", security: MQTTSecurity{}, protocol: "tcp"},
+		{name: "TLS", security: MQTTSecurity{CAFile: "ca.crt", CertFile: "c.crt", KeyFile: "c.key"}, protocol: "ssl"},
+		{name: "credentials without TLS", security: MQTTSecurity{Username: "u", Password: "p"}, protocol: "tcp"},
+		{name: "certificate without key", security: MQTTSecurity{CertFile: "c.crt"}, protocol: "ssl", wantErr: true},
+		{name: "password and token", security: MQTTSecurity{Password: "p", Token: "t"}, protocol: "tcp", wantErr: true},
+		{name: "TLS over tcp", security: MQTTSecurity{CAFile: "ca.crt"}, protocol: "tcp", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.security.Validate(tt.protocol); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMQTTSecurityResolveIdentity(t *testing.T) {
+	ca := newTestCA(t, t.TempDir(), "ca")
+	certFile, keyFile := ca.issue(t, "sensor-01", false)
+	security := MQTTSecurity{CAFile: ca.file, CertFile: certFile, KeyFile: keyFile}
+
+	if id, err := security.ResolveIdentity("random-id", false); err != nil || id != "sensor-01" {
+		t.Errorf("ResolveIdentity without configured id = %q, %v; want sensor-01", id, err)
+	}
+	if id, err := security.ResolveIdentity("sensor-01", true); err != nil || id != "sensor-01" {
+		t.Errorf("ResolveIdentity with matching id = %q, %v; want sensor-01", id, err)
+	}
+	if _, err := security.ResolveIdentity("sensor-02", true); err == nil {
+		t.Error("ResolveIdentity accepted an id that does not match the certificate")
+	}
+	if id, err := (MQTTSecurity{}).ResolveIdentity("sensor-02", true); err != nil || id != "sensor-02" {
+		t.Errorf("ResolveIdentity without certificate = %q, %v; want sensor-02", id, err)
+	}
+}
+
+/* ----- Test di integrazione con Mosquitto ----- */
+
+// mosquittoBroker avvia un broker Mosquitto locale con la configurazione indicata e restituisce l'indirizzo del listener.
+// Il test viene saltato se Mosquitto non è installato.
+func mosquittoBroker(t *testing.T, dir string, config func(port int) string) string {
+	t.Helper()
+	binary, err := exec.LookPath("mosquitto")
+	if err != nil {
+		t.Skip("mosquitto not installed")
+	}
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	_ = listener.Close()
+
+	// Avviato come root, Mosquitto passa all'utente mosquitto, che non può leggere i file temporanei del test
+	content := config(port)
+	if os.Geteuid() == 0 {
+		content += "user root\n"
+	}
+	configFile := filepath.Join(dir, "mosquitto.conf")
+	if err := os.WriteFile(configFile, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, binary, "-c", configFile)
+	var output strings.Builder
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Start(); err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		_ = cmd.Wait()
+		if t.Failed() {
+			t.Log("mosquitto output:\n", output.String())
+		}
+	})
+
+	address := "127.0.0.1:" + strconv.Itoa(port)
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		if conn, err := net.Dial("tcp", address); err == nil {
+			_ = conn.Close()
+			return address
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("mosquitto did not start listening on ", address)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// repositoryACL restituisce le ACL di configs/mosquitto/acl.conf, con i blocchi di esempio degli hub e dei canali abilitati.
+func repositoryACL(t *testing.T) string {
+	t.Helper()
+	file, err := os.Open(filepath.Join("..", "..", "configs", "mosquitto", "acl.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var acl strings.Builder
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "# user ") || strings.HasPrefix(line, "# topic ") {
+			line = strings.TrimPrefix(line, "# ")
+		}
+		acl.WriteString(line + "\n")
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return acl.String()
+}
+
+// tlsBrokerConfig restituisce configs/mosquitto/mosquitto-tls.conf, con la porta e i percorsi dei file del test.
+func tlsBrokerConfig(t *testing.T, dir string, port int) string {
+	t.Helper()
+	config, err := os.ReadFile(filepath.Join("..", "..", "configs", "mosquitto", "mosquitto-tls.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replacer := strings.NewReplacer(
+		"listener 8883 0.0.0.0", "listener "+strconv.Itoa(port)+" 127.0.0.1",
+		"/mosquitto/certs/", dir+"/",
+		"/mosquitto/config/acl.conf", filepath.Join(dir, "acl.conf"),
+	)
+	return replacer.Replace(string(config))
+}
+
+// tlsBroker avvia un broker con la configurazione TLS e le ACL del repository,
+// e restituisce la CA che ha firmato il certificato del broker e l'indirizzo del broker.
+func tlsBroker(t *testing.T) (*testCA, string) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	ca.issue(t, "server", true)
+	if err := os.WriteFile(filepath.Join(dir, "acl.conf"), []byte(repositoryACL(t)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	address := mosquittoBroker(t, dir, func(port int) string { return tlsBrokerConfig(t, dir, port) })
+	return ca, address
+}
+
+// connect collega un client al broker con le impostazioni di sicurezza indicate.
+func connect(address string, security MQTTSecurity, identity string) (MQTT.Client, error) {
+	opts := MQTT.NewClientOptions().AddBroker("ssl://" + address).SetClientID(identity + "-" + strconv.FormatInt(time.Now().UnixNano(), 36))
+	opts.SetConnectTimeout(5 * time.Second).SetAutoReconnect(false)
+	if err := security.Apply(opts, identity); err != nil {
+		return nil, err
+	}
+	client := MQTT.NewClient(opts)
+	token := client.Connect()
+	if !token.WaitTimeout(10 * time.Second) {
+		return nil, os.ErrDeadlineExceeded
+	}
+	return client, token.Error()
+}
+
+// connectWithCertificate collega un client autenticato con un certificato firmato dalla CA, con il CN indicato.
+func connectWithCertificate(t *testing.T, ca *testCA, address, name string) MQTT.Client {
+	t.Helper()
+	certFile, keyFile := ca.issue(t, name, false)
+	client, err := connect(address, MQTTSecurity{CAFile: ca.file, CertFile: certFile, KeyFile: keyFile}, name)
+	if err != nil {
+		t.Fatalf("%s cannot connect: %v", name, err)
+	}
+	t.Cleanup(func() { client.Disconnect(100) })
+	return client
+}
+
+// subscribe sottoscrive il topic e restituisce il canale dei messaggi ricevuti, fallendo se la sottoscrizione viene rifiutata.
+func subscribe(t *testing.T, client MQTT.Client, topic string) chan MQTT.Message {
+	t.Helper()
+	messages := make(chan MQTT.Message, 10)
+	token := client.Subscribe(topic, 1, func(_ MQTT.Client, msg MQTT.Message) { messages <- msg })
+	if !token.WaitTimeout(5*time.Second) || token.Error() != nil {
+		t.Fatalf("subscription to %s failed: %v", topic, token.Error())
+	}
+	for _, code := range token.(*MQTT.SubscribeToken).Result() {
+		if code == 0x80 {
+			t.Fatalf("subscription to %s rejected by the broker", topic)
+		}
+	}
+	return messages
+}
+
+func publish(t *testing.T, client MQTT.Client, topic, payload string) {
+	t.Helper()
+	token := client.Publish(topic, 1, false, payload)
+	if !token.WaitTimeout(5*time.Second) || token.Error() != nil {
+		t.Fatalf("publish on %s failed: %v", topic, token.Error())
+	}
+}
+
+// expectMessage verifica che venga ricevuto il payload indicato, scartando i messaggi precedenti.
+func expectMessage(t *testing.T, messages chan MQTT.Message, payload string) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg := <-messages:
+			if string(msg.Payload()) == payload {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("message %q not received", payload)
+		}
+	}
+}
+
+// expectNoMessage verifica che il payload indicato non venga consegnato.
+func expectNoMessage(t *testing.T, messages chan MQTT.Message, payload string) {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case msg := <-messages:
+			if string(msg.Payload()) == payload {
+				t.Fatalf("message %q on %s was delivered", payload, msg.Topic())
+			}
+		case <-timeout:
+			return
+		}
+	}
+}
+
+func TestMosquittoTLSHandshake(t *testing.T) {
+	ca, address := tlsBroker(t)
+
+	t.Run("trusted certificate", func(t *testing.T) {
+		connectWithCertificate(t, ca, address, "sensor-01")
+	})
+
+	t.Run("untrusted certificate", func(t *testing.T) {
+		other := newTestCA(t, t.TempDir(), "other-ca")
+		certFile, keyFile := other.issue(t, "sensor-01", false)
+		if client, err := connect(address, MQTTSecurity{CAFile: ca.file, CertFile: certFile, KeyFile: keyFile}, "sensor-01"); err == nil {
+			client.Disconnect(100)
+			t.Fatal("broker accepted a certificate signed by another CA")
+		}
+	})
+
+	t.Run("missing certificate", func(t *testing.T) {
+		if client, err := connect(address, MQTTSecurity{CAFile: ca.file}, "sensor-01"); err == nil {
+			client.Disconnect(100)
+			t.Fatal("broker accepted a client without certificate")
+		}
+	})
+
+	t.Run("untrusted broker", func(t *testing.T) {
+		other := newTestCA(t, t.TempDir(), "other-ca")
+		certFile, keyFile := ca.issue(t, "sensor-01", false)
+		if client, err := connect(address, MQTTSecurity{CAFile: other.file, CertFile: certFile, KeyFile: keyFile}, "sensor-01"); err == nil {
+			client.Disconnect(100)
+			t.Fatal("client accepted a broker certificate signed by an unknown CA")
+		}
+	})
+}
+
+func TestMosquittoACL(t *testing.T) {
+	ca, address := tlsBroker(t)
+	sensor := connectWithCertificate(t, ca, address, "sensor-01")
+	edgeHub := connectWithCertificate(t, ca, address, "edge-hub-0001-zone-001")
+	proximityHub := connectWithCertificate(t, ca, address, "proximity-hub-0001")
+
+	sensorData := subscribe(t, edgeHub, "$share/edge-hub_build-0001_floor-001/sensor-data/build-0001/floor-001/#")
+	criticalData := subscribe(t, proximityHub, "$share/proximity-fog-hub_build-0001/critical-data/build-0001/#")
+	filteredData := subscribe(t, proximityHub, "$share/proximity-fog-hub_build-0001/filtered-data/build-0001/#")
+
+	t.Run("sensor publishes with its own identity", func(t *testing.T) {
+		publish(t, sensor, "sensor-data/build-0001/floor-001/sensor-01", "own")
+		expectMessage(t, sensorData, "own")
+	})
+
+	t.Run("sensor publishes with another identity", func(t *testing.T) {
+		// Con MQTT 3.1.1 il broker conferma la pubblicazione ma non la consegna
+		publish(t, sensor, "sensor-data/build-0001/floor-001/sensor-02", "spoofed")
+		expectNoMessage(t, sensorData, "spoofed")
+	})
+
+	t.Run("edge hub forwards critical and filtered data", func(t *testing.T) {
+		publish(t, edgeHub, "critical-data/build-0001/floor-001/sensor-01", "critical")
+		expectMessage(t, criticalData, "critical")
+		publish(t, edgeHub, "filtered-data/build-0001/floor-001/sensor-01", "filtered")
+		expectMessage(t, filteredData, "filtered")
+	})
+
+	t.Run("edge hub publishes outside its zone", func(t *testing.T) {
+		publish(t, edgeHub, "critical-data/build-0001/floor-002/sensor-01", "other zone")
+		expectNoMessage(t, criticalData, "other zone")
+	})
+
+	t.Run("sensor publishes critical data", func(t *testing.T) {
+		publish(t, sensor, "critical-data/build-0001/floor-001/sensor-01", "from sensor")
+		expectNoMessage(t, criticalData, "from sensor")
+	})
+
+	t.Run("sensor subscribes to other sensors", func(t *testing.T) {
+		token := sensor.Subscribe("sensor-data/build-0001/floor-001/#", 1, nil)
+		if !token.WaitTimeout(5 * time.Second) {
+			t.Fatal("subscription not acknowledged")
+		}
+		for topic, code := range token.(*MQTT.SubscribeToken).Result() {
+			if code != 0x80 {
+				t.Fatalf("subscription to %s granted with QoS %d, want rejection", topic, code)
+			}
+		}
+	})
+}
+
+func TestMosquittoCredentials(t *testing.T) {
+	passwd, err := exec.LookPath("mosquitto_passwd")
+	if err != nil {
+		t.Skip("mosquitto_passwd not installed")
+	}
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	ca.issue(t, "server", true)
+	passwordFile := filepath.Join(dir, "passwd")
+	if output, err := exec.Command(passwd, "-c", "-b", passwordFile, "sensor-01", "secret").CombinedOutput(); err != nil {
+		t.Fatalf("mosquitto_passwd: %v: %s", err, output)
+	}
+
+	// TLS senza certificato client, con autenticazione tramite username e password
+	address := mosquittoBroker(t, dir, func(port int) string {
+		return "listener " + strconv.Itoa(port) + " 127.0.0.1\n" +
+			"cafile " + ca.file + "\n" +
+			"certfile " + filepath.Join(dir, "server.crt") + "\n" +
+			"keyfile " + filepath.Join(dir, "server.key") + "\n" +
+			"allow_anonymous false\n" +
+			"password_file " + passwordFile + "\n"
+	})
+
+	tests := []struct {
+		name     string
+		security MQTTSecurity
+		wantErr  bool
+	}{
+		{name: "password with identity as username", security: MQTTSecurity{CAFile: ca.file, Password: "secret"}},
+		{name: "explicit username", security: MQTTSecurity{CAFile: ca.file, Username: "sensor-01", Password: "secret"}},
+		{name: "token", security: MQTTSecurity{CAFile: ca.file, Token: "secret"}},
+		{name: "wrong password", security: MQTTSecurity{CAFile: ca.file, Password: "wrong"}, wantErr: true},
+		{name: "unknown user", security: MQTTSecurity{CAFile: ca.file, Username: "sensor-02", Password: "secret"}, wantErr: true},
+		{name: "no credentials", security: MQTTSecurity{CAFile: ca.file}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := connect(address, tt.security, "sensor-01")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("connect error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if client != nil && err == nil {
+				client.Disconnect(100)
+			}
+		})
+	}
+}